@@ -0,0 +1,82 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Accumulator can be implemented by a target to receive the decoded elements
+// one at a time instead of having them stored in its fields. This allows
+// decoding directly into channels, ring buffers, mutex-protected collections,
+// and the like.
+//
+// Since an Accumulator has no fields to define the types of the elements, the
+// types are taken from the Registry given with the WithRegistry option.
+type Accumulator interface {
+	// Add is called with the type name of each element whose type name is
+	// in the Registry, in the order of the elements, along with a pointer to
+	// the decoded element, e.g. *Dog. Returning an error stops the
+	// unmarshalling, and the error is returned from it.
+	Add(typeName string, v any) error
+}
+
+// accumulate decodes the elements of the source with the types from the
+// registry in the options and passes them to the Accumulator. The number of
+// elements read from the source is returned.
+func accumulate(src ElementSource, acc Accumulator, o *options) (int, error) {
+	if o.registry == nil {
+		return 0, fmt.Errorf("unmarshalling into an Accumulator requires a registry")
+	}
+	resolve, err := optionsResolver(o)
+	if err != nil {
+		return 0, err
+	}
+
+	memory := memoryBudget{limit: o.memoryLimit}
+	return forEachElement(src, o.firstIndex, resolve, func(index int, typeName string, raw json.RawMessage) error {
+		elemType, ok := o.registry.Lookup(typeName)
+		if len(typeName) == 0 || !ok {
+			if o.metrics != nil {
+				o.metrics.ElementUnmatched(typeName, len(raw))
+			}
+			if o.report != nil {
+				o.report.unmatched(len(raw))
+			}
+			return nil
+		}
+
+		raw, err := openElement(raw, index, typeName, o)
+		if err != nil {
+			return err
+		}
+		if predicate, ok := o.predicates[typeName]; ok && !predicate(raw) {
+			if o.metrics != nil {
+				o.metrics.ElementUnmatched(typeName, len(raw))
+			}
+			if o.report != nil {
+				o.report.unmatched(len(raw))
+			}
+			return nil
+		}
+		err = memory.charge(index, typeName, len(raw), elemType)
+		if err != nil {
+			return err
+		}
+		var start time.Time
+		if o.report != nil {
+			start = time.Now()
+		}
+		v, err := guardedDecodeElement(o, raw, elemType, index, typeName)
+		if err != nil {
+			return err
+		}
+		if o.metrics != nil {
+			o.metrics.ElementDecoded(typeName, len(raw))
+		}
+		if o.report != nil {
+			o.report.decoded(typeName, len(raw), start)
+		}
+		return acc.Add(typeName, v.Interface())
+	})
+}
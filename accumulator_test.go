@@ -0,0 +1,64 @@
+package poly
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// lockedList is a mutex-protected collection of elements.
+type lockedList struct {
+	mu       sync.Mutex
+	elements []any
+}
+
+func (l *lockedList) Add(typeName string, v any) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.elements = append(l.elements, v)
+	return nil
+}
+
+// channelAccumulator sends the elements to a channel.
+type channelAccumulator chan any
+
+func (c channelAccumulator) Add(typeName string, v any) error {
+	if typeName == "pet" {
+		return errors.New("no pets allowed")
+	}
+	c <- v
+	return nil
+}
+
+func accumulatorRegistry() *Registry {
+	registry := NewRegistry()
+	_ = registry.Register("person", Person{})
+	_ = registry.Register("pet", Pet{})
+	return registry
+}
+
+func TestUnmarshalWithOptions_Accumulator(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"location", "address":"123 Main St"},
+		{"type":"pet", "name":"Fido"}
+	]`)
+
+	list := &lockedList{}
+	err := UnmarshalWithOptions(input, list, WithRegistry(accumulatorRegistry()))
+	assert.NoError(t, err)
+	assert.Equal(t, []any{&Person{Name: "John"}, &Pet{Name: "Fido"}}, list.elements)
+
+	err = Unmarshal(input, list)
+	assert.EqualError(t, err, "unmarshalling into an Accumulator requires a registry")
+}
+
+func TestUnmarshalWithOptions_AccumulatorError(t *testing.T) {
+	input := []byte(`[{"type":"person", "name":"John"}, {"type":"pet", "name":"Fido"}]`)
+
+	c := make(channelAccumulator, 2)
+	err := UnmarshalWithOptions(input, c, WithRegistry(accumulatorRegistry()))
+	assert.EqualError(t, err, "no pets allowed")
+	assert.Equal(t, &Person{Name: "John"}, <-c)
+}
@@ -0,0 +1,54 @@
+package poly
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// DecodeBatch unmarshals many independent documents concurrently, as for
+// consumers that drain a message queue in bulk. Each payload is unmarshalled
+// with UnmarshalWithOptions into a new target returned by the target function,
+// which must return a pointer to a struct, such as
+// `func() any { return &Residence{} }`. The targets and errors are returned in
+// the order of the payloads, with a nil error for each payload that was
+// decoded.
+//
+// The payloads are decoded by the given number of workers, or by one for each
+// CPU if it isn't positive. The options are parsed once and the mapping of the
+// target type is built once, and both are shared by all the payloads, so the
+// options must be safe for concurrent use: a Metrics implementation must allow
+// concurrent calls, and WithDecodeReport should not be used. Once the context
+// is done, the payloads that haven't been started are not decoded and their
+// error is that of the context.
+func DecodeBatch(ctx context.Context, payloads [][]byte, target func() any, workers int, opts ...Option) ([]any, []error) {
+	o := newOptions(opts)
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	results := make([]any, len(payloads))
+	errs := make([]error, len(payloads))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(payloads); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				results[i] = target()
+				errs[i] = unmarshal(payloads[i], results[i], o)
+			}
+		}()
+	}
+	for i := range payloads {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results, errs
+}
@@ -0,0 +1,46 @@
+package poly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	var payloads [][]byte
+	for i := 0; i < 50; i++ {
+		payloads = append(payloads, []byte(fmt.Sprintf(`[{"type":"person","name":"P%d"},{"type":"pet","name":"Fido"}]`, i)))
+	}
+	payloads = append(payloads, []byte(`{"type":"person"}`), []byte(`[]`))
+
+	results, errs := DecodeBatch(context.Background(), payloads, func() any { return &Residence{} }, 4)
+	assert.Len(t, results, len(payloads))
+	assert.Len(t, errs, len(payloads))
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, &Residence{
+			People: []Person{{Name: fmt.Sprintf("P%d", i)}},
+			Pets:   []Pet{{Name: "Fido"}},
+		}, results[i])
+	}
+	assert.ErrorIs(t, errs[50], ErrNotArray)
+	assert.NoError(t, errs[51])
+	assert.Equal(t, &Residence{}, results[51])
+
+	// The options apply to every payload.
+	results, errs = DecodeBatch(context.Background(), payloads[:1], func() any { return &Residence{} }, 0, WithFieldPredicate("pet", func(raw json.RawMessage) bool { return false }))
+	assert.NoError(t, errs[0])
+	assert.Empty(t, results[0].(*Residence).Pets)
+}
+
+func TestDecodeBatch_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results, errs := DecodeBatch(ctx, [][]byte{[]byte(`[]`), []byte(`[]`)}, func() any { return &Residence{} }, 1)
+	assert.Equal(t, []any{nil, nil}, results)
+	assert.ErrorIs(t, errs[0], context.Canceled)
+	assert.ErrorIs(t, errs[1], context.Canceled)
+}
@@ -0,0 +1,50 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// binding adapts a target to the json.Marshaler and json.Unmarshaler
+// interfaces.
+type binding struct {
+	target any
+	opts   []Option
+}
+
+// Bind returns adapters that encode and decode the target as a polymorphic
+// JSON array with the given options, for types that can't implement
+// json.Marshaler and json.Unmarshaler themselves, such as vendored or
+// generated ones. The adapters can be used wherever encoding/json expects its
+// interfaces, for instance as a field of a larger document. The target must be
+// a pointer to a struct for the Unmarshaler; both adapters work on the value
+// it points to.
+//
+// Example usage:
+//
+//	var residence vendor.Residence
+//	marshaler, unmarshaler := poly.Bind(&residence)
+//
+//	message := struct {
+//	    ID        string         `json:"id"`
+//	    Residence json.Unmarshaler `json:"residence"`
+//	}{Residence: unmarshaler}
+//	err := json.Unmarshal(data, &message)
+func Bind(target any, opts ...Option) (json.Marshaler, json.Unmarshaler) {
+	b := &binding{target: target, opts: opts}
+	return b, b
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (b *binding) MarshalJSON() ([]byte, error) {
+	return MarshalWithOptions(b.target, b.opts...)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. As is the
+// convention, a JSON null leaves the target unchanged.
+func (b *binding) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+	return UnmarshalWithOptions(data, b.target, b.opts...)
+}
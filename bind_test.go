@@ -0,0 +1,57 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Vendored stands in for a type that can't be given marshalling methods.
+type Vendored struct {
+	Pets  []Pet         `poly:"pet"`
+	Water *WaterService `poly:"water"`
+}
+
+func TestBind(t *testing.T) {
+	vendored := Vendored{
+		Pets:  []Pet{{Name: "Fido", Species: "dog"}},
+		Water: &WaterService{Provider: "City"},
+	}
+	marshaler, _ := Bind(&vendored, WithDiscriminator("type"))
+
+	message := struct {
+		ID       string         `json:"id"`
+		Vendored json.Marshaler `json:"vendored"`
+	}{ID: "1", Vendored: marshaler}
+	bytes, err := json.Marshal(message)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":"1","vendored":[
+		{"type":"pet","name":"Fido","species":"dog"},
+		{"type":"water","provider":"City"}
+	]}`, string(bytes))
+
+	var decoded Vendored
+	_, unmarshaler := Bind(&decoded)
+	incoming := struct {
+		ID       string           `json:"id"`
+		Vendored json.Unmarshaler `json:"vendored"`
+	}{Vendored: unmarshaler}
+	err = json.Unmarshal(bytes, &incoming)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", incoming.ID)
+	assert.Equal(t, vendored, decoded)
+
+	// A null leaves the target unchanged.
+	err = json.Unmarshal([]byte(`{"vendored":null}`), &incoming)
+	assert.NoError(t, err)
+	assert.Equal(t, vendored, decoded)
+}
+
+func TestBind_Errors(t *testing.T) {
+	var decoded Vendored
+	_, unmarshaler := Bind(&decoded)
+	err := json.Unmarshal([]byte(`{"vendored":[{"type":"pet","name":1}]}`), &struct {
+		Vendored json.Unmarshaler `json:"vendored"`
+	}{Vendored: unmarshaler})
+	assert.Error(t, err)
+}
@@ -0,0 +1,253 @@
+package poly
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Builder assembles a polymorphic document for a target struct one element at
+// a time, as an alternative to filling in the slice fields of the target and
+// keeping track of the indexes by hand. Elements are added with Add, and the
+// result is either encoded with Marshal, in the order the elements were added,
+// or stored in a target struct with Build.
+//
+// The first error, such as adding an element that no field of the target can
+// hold, is kept and returned by Marshal and Build, so that the elements can be
+// added without checking each one.
+//
+// Example usage:
+//
+//	b := poly.NewBuilder(&Residence{}, poly.WithDiscriminator("type"))
+//	poly.Add(b, Location{Address: "123 Main St"}, poly.AtStart())
+//	poly.Add(b, Person{Name: "John"})
+//	poly.Add(b, Pet{Name: "Fido"})
+//	bytes, err := b.Marshal()
+type Builder struct {
+	targetType reflect.Type
+	fields     map[string]fieldLookup
+	o          *options
+	elements   []builtElement
+	err        error
+}
+
+// builtElement is an element added to a Builder.
+type builtElement struct {
+	value    reflect.Value
+	typeName string
+	position int
+}
+
+// The positions of the elements, which they are ordered by.
+const (
+	positionFirst = iota - 1
+	positionMiddle
+	positionLast
+)
+
+// ElementOption adjusts how an element is added to a Builder.
+type ElementOption func(e *builtElement)
+
+// As sets the type name of the element. It is needed when more than one field
+// of the target can hold elements of the type of the value.
+func As(typeName string) ElementOption {
+	return func(e *builtElement) {
+		e.typeName = typeName
+	}
+}
+
+// AtStart places the element before all the elements that aren't placed at the
+// start. The elements of fields with the `first` tag option are placed there
+// automatically.
+func AtStart() ElementOption {
+	return func(e *builtElement) {
+		e.position = positionFirst
+	}
+}
+
+// AtEnd places the element after all the elements that aren't placed at the
+// end. The elements of fields with the `last` tag option are placed there
+// automatically.
+func AtEnd() ElementOption {
+	return func(e *builtElement) {
+		e.position = positionLast
+	}
+}
+
+// NewBuilder creates a Builder for documents of the target struct, which may be
+// a struct or a pointer to one. The options apply when the document is
+// marshalled, and determine the struct tags that map the fields, as with
+// MarshalWithOptions.
+func NewBuilder(target any, opts ...Option) *Builder {
+	b := &Builder{o: newOptions(opts)}
+	t := reflect.TypeOf(target)
+	if t != nil && t.Kind() != reflect.Pointer {
+		t = reflect.PointerTo(t)
+	}
+	var ptr any
+	if t != nil {
+		ptr = reflect.New(t.Elem()).Interface()
+	}
+	b.fields, b.err = makeTargetFieldLookup(ptr, b.o.tagKeys)
+	if b.err == nil {
+		b.targetType = t.Elem()
+	}
+	return b
+}
+
+// Add adds a copy of the value as an element of the document. The value, or
+// what it points to, must be of the element type of a field of the target; if
+// several fields have that type, the type name must be given with As.
+func Add[T any](b *Builder, v T, opts ...ElementOption) {
+	if b.err != nil {
+		return
+	}
+	value := reflect.ValueOf(&v).Elem()
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			b.err = fmt.Errorf("element %d is a nil %v", len(b.elements), value.Type())
+			return
+		}
+		// Keep a copy, as with the values that aren't pointers.
+		copied := reflect.New(value.Type().Elem()).Elem()
+		copied.Set(value.Elem())
+		value = copied
+	}
+
+	e := builtElement{value: value, position: positionMiddle}
+	for _, opt := range opts {
+		opt(&e)
+	}
+	fl, err := b.field(&e)
+	if err != nil {
+		b.err = err
+		return
+	}
+	if fl.first {
+		e.position = positionFirst
+	}
+	if fl.last {
+		e.position = positionLast
+	}
+	b.elements = append(b.elements, e)
+}
+
+// field finds the field of the target for the element, setting its type name
+// if it hasn't been given.
+func (b *Builder) field(e *builtElement) (fieldLookup, error) {
+	if e.typeName != "" {
+		fl, ok := b.fields[e.typeName]
+		if !ok {
+			return fieldLookup{}, fmt.Errorf("type name %q has no field in %v", e.typeName, b.targetType)
+		}
+		if fl.fieldType != e.value.Type() {
+			return fieldLookup{}, fmt.Errorf("field %s of %v for type name %q can't hold a %v", fl.goName, b.targetType, e.typeName, e.value.Type())
+		}
+		return fl, nil
+	}
+
+	var matches []fieldLookup
+	for _, fl := range sortedFieldLookups(b.fields) {
+		if fl.fieldType == e.value.Type() {
+			matches = append(matches, fl)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return fieldLookup{}, fmt.Errorf("no field of %v holds a %v", b.targetType, e.value.Type())
+	case 1:
+		e.typeName = matches[0].name
+		return matches[0], nil
+	}
+	return fieldLookup{}, fmt.Errorf("several fields of %v hold a %v, use As to give the type name", b.targetType, e.value.Type())
+}
+
+// ordered returns the elements in the order they are emitted.
+func (b *Builder) ordered() []builtElement {
+	elements := append([]builtElement(nil), b.elements...)
+	sort.SliceStable(elements, func(i, j int) bool {
+		return elements[i].position < elements[j].position
+	})
+	return elements
+}
+
+// Marshal encodes the elements as a JSON array, or in the other form the
+// options ask for, as with MarshalWithOptions, in the order they were added
+// apart from the ones placed at the start or the end, and the ones moved to
+// satisfy the `after` and `before` tag options of their fields.
+func (b *Builder) Marshal() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	var indexedObjects []indexedObject
+	for i, e := range b.ordered() {
+		fl := b.fields[e.typeName]
+		indexedObjects = append(indexedObjects, indexedObject{
+			Index:    i,
+			Value:    e.value.Interface(),
+			Field:    fl.goName,
+			TypeName: fl.name,
+			Emit:     fl.emit,
+		})
+	}
+	relativeOrder := map[string]tagOptions{}
+	typeNames := map[string]bool{}
+	for _, fl := range b.fields {
+		typeNames[fl.name] = true
+		if len(fl.after) > 0 || len(fl.before) > 0 {
+			relativeOrder[fl.name] = tagOptions{after: fl.after, before: fl.before}
+		}
+	}
+	if len(relativeOrder) > 0 {
+		var err error
+		indexedObjects, err = applyRelativeOrder(indexedObjects, relativeOrder, typeNames)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return joinObjects(indexedObjects, b.o)
+}
+
+// Build stores the elements in the fields of the target, which must be a
+// pointer to the struct the Builder was created for. The elements are
+// appended to slice fields in order, and an error is returned if more than one
+// element is added for a field that holds a single one.
+func (b *Builder) Build(target any) error {
+	if b.err != nil {
+		return b.err
+	}
+	targetValue := reflect.ValueOf(target)
+	if targetValue.Kind() != reflect.Pointer || targetValue.IsNil() || targetValue.Elem().Type() != b.targetType {
+		return fmt.Errorf("target must be a non-nil *%v, got %T", b.targetType, target)
+	}
+	targetValue = targetValue.Elem()
+
+	set := map[string]bool{}
+	for _, e := range b.ordered() {
+		fl := b.fields[e.typeName]
+		field := targetValue.Field(fl.index)
+		value := e.value
+		if fl.ptr {
+			ptr := reflect.New(value.Type())
+			ptr.Elem().Set(value)
+			value = ptr
+		}
+		if fl.slice {
+			field.Set(reflect.Append(field, value))
+			continue
+		}
+		if fl.container {
+			err := appendToContainer(field, value)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if set[fl.goName] {
+			return fmt.Errorf("field %s of %v holds a single element, but more than one was added", fl.goName, b.targetType)
+		}
+		set[fl.goName] = true
+		field.Set(value)
+	}
+	return nil
+}
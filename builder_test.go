@@ -0,0 +1,118 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Flock struct {
+	Header   TypeString  `poly:"header,first"`
+	Birds    []TypeFloat `poly:"bird"`
+	Footer   *TypeString `poly:"footer,last"`
+	Managers []*Person   `poly:"manager"`
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(Flock{}, WithDiscriminator("type"))
+	Add(b, TypeFloat{ValueB: 1})
+	Add(b, TypeString{ValueA: "end"}, As("footer"))
+	Add(b, &Person{Name: "John"})
+	Add(b, TypeFloat{ValueB: 2})
+	Add(b, TypeString{ValueA: "start"}, As("header"))
+
+	bytes, err := b.Marshal()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type":"header","ValueA":"start"},
+		{"type":"bird","ValueB":1},
+		{"type":"manager","name":"John"},
+		{"type":"bird","ValueB":2},
+		{"type":"footer","ValueA":"end"}
+	]`, string(bytes))
+
+	var flock Flock
+	err = b.Build(&flock)
+	assert.NoError(t, err)
+	assert.Equal(t, Flock{
+		Header:   TypeString{ValueA: "start"},
+		Birds:    []TypeFloat{{ValueB: 1}, {ValueB: 2}},
+		Footer:   &TypeString{ValueA: "end"},
+		Managers: []*Person{{Name: "John"}},
+	}, flock)
+}
+
+func TestBuilder_Ordering(t *testing.T) {
+	b := NewBuilder(&Residence{})
+	Add(b, Person{Name: "John"})
+	Add(b, Pet{Name: "Fido"}, AtStart())
+	Add(b, Person{Name: "Jane"}, AtEnd())
+	Add(b, Pet{Name: "Rex"})
+
+	bytes, err := b.Marshal()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"name":"Fido"},{"name":"John"},{"name":"Rex"},{"name":"Jane"}]`, string(bytes))
+
+	bytes, err = NewBuilder(&Residence{}).Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(bytes))
+}
+
+func TestBuilder_Emit(t *testing.T) {
+	b := NewBuilder(MigratingKennel{}, WithDiscriminator("type"))
+	Add(b, Pet{Name: "Fido"}, As("dog"))
+	Add(b, Pet{Name: "Tom"}, As("cat"))
+
+	bytes, err := b.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"canine","name":"Fido"},{"type":"cat","name":"Tom"}]`, string(bytes))
+}
+
+func TestBuilder_RelativeOrder(t *testing.T) {
+	b := NewBuilder(Report{})
+	Add(b, TypeString{ValueA: "total"})
+	Add(b, TypeFloat{ValueB: 1})
+	Add(b, TypeInt{ValueC: 3})
+	Add(b, TypeFloat{ValueB: 2})
+
+	bytes, err := b.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueB":1},{"ValueC":3},{"ValueB":2},{"ValueA":"total"}]`, string(bytes))
+
+	b = NewBuilder(CircularReport{})
+	Add(b, TypeString{ValueA: "total"})
+	_, err = b.Marshal()
+	assert.EqualError(t, err, `ordering constraints on "detail" are circular`)
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	b := NewBuilder(Flock{})
+	Add(b, TypeString{})
+	_, err := b.Marshal()
+	assert.EqualError(t, err, "several fields of poly.Flock hold a poly.TypeString, use As to give the type name")
+
+	b = NewBuilder(Flock{})
+	Add(b, TypeInt{})
+	assert.EqualError(t, b.Build(&Flock{}), "no field of poly.Flock holds a poly.TypeInt")
+
+	b = NewBuilder(Flock{})
+	Add(b, TypeInt{}, As("bird"))
+	assert.EqualError(t, b.Build(&Flock{}), `field Birds of poly.Flock for type name "bird" can't hold a poly.TypeInt`)
+
+	b = NewBuilder(Flock{})
+	Add(b, TypeFloat{}, As("fish"))
+	assert.EqualError(t, b.Build(&Flock{}), `type name "fish" has no field in poly.Flock`)
+
+	b = NewBuilder(Flock{})
+	Add(b, (*Person)(nil))
+	assert.EqualError(t, b.Build(&Flock{}), "element 0 is a nil *poly.Person")
+
+	b = NewBuilder(Flock{})
+	Add(b, TypeString{}, As("header"))
+	Add(b, TypeString{}, As("header"))
+	assert.EqualError(t, b.Build(&Flock{}), "field Header of poly.Flock holds a single element, but more than one was added")
+	assert.EqualError(t, b.Build(&Residence{}), "target must be a non-nil *poly.Flock, got *poly.Residence")
+
+	b = NewBuilder(42)
+	_, err = b.Marshal()
+	assert.EqualError(t, err, "target must be a pointer to a struct")
+}
@@ -0,0 +1,70 @@
+package poly
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// LocatorCache remembers the type names resolved for small elements so that
+// elements that repeat verbatim, such as heartbeat or status records in a
+// feed, are only resolved once. The elements are matched by their exact JSON,
+// so elements that differ only in whitespace or the order of their keys are
+// cached separately.
+//
+// A LocatorCache is safe for concurrent use and can be shared between calls,
+// but it must only be used with a single way of locating the types, since the
+// cached type names depend on it.
+type LocatorCache struct {
+	mu             sync.RWMutex
+	maxElementSize int
+	maxEntries     int
+	typeNames      map[string]string
+}
+
+// NewLocatorCache creates a LocatorCache for the elements of at most
+// maxElementSize bytes. Larger elements are always resolved, since they are
+// unlikely to repeat and would use a lot of memory. Once the cache holds
+// maxEntries type names it is cleared, so that it adapts if the repeating
+// elements change over time.
+func NewLocatorCache(maxElementSize int, maxEntries int) *LocatorCache {
+	return &LocatorCache{
+		maxElementSize: maxElementSize,
+		maxEntries:     maxEntries,
+		typeNames:      map[string]string{},
+	}
+}
+
+// Len returns the number of type names currently in the cache.
+func (c *LocatorCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.typeNames)
+}
+
+// wrap returns a resolver that consults the cache before calling resolve.
+func (c *LocatorCache) wrap(resolve resolver) resolver {
+	return func(index int, raw json.RawMessage) (string, error) {
+		if len(raw) > c.maxElementSize {
+			return resolve(index, raw)
+		}
+
+		c.mu.RLock()
+		typeName, ok := c.typeNames[string(raw)]
+		c.mu.RUnlock()
+		if ok {
+			return typeName, nil
+		}
+
+		typeName, err := resolve(index, raw)
+		if err != nil {
+			return "", err
+		}
+		c.mu.Lock()
+		if len(c.typeNames) >= c.maxEntries {
+			c.typeNames = map[string]string{}
+		}
+		c.typeNames[string(raw)] = typeName
+		c.mu.Unlock()
+		return typeName, nil
+	}
+}
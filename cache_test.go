@@ -0,0 +1,53 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+var countingLocatorCalls int64
+
+// countingLocator counts how many times the type is located.
+type countingLocator struct {
+	Type string `json:"type"`
+}
+
+func (c *countingLocator) TypeName() string {
+	atomic.AddInt64(&countingLocatorCalls, 1)
+	return c.Type
+}
+
+func TestUnmarshalWithOptions_LocatorCache(t *testing.T) {
+	input := []byte(`[
+		{"type":"TypeString","ValueA":"status"},
+		{"type":"TypeString","ValueA":"status"},
+		{"type":"TypeString","ValueA":"longer than the limit"},
+		{"type":"TypeString","ValueA":"status"},
+		{"type":"TypeString","ValueA":"longer than the limit"}
+	]`)
+
+	atomic.StoreInt64(&countingLocatorCalls, 0)
+	cache := NewLocatorCache(40, 10)
+	var result SlicesABC
+	err := UnmarshalWithOptions(input, &result, WithLocator(reflect.TypeOf(countingLocator{})), WithLocatorCache(cache))
+	assert.NoError(t, err)
+	assert.Len(t, result.TypeString, 5)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&countingLocatorCalls))
+	assert.Equal(t, 1, cache.Len())
+
+	// The cache is kept between calls.
+	result = SlicesABC{}
+	err = UnmarshalWithOptions(input, &result, WithLocator(reflect.TypeOf(countingLocator{})), WithLocatorCache(cache))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), atomic.LoadInt64(&countingLocatorCalls))
+}
+
+func TestLocatorCache_Full(t *testing.T) {
+	cache := NewLocatorCache(100, 2)
+	var result SlicesABC
+	err := UnmarshalWithOptions([]byte(`[{"type":"TypeString"},{"type":"TypeInt"},{"type":"TypeFloat"}]`), &result, WithLocatorCache(cache))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, cache.Len())
+}
@@ -0,0 +1,96 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// MarshalChunks works like MarshalWithOptions, but splits the flattened
+// elements over as many JSON arrays as needed to keep each one within
+// maxBytesPerChunk bytes, for APIs and message buses that cap the size of a
+// payload. The elements keep their order, and each chunk holds as many of them
+// as fit. If an envelope is given with WithEnvelope, each chunk is wrapped in
+// it, and the envelope counts towards the size of the chunk.
+//
+// No chunks are returned if there are no elements to marshal. An error is
+// returned if a single element, together with the brackets of the array and
+// the envelope, doesn't fit in a chunk, and if the options ask for the object
+// form with ObjectKeyed, which can't be split.
+func MarshalChunks(obj any, maxBytesPerChunk int, opts ...Option) (chunks [][]byte, err error) {
+	o := newOptions(opts)
+	if o.objectMode == ObjectKeyed {
+		return nil, fmt.Errorf("a keyed object can't be split into chunks")
+	}
+
+	var indexedObjects []indexedObject
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.Encoded(len(indexedObjects), err)
+		}()
+	}
+
+	indexedObjects, err = flattenObjects(obj, o)
+	if err != nil {
+		return nil, err
+	}
+	indexedObjects = append(indexedObjects, syntheticObjects(obj, o)...)
+	encoded, err := encodeElements(indexedObjects, o)
+	if err != nil {
+		return nil, err
+	}
+
+	// The overhead of a chunk is the brackets of the array and the envelope.
+	overhead := 2
+	if o.envelope != nil {
+		wrapped, err := o.envelope.wrap([]byte("[]"))
+		if err != nil {
+			return nil, err
+		}
+		overhead = len(wrapped)
+	}
+
+	var chunk []json.RawMessage
+	size := overhead
+	for i, e := range encoded {
+		if overhead+len(e) > maxBytesPerChunk {
+			return nil, fmt.Errorf("element %d of type %q is %d bytes, which doesn't fit in a chunk of %d bytes", i, indexedObjects[i].TypeName, len(e), maxBytesPerChunk)
+		}
+		// Every element but the first of a chunk needs a comma.
+		needed := len(e)
+		if len(chunk) > 0 {
+			needed++
+		}
+		if size+needed > maxBytesPerChunk {
+			chunks, err = appendChunk(chunks, chunk, o)
+			if err != nil {
+				return nil, err
+			}
+			chunk = nil
+			size = overhead
+			needed = len(e)
+		}
+		chunk = append(chunk, e)
+		size += needed
+	}
+	if len(chunk) > 0 {
+		chunks, err = appendChunk(chunks, chunk, o)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return chunks, nil
+}
+
+// appendChunk joins the elements into a JSON array, wrapped in the envelope if
+// one is configured, and appends it to the chunks.
+func appendChunk(chunks [][]byte, elements []json.RawMessage, o *options) ([][]byte, error) {
+	items := joinElements(elements)
+	if o.envelope != nil {
+		var err error
+		items, err = o.envelope.wrap(items)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return append(chunks, items), nil
+}
@@ -0,0 +1,61 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMarshalChunks(t *testing.T) {
+	residence := Residence{
+		People: []Person{{Name: "John"}, {Name: "Jane"}, {Name: "Joe"}},
+		Pets:   []Pet{{Name: "Fido", Species: "dog"}},
+	}
+
+	// Just enough room for two of the people.
+	chunks, err := MarshalChunks(residence, 33)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`[{"name":"John"},{"name":"Jane"}]`,
+		`[{"name":"Joe"}]`,
+		`[{"name":"Fido","species":"dog"}]`,
+	}, chunkStrings(chunks))
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, len(chunk), 33)
+	}
+
+	// Everything fits in a single chunk that is the same as Marshal.
+	chunks, err = MarshalChunks(residence, 1000)
+	assert.NoError(t, err)
+	expected, err := Marshal(residence)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{string(expected)}, chunkStrings(chunks))
+}
+
+func TestMarshalChunks_Envelope(t *testing.T) {
+	residence := Residence{
+		People: []Person{{Name: "John"}, {Name: "Jane"}},
+	}
+	chunks, err := MarshalChunks(residence, 40, WithEnvelope(map[string]int{"v": 1}, "items"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"v":1,"items":[{"name":"John"}]}`,
+		`{"v":1,"items":[{"name":"Jane"}]}`,
+	}, chunkStrings(chunks))
+}
+
+func TestMarshalChunks_Errors(t *testing.T) {
+	_, err := MarshalChunks(Residence{People: []Person{{Name: "Johnathan"}}}, 20)
+	assert.EqualError(t, err, `element 0 of type "person" is 20 bytes, which doesn't fit in a chunk of 20 bytes`)
+
+	chunks, err := MarshalChunks(SlicesABC{}, 20)
+	assert.NoError(t, err)
+	assert.Empty(t, chunks)
+}
+
+func chunkStrings(chunks [][]byte) []string {
+	var result []string
+	for _, chunk := range chunks {
+		result = append(result, string(chunk))
+	}
+	return result
+}
@@ -0,0 +1,181 @@
+package poly
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// JSONColumn wraps a polymorphic target struct of type T that is stored as a
+// JSON array in a database column, such as a JSONB column in PostgreSQL.
+//
+// The column implements sql.Scanner and driver.Valuer so that it can be used
+// as a field of a model with database/sql as well as ORMs built on it, such as
+// GORM, which also picks up the GormDataType method. Scanning only keeps the
+// raw JSON; it is decoded the first time the value is accessed. When the
+// column is written back, the raw JSON is returned as is unless the value has
+// been modified, in which case it is marshalled again.
+//
+// The value is marshalled and unmarshalled with the options given to
+// NewJSONColumn or SetOptions, which are kept when a new value is scanned.
+// Without a discriminator, such as WithDiscriminator("type"), the elements
+// must carry their own type names for the value to be read back.
+//
+// Example usage:
+//
+//	type Household struct {
+//	    ID        int
+//	    Residence poly.JSONColumn[Residence]
+//	}
+//
+//	residence, err := household.Residence.Get()
+//	...
+//	err = household.Residence.Modify(func(r *Residence) error {
+//	    r.Pets = append(r.Pets, Pet{Name: "Rex"})
+//	    return nil
+//	})
+type JSONColumn[T any] struct {
+	raw     []byte
+	value   T
+	decoded bool
+	dirty   bool
+	opts    []Option
+}
+
+// NewJSONColumn creates a JSONColumn holding the value v that is marshalled
+// and unmarshalled with the options. The column is considered modified, so it
+// is marshalled when it is written.
+func NewJSONColumn[T any](v T, opts ...Option) JSONColumn[T] {
+	return JSONColumn[T]{
+		value:   v,
+		decoded: true,
+		dirty:   true,
+		opts:    opts,
+	}
+}
+
+// SetOptions replaces the options that the value is marshalled and
+// unmarshalled with. For a column that is scanned by database/sql, the options
+// are set before scanning, such as in a constructor of the model.
+func (c *JSONColumn[T]) SetOptions(opts ...Option) {
+	c.opts = opts
+}
+
+// Get returns the value of the column, decoding the raw JSON on first access.
+// The value is returned as a copy; changes made to it are not tracked, so use
+// Set or Modify to change the value of the column.
+func (c *JSONColumn[T]) Get() (T, error) {
+	err := c.decode()
+	return c.value, err
+}
+
+// Set replaces the value of the column and marks it as modified.
+func (c *JSONColumn[T]) Set(v T) {
+	c.value = v
+	c.decoded = true
+	c.dirty = true
+}
+
+// Modify decodes the value of the column if needed and calls fn with a pointer
+// to it so that it can be changed in place. The column is marked as modified
+// unless fn returns an error.
+func (c *JSONColumn[T]) Modify(fn func(v *T) error) error {
+	err := c.decode()
+	if err != nil {
+		return err
+	}
+	err = fn(&c.value)
+	if err != nil {
+		return err
+	}
+	c.dirty = true
+	return nil
+}
+
+// MarkDirty marks the column as modified so that it is marshalled the next
+// time it is written. This is needed if the value was changed through
+// references that Get returned, such as the elements of a slice.
+func (c *JSONColumn[T]) MarkDirty() {
+	c.dirty = true
+}
+
+// IsDirty reports whether the column has been modified since it was scanned.
+func (c *JSONColumn[T]) IsDirty() bool {
+	return c.dirty
+}
+
+// decode unmarshals the raw JSON into the value if that hasn't happened yet.
+func (c *JSONColumn[T]) decode() error {
+	if c.decoded {
+		return nil
+	}
+	var v T
+	err := UnmarshalWithOptions(c.raw, &v, c.opts...)
+	if err != nil {
+		return err
+	}
+	c.value = v
+	c.decoded = true
+	return nil
+}
+
+// Scan implements the sql.Scanner interface. It keeps a copy of the raw JSON
+// without decoding it and resets the modification tracking. The options of
+// the column are kept.
+func (c *JSONColumn[T]) Scan(src any) error {
+	var raw []byte
+	switch s := src.(type) {
+	case nil:
+	case []byte:
+		// The driver may reuse the buffer, so take a copy.
+		raw = append([]byte(nil), s...)
+	case string:
+		raw = []byte(s)
+	default:
+		return fmt.Errorf("cannot scan %T into a JSONColumn", src)
+	}
+
+	var zero T
+	*c = JSONColumn[T]{
+		raw:   raw,
+		value: zero,
+		opts:  c.opts,
+	}
+	return nil
+}
+
+// Value implements the driver.Valuer interface. If the column hasn't been
+// modified, the raw JSON that was scanned is returned as is, which is nil for
+// a NULL column. Otherwise the value is marshalled.
+func (c JSONColumn[T]) Value() (driver.Value, error) {
+	if !c.dirty {
+		if c.raw == nil {
+			return nil, nil
+		}
+		return c.raw, nil
+	}
+	return MarshalWithOptions(c.value, c.opts...)
+}
+
+// GormDataType returns the general data type of the column for GORM.
+func (JSONColumn[T]) GormDataType() string {
+	return "json"
+}
+
+// MarshalJSON implements the json.Marshaler interface so that a JSONColumn
+// can also be embedded in other JSON documents, following the same rules as
+// Value.
+func (c JSONColumn[T]) MarshalJSON() ([]byte, error) {
+	if !c.dirty {
+		if c.raw == nil {
+			return []byte("null"), nil
+		}
+		return c.raw, nil
+	}
+	return MarshalWithOptions(c.value, c.opts...)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, keeping the raw
+// JSON to be decoded on first access in the same way as Scan.
+func (c *JSONColumn[T]) UnmarshalJSON(rawJson []byte) error {
+	return c.Scan(rawJson)
+}
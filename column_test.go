@@ -0,0 +1,119 @@
+package poly
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var (
+	_ sql.Scanner   = &JSONColumn[SlicesABC]{}
+	_ driver.Valuer = JSONColumn[SlicesABC]{}
+)
+
+func TestJSONColumn_ScanUnmodified(t *testing.T) {
+	// Spacing is kept to show that the raw bytes are returned as is.
+	in := `[ {"type": "TypeString", "ValueA": "A"} ]`
+
+	var c JSONColumn[SlicesABC]
+	err := c.Scan([]byte(in))
+	assert.NoError(t, err)
+
+	v, err := c.Get()
+	assert.NoError(t, err)
+	assert.Len(t, v.TypeString, 1)
+	assert.Equal(t, "A", v.TypeString[0].ValueA)
+	assert.False(t, c.IsDirty())
+
+	out, err := c.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(in), out)
+}
+
+func TestJSONColumn_Modify(t *testing.T) {
+	var c JSONColumn[SlicesABC]
+	c.SetOptions(WithDiscriminator("type"))
+	err := c.Scan(`[{"type": "TypeString", "ValueA": "A"}]`)
+	assert.NoError(t, err)
+
+	err = c.Modify(func(v *SlicesABC) error {
+		v.TypeString = append(v.TypeString, TypeString{ValueA: "B"})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, c.IsDirty())
+
+	out, err := c.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`[{"type":"TypeString","ValueA":"A"},{"type":"TypeString","ValueA":"B"}]`), out)
+}
+
+func TestJSONColumn_RoundTrip(t *testing.T) {
+	in := SlicesABC{
+		TypeString: []TypeString{{ValueA: "A"}},
+		TypeBravo:  []TypeFloat{{ValueB: 1.5}},
+	}
+	c := NewJSONColumn(in, WithDiscriminator("type"))
+	out, err := c.Value()
+	assert.NoError(t, err)
+
+	err = c.Scan(out)
+	assert.NoError(t, err)
+	assert.False(t, c.IsDirty())
+	v, err := c.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, in, v)
+}
+
+func TestJSONColumn_Null(t *testing.T) {
+	var c JSONColumn[SlicesABC]
+	assert.NoError(t, c.Scan(nil))
+
+	v, err := c.Get()
+	assert.NoError(t, err)
+	assert.Empty(t, v.TypeString)
+
+	out, err := c.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, out)
+}
+
+func TestJSONColumn_ScanError(t *testing.T) {
+	var c JSONColumn[SlicesABC]
+	assert.Error(t, c.Scan(42))
+
+	assert.NoError(t, c.Scan(`not valid JSON`))
+	_, err := c.Get()
+	assert.Error(t, err)
+}
+
+func TestJSONColumn_New(t *testing.T) {
+	c := NewJSONColumn(SlicesABC{TypeString: []TypeString{{ValueA: "A"}}}, WithDiscriminator("type"))
+	assert.True(t, c.IsDirty())
+	assert.Equal(t, "json", c.GormDataType())
+
+	out, err := c.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(`[{"type":"TypeString","ValueA":"A"}]`), out)
+}
+
+func TestJSONColumn_JSON(t *testing.T) {
+	type model struct {
+		Column JSONColumn[SlicesABC] `json:"column"`
+	}
+
+	in := `{"column":[{"type":"TypeString","ValueA":"A"}]}`
+	var m model
+	err := json.Unmarshal([]byte(in), &m)
+	assert.NoError(t, err)
+
+	v, err := m.Column.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, "A", v.TypeString[0].ValueA)
+
+	out, err := json.Marshal(m)
+	assert.NoError(t, err)
+	assert.Equal(t, in, string(out))
+}
@@ -0,0 +1,166 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Incompatibility describes a change between two contracts that can make
+// payloads that are valid for the old contract invalid for the new one.
+type Incompatibility struct {
+	// TypeName is the type name the change affects.
+	TypeName string
+	// Path is the path of the affected property within the elements, with
+	// "[]" for the items of arrays and "*" for the values of maps. It is empty
+	// for changes to the type name as a whole.
+	Path string
+	// Reason describes the change.
+	Reason string
+}
+
+// String returns a description of the incompatibility.
+func (i Incompatibility) String() string {
+	if i.Path == "" {
+		return fmt.Sprintf("%q: %s", i.TypeName, i.Reason)
+	}
+	return fmt.Sprintf("%q at %s: %s", i.TypeName, i.Path, i.Reason)
+}
+
+// CheckCompatibility compares two contracts exported by ExportContract and
+// returns the changes that can break existing producers: type names that were
+// removed, cardinality that was tightened, position constraints that were
+// added or changed, and properties whose type changed. Changes that only make
+// the new contract more permissive, such as new type names or properties, are
+// not reported. The aliases of a type count as its type names, so a type that
+// is renamed, keeping its old name as an alias, isn't reported as removed,
+// while an alias that is dropped is. This can be used as a CI gate on the
+// evolution of a payload.
+//
+// An error is returned if either contract can't be parsed.
+func CheckCompatibility(oldContract []byte, newContract []byte) ([]Incompatibility, error) {
+	var oldC, newC Contract
+	err := json.Unmarshal(oldContract, &oldC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid old contract: %w", err)
+	}
+	err = json.Unmarshal(newContract, &newC)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new contract: %w", err)
+	}
+
+	newTypes := map[string]ContractType{}
+	for _, ct := range newC.Types {
+		newTypes[ct.TypeName] = ct
+		for _, alias := range ct.Aliases {
+			if _, ok := newTypes[alias]; !ok {
+				newTypes[alias] = ct
+			}
+		}
+	}
+
+	var result []Incompatibility
+	for _, oldType := range oldC.Types {
+		for _, alias := range oldType.Aliases {
+			if _, ok := newTypes[alias]; !ok {
+				result = append(result, Incompatibility{TypeName: alias, Reason: "type name was removed"})
+			}
+		}
+		newType, ok := newTypes[oldType.TypeName]
+		if !ok {
+			result = append(result, Incompatibility{TypeName: oldType.TypeName, Reason: "type name was removed"})
+			continue
+		}
+
+		if newType.MaxOccurs != 0 && (oldType.MaxOccurs == 0 || newType.MaxOccurs < oldType.MaxOccurs) {
+			result = append(result, Incompatibility{
+				TypeName: oldType.TypeName,
+				Reason:   fmt.Sprintf("maximum occurrences tightened from %s to %d", maxOccursString(oldType.MaxOccurs), newType.MaxOccurs),
+			})
+		}
+		if newType.Position != "" && newType.Position != oldType.Position {
+			result = append(result, Incompatibility{
+				TypeName: oldType.TypeName,
+				Reason:   fmt.Sprintf("elements must now be %s", newType.Position),
+			})
+		}
+
+		for _, change := range compareSchemas(oldType.Schema, newType.Schema, "") {
+			change.TypeName = oldType.TypeName
+			result = append(result, change)
+		}
+	}
+	return result, nil
+}
+
+// maxOccursString formats a MaxOccurs value for a message.
+func maxOccursString(maxOccurs int) string {
+	if maxOccurs == 0 {
+		return "unbounded"
+	}
+	return fmt.Sprint(maxOccurs)
+}
+
+// compareSchemas returns the properties within the schemas whose type changed.
+// A missing or empty new schema accepts anything, so it is compatible with any
+// old schema.
+func compareSchemas(oldSchema *Schema, newSchema *Schema, path string) []Incompatibility {
+	if newSchema == nil || newSchema.Type == "" {
+		return nil
+	}
+	if oldSchema == nil {
+		oldSchema = &Schema{}
+	}
+	if oldSchema.Type != newSchema.Type || oldSchema.Format != newSchema.Format {
+		return []Incompatibility{{
+			Path:   pathOrRoot(path),
+			Reason: fmt.Sprintf("type changed from %s to %s", schemaTypeString(oldSchema), schemaTypeString(newSchema)),
+		}}
+	}
+
+	var result []Incompatibility
+	switch newSchema.Type {
+	case "array":
+		result = append(result, compareSchemas(oldSchema.Items, newSchema.Items, path+"[]")...)
+	case "object":
+		result = append(result, compareSchemas(oldSchema.AdditionalProperties, newSchema.AdditionalProperties, joinPath(path, "*"))...)
+		names := make([]string, 0, len(oldSchema.Properties))
+		for name := range oldSchema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if newProperty, ok := newSchema.Properties[name]; ok {
+				result = append(result, compareSchemas(oldSchema.Properties[name], newProperty, joinPath(path, name))...)
+			}
+		}
+	}
+	return result
+}
+
+// schemaTypeString formats the type of a schema for a message.
+func schemaTypeString(s *Schema) string {
+	switch {
+	case s.Type == "":
+		return "any"
+	case s.Format != "":
+		return s.Type + " (" + s.Format + ")"
+	}
+	return s.Type
+}
+
+// joinPath appends a property name to a path.
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// pathOrRoot returns the path, or "(element)" for the element itself.
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "(element)"
+	}
+	return path
+}
@@ -0,0 +1,90 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type ContractV1 struct {
+	Location Location `poly:"location"`
+	People   []Person `poly:"person"`
+	Pets     []Pet    `poly:"pet"`
+	Notes    []Node   `poly:"note"`
+}
+
+type PersonV2 struct {
+	Name       string   `json:"name,omitempty"`
+	Occupation []string `json:"occupation,omitempty"`
+	Age        float64  `json:"age,omitempty"`
+	Email      string   `json:"email,omitempty"`
+}
+
+type NodeV2 struct {
+	ID     string         `json:"id"`
+	Labels map[string]int `json:"labels"`
+}
+
+type ContractV2 struct {
+	Location Location   `poly:"location,first"`
+	People   *PersonV2  `poly:"person"`
+	Notes    []NodeV2   `poly:"note"`
+	Water    []Location `poly:"water"`
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	v1, err := ExportContract(ContractV1{})
+	assert.NoError(t, err)
+	v2, err := ExportContract(ContractV2{})
+	assert.NoError(t, err)
+
+	incompatibilities, err := CheckCompatibility(v1, v2)
+	assert.NoError(t, err)
+	var descriptions []string
+	for _, i := range incompatibilities {
+		descriptions = append(descriptions, i.String())
+	}
+	assert.Equal(t, []string{
+		`"location": elements must now be first`,
+		`"person": maximum occurrences tightened from unbounded to 1`,
+		`"person" at age: type changed from integer to number`,
+		`"person" at occupation: type changed from string to array`,
+		`"pet": type name was removed`,
+		`"note" at id: type changed from integer to string`,
+		`"note" at labels.*: type changed from string to integer`,
+	}, descriptions)
+
+	// A contract is compatible with itself.
+	incompatibilities, err = CheckCompatibility(v2, v2)
+	assert.NoError(t, err)
+	assert.Empty(t, incompatibilities)
+
+	_, err = CheckCompatibility([]byte(`{`), v2)
+	assert.EqualError(t, err, "invalid old contract: unexpected end of JSON input")
+}
+
+func TestCheckCompatibility_Aliases(t *testing.T) {
+	type Before struct {
+		Dogs []Pet `poly:"dog,puppy"`
+	}
+	type Renamed struct {
+		Dogs []Pet `poly:"canine,dog"`
+	}
+	before, err := ExportContract(Before{})
+	assert.NoError(t, err)
+	renamed, err := ExportContract(Renamed{})
+	assert.NoError(t, err)
+	var contract Contract
+	assert.NoError(t, json.Unmarshal(renamed, &contract))
+	assert.Equal(t, []string{"dog"}, contract.Types[0].Aliases)
+
+	// Renaming a type keeps it compatible as long as the old name is an
+	// alias, but dropping an alias doesn't.
+	incompatibilities, err := CheckCompatibility(before, renamed)
+	assert.NoError(t, err)
+	assert.Equal(t, []Incompatibility{{TypeName: "puppy", Reason: "type name was removed"}}, incompatibilities)
+
+	incompatibilities, err = CheckCompatibility(renamed, before)
+	assert.NoError(t, err)
+	assert.Equal(t, []Incompatibility{{TypeName: "canine", Reason: "type name was removed"}}, incompatibilities)
+}
@@ -0,0 +1,63 @@
+package poly
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// CompositeTypeLocator is an alternative to TypeLocator for elements whose type
+// is identified by more than one key, as in APIs that version their payload
+// types independently of their kind, such as {"kind":"dog","version":"v2"}.
+// The parts are joined with slashes into the type name that is matched against
+// the target, "dog/v2" in this case, and the parts that are empty are left out.
+// It can be used wherever a TypeLocator can. A type that implements both
+// interfaces is asked for its composite type name only when its type name is
+// empty.
+type CompositeTypeLocator interface {
+	// CompositeTypeName returns the parts of the type name of the element.
+	CompositeTypeName() []string
+}
+
+// compositeTypeLocatorType is the type of the above interface.
+var compositeTypeLocatorType = reflect.TypeOf([]CompositeTypeLocator{}).Elem()
+
+// compositeSeparator separates the parts of a composite type name.
+const compositeSeparator = "/"
+
+// compositeTypeName joins the non-empty parts into a type name.
+func compositeTypeName(parts []string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, compositeSeparator)
+}
+
+// compositeResolver returns a function that reads the parts of a composite
+// type name from the keys of the element. A key may hold a string or a
+// number, which is used as it is written, so that {"kind":"dog","version":2}
+// is of type "dog/2". An error is returned if the element isn't an object.
+func compositeResolver(keys []string) func(raw json.RawMessage) (string, error) {
+	return func(raw json.RawMessage) (string, error) {
+		var object map[string]json.RawMessage
+		err := json.Unmarshal(raw, &object)
+		if err != nil {
+			return "", err
+		}
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			value := object[key]
+			if json.Unmarshal(value, &parts[i]) == nil {
+				continue
+			}
+			var number json.Number
+			if json.Unmarshal(value, &number) == nil {
+				parts[i] = number.String()
+			}
+		}
+		return compositeTypeName(parts), nil
+	}
+}
@@ -0,0 +1,66 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+type KindVersionLocator struct {
+	Kind    string `json:"kind"`
+	Version string `json:"version"`
+}
+
+func (l *KindVersionLocator) CompositeTypeName() []string {
+	return []string{l.Kind, l.Version}
+}
+
+type VersionedKennel struct {
+	Dogs   []Pet    `poly:"dog"`
+	DogsV2 []Pet    `poly:"dog/v2"`
+	People []Person `poly:"person/v1"`
+}
+
+func TestUnmarshal_CompositeTypeLocator(t *testing.T) {
+	in := []byte(`[
+		{"kind":"dog","name":"Fido"},
+		{"kind":"dog","version":"v2","name":"Rex"},
+		{"kind":"person","version":"v1","name":"John"},
+		{"kind":"person","version":"v2","name":"Juan"}
+	]`)
+
+	var result VersionedKennel
+	err := UnmarshalCustom(in, &result, reflect.TypeOf(KindVersionLocator{}))
+	assert.NoError(t, err)
+	assert.Equal(t, VersionedKennel{
+		Dogs:   []Pet{{Name: "Fido"}},
+		DogsV2: []Pet{{Name: "Rex"}},
+		People: []Person{{Name: "John"}},
+	}, result)
+}
+
+func TestUnmarshal_CompositeKeys(t *testing.T) {
+	in := []byte(`[
+		{"kind":"dog","name":"Fido"},
+		{"kind":"dog","version":"v2","name":"Rex"},
+		{"kind":"person","version":1,"name":"John"},
+		{"version":"v1","name":"?"}
+	]`)
+
+	var result VersionedKennel
+	err := UnmarshalWithOptions([]byte(`[{"kind":"person","version":"v1","name":"John"}]`), &result, WithCompositeKeys("kind", "version"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+
+	result = VersionedKennel{}
+	err = UnmarshalWithOptions(in, &result, WithCompositeKeys("kind", "version"), WithVocabulary(map[string][]string{"person/v1": {"person/1"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, VersionedKennel{
+		Dogs:   []Pet{{Name: "Fido"}},
+		DogsV2: []Pet{{Name: "Rex"}},
+		People: []Person{{Name: "John"}},
+	}, result)
+
+	err = UnmarshalWithOptions([]byte(`["dog"]`), &result, WithCompositeKeys("kind", "version"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,82 @@
+package poly
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// ContainerAppender can be implemented by the types of target fields that
+// collect their elements in something other than a Go slice, such as an
+// ordered map or a set from another library, so that the elements are added
+// to the container instead of being appended to a slice. The method set of a
+// pointer to the field type is used, so the methods usually have pointer
+// receivers. Types from other libraries can be adapted by wrapping them:
+//
+//	type PetSet struct {
+//	    set.Set[Pet]
+//	}
+//
+//	func (s *PetSet) ElementType() reflect.Type { return reflect.TypeOf(Pet{}) }
+//
+//	func (s *PetSet) AppendElement(element any) error {
+//	    s.Add(element.(Pet))
+//	    return nil
+//	}
+//
+//	type Residence struct {
+//	    Pets PetSet `poly:"pet"`
+//	}
+//
+// Containers can also implement ContainerLister so that their elements are
+// marshalled.
+type ContainerAppender interface {
+	// ElementType returns the type of the elements of the container, which
+	// the elements are decoded into. If it is a pointer type, the elements
+	// are passed to AppendElement as pointers.
+	ElementType() reflect.Type
+	// AppendElement adds a decoded element to the container. An error stops
+	// the unmarshalling and is returned from it.
+	AppendElement(element any) error
+}
+
+// ContainerLister can be implemented by the types of target fields that
+// implement ContainerAppender, so that their elements are marshalled and
+// flattened like those of a slice.
+type ContainerLister interface {
+	// Elements returns the elements of the container in the order they are
+	// marshalled.
+	Elements() []any
+}
+
+var (
+	containerAppenderType = reflect.TypeOf((*ContainerAppender)(nil)).Elem()
+	containerListerType   = reflect.TypeOf((*ContainerLister)(nil)).Elem()
+)
+
+// containerElementType returns the type of the elements of a target field of
+// the given type if a pointer to it implements ContainerAppender, or nil if it
+// doesn't.
+func containerElementType(t reflect.Type) (reflect.Type, error) {
+	if !reflect.PointerTo(t).Implements(containerAppenderType) {
+		return nil, nil
+	}
+	elemType := reflect.New(t).Interface().(ContainerAppender).ElementType()
+	if elemType == nil {
+		return nil, fmt.Errorf("container %v has no element type", t)
+	}
+	return elemType, nil
+}
+
+// appendToContainer adds the element to the container field.
+func appendToContainer(field reflect.Value, element reflect.Value) error {
+	return field.Addr().Interface().(ContainerAppender).AppendElement(element.Interface())
+}
+
+// containerElements returns the elements of the container that v points to,
+// and false if it isn't a ContainerLister.
+func containerElements(v reflect.Value) ([]any, bool) {
+	if v.Kind() != reflect.Pointer || !v.Type().Implements(containerListerType) {
+		return nil, false
+	}
+	return v.Interface().(ContainerLister).Elements(), true
+}
@@ -0,0 +1,99 @@
+package poly
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+// PetsByName is an ordered map of pets by their names.
+type PetsByName struct {
+	names []string
+	pets  map[string]Pet
+}
+
+func (p *PetsByName) ElementType() reflect.Type {
+	return reflect.TypeOf(Pet{})
+}
+
+func (p *PetsByName) AppendElement(element any) error {
+	pet := element.(Pet)
+	if pet.Name == "" {
+		return errors.New("pet without a name")
+	}
+	if p.pets == nil {
+		p.pets = map[string]Pet{}
+	}
+	if _, ok := p.pets[pet.Name]; !ok {
+		p.names = append(p.names, pet.Name)
+	}
+	p.pets[pet.Name] = pet
+	return nil
+}
+
+func (p *PetsByName) Elements() []any {
+	var elements []any
+	for _, name := range p.names {
+		elements = append(elements, p.pets[name])
+	}
+	return elements
+}
+
+// PeopleSet is a set of people that only collects them.
+type PeopleSet map[string]*Person
+
+func (s *PeopleSet) ElementType() reflect.Type {
+	return reflect.TypeOf(&Person{})
+}
+
+func (s *PeopleSet) AppendElement(element any) error {
+	if *s == nil {
+		*s = PeopleSet{}
+	}
+	person := element.(*Person)
+	(*s)[person.Name] = person
+	return nil
+}
+
+type ContainerResidence struct {
+	People PeopleSet  `poly:"person"`
+	Pets   PetsByName `poly:"pet"`
+}
+
+func TestUnmarshal_Container(t *testing.T) {
+	in := []byte(`[
+		{"type":"pet","name":"Rex","species":"cat"},
+		{"type":"person","name":"John"},
+		{"type":"pet","name":"Fido","species":"dog"},
+		{"type":"pet","name":"Rex","species":"dog"}
+	]`)
+
+	var result ContainerResidence
+	err := Unmarshal(in, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, PeopleSet{"John": {Name: "John"}}, result.People)
+	assert.Equal(t, []any{Pet{Name: "Rex", Species: "dog"}, Pet{Name: "Fido", Species: "dog"}}, result.Pets.Elements())
+
+	bytes, err := MarshalWithOptions(ContainerResidence{Pets: result.Pets}, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"pet","name":"Rex","species":"dog"},{"type":"pet","name":"Fido","species":"dog"}]`, string(bytes))
+
+	err = Unmarshal([]byte(`[{"type":"pet"}]`), &result)
+	assert.EqualError(t, err, "pet without a name")
+
+	fields, err := DescribeTarget(result)
+	assert.NoError(t, err)
+	assert.Equal(t, reflect.TypeOf(Person{}), fields[0].Type)
+	assert.True(t, fields[0].Pointer)
+	assert.Equal(t, reflect.TypeOf(Pet{}), fields[1].Type)
+}
+
+func TestBuilder_Container(t *testing.T) {
+	b := NewBuilder(&ContainerResidence{})
+	Add(b, Pet{Name: "Fido"})
+	Add(b, Pet{Name: "Rex"})
+	var result ContainerResidence
+	assert.NoError(t, b.Build(&result))
+	assert.Equal(t, []any{Pet{Name: "Fido"}, Pet{Name: "Rex"}}, result.Pets.Elements())
+}
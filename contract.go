@@ -0,0 +1,163 @@
+package poly
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Contract is the machine-readable description of the polymorphic array that
+// a target struct accepts, as exported by ExportContract. Producer services can
+// use it to generate compatible payloads, and CheckCompatibility compares two
+// of them.
+type Contract struct {
+	// Types describes each type name the target accepts, in the order of the
+	// fields of the target.
+	Types []ContractType `json:"types"`
+}
+
+// ContractType describes the elements of one type name in a Contract.
+type ContractType struct {
+	// TypeName is the polymorphic type name of the elements.
+	TypeName string `json:"typeName"`
+	// Aliases are the other type names that the elements are accepted
+	// under.
+	Aliases []string `json:"aliases,omitempty"`
+	// Field is the name of the Go field that receives the elements.
+	Field string `json:"field"`
+	// MaxOccurs is the maximum number of elements of the type that are kept.
+	// It is 1 for fields that hold a single element and 0, meaning unbounded,
+	// for slice fields.
+	MaxOccurs int `json:"maxOccurs,omitempty"`
+	// Position is "first" or "last" if the elements must appear at the start
+	// or the end of the array, and empty otherwise.
+	Position string `json:"position,omitempty"`
+	// Schema is the JSON schema of the elements.
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema needed to describe the elements that Go
+// types marshal to and unmarshal from with encoding/json.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ExportContract returns the JSON encoding of the Contract of the target, which
+// may be a struct or a pointer to one. It describes each type name the target
+// accepts along with the constraints from its `poly` tag and the JSON schema
+// of its elements, derived from their Go types and `json` tags. Of the
+// options, only WithTagKey and WithTagKeys apply.
+func ExportContract(target any, opts ...Option) ([]byte, error) {
+	fields, err := DescribeTarget(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	contract := Contract{Types: make([]ContractType, 0, len(fields))}
+	for _, f := range fields {
+		ct := ContractType{
+			TypeName: f.TypeName,
+			Aliases:  f.Aliases,
+			Field:    f.FieldName,
+			Schema:   schemaFor(f.Type, map[reflect.Type]bool{}),
+		}
+		if !f.Slice {
+			ct.MaxOccurs = 1
+		}
+		if f.First {
+			ct.Position = "first"
+		} else if f.Last {
+			ct.Position = "last"
+		}
+		contract.Types = append(contract.Types, ct)
+	}
+	return json.MarshalIndent(contract, "", "  ")
+}
+
+// schemaFor returns the JSON schema for the values of type t. The types that
+// are being described are kept in visiting so that recursive types are cut
+// short with an empty schema, which accepts anything.
+func schemaFor(t reflect.Type, visiting map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64 strings.
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaFor(t.Elem(), visiting)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaFor(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return &Schema{}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		addProperties(s, t, visiting, false)
+		return s
+	}
+	return &Schema{}
+}
+
+// addProperties adds the properties for the fields of the struct type t to the
+// schema, following the rules of encoding/json for names and embedded structs.
+// The fields of embedded structs, for which embedded is set, don't replace the
+// properties of the outer struct.
+func addProperties(s *Schema, t reflect.Type, visiting map[reflect.Type]bool, embedded bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addProperties(s, ft, visiting, true)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if _, ok := s.Properties[name]; ok && embedded {
+			continue
+		}
+		s.Properties[name] = schemaFor(f.Type, visiting)
+	}
+}
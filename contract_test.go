@@ -0,0 +1,88 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestExportContract(t *testing.T) {
+	contract, err := ExportContract(OrderedResidence{})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"types": [
+			{
+				"typeName": "location",
+				"field": "Location",
+				"maxOccurs": 1,
+				"position": "first",
+				"schema": {"type": "object", "properties": {"address": {"type": "string"}}}
+			},
+			{
+				"typeName": "person",
+				"field": "People",
+				"schema": {"type": "object", "properties": {
+					"name": {"type": "string"},
+					"occupation": {"type": "string"},
+					"age": {"type": "integer"}
+				}}
+			},
+			{
+				"typeName": "note",
+				"field": "Notes",
+				"position": "last",
+				"schema": {"type": "object", "properties": {
+					"name": {"type": "string"},
+					"species": {"type": "string"}
+				}}
+			}
+		]
+	}`, string(contract))
+
+	_, err = ExportContract(42)
+	assert.EqualError(t, err, "target must be a pointer to a struct")
+}
+
+type Audited struct {
+	By string `json:"by"`
+	At time.Time
+}
+
+type Node struct {
+	Audited
+	ID       int               `json:"id"`
+	By       float64           `json:"by"`
+	Children []*Node           `json:"children,omitempty"`
+	Labels   map[string]string `json:"labels"`
+	Blob     []byte            `json:"blob"`
+	Extra    json.RawMessage   `json:"extra"`
+	Internal string            `json:"-"`
+	secret   string
+}
+
+func TestExportContract_Schema(t *testing.T) {
+	var target struct {
+		Node *Node `poly:"node"`
+	}
+	contract, err := ExportContract(&target)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"types": [
+			{
+				"typeName": "node",
+				"field": "Node",
+				"maxOccurs": 1,
+				"schema": {"type": "object", "properties": {
+					"by": {"type": "number"},
+					"At": {"type": "string", "format": "date-time"},
+					"id": {"type": "integer"},
+					"children": {"type": "array", "items": {}},
+					"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+					"blob": {"type": "string", "format": "byte"},
+					"extra": {}
+				}}
+			}
+		]
+	}`, string(contract))
+}
@@ -0,0 +1,230 @@
+package poly
+
+import (
+	"encoding"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// UnmarshalCSV reads rows of CSV from r and unmarshals them into the target as
+// the elements of a polymorphic array, for bulk exports that aren't JSON but
+// share the routing problem. The first row is the header, which names the
+// columns. The typeColumn is the column that holds the type name of each row,
+// and the other columns are the keys of the element, matched to the fields of
+// the element struct by their JSON names. The elements are then routed and
+// decoded as with UnmarshalSource, and the index of an element is its row,
+// not counting the header.
+//
+// Each cell is converted to the JSON value that the field of its column
+// expects: a number or a boolean for the fields of those kinds, the JSON of
+// the cell for slices, maps and structs, and a string otherwise, so that the
+// types that implement encoding.TextUnmarshaler, such as time.Time, parse the
+// cell themselves. Empty cells are left out of the element, and the type
+// column is also a key of the element.
+//
+// Example usage:
+//
+//	type,name,age,species
+//	person,Alice,30,
+//	pet,Rex,,dog
+//
+//	var residence Residence
+//	err := poly.UnmarshalCSV(file, &residence, "type")
+func UnmarshalCSV(r io.Reader, target any, typeColumn string, opts ...Option) error {
+	return unmarshalDelimited(csv.NewReader(r), target, typeColumn, newOptions(opts))
+}
+
+// UnmarshalTSV works like UnmarshalCSV, but reads tab-separated values. Quotes
+// don't need to be balanced, as TSV doesn't quote its cells.
+func UnmarshalTSV(r io.Reader, target any, typeColumn string, opts ...Option) error {
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	return unmarshalDelimited(reader, target, typeColumn, newOptions(opts))
+}
+
+// unmarshalDelimited unmarshals the rows of the reader into the target.
+func unmarshalDelimited(reader *csv.Reader, target any, typeColumn string, o *options) error {
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	src := &csvSource{reader: reader, header: append([]string(nil), header...), typeColumn: -1}
+	for i, name := range src.header {
+		if name == typeColumn {
+			src.typeColumn = i
+			break
+		}
+	}
+	if src.typeColumn < 0 {
+		return fmt.Errorf("type column %q is not in the header", typeColumn)
+	}
+	src.elementType, err = elementTypes(target, o)
+	if err != nil {
+		return err
+	}
+	return unmarshalSource(src, target, o)
+}
+
+// elementTypes returns a function that gives the type that the elements of a
+// type name are decoded into, as the decoder would find it, or nil if the
+// elements of the type name aren't decoded into a struct.
+func elementTypes(target any, o *options) (func(typeName string) reflect.Type, error) {
+	targetFields, err := makeTargetFieldLookup(target, o.tagKeys)
+	if err != nil {
+		return nil, err
+	}
+	err = applyFieldOverrides(targetFields, o.fieldOverrides)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := fieldAliases(targetFields)
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := fallbackField(targetFields, o.defaultType)
+	if err != nil {
+		return nil, err
+	}
+	return func(typeName string) reflect.Type {
+		if canonical, ok := aliases[typeName]; ok {
+			typeName = canonical
+		}
+		fl, ok := targetFields[typeName]
+		if !ok && typeName != "" && fallback != "" {
+			fl, ok = targetFields[fallback]
+		}
+		if !ok || fl.raw || fl.fieldType.Kind() != reflect.Struct {
+			return nil
+		}
+		return fl.fieldType
+	}, nil
+}
+
+// csvSource is an ElementSource over the rows of a CSV reader whose header
+// has already been read.
+type csvSource struct {
+	reader      *csv.Reader
+	header      []string
+	typeColumn  int
+	elementType func(typeName string) reflect.Type
+	// columns caches the fields of the columns by element type.
+	columns map[reflect.Type][]jsonField
+}
+
+// Next implements the ElementSource interface.
+func (s *csvSource) Next() (SourceElement, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		return SourceElement{}, err
+	}
+	typeName := record[s.typeColumn]
+	columns := s.columnFields(s.elementType(typeName))
+	element := make(map[string]json.RawMessage, len(record))
+	for i, cell := range record {
+		if cell == "" {
+			continue
+		}
+		element[s.header[i]] = cellJSON(cell, columns[i])
+	}
+	raw, err := json.Marshal(element)
+	if err != nil {
+		return SourceElement{}, err
+	}
+	return SourceElement{Raw: raw, TypeName: typeName}, nil
+}
+
+// columnFields returns the fields of the element type that the columns map
+// to, with the zero jsonField for the columns that map to no field.
+func (s *csvSource) columnFields(elemType reflect.Type) []jsonField {
+	if columns, ok := s.columns[elemType]; ok {
+		return columns
+	}
+	columns := make([]jsonField, len(s.header))
+	if elemType != nil {
+		fields := jsonFields(elemType)
+		for i, name := range s.header {
+			columns[i] = fields[strings.ToLower(name)]
+		}
+	}
+	if s.columns == nil {
+		s.columns = map[reflect.Type][]jsonField{}
+	}
+	s.columns[elemType] = columns
+	return columns
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// cellJSON returns the JSON value of a cell for the field of its column,
+// whose type is nil if the column maps to no field. Cells that aren't valid
+// JSON for a number, a boolean or a composite field are passed on as strings,
+// so that decoding reports them with the field they belong to. The value of a
+// field tagged with the string option is quoted once more, as encoding/json
+// expects it.
+func cellJSON(cell string, field jsonField) json.RawMessage {
+	value := cellValue(cell, field.fieldType)
+	if field.quoted && quotable(field.fieldType) {
+		encoded, _ := json.Marshal(string(value))
+		return encoded
+	}
+	return value
+}
+
+// quotable reports whether the string option of encoding/json applies to the
+// values of the type, which are strings, numbers and booleans, or pointers to
+// them.
+func quotable(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+// cellValue returns the JSON value of a cell for a field of the given type,
+// which is nil if the column maps to no field.
+func cellValue(cell string, t reflect.Type) json.RawMessage {
+	literal := false
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == nil:
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+	case reflect.PointerTo(t).Implements(jsonUnmarshalerType):
+		literal = true
+	default:
+		switch t.Kind() {
+		case reflect.Bool, reflect.Float32, reflect.Float64,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Map, reflect.Struct, reflect.Array:
+			literal = true
+		case reflect.Slice:
+			// Byte slices are encoded as base64 strings.
+			literal = t.Elem().Kind() != reflect.Uint8
+		}
+	}
+	if literal && json.Valid([]byte(cell)) {
+		return json.RawMessage(cell)
+	}
+	encoded, _ := json.Marshal(cell)
+	return encoded
+}
@@ -0,0 +1,116 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalCSV(t *testing.T) {
+	in := "type,name,age,species,address\n" +
+		"location,,,,\"1 Main St, Springfield\"\n" +
+		"person,Alice,30,,\n" +
+		"pet,Rex,,dog,\n" +
+		"person,Bob,42,,\n" +
+		"car,Herbie,,,\n"
+
+	var residence Residence
+	err := UnmarshalCSV(strings.NewReader(in), &residence, "type")
+	assert.NoError(t, err)
+	assert.Equal(t, Residence{
+		Location: Location{Address: "1 Main St, Springfield"},
+		People:   []Person{{Name: "Alice", Age: 30}, {Name: "Bob", Age: 42}},
+		Pets:     []Pet{{Name: "Rex", Species: "dog"}},
+	}, residence)
+}
+
+func TestUnmarshalTSV(t *testing.T) {
+	in := "kind\tname\toccupation\n" +
+		"person\tAlice\tsays \"hi\"\n"
+
+	var residence Residence
+	err := UnmarshalTSV(strings.NewReader(in), &residence, "kind")
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "Alice", Occupation: `says "hi"`}}, residence.People)
+}
+
+type Shipment struct {
+	Type      string    `json:"type"`
+	Tracking  string    `json:"tracking"`
+	Shipped   time.Time `json:"shipped"`
+	Express   bool      `json:"express"`
+	Weight    *float64  `json:"weight"`
+	Tags      []string  `json:"tags"`
+	Reference string    `json:"reference"`
+}
+
+type Shipments struct {
+	Parcels []Shipment `poly:"parcel,package"`
+}
+
+func TestUnmarshalCSV_FieldTypes(t *testing.T) {
+	in := "type,tracking,shipped,express,weight,tags,reference\n" +
+		"package,1Z999,2024-03-01T10:00:00Z,true,2.5,\"[\"\"fragile\"\"]\",42\n" +
+		"parcel,1Z998,,,,,\n"
+
+	var shipments Shipments
+	err := UnmarshalCSV(strings.NewReader(in), &shipments, "type")
+	assert.NoError(t, err)
+	weight := 2.5
+	assert.Equal(t, []Shipment{
+		{
+			Type:      "package",
+			Tracking:  "1Z999",
+			Shipped:   time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+			Express:   true,
+			Weight:    &weight,
+			Tags:      []string{"fragile"},
+			Reference: "42",
+		},
+		{Type: "parcel", Tracking: "1Z998"},
+	}, shipments.Parcels)
+}
+
+type Invoice struct {
+	Number string  `json:"number,string"`
+	Total  float64 `json:"total,string"`
+	Paid   *bool   `json:"paid,omitempty,string"`
+}
+
+type Invoices struct {
+	Invoices []Invoice `poly:"invoice"`
+}
+
+func TestUnmarshalCSV_QuotedFields(t *testing.T) {
+	in := "type,number,total,paid\n" +
+		"invoice,0042,19.99,true\n"
+
+	var invoices Invoices
+	err := UnmarshalCSV(strings.NewReader(in), &invoices, "type")
+	assert.NoError(t, err)
+	paid := true
+	assert.Equal(t, []Invoice{{Number: "0042", Total: 19.99, Paid: &paid}}, invoices.Invoices)
+}
+
+func TestUnmarshalCSV_Errors(t *testing.T) {
+	var residence Residence
+	err := UnmarshalCSV(strings.NewReader("kind,name\nperson,Alice\n"), &residence, "type")
+	assert.EqualError(t, err, `type column "type" is not in the header`)
+
+	err = UnmarshalCSV(strings.NewReader("type,age\nperson,old\n"), &residence, "type")
+	assert.Error(t, err)
+
+	err = UnmarshalCSV(strings.NewReader("type,name\nperson,Alice,extra\n"), &residence, "type")
+	assert.Error(t, err)
+
+	err = UnmarshalCSV(strings.NewReader("type\n"), residence, "type")
+	assert.EqualError(t, err, "target must be a pointer")
+}
+
+func TestUnmarshalCSV_Empty(t *testing.T) {
+	var residence Residence
+	assert.NoError(t, UnmarshalCSV(strings.NewReader(""), &residence, "type"))
+	assert.NoError(t, UnmarshalCSV(strings.NewReader("type,name\n"), &residence, "type"))
+	assert.Equal(t, Residence{}, residence)
+}
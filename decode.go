@@ -0,0 +1,630 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// UnmarshalSource works like UnmarshalWithOptions, but reads the elements from
+// the given ElementSource instead of a JSON array. Each element is routed to the
+// field of the target for its type name in the same way as with Unmarshal, and
+// the index of an element is its position in the source.
+func UnmarshalSource(src ElementSource, target any, opts ...Option) error {
+	return unmarshalSource(src, target, newOptions(opts))
+}
+
+// wrapSource wraps the source to unpack the elements according to the
+// provenance and tagging options, and to transform the type names that come
+// with them.
+func wrapSource(src ElementSource, o *options) ElementSource {
+	if o.provenance != nil {
+		src = &provenanceSource{src: src, keys: *o.provenance}
+	}
+	if o.externalTags {
+		src = externalTagSource{src: src}
+	}
+	if o.payloadKey != "" {
+		src = adjacentTagSource{src: src, payloadKey: o.payloadKey}
+	}
+	if len(o.typeNameTransforms) > 0 {
+		src = transformSource{src: src, transforms: o.typeNameTransforms}
+	}
+	return src
+}
+
+// unmarshalSource is the decoding engine behind all the ways of unmarshalling
+// into a target struct.
+func unmarshalSource(src ElementSource, target any, o *options) (err error) {
+	count := 0
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.Decoded(count, err)
+		}()
+	}
+	if o.report != nil {
+		o.report.reset()
+		start := time.Now()
+		defer func() {
+			o.report.Elements = count
+			o.report.Duration = time.Since(start)
+		}()
+	}
+
+	src = wrapSource(src, o)
+	if acc, ok := target.(Accumulator); ok {
+		count, err = accumulate(src, acc, o)
+		return err
+	}
+
+	d, err := newDecoder(target, o)
+	if err != nil {
+		return err
+	}
+	resolveOptions := o
+	if o.typeFields {
+		keys, err := typeFieldKeys(d.targetFields)
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			typed := *o
+			typed.typeKeys = keys
+			typed.typeResolver = nil
+			resolveOptions = &typed
+		}
+	}
+	resolve, err := optionsResolver(resolveOptions)
+	if err != nil {
+		return err
+	}
+	if o.duckTyping {
+		resolve = duckResolver(duckCandidates(d.targetFields), resolve)
+	}
+	if len(d.tuple) > 0 {
+		resolve = positionalResolver(d.tuple, resolve)
+	}
+
+	if o.workers > 1 {
+		count, err = d.decodeParallel(src, resolve)
+	} else {
+		count, err = forEachElement(src, o.firstIndex, resolve, d.element)
+	}
+	if err != nil {
+		return err
+	}
+	return d.finish(count)
+}
+
+// decoder holds the state of unmarshalling a sequence of elements into the
+// fields of a target struct.
+type decoder struct {
+	o            *options
+	targetFields map[string]fieldLookup
+	targetValue  reflect.Value
+
+	// seen maps the identities of the elements of the fields with the
+	// dedupe tag option, by the Go name of the field, to their positions in
+	// the slices of the fields.
+	seen map[string]map[any]int
+
+	// orderSettables are told the original order of the elements: the
+	// target if it implements OrderSettable, and the internal one from the
+	// options, if any. If there are any, the references to the elements are
+	// collected in order, and scalarRefs holds the positions in order of the
+	// references to the elements of fields that hold a single element.
+	orderSettables []OrderSettable
+	order          []ElementRef
+	scalarRefs     map[string]int
+
+	// restIndex is the index of the field that receives the unmatched
+	// elements, or -1 if there is none, and rest holds those elements.
+	restIndex int
+	rest      []UnmatchedElement
+
+	// positions keeps track of where the elements of any field with an
+	// ordering constraint were found so that they can be validated once
+	// everything is read.
+	positions map[string][]int
+	// tuple holds the type names of the positional fields by their
+	// positions.
+	tuple map[int]string
+
+	// memory tracks the approximate memory used against the limit from the
+	// options.
+	memory memoryBudget
+
+	// aliases maps the aliases of the type names of the target fields to
+	// the type names.
+	aliases map[string]string
+
+	// fallback is the type name of the field that receives the elements
+	// whose type names match no field, if any.
+	fallback string
+
+	// predecoded holds the elements that were decoded in parallel ahead of
+	// being stored, by their indexes.
+	predecoded map[int]predecodedElement
+}
+
+// newDecoder creates a decoder for the target, which must be a pointer to a
+// struct.
+func newDecoder(target any, o *options) (*decoder, error) {
+	targetFields, err := makeTargetFieldLookup(target, o.tagKeys)
+	if err != nil {
+		return nil, err
+	}
+	err = applyFieldOverrides(targetFields, o.fieldOverrides)
+	if err != nil {
+		return nil, err
+	}
+	restIndex, err := findRestField(reflect.TypeOf(target).Elem(), o.tagKeys)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := fieldAliases(targetFields)
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := fallbackField(targetFields, o.defaultType)
+	if err != nil {
+		return nil, err
+	}
+	tuple, err := positionalFields(targetFields)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{
+		o:            o,
+		targetFields: targetFields,
+		targetValue:  reflect.ValueOf(target).Elem(),
+		seen:         map[string]map[any]int{},
+		restIndex:    restIndex,
+		positions:    map[string][]int{},
+		memory:       memoryBudget{limit: o.memoryLimit},
+		aliases:      aliases,
+		fallback:     fallback,
+		tuple:        tuple,
+	}
+	if o.reset {
+		d.reset()
+	}
+	if orderSettable, ok := target.(OrderSettable); ok {
+		d.orderSettables = append(d.orderSettables, orderSettable)
+	}
+	if o.orderSink != nil {
+		d.orderSettables = append(d.orderSettables, o.orderSink)
+	}
+	if len(d.orderSettables) > 0 {
+		d.order = []ElementRef{}
+		d.scalarRefs = map[string]int{}
+	}
+	return d, nil
+}
+
+// reset sets the fields of the target that receive elements to their zero
+// values, as asked for by WithReset.
+func (d *decoder) reset() {
+	for _, fl := range d.targetFields {
+		field := d.targetValue.Field(fl.index)
+		field.Set(reflect.Zero(field.Type()))
+	}
+	if d.restIndex >= 0 {
+		field := d.targetValue.Field(d.restIndex)
+		field.Set(reflect.Zero(field.Type()))
+	}
+}
+
+// fieldAliases returns the map from the aliases of the type names of the
+// target fields to the type names. An error is returned if an alias is also
+// the type name or an alias of another field.
+func fieldAliases(targetFields map[string]fieldLookup) (map[string]string, error) {
+	aliases := map[string]string{}
+	for _, fl := range sortedFieldLookups(targetFields) {
+		for _, alias := range fl.aliases {
+			other, ok := targetFields[alias]
+			if !ok {
+				other, ok = targetFields[aliases[alias]]
+			}
+			if ok && other.goName != fl.goName {
+				return nil, fmt.Errorf("type name %q is used by both fields %s and %s", alias, other.goName, fl.goName)
+			}
+			if !ok {
+				aliases[alias] = fl.name
+			}
+		}
+	}
+	return aliases, nil
+}
+
+// fallbackField returns the type name of the field that receives the elements
+// whose type names match no field: the one given with WithDefaultType, if any,
+// or that of the field with the default tag option. An empty string is
+// returned if there is none, and an error if the type name given has no field
+// or if more than one field has the tag option.
+func fallbackField(targetFields map[string]fieldLookup, defaultType string) (string, error) {
+	if defaultType != "" {
+		if _, ok := targetFields[defaultType]; !ok {
+			return "", fmt.Errorf("default type %q has no field in the target", defaultType)
+		}
+		return defaultType, nil
+	}
+	fallback := ""
+	for _, fl := range sortedFieldLookups(targetFields) {
+		if !fl.fallback {
+			continue
+		}
+		if fallback != "" {
+			return "", fmt.Errorf("only one field may have the default option, found %s and %s", targetFields[fallback].goName, fl.goName)
+		}
+		fallback = fl.name
+	}
+	return fallback, nil
+}
+
+// canonical returns the type name of the target field that the type name is
+// an alias of, or the type name itself if it isn't an alias.
+func (d *decoder) canonical(typeName string) string {
+	if canonical, ok := d.aliases[typeName]; ok {
+		return canonical
+	}
+	return typeName
+}
+
+// applyFieldOverrides changes the type names of the target fields as given
+// with WithFieldOverride. Every field that is overridden loses the type name and
+// the aliases it had from its tag, and is then reachable only through the type
+// names given for it.
+func applyFieldOverrides(targetFields map[string]fieldLookup, overrides []fieldOverride) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+
+	byGoName := map[string]fieldLookup{}
+	for _, fl := range targetFields {
+		byGoName[fl.goName] = fl
+	}
+	for _, override := range overrides {
+		fl, ok := byGoName[override.fieldName]
+		if !ok {
+			return fmt.Errorf("field %s for type name %q does not exist in the target", override.fieldName, override.typeName)
+		}
+		if existing, ok := targetFields[fl.name]; ok && existing.goName == fl.goName {
+			delete(targetFields, fl.name)
+		}
+	}
+	for _, override := range overrides {
+		fl := byGoName[override.fieldName]
+		fl.name = override.typeName
+		fl.aliases = nil
+		targetFields[override.typeName] = fl
+	}
+	return nil
+}
+
+// element decodes a single element with the given index and type name into the
+// matching field of the target. If the field takes batches with the items tag
+// option and the element is one, each of its sub-objects is stored instead.
+func (d *decoder) element(index int, typeName string, raw json.RawMessage) error {
+	typeName = d.canonical(typeName)
+	fl, ok := d.targetFields[typeName]
+	if !ok && typeName != "" && d.fallback != "" {
+		typeName = d.fallback
+		fl, ok = d.targetFields[typeName]
+	}
+	if len(typeName) == 0 || !ok {
+		// If nothing is returned, that's the signal that we are not interested in
+		// this sub-object. Otherwise there is no field for it.
+		if d.o.metrics != nil {
+			d.o.metrics.ElementUnmatched(typeName, len(raw))
+		}
+		if d.o.report != nil {
+			d.o.report.unmatched(len(raw))
+		}
+		if d.restIndex >= 0 {
+			err := d.memory.charge(index, typeName, len(raw), nil)
+			if err != nil {
+				return err
+			}
+			d.rest = append(d.rest, UnmatchedElement{TypeName: typeName, Index: index, Raw: append(json.RawMessage(nil), raw...)})
+		}
+		return nil
+	}
+
+	if fl.items != "" {
+		items, ok, err := batchItems(raw, fl.items)
+		if err != nil {
+			return fmt.Errorf("batch element %d of type %q: %w", index, typeName, err)
+		}
+		if ok {
+			for _, item := range items {
+				err = d.store(fl, index, typeName, item)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	return d.store(fl, index, typeName, raw)
+}
+
+// store decodes a single element with the given index and type name into the
+// field of the target described by fl.
+func (d *decoder) store(fl fieldLookup, index int, typeName string, raw json.RawMessage) error {
+	var start time.Time
+	if d.o.report != nil {
+		start = time.Now()
+	}
+	raw, err := openElement(raw, index, typeName, d.o)
+	if err != nil {
+		return err
+	}
+	if predicate, ok := d.o.predicates[typeName]; ok && !predicate(raw) {
+		if d.o.metrics != nil {
+			d.o.metrics.ElementUnmatched(typeName, len(raw))
+		}
+		if d.o.report != nil {
+			d.o.report.unmatched(len(raw))
+		}
+		return nil
+	}
+	err = d.memory.charge(index, typeName, len(raw), fl.fieldType)
+	if err != nil {
+		return err
+	}
+	field := d.targetValue.Field(fl.index)
+	var dup bool
+	if d.decodesInPlace(fl, typeName) {
+		dup, err = d.decodeInPlace(fl, field, index, typeName, raw)
+	} else {
+		dup, err = d.decodeAndStore(fl, field, index, typeName, raw)
+	}
+	if err != nil {
+		return err
+	}
+	if d.o.metrics != nil {
+		d.o.metrics.ElementDecoded(typeName, len(raw))
+	}
+	if d.o.report != nil {
+		d.o.report.decoded(typeName, len(raw), start)
+	}
+
+	if fl.first || fl.last {
+		// The sub-objects of a batch share the index of the batch, which
+		// is only recorded once.
+		found := d.positions[typeName]
+		if len(found) == 0 || found[len(found)-1] != index {
+			d.positions[typeName] = append(found, index)
+		}
+	}
+	if d.orderSettables != nil && !dup {
+		d.recordOrder(fl, field, index)
+	}
+	return nil
+}
+
+// decodesInPlace reports whether the elements of the type name are decoded
+// with decodeInPlace.
+func (d *decoder) decodesInPlace(fl fieldLookup, typeName string) bool {
+	return d.o.batchAllocation && fl.slice && !fl.ptr && !fl.raw && d.o.elementTimeout <= 0 && d.o.fieldDecoders[typeName] == nil
+}
+
+// batchItems returns the sub-objects of a batch element, held in an array
+// under the given key. False is returned if the element doesn't have the key,
+// and so is not a batch.
+func batchItems(raw json.RawMessage, key string) ([]json.RawMessage, bool, error) {
+	var obj map[string]json.RawMessage
+	err := json.Unmarshal(raw, &obj)
+	if err != nil {
+		return nil, false, err
+	}
+	itemsRaw, ok := obj[key]
+	if !ok {
+		return nil, false, nil
+	}
+	var items []json.RawMessage
+	err = json.Unmarshal(itemsRaw, &items)
+	if err != nil {
+		return nil, false, fmt.Errorf("%q does not hold an array: %w", key, err)
+	}
+	return items, true, nil
+}
+
+// decodeInPlace decodes an element straight into a new element at the end of
+// the slice field, so that the elements share the backing array of the slice
+// instead of each being allocated on its own. With a timeout the decoding may
+// be abandoned while it still writes to the element, so this can't be used
+// then. True is returned if the element was a duplicate.
+func (d *decoder) decodeInPlace(fl fieldLookup, field reflect.Value, index int, typeName string, raw json.RawMessage) (bool, error) {
+	field.Set(reflect.Append(field, reflect.Zero(fl.fieldType)))
+	last := field.Len() - 1
+	_, err := recoveringDecodeElement(d.o, field.Index(last).Addr(), raw, index, typeName)
+	dup := false
+	if err == nil && fl.dedupeIndex != nil {
+		dup, err = d.dedupe(fl, field, field.Index(last).Addr(), raw, last)
+	}
+	if dup || err != nil {
+		field.SetLen(last)
+	}
+	return dup, err
+}
+
+// decodeAndStore decodes an element into a new value and stores it in the
+// field. True is returned if the element was a duplicate, and so not stored.
+func (d *decoder) decodeAndStore(fl fieldLookup, field reflect.Value, index int, typeName string, raw json.RawMessage) (bool, error) {
+	// We have a matching field we should unmarshal into. Raw fields get a
+	// copy of the JSON of the element as it is.
+	var newSub reflect.Value
+	if fl.raw {
+		newSub = reflect.New(rawMessageType)
+		newSub.Elem().Set(reflect.ValueOf(append(json.RawMessage(nil), raw...)))
+	} else if p, ok := d.predecoded[index]; ok {
+		delete(d.predecoded, index)
+		if p.recovered != nil {
+			panic(p.recovered)
+		}
+		if p.err != nil {
+			return false, p.err
+		}
+		newSub = p.value
+	} else {
+		var err error
+		newSub, err = guardedDecodeElement(d.o, raw, fl.fieldType, index, typeName)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	if fl.dedupeIndex != nil {
+		dup, err := d.dedupe(fl, field, newSub, raw, field.Len())
+		if dup || err != nil {
+			return dup, err
+		}
+	}
+
+	// If the actual target isn't a pointer, unwrap the Value into the object itself.
+	if !fl.ptr {
+		newSub = newSub.Elem()
+	}
+
+	// Finally figure out how to save it.
+	if fl.container {
+		return false, appendToContainer(field, newSub)
+	}
+	if fl.slice {
+		// A slice gets appended to.
+		field.Set(reflect.Append(field, newSub))
+	} else {
+		// A value just gets set.
+		field.Set(newSub)
+	}
+	return false, nil
+}
+
+// dedupe checks whether the element that elem points to is a duplicate of an
+// element already decoded into the slice field, based on its identity field.
+// If it is, it is merged into the existing element if the merge tag option
+// is set, and true is returned so the caller drops it. Otherwise its identity
+// is recorded for the given position in the slice. Elements whose identity
+// is the zero value are never duplicates.
+func (d *decoder) dedupe(fl fieldLookup, field reflect.Value, elem reflect.Value, raw json.RawMessage, position int) (bool, error) {
+	id := elem.Elem().FieldByIndex(fl.dedupeIndex)
+	if id.IsZero() {
+		return false, nil
+	}
+	key := id.Interface()
+
+	seen := d.seen[fl.goName]
+	if seen == nil {
+		seen = map[any]int{}
+		d.seen[fl.goName] = seen
+	}
+	existing, ok := seen[key]
+	if !ok {
+		seen[key] = position
+		return false, nil
+	}
+
+	if fl.merge {
+		target := field.Index(existing)
+		if !fl.ptr {
+			target = target.Addr()
+		}
+		err := unmarshalJSON(raw, target.Interface(), d.o.useNumber)
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+// finish completes the decoding once all count elements have been passed to
+// element, validating the constraints that depend on all of them.
+func (d *decoder) finish(count int) error {
+	if !d.o.partial {
+		err := validatePositions(d.targetFields, d.positions, count)
+		if err != nil {
+			return err
+		}
+	}
+	for _, orderSettable := range d.orderSettables {
+		orderSettable.SetOriginalOrder(d.order)
+	}
+	if len(d.rest) > 0 {
+		setRest(d.targetValue.Field(d.restIndex), d.rest)
+	}
+	if d.o.resolveReferences {
+		return resolveReferences(d.targetValue, d.targetFields)
+	}
+	return nil
+}
+
+// decodeElementWithOptions works like decodeElementInto, but decodes with the
+// field decoder for the type name if there is one, and applies the defaults
+// configured in the options: the `default` tags are applied before decoding
+// and the defaulter for the type name after it. The returned value is a
+// pointer to the element, which is newSub unless the field decoder returned a
+// pointer of its own.
+func decodeElementWithOptions(o *options, newSub reflect.Value, raw json.RawMessage, index int, typeName string) (reflect.Value, error) {
+	if fieldDecoder, ok := o.fieldDecoders[typeName]; ok {
+		v, err := fieldDecoder(raw)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		decoded := reflect.ValueOf(v)
+		elemType := newSub.Type().Elem()
+		switch {
+		case !decoded.IsValid():
+			return reflect.Value{}, fmt.Errorf("decoder for %q returned nil, expected %v", typeName, elemType)
+		case decoded.Type() == elemType:
+			newSub.Elem().Set(decoded)
+		case decoded.Type() == newSub.Type() && !decoded.IsNil():
+			newSub = decoded
+		default:
+			return reflect.Value{}, fmt.Errorf("decoder for %q returned %T, expected %v", typeName, v, elemType)
+		}
+		if indexable, ok := newSub.Interface().(IndexSettable); ok {
+			indexable.SetIndex(index)
+		}
+	} else {
+		if o.defaultTags {
+			err := applyDefaultTags(newSub.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+		}
+
+		var err error
+		newSub, err = decodeElementInto(newSub, raw, index, o.useNumber)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	if o.extraFields {
+		err := captureExtra(newSub, raw, o)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	if o.elementKeys != nil {
+		if keySettable, ok := newSub.Interface().(KeySettable); ok {
+			keySettable.SetKey(o.elementKeys[index])
+		}
+	}
+	if o.elementIDs != nil {
+		if idSettable, ok := newSub.Interface().(IDSettable); ok {
+			id, err := ElementID(typeName, raw, index, *o.elementIDs)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			idSettable.SetElementID(id)
+		}
+	}
+	if defaulter, ok := o.defaulters[typeName]; ok {
+		defaulter(newSub.Interface())
+	}
+	return newSub, nil
+}
@@ -0,0 +1,42 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// applyDefaultTags sets every field of the struct v that has a `default` tag
+// to the value of the tag, including the fields of nested structs.
+func applyDefaultTags(v reflect.Value) error {
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		fieldValue := v.Field(i)
+
+		tag, ok := f.Tag.Lookup("default")
+		if !ok {
+			err := applyDefaultTags(fieldValue)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if fieldValue.Kind() == reflect.String {
+			fieldValue.SetString(tag)
+			continue
+		}
+		err := json.Unmarshal([]byte(tag), fieldValue.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("invalid default %q for field %s of %v: %w", tag, f.Name, t, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Retry struct {
+	Attempts int `json:"attempts"`
+	Backoff  int `json:"backoff" default:"100"`
+}
+
+type Job struct {
+	Name     string   `json:"name" default:"unnamed"`
+	Priority int      `json:"priority" default:"5"`
+	Enabled  bool     `json:"enabled" default:"true"`
+	Tags     []string `json:"tags" default:"[\"batch\"]"`
+	Retry    Retry    `json:"retry"`
+	Owner    string   `json:"owner"`
+}
+
+type Jobs struct {
+	Jobs []Job `poly:"job"`
+}
+
+func TestUnmarshalWithOptions_DefaultTags(t *testing.T) {
+	input := []byte(`[
+		{"type":"job"},
+		{"type":"job", "name":"nightly", "priority":0, "enabled":false, "tags":[], "retry":{"backoff":5}}
+	]`)
+
+	var result Jobs
+	err := UnmarshalWithOptions(input, &result, WithDefaultTags())
+	assert.NoError(t, err)
+	assert.Equal(t, []Job{
+		{Name: "unnamed", Priority: 5, Enabled: true, Tags: []string{"batch"}, Retry: Retry{Backoff: 100}},
+		{Name: "nightly", Priority: 0, Enabled: false, Tags: []string{}, Retry: Retry{Backoff: 5}},
+	}, result.Jobs)
+
+	// Without the option the tags are ignored.
+	result = Jobs{}
+	err = Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, Job{}, result.Jobs[0])
+}
+
+type BadDefault struct {
+	Count int `default:"many"`
+}
+
+func TestUnmarshalWithOptions_DefaultTagsInvalid(t *testing.T) {
+	var result struct {
+		Bad BadDefault `poly:"bad"`
+	}
+	err := UnmarshalWithOptions([]byte(`[{"type":"bad"}]`), &result, WithDefaultTags())
+	assert.ErrorContains(t, err, `invalid default "many" for field Count of poly.BadDefault`)
+}
+
+func TestUnmarshalWithOptions_Defaulter(t *testing.T) {
+	input := []byte(`[{"type":"job", "name":"nightly"}, {"type":"job", "name":"hourly", "owner":"ops"}]`)
+
+	var result Jobs
+	err := UnmarshalWithOptions(input, &result, WithDefaulter("job", func(v any) {
+		job := v.(*Job)
+		if job.Owner == "" {
+			job.Owner = "platform"
+		}
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "platform", result.Jobs[0].Owner)
+	assert.Equal(t, "ops", result.Jobs[1].Owner)
+}
@@ -0,0 +1,64 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Demux works like MarshalWithOptions, but rather than joining the flattened
+// elements into one array, it writes each of them to the writer routed for its
+// type name, for fanning a mixed batch out to per-type sinks, such as files or
+// topics, in a single pass. The writer routed for the empty type name is the
+// default, which receives the elements of the other types; without it, those
+// elements are left out.
+//
+// Each writer receives its elements as newline-delimited JSON, one element per
+// line, in the order of the elements. The elements are compacted to keep each
+// of them on its line, including raw elements. Several type names can be
+// routed to the same writer. The envelope and the manifest don't apply. An
+// error is returned if an element can't be encoded or written, and the
+// elements after it are not written.
+func Demux(obj any, routes map[string]io.Writer, opts ...Option) (err error) {
+	o := newOptions(opts)
+
+	var indexedObjects []indexedObject
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.Encoded(len(indexedObjects), err)
+		}()
+	}
+
+	indexedObjects, err = flattenObjects(obj, o)
+	if err != nil {
+		return err
+	}
+	indexedObjects = append(indexedObjects, syntheticObjects(obj, o)...)
+	encoded, err := encodeElements(indexedObjects, o)
+	if err != nil {
+		return err
+	}
+	var line bytes.Buffer
+	for i, e := range encoded {
+		typeName := indexedObjects[i].TypeName
+		w, ok := routes[typeName]
+		if !ok || w == nil {
+			w = routes[""]
+			if w == nil {
+				continue
+			}
+		}
+		line.Reset()
+		err = json.Compact(&line, e)
+		if err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+		_, err = w.Write(line.Bytes())
+		if err != nil {
+			return fmt.Errorf("writing element %d of type %q: %w", i, typeName, err)
+		}
+	}
+	return nil
+}
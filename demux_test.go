@@ -0,0 +1,40 @@
+package poly
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("topic closed")
+}
+
+func TestDemux(t *testing.T) {
+	residence := Residence{
+		Location: Location{Address: "123 Main St"},
+		People:   []Person{{Name: "John"}, {Name: "Jane"}},
+		Pets:     []Pet{{Name: "Fido", Species: "dog"}},
+	}
+
+	var people, others bytes.Buffer
+	err := Demux(residence, map[string]io.Writer{
+		"person": &people,
+		"":       &others,
+	}, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"type\":\"person\",\"name\":\"John\"}\n{\"type\":\"person\",\"name\":\"Jane\"}\n", people.String())
+	assert.Equal(t, "{\"type\":\"location\",\"address\":\"123 Main St\"}\n{\"type\":\"pet\",\"name\":\"Fido\",\"species\":\"dog\"}\n", others.String())
+
+	var pets bytes.Buffer
+	err = Demux(residence, map[string]io.Writer{"pet": &pets})
+	assert.NoError(t, err)
+	assert.Equal(t, "{\"name\":\"Fido\",\"species\":\"dog\"}\n", pets.String())
+
+	err = Demux(residence, map[string]io.Writer{"person": failingWriter{}})
+	assert.EqualError(t, err, `writing element 1 of type "person": topic closed`)
+}
@@ -0,0 +1,75 @@
+package poly
+
+import (
+	"reflect"
+	"sort"
+)
+
+// TargetField describes how the elements of one polymorphic type name map onto
+// a field of a target struct. It is returned by DescribeTarget for tools that
+// need to work with the mapping of a target, such as test data generators.
+type TargetField struct {
+	// TypeName is the polymorphic type name that maps to the field.
+	TypeName string
+	// FieldName is the name of the Go field in the target struct.
+	FieldName string
+	// Type is the type that each element is decoded into. For slice and
+	// pointer fields this is the underlying element type.
+	Type reflect.Type
+	// Slice is set if the field is a slice that collects every matching
+	// element. Otherwise the field holds at most one element.
+	Slice bool
+	// Pointer is set if the field holds pointers to the elements.
+	Pointer bool
+	// First is set if the elements must be first in the array.
+	First bool
+	// Last is set if the elements must be last in the array.
+	Last bool
+	// Aliases are the other type names that the elements are accepted under
+	// when unmarshalling.
+	Aliases []string
+}
+
+// DescribeTarget returns the description of each field of the target struct
+// that elements can be unmarshalled into, in the order the fields are
+// declared. The target may be a struct or a pointer to one. Of the options,
+// only WithTagKey and WithTagKeys apply.
+func DescribeTarget(target any, opts ...Option) ([]TargetField, error) {
+	targetType := reflect.TypeOf(target)
+	if targetType != nil && targetType.Kind() != reflect.Pointer {
+		target = reflect.New(targetType).Interface()
+	}
+	lookup, err := makeTargetFieldLookup(target, newOptions(opts).tagKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldLookups := sortedFieldLookups(lookup)
+	fields := make([]TargetField, len(fieldLookups))
+	for i, fl := range fieldLookups {
+		fields[i] = TargetField{
+			TypeName:  fl.name,
+			FieldName: fl.goName,
+			Type:      fl.fieldType,
+			Slice:     fl.slice,
+			Pointer:   fl.ptr,
+			First:     fl.first,
+			Last:      fl.last,
+			Aliases:   fl.aliases,
+		}
+	}
+	return fields, nil
+}
+
+// sortedFieldLookups returns the field lookups in the order the fields are
+// declared.
+func sortedFieldLookups(lookup map[string]fieldLookup) []fieldLookup {
+	fieldLookups := make([]fieldLookup, 0, len(lookup))
+	for _, fl := range lookup {
+		fieldLookups = append(fieldLookups, fl)
+	}
+	sort.Slice(fieldLookups, func(i, j int) bool {
+		return fieldLookups[i].index < fieldLookups[j].index
+	})
+	return fieldLookups
+}
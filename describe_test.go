@@ -0,0 +1,26 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func TestDescribeTarget(t *testing.T) {
+	fields, err := DescribeTarget(OrderedResidence{})
+	assert.NoError(t, err)
+	assert.Equal(t, []TargetField{
+		{TypeName: "location", FieldName: "Location", Type: reflect.TypeOf(Location{}), First: true},
+		{TypeName: "person", FieldName: "People", Type: reflect.TypeOf(Person{}), Slice: true},
+		{TypeName: "note", FieldName: "Notes", Type: reflect.TypeOf(Pet{}), Slice: true, Last: true},
+	}, fields)
+
+	fields, err = DescribeTarget(&Residence{})
+	assert.NoError(t, err)
+	assert.Equal(t, TargetField{TypeName: "water", FieldName: "Water", Type: reflect.TypeOf(WaterService{}), Pointer: true}, fields[3])
+
+	_, err = DescribeTarget("not a struct")
+	assert.Error(t, err)
+	_, err = DescribeTarget(nil)
+	assert.Error(t, err)
+}
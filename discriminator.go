@@ -0,0 +1,94 @@
+package poly
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Discriminator is a key of an element that holds a type name, along with the
+// type name it holds.
+type Discriminator struct {
+	Key   string
+	Value string
+}
+
+// DiscriminatorReporter is implemented by TypeLocators that read the type name
+// from one of several keys, such as the GenericTypeLocator, to report the
+// values of all of them. This lets unmarshalling handle elements whose keys
+// hold conflicting type names with WithDiscriminatorConflicts.
+type DiscriminatorReporter interface {
+	// Discriminators returns the keys that hold a non-empty type name, in the
+	// order of priority that TypeName uses.
+	Discriminators() []Discriminator
+}
+
+// Discriminators returns the keys of the receiver that hold a non-empty type
+// name, in the order of priority that TypeName uses.
+func (t *GenericTypeLocator) Discriminators() []Discriminator {
+	var found []Discriminator
+	for _, d := range []Discriminator{
+		{"type", t.Type},
+		{"@type", t.TypeAt},
+		{"Type", t.TypeCaps},
+		{"@Type", t.TypeAtCaps},
+	} {
+		if d.Value != "" {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// ErrConflictingDiscriminators is wrapped by the error returned by
+// RejectConflicts.
+var ErrConflictingDiscriminators = errors.New("conflicting discriminators")
+
+// RejectConflicts is a policy for WithDiscriminatorConflicts that fails the
+// unmarshalling of an element whose keys hold different type names.
+func RejectConflicts(found []Discriminator) (string, error) {
+	parts := make([]string, len(found))
+	for i, d := range found {
+		parts[i] = fmt.Sprintf("%q is %q", d.Key, d.Value)
+	}
+	return "", fmt.Errorf("%w: %s", ErrConflictingDiscriminators, strings.Join(parts, ", "))
+}
+
+// PreferKeys returns a policy for WithDiscriminatorConflicts that takes the
+// type name from the first of the keys that the element has, or from the key
+// of the highest priority if it has none of them.
+func PreferKeys(keys ...string) func(found []Discriminator) (string, error) {
+	return func(found []Discriminator) (string, error) {
+		for _, key := range keys {
+			for _, d := range found {
+				if d.Key == key {
+					return d.Value, nil
+				}
+			}
+		}
+		return found[0].Value, nil
+	}
+}
+
+// resolveConflicts returns the type name of the element at the index from the
+// keys found in it, which are in order of priority. The first one is used
+// unless there is a policy and the keys hold different type names, in which
+// case the policy decides.
+func resolveConflicts(index int, found []Discriminator, policy func(found []Discriminator) (string, error)) (string, error) {
+	if len(found) == 0 {
+		return "", nil
+	}
+	if policy == nil {
+		return found[0].Value, nil
+	}
+	for _, d := range found[1:] {
+		if d.Value != found[0].Value {
+			typeName, err := policy(found)
+			if err != nil {
+				return "", fmt.Errorf("element %d: %w", index, err)
+			}
+			return typeName, nil
+		}
+	}
+	return found[0].Value, nil
+}
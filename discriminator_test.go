@@ -0,0 +1,86 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithDiscriminatorConflicts(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "@type":"pet", "name":"John"},
+		{"type":"pet", "@type":"pet", "name":"Fido"}
+	]`)
+
+	// By default the first key wins.
+	var result Residence
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalWithOptions(input, &result, WithDiscriminatorConflicts(PreferKeys("@type")))
+	assert.NoError(t, err)
+	assert.Empty(t, result.People)
+	assert.Equal(t, []Pet{{Name: "John"}, {Name: "Fido"}}, result.Pets)
+
+	err = UnmarshalWithOptions(input, &Residence{}, WithDiscriminatorConflicts(RejectConflicts))
+	assert.ErrorIs(t, err, ErrConflictingDiscriminators)
+	assert.EqualError(t, err, `element 0: conflicting discriminators: "type" is "person", "@type" is "pet"`)
+
+	// Elements that agree aren't passed to the policy.
+	var calls [][]Discriminator
+	err = UnmarshalWithOptions(input, &Residence{}, WithDiscriminatorConflicts(func(found []Discriminator) (string, error) {
+		calls = append(calls, found)
+		return "pet", nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, [][]Discriminator{{{"type", "person"}, {"@type", "pet"}}}, calls)
+}
+
+func TestGenericTypeLocator_Precedence(t *testing.T) {
+	keys := DefaultTypeKeys()
+	for i := range keys {
+		// Each key takes precedence over the keys after it.
+		element := map[string]string{}
+		for j, key := range keys[i:] {
+			element[key] = []string{"first", "second", "third", "fourth"}[j]
+		}
+		raw, err := json.Marshal(element)
+		assert.NoError(t, err)
+
+		var locator GenericTypeLocator
+		assert.NoError(t, json.Unmarshal(raw, &locator))
+		assert.Equal(t, "first", locator.TypeName(), keys[i])
+		assert.Equal(t, keys[i], locator.Discriminators()[0].Key)
+	}
+
+	input := []byte(`[{"type":"person","@type":"pet","name":"John"}]`)
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithTypeKeys("@type", "type"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "John"}}, result.Pets)
+
+	err = UnmarshalWithOptions(input, &Residence{}, WithTypeKeys("@type", "type"), WithDiscriminatorConflicts(RejectConflicts))
+	assert.EqualError(t, err, `element 0: conflicting discriminators: "@type" is "pet", "type" is "person"`)
+}
+
+func TestWithDiscriminatorConflicts_Keys(t *testing.T) {
+	input := []byte(`[{"kind":"person", "type":"pet", "name":"John"}]`)
+	profile := Profile{DiscriminatorKey: "kind"}
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithProfile(profile), WithDiscriminatorConflicts(RejectConflicts))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+
+	resolve := keyResolver([]string{"kind", "type"}, nil, RejectConflicts)
+	_, err = resolve(3, input[1:len(input)-1])
+	assert.EqualError(t, err, `element 3: conflicting discriminators: "kind" is "person", "type" is "pet"`)
+
+	resolve = keyResolver([]string{"kind", "type"}, nil, PreferKeys("missing"))
+	typeName, err := resolve(3, input[1:len(input)-1])
+	assert.NoError(t, err)
+	assert.Equal(t, "person", typeName)
+}
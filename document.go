@@ -0,0 +1,257 @@
+package poly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Document keeps a decoded target of type T together with the raw JSON of each
+// of its elements, so that it can be marshalled again with the elements that
+// were not modified emitted byte for byte as they were read. This allows
+// tooling to edit documents in place without disturbing the formatting, key
+// order, or number representation of the parts it doesn't touch.
+//
+// Elements are identified by their position within their field, so appending
+// to a slice leaves the existing elements untouched, while removing or
+// reordering the elements of a slice makes the elements after the change count
+// as modified. A batch element, read into a field with the items tag option,
+// is emitted as it was only if none of its sub-objects were modified, and is
+// otherwise split into an element for each of them. Elements that were read
+// but not stored in the target, because no field matched them, or because a
+// later element replaced them, are emitted as they were, in their original
+// places.
+//
+// Example usage:
+//
+//	doc, err := poly.ParseDocument[Residence](data)
+//	doc.Value.People[1].Age++
+//	data, err = doc.Marshal()
+type Document[T any] struct {
+	// Value is the decoded target, which may be modified freely.
+	Value T
+
+	o        *options
+	elements []documentElement
+	// sliceLens is the number of elements decoded into each slice field,
+	// keyed by Go name, and scalars is the set of single element fields that
+	// were decoded into, so that new elements can be found.
+	sliceLens map[string]int
+	scalars   map[string]bool
+	// emit maps the type names of the fields tagged with the emit option to
+	// the type names that their elements are emitted with.
+	emit map[string]string
+}
+
+// documentElement is an element as it was read into a Document.
+type documentElement struct {
+	raw json.RawMessage
+	// parts are where the element was stored in the target, if it was. A
+	// batch element is stored as several parts, and any other as one.
+	parts []documentPart
+}
+
+// documentPart is a value stored in the target for an element of a Document.
+type documentPart struct {
+	ref ElementRef
+	// hash is the hash of the encoding of the value right after it was
+	// decoded.
+	hash [sha256.Size]byte
+}
+
+// ParseDocument unmarshals the raw JSON array into a new Document, accepting
+// the same options as UnmarshalWithOptions. The options are also used when the
+// modified elements are encoded by Marshal, so pass WithDiscriminator if the
+// element structs don't carry their type names. An error is returned if a field of T
+// is a container, implementing ContainerAppender, since its elements can't be
+// told apart once they are added to it.
+func ParseDocument[T any](rawJson []byte, opts ...Option) (*Document[T], error) {
+	doc := &Document[T]{
+		o:         newOptions(opts),
+		sliceLens: map[string]int{},
+		scalars:   map[string]bool{},
+	}
+
+	fields, err := makeTargetFieldLookup(&doc.Value, doc.o.tagKeys)
+	if err != nil {
+		return nil, err
+	}
+	for _, fl := range sortedFieldLookups(fields) {
+		if fl.container {
+			return nil, fmt.Errorf("field %s is a container, which Document doesn't support", fl.goName)
+		}
+	}
+	for typeName, fl := range fields {
+		if fl.emit != "" {
+			if doc.emit == nil {
+				doc.emit = map[string]string{}
+			}
+			doc.emit[typeName] = fl.emit
+		}
+	}
+
+	var order ElementOrder
+	o := *doc.o
+	o.orderSink = &order
+	src := &recordingSource{src: newArraySource(rawJson, doc.o.objectMode)}
+	err = unmarshalSource(src, &doc.Value, &o)
+	if err != nil {
+		return nil, err
+	}
+
+	doc.elements = make([]documentElement, len(src.elements))
+	for i, raw := range src.elements {
+		doc.elements[i].raw = raw
+	}
+	for _, ref := range order.OriginalOrder() {
+		e := &doc.elements[ref.ArrayIndex]
+		v, _ := doc.valueAt(ref)
+		encoded, err := encodeItem(doc.item(v, ref), ref.ArrayIndex, doc.o)
+		if err != nil {
+			return nil, err
+		}
+		e.parts = append(e.parts, documentPart{ref: ref, hash: sha256.Sum256(encoded)})
+		if ref.SliceIndex >= 0 {
+			doc.sliceLens[ref.Field] = ref.SliceIndex + 1
+		} else {
+			doc.scalars[ref.Field] = true
+		}
+	}
+	return doc, nil
+}
+
+// Marshal returns the JSON array for the current Value of the document. The
+// elements that are unchanged since they were read are emitted as they were,
+// the modified ones are encoded again in their original places, and elements
+// that were removed are left out. New elements, those appended to slices and
+// those in fields that were empty, are encoded after all the others, in the
+// order of the fields. The document is always emitted as an array, so an error
+// is returned if the options ask for the object form with ObjectKeyed.
+func (d *Document[T]) Marshal() ([]byte, error) {
+	if d.o.objectMode == ObjectKeyed {
+		return nil, fmt.Errorf("a Document can't be emitted as a keyed object")
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	written := 0
+	write := func(encoded []byte) {
+		if written > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(encoded)
+		written++
+	}
+
+	for _, e := range d.elements {
+		if len(e.parts) == 0 {
+			write(e.raw)
+			continue
+		}
+
+		// An element is emitted as it was only if all of its parts are
+		// unchanged, including their position if it is emitted with them.
+		// Otherwise the parts that remain are encoded as elements of their
+		// own, which splits up a modified batch.
+		unchanged := true
+		var items []indexedObject
+		for _, part := range e.parts {
+			v, ok := d.valueAt(part.ref)
+			if !ok {
+				unchanged = false
+				continue
+			}
+			item := d.item(v, part.ref)
+			encoded, err := encodeItem(item, written, d.o)
+			if err != nil {
+				return nil, err
+			}
+			if sha256.Sum256(encoded) != part.hash {
+				unchanged = false
+			}
+			items = append(items, item)
+		}
+		if unchanged {
+			write(e.raw)
+			continue
+		}
+		for _, item := range items {
+			encoded, err := encodeItem(item, written, d.o)
+			if err != nil {
+				return nil, err
+			}
+			write(encoded)
+		}
+	}
+
+	fields, err := makeTargetFieldLookup(&d.Value, d.o.tagKeys)
+	if err != nil {
+		return nil, err
+	}
+	err = applyFieldOverrides(fields, d.o.fieldOverrides)
+	if err != nil {
+		return nil, err
+	}
+	done := map[string]bool{}
+	for _, fl := range sortedFieldLookups(fields) {
+		if done[fl.goName] {
+			// Another type name maps to the same field.
+			continue
+		}
+		done[fl.goName] = true
+		field := reflect.ValueOf(&d.Value).Elem().Field(fl.index)
+		var added []reflect.Value
+		if fl.slice {
+			for i := d.sliceLens[fl.goName]; i < field.Len(); i++ {
+				added = append(added, field.Index(i))
+			}
+		} else if !d.scalars[fl.goName] && !field.IsZero() {
+			added = append(added, field)
+		}
+		for _, v := range added {
+			encoded, err := encodeItem(indexedObject{Value: v.Interface(), Field: fl.goName, TypeName: fl.name, Emit: fl.emit}, written, d.o)
+			if err != nil {
+				return nil, err
+			}
+			write(encoded)
+		}
+	}
+
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// valueAt returns the current value of the element at ref, or false if it no
+// longer exists.
+func (d *Document[T]) valueAt(ref ElementRef) (reflect.Value, bool) {
+	field := reflect.ValueOf(&d.Value).Elem().FieldByName(ref.Field)
+	if ref.SliceIndex < 0 {
+		return field, !field.IsZero()
+	}
+	if ref.SliceIndex >= field.Len() {
+		return reflect.Value{}, false
+	}
+	return field.Index(ref.SliceIndex), true
+}
+
+// item returns the flattened element for the value of the element at ref.
+func (d *Document[T]) item(v reflect.Value, ref ElementRef) indexedObject {
+	return indexedObject{Value: v.Interface(), Field: ref.Field, TypeName: ref.TypeName, Emit: d.emit[ref.TypeName]}
+}
+
+// recordingSource is an ElementSource that keeps the raw JSON of every element
+// read from the source it wraps.
+type recordingSource struct {
+	src      ElementSource
+	elements []json.RawMessage
+}
+
+// Next returns the next element of the wrapped source, recording it.
+func (r *recordingSource) Next() (SourceElement, error) {
+	e, err := r.src.Next()
+	if err == nil {
+		r.elements = append(r.elements, e.Raw)
+	}
+	return e, err
+}
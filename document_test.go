@@ -0,0 +1,84 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const documentInput = `[
+	{"type": "location", "address": "123 Main St"},
+	{"type":"person","name":"John",   "age":  30},
+	{"type": "starship", "name": "Enterprise"},
+	{"type":"person","name":"Jane"}
+]`
+
+func TestDocument_Unmodified(t *testing.T) {
+	doc, err := ParseDocument[Residence]([]byte(documentInput), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John", Age: 30}, {Name: "Jane"}}, doc.Value.People)
+
+	bytes, err := doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type": "location", "address": "123 Main St"},{"type":"person","name":"John",   "age":  30},{"type": "starship", "name": "Enterprise"},{"type":"person","name":"Jane"}]`, string(bytes))
+}
+
+func TestDocument_Modified(t *testing.T) {
+	doc, err := ParseDocument[Residence]([]byte(documentInput), WithDiscriminator("type"))
+	assert.NoError(t, err)
+
+	doc.Value.People[1].Age = 25
+	doc.Value.Pets = append(doc.Value.Pets, Pet{Name: "Fido"})
+	doc.Value.Water = &WaterService{Provider: "City"}
+
+	bytes, err := doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type": "location", "address": "123 Main St"},{"type":"person","name":"John",   "age":  30},{"type": "starship", "name": "Enterprise"},{"type":"person","name":"Jane","age":25},{"type":"pet","name":"Fido"},{"type":"water","provider":"City"}]`, string(bytes))
+
+	// Removing an element leaves it out.
+	doc.Value.People = doc.Value.People[:1]
+	doc.Value.Location = Location{}
+	bytes, err = doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"person","name":"John",   "age":  30},{"type": "starship", "name": "Enterprise"},{"type":"pet","name":"Fido"},{"type":"water","provider":"City"}]`, string(bytes))
+}
+
+func TestDocument_Provenance(t *testing.T) {
+	input := `[{"_idx":0, "_type":"person", "value":{"name":"John"}},{"_idx":1, "_type":"pet", "value":{"name":"Fido"}}]`
+	doc, err := ParseDocument[Residence]([]byte(input), WithProvenance(ProvenanceKeys{}))
+	assert.NoError(t, err)
+
+	bytes, err := doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, input, string(bytes))
+
+	// The elements after a removed one are emitted at their new positions.
+	doc.Value.People = nil
+	doc.Value.Pets = append(doc.Value.Pets, Pet{Name: "Rex"})
+	bytes, err = doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"_idx":0,"_type":"pet","value":{"name":"Fido"}},{"_idx":1,"_type":"pet","value":{"name":"Rex"}}]`, string(bytes))
+}
+
+func TestDocument_Error(t *testing.T) {
+	_, err := ParseDocument[Residence]([]byte(`{}`))
+	assert.Error(t, err)
+
+	_, err = ParseDocument[ContainerResidence]([]byte(`[{"type":"pet","name":"Fido"}]`))
+	assert.EqualError(t, err, "field People is a container, which Document doesn't support")
+}
+
+func TestDocument_Batches(t *testing.T) {
+	input := `[{"type":"person", "items":[{"name":"John"}, {"name":"Jane"}]},{"type":"pet","name":"Fido"}]`
+	doc, err := ParseDocument[Batches]([]byte(input), WithDiscriminator("type"))
+	assert.NoError(t, err)
+
+	bytes, err := doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, input, string(bytes))
+
+	// A modified batch is split up.
+	doc.Value.People[1].Age = 25
+	bytes, err = doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"person","name":"John"},{"type":"person","name":"Jane","age":25},{"type":"pet","name":"Fido"}]`, string(bytes))
+}
@@ -0,0 +1,64 @@
+package poly
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// duckCandidate is a target field that elements without a type name can be
+// matched to by their keys.
+type duckCandidate struct {
+	typeName string
+	keys     map[string]bool
+}
+
+// duckCandidates returns the target fields whose elements are decoded into
+// structs, along with the JSON keys of the structs, in the order of their type
+// names.
+func duckCandidates(targetFields map[string]fieldLookup) []duckCandidate {
+	var candidates []duckCandidate
+	for _, fl := range sortedFieldLookups(targetFields) {
+		keys := knownKeys(fl.fieldType)
+		if fl.raw || len(keys) == 0 {
+			continue
+		}
+		candidates = append(candidates, duckCandidate{typeName: fl.name, keys: keys})
+	}
+	return candidates
+}
+
+// duckResolver wraps a resolver to find the type name of the elements that it
+// finds none for by the keys that they hold, as described for WithDuckTyping.
+func duckResolver(candidates []duckCandidate, resolve resolver) resolver {
+	return func(index int, raw json.RawMessage) (string, error) {
+		typeName, err := resolve(index, raw)
+		if err != nil || typeName != "" {
+			return typeName, err
+		}
+		var object map[string]json.RawMessage
+		if json.Unmarshal(raw, &object) != nil {
+			return "", nil
+		}
+		best, bestMatched, bestMissing, tied := "", 0, 0, false
+		for _, c := range candidates {
+			matched := 0
+			for key := range object {
+				if c.keys[strings.ToLower(key)] {
+					matched++
+				}
+			}
+			missing := len(c.keys) - matched
+			switch {
+			case matched == 0:
+			case matched > bestMatched || (matched == bestMatched && missing < bestMissing):
+				best, bestMatched, bestMissing, tied = c.typeName, matched, missing, false
+			case matched == bestMatched && missing == bestMissing:
+				tied = true
+			}
+		}
+		if tied {
+			return "", nil
+		}
+		return best, nil
+	}
+}
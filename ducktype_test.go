@@ -0,0 +1,46 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnmarshal_DuckTyping(t *testing.T) {
+	in := []byte(`[
+		{"name":"John","occupation":"developer"},
+		{"name":"Fido","species":"dog"},
+		{"Address":"123 Main St"},
+		{"name":"Rex"},
+		{"color":"red"},
+		{"type":"person","name":"Juan"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(in, &result, WithDuckTyping())
+	assert.NoError(t, err)
+	assert.Equal(t, Residence{
+		Location: Location{Address: "123 Main St"},
+		People:   []Person{{Name: "John", Occupation: "developer"}, {Name: "Juan"}},
+		// Pet has fewer other keys than Person.
+		Pets: []Pet{{Name: "Fido", Species: "dog"}, {Name: "Rex"}},
+	}, result)
+
+	// Without the option, only the element with a type name is decoded.
+	result = Residence{}
+	err = Unmarshal(in, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, Residence{People: []Person{{Name: "Juan"}}}, result)
+}
+
+type TwinKennel struct {
+	Dogs []Pet `poly:"dog"`
+	Cats []Pet `poly:"cat"`
+}
+
+func TestUnmarshal_DuckTypingTie(t *testing.T) {
+	var result TwinKennel
+	err := UnmarshalWithOptions([]byte(`[{"name":"Fido"},{"type":"cat","name":"Tom"}]`), &result, WithDuckTyping())
+	assert.NoError(t, err)
+	assert.Empty(t, result.Dogs)
+	assert.Equal(t, []Pet{{Name: "Tom"}}, result.Cats)
+}
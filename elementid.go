@@ -0,0 +1,53 @@
+package poly
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+)
+
+// IDSettable can be implemented by element types to receive a stable ID for
+// each element when unmarshalling with WithElementIDs, for deduplication and
+// merge logic downstream when the producers don't give the elements IDs of
+// their own.
+type IDSettable interface {
+	// SetElementID is called with the ID of the element after it is
+	// unmarshalled.
+	SetElementID(id string)
+}
+
+// IDPolicy selects what the IDs of WithElementIDs are computed from.
+type IDPolicy int
+
+const (
+	// IDByContent computes the ID from the type name and the content of the
+	// element, so identical elements have the same ID wherever they are in
+	// the array, and in whichever payload.
+	IDByContent IDPolicy = iota
+	// IDByPosition computes the ID from the position of the element as well,
+	// so identical elements at different positions have different IDs.
+	IDByPosition
+)
+
+// ElementID returns the ID that WithElementIDs gives the element with the
+// raw JSON, type name, and index, for computing the same IDs for elements that
+// aren't unmarshalled into structs, such as those given to an ElementSink. The
+// ID is the hex-encoded SHA-256 hash of the type name, the canonical encoding
+// of the element, as with Hashes, and the index if the policy is IDByPosition.
+// An error is returned if the raw JSON isn't valid.
+func ElementID(typeName string, raw json.RawMessage, index int, policy IDPolicy) (string, error) {
+	canonical, err := canonicalJSON(raw)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	// The type name is quoted so that it can't run into the content.
+	h.Write(strconv.AppendQuote(nil, typeName))
+	h.Write(canonical)
+	if policy == IDByPosition {
+		h.Write([]byte{'@'})
+		h.Write(strconv.AppendInt(nil, int64(index), 10))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
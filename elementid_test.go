@@ -0,0 +1,58 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Measurement struct {
+	Sensor string  `json:"sensor"`
+	Value  float64 `json:"value"`
+	ID     string  `json:"-"`
+}
+
+func (m *Measurement) SetElementID(id string) {
+	m.ID = id
+}
+
+type Measurements struct {
+	Measurements []Measurement `poly:"reading"`
+	Pets         []Pet         `poly:"pet"`
+}
+
+func TestUnmarshalWithOptions_ElementIDs(t *testing.T) {
+	in := []byte(`[
+		{"type":"reading","sensor":"a","value":1},
+		{"type":"pet","name":"Fido"},
+		{"value":1, "type":"reading", "sensor":"a"},
+		{"type":"reading","sensor":"b","value":1}
+	]`)
+
+	var result Measurements
+	err := UnmarshalWithOptions(in, &result, WithElementIDs(IDByContent))
+	assert.NoError(t, err)
+	ids := []string{result.Measurements[0].ID, result.Measurements[1].ID, result.Measurements[2].ID}
+	assert.Len(t, ids[0], 64)
+	assert.Equal(t, ids[0], ids[1])
+	assert.NotEqual(t, ids[0], ids[2])
+
+	id, err := ElementID("reading", []byte(`{"sensor":"a","value":1,"type":"reading"}`), 7, IDByContent)
+	assert.NoError(t, err)
+	assert.Equal(t, ids[0], id)
+	id, err = ElementID("sensor", []byte(`{"sensor":"a","value":1,"type":"reading"}`), 7, IDByContent)
+	assert.NoError(t, err)
+	assert.NotEqual(t, ids[0], id)
+
+	result = Measurements{}
+	err = UnmarshalWithOptions(in, &result, WithElementIDs(IDByPosition))
+	assert.NoError(t, err)
+	assert.NotEqual(t, result.Measurements[0].ID, result.Measurements[1].ID)
+	id, err = ElementID("reading", []byte(`{"type":"reading","sensor":"a","value":1}`), 2, IDByPosition)
+	assert.NoError(t, err)
+	assert.Equal(t, result.Measurements[1].ID, id)
+
+	result = Measurements{}
+	err = Unmarshal(in, &result)
+	assert.NoError(t, err)
+	assert.Empty(t, result.Measurements[0].ID)
+}
@@ -0,0 +1,86 @@
+package poly
+
+import (
+	"reflect"
+)
+
+// ElementRef identifies where a decoded element was stored in the target.
+type ElementRef struct {
+	// Field is the name of the Go field of the target holding the element.
+	Field string
+	// SliceIndex is the position of the element in the slice field, or -1
+	// if the field holds a single element.
+	SliceIndex int
+	// ArrayIndex is the position of the element in the JSON array.
+	ArrayIndex int
+	// TypeName is the polymorphic type name of the element.
+	TypeName string
+}
+
+// OrderSettable can be implemented by a target to be told the original order
+// of the elements that were decoded into it, across all of its fields. After
+// unmarshalling, SetOriginalOrder is called with a reference to every element
+// stored in the target, in the order the elements appeared in the JSON array.
+// Elements that were later replaced by another element of the same type in a
+// field that holds a single element, or that were dropped as duplicates, are
+// not included.
+//
+// This saves consumers that need the document order from having to implement
+// IndexSettable on every element type. Embedding ElementOrder in the target is
+// the easiest way to implement it.
+type OrderSettable interface {
+	SetOriginalOrder(order []ElementRef)
+}
+
+// ElementOrder implements OrderSettable by keeping the original order of the
+// elements. Embed it in a target struct to make the order available through
+// OriginalOrder after unmarshalling. Fields of this type are never treated as
+// holding elements, neither when unmarshalling nor when marshalling.
+//
+// Example usage:
+//
+//	type Result struct {
+//	    poly.ElementOrder
+//	    Dogs []Dog `poly:"dog"`
+//	    Cats []Cat `poly:"cat"`
+//	}
+//
+//	for _, ref := range result.OriginalOrder() { ... }
+type ElementOrder struct {
+	order []ElementRef
+}
+
+var elementOrderType = reflect.TypeOf(ElementOrder{})
+
+// SetOriginalOrder records the original order of the elements.
+func (e *ElementOrder) SetOriginalOrder(order []ElementRef) {
+	e.order = order
+}
+
+// OriginalOrder returns the references to the elements in the order they
+// appeared in the JSON array.
+func (e *ElementOrder) OriginalOrder() []ElementRef {
+	return e.order
+}
+
+// recordOrder adds the reference to an element that was just stored in the
+// field to the original order. An earlier element of a field that holds a
+// single element was replaced by this one, so its reference is removed. The
+// elements of containers have no position in the field to refer to.
+func (d *decoder) recordOrder(fl fieldLookup, field reflect.Value, index int) {
+	ref := ElementRef{Field: fl.goName, SliceIndex: -1, ArrayIndex: index, TypeName: fl.name}
+	if fl.slice {
+		ref.SliceIndex = field.Len() - 1
+	} else if previous, ok := d.scalarRefs[fl.goName]; ok {
+		d.order = append(d.order[:previous], d.order[previous+1:]...)
+		for goName, i := range d.scalarRefs {
+			if i > previous {
+				d.scalarRefs[goName] = i - 1
+			}
+		}
+	}
+	if !fl.slice && !fl.container {
+		d.scalarRefs[fl.goName] = len(d.order)
+	}
+	d.order = append(d.order, ref)
+}
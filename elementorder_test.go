@@ -0,0 +1,56 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type OrderedHousehold struct {
+	ElementOrder
+	Location Location `poly:"location"`
+	People   []Person `poly:"person"`
+	Pets     []*Pet   `poly:"pet"`
+}
+
+func TestUnmarshal_OriginalOrder(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"location", "address":"Old St"},
+		{"type":"pet", "name":"Fido"},
+		{"type":"unknown"},
+		{"type":"person", "name":"Jane"},
+		{"type":"location", "address":"123 Main St"}
+	]`)
+
+	var result OrderedHousehold
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []ElementRef{
+		{Field: "People", SliceIndex: 0, ArrayIndex: 0, TypeName: "person"},
+		{Field: "Pets", SliceIndex: 0, ArrayIndex: 2, TypeName: "pet"},
+		{Field: "People", SliceIndex: 1, ArrayIndex: 4, TypeName: "person"},
+		{Field: "Location", SliceIndex: -1, ArrayIndex: 5, TypeName: "location"},
+	}, result.OriginalOrder())
+
+	// The order is not an element when marshalling.
+	bytes, err := Marshal(result)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"address":"123 Main St"},{"name":"John"},{"name":"Jane"},{"name":"Fido"}]`, string(bytes))
+
+	fields, err := DescribeTarget(result)
+	assert.NoError(t, err)
+	assert.Len(t, fields, 3)
+}
+
+func TestUnmarshal_OriginalOrderDedupe(t *testing.T) {
+	var result struct {
+		ElementOrder
+		Contacts []Contact `poly:"contact,dedupe=ID"`
+	}
+	err := Unmarshal([]byte(`[{"type":"contact","id":1},{"type":"contact","id":1},{"type":"contact","id":2}]`), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []ElementRef{
+		{Field: "Contacts", SliceIndex: 0, ArrayIndex: 0, TypeName: "contact"},
+		{Field: "Contacts", SliceIndex: 1, ArrayIndex: 2, TypeName: "contact"},
+	}, result.OriginalOrder())
+}
@@ -0,0 +1,54 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// envelope is the object that the flattened array is wrapped in when
+// marshalling with WithEnvelope.
+type envelope struct {
+	meta     any
+	itemsKey string
+}
+
+// wrap returns the JSON of the envelope, which is the encoding of the metadata
+// with the items added under the items key, after the keys of the metadata.
+func (e *envelope) wrap(items []byte) ([]byte, error) {
+	var object map[string]json.RawMessage
+	var encoded []byte
+	if e.meta != nil {
+		var err error
+		encoded, err = json.Marshal(e.meta)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(encoded, &object)
+		if err != nil {
+			return nil, fmt.Errorf("envelope metadata of type %T is not a JSON object", e.meta)
+		}
+	}
+	if _, ok := object[e.itemsKey]; ok {
+		return nil, fmt.Errorf("envelope metadata already has the key %q", e.itemsKey)
+	}
+
+	keyJson, err := json.Marshal(e.itemsKey)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if len(object) > 0 {
+		// Keep the metadata as it was encoded, dropping the closing brace.
+		encoded = bytes.TrimSpace(encoded)
+		buf.Write(encoded[:len(encoded)-1])
+		buf.WriteByte(',')
+	} else {
+		buf.WriteByte('{')
+	}
+	buf.Write(keyJson)
+	buf.WriteByte(':')
+	buf.Write(items)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
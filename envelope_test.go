@@ -0,0 +1,36 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMarshalWithOptions_Envelope(t *testing.T) {
+	input := Residence{People: []Person{{Name: "John"}}}
+	meta := struct {
+		Version     int    `json:"version"`
+		GeneratedAt string `json:"generated_at"`
+	}{1, "2024-01-02T15:04:05Z"}
+
+	result, err := MarshalWithOptions(input, WithEnvelope(meta, "items"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":1,"generated_at":"2024-01-02T15:04:05Z","items":[{"name":"John"}]}`, string(result))
+
+	result, err = MarshalWithOptions(Residence{}, WithEnvelope(map[string]any{}, "items"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"items":[]}`, string(result))
+
+	result, err = MarshalWithOptions(input, WithEnvelope(nil, "data"), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data":[{"type":"person","name":"John"}]}`, string(result))
+}
+
+func TestMarshalWithOptions_EnvelopeErrors(t *testing.T) {
+	input := Residence{People: []Person{{Name: "John"}}}
+
+	_, err := MarshalWithOptions(input, WithEnvelope([]int{1}, "items"))
+	assert.EqualError(t, err, "envelope metadata of type []int is not a JSON object")
+
+	_, err = MarshalWithOptions(input, WithEnvelope(map[string]int{"items": 1}, "items"))
+	assert.EqualError(t, err, `envelope metadata already has the key "items"`)
+}
@@ -0,0 +1,54 @@
+package poly
+
+import (
+	"encoding/json"
+)
+
+// ExternalResolver provides the type names of elements from information that
+// is outside of the elements themselves, such as HTTP headers, the parts of a
+// multipart message, or a sidecar manifest. This allows hybrid protocols in
+// which only some of the type information is in band to be decoded in a single
+// pass. The implementation holds whatever context it needs, and is given to
+// the unmarshalling with the WithExternalResolver option.
+type ExternalResolver interface {
+	// ResolveType returns the type name of the element at the given index in
+	// the array or source. An empty type name falls back to resolving the type
+	// from the element itself with the type locator. An error stops the
+	// unmarshalling, and is returned from it.
+	ResolveType(index int) (string, error)
+}
+
+// ExternalResolverFunc adapts a function to the ExternalResolver interface.
+type ExternalResolverFunc func(index int) (string, error)
+
+// ResolveType calls the function.
+func (f ExternalResolverFunc) ResolveType(index int) (string, error) {
+	return f(index)
+}
+
+// ManifestResolver is an ExternalResolver that takes the type names from a
+// manifest listing the type name of each element in order, such as one sent
+// in a header alongside the array. Elements beyond the end of the manifest,
+// and those with an empty type name in it, are resolved in band.
+type ManifestResolver []string
+
+// ResolveType returns the type name of the element at the index from the
+// manifest.
+func (m ManifestResolver) ResolveType(index int) (string, error) {
+	if index < len(m) {
+		return m[index], nil
+	}
+	return "", nil
+}
+
+// externalResolver returns a resolver that asks the ExternalResolver first and
+// falls back on resolve.
+func externalResolver(external ExternalResolver, resolve resolver) resolver {
+	return func(index int, raw json.RawMessage) (string, error) {
+		typeName, err := external.ResolveType(index)
+		if err != nil || typeName != "" {
+			return typeName, err
+		}
+		return resolve(index, raw)
+	}
+}
@@ -0,0 +1,34 @@
+package poly
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnmarshalWithOptions_ExternalResolver(t *testing.T) {
+	// The first two parts have their types in the headers, the last one in
+	// band.
+	input := []byte(`[{"address":"123 Main St"}, {"name":"John"}, {"type":"pet", "name":"Fido"}]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithExternalResolver(ManifestResolver{"location", "person"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "123 Main St", result.Location.Address)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+}
+
+func TestUnmarshalWithOptions_ExternalResolverFunc(t *testing.T) {
+	input := []byte(`[{"type":"person", "name":"John"}, {"name":"Jane"}]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithExternalResolver(ExternalResolverFunc(func(index int) (string, error) {
+		if index == 1 {
+			return "", errors.New("missing part header")
+		}
+		return "", nil
+	})))
+	assert.EqualError(t, err, "missing part header")
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+}
@@ -0,0 +1,203 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// extraFieldsType is the type of the fields tagged with `polyextra:"true"`.
+var extraFieldsType = reflect.TypeOf(map[string]json.RawMessage{})
+
+// extraField finds the field of the element struct type that is tagged with
+// `polyextra:"true"` as receiving the keys of the element that the struct
+// doesn't know, and returns its index. A nil index is returned if there is no
+// such field.
+func extraField(t reflect.Type) ([]int, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("polyextra") != "true" {
+			continue
+		}
+		if f.Type != extraFieldsType {
+			return nil, fmt.Errorf("polyextra field %s of %v must be a map[string]json.RawMessage", f.Name, t)
+		}
+		if f.Tag.Get("json") != "-" {
+			return nil, fmt.Errorf("polyextra field %s of %v must be tagged `json:\"-\"`", f.Name, t)
+		}
+		return f.Index, nil
+	}
+	return nil, nil
+}
+
+// knownKeys returns the JSON keys of the fields of the struct type, including
+// those of embedded structs, in lower case since encoding/json matches the
+// keys without regard to case.
+func knownKeys(t reflect.Type) map[string]bool {
+	keys := map[string]bool{}
+	for key := range jsonFields(t) {
+		keys[key] = true
+	}
+	return keys
+}
+
+// jsonField is a field of a struct type as encoding/json sees it.
+type jsonField struct {
+	// fieldType is the type of the field.
+	fieldType reflect.Type
+	// quoted is set if the field is tagged with the string option, so that
+	// its value is encoded within a JSON string.
+	quoted bool
+}
+
+// jsonFields returns the fields of the struct type by their JSON keys,
+// including those of embedded structs, in lower case since encoding/json
+// matches the keys without regard to case. The fields of the struct take
+// precedence over the ones of the structs it embeds. There are none if the
+// type isn't a struct.
+func jsonFields(t reflect.Type) map[string]jsonField {
+	fields := map[string]jsonField{}
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for key, field := range jsonFields(ft) {
+					if _, ok := fields[key]; !ok {
+						fields[key] = field
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		field := jsonField{fieldType: f.Type}
+		for _, opt := range strings.Split(opts, ",") {
+			if opt == "string" {
+				field.quoted = true
+			}
+		}
+		fields[strings.ToLower(name)] = field
+	}
+	return fields
+}
+
+// locatorKeys returns the keys that the type names of the elements are read
+// from, as far as they are known, since they aren't extra fields of the
+// elements.
+func locatorKeys(o *options) []string {
+	switch {
+	case o.typeResolver != nil:
+		return nil
+	case len(o.typeKeys) > 0:
+		return o.typeKeys
+	case o.typeLocator == nil:
+		return nil
+	}
+	var keys []string
+	for key := range knownKeys(o.typeLocator) {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// captureExtra stores the keys of the raw element that the element struct
+// newSub points to doesn't know in its polyextra field, if it has one. The keys
+// of the type names are left out.
+func captureExtra(newSub reflect.Value, raw json.RawMessage, o *options) error {
+	elem := newSub.Elem()
+	index, err := extraField(elem.Type())
+	if err != nil || index == nil {
+		return err
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal(raw, &object) != nil {
+		return nil
+	}
+	known := knownKeys(elem.Type())
+	for _, key := range locatorKeys(o) {
+		known[strings.ToLower(key)] = true
+	}
+	extra := map[string]json.RawMessage{}
+	for key, value := range object {
+		if !known[strings.ToLower(key)] {
+			extra[key] = value
+		}
+	}
+	if len(extra) > 0 {
+		elem.FieldByIndex(index).Set(reflect.ValueOf(extra))
+	}
+	return nil
+}
+
+// mergeExtra adds the keys held by the polyextra field of the element, if it
+// has one, to its encoding. Keys that the encoding already has are kept as
+// they are.
+func mergeExtra(encoded []byte, value any) ([]byte, error) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if !v.IsValid() {
+		return encoded, nil
+	}
+	index, err := extraField(v.Type())
+	if err != nil || index == nil {
+		return encoded, err
+	}
+	extra := v.FieldByIndex(index).Interface().(map[string]json.RawMessage)
+	if len(extra) == 0 {
+		return encoded, nil
+	}
+	var object map[string]json.RawMessage
+	err = json.Unmarshal(encoded, &object)
+	if err != nil || object == nil {
+		return encoded, err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(bytes.TrimSuffix(bytes.TrimSpace(encoded), []byte("}")))
+	needComma := len(object) > 0
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := object[key]; ok {
+			continue
+		}
+		if needComma {
+			buf.WriteByte(',')
+		}
+		needComma = true
+		keyJson, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(keyJson)
+		buf.WriteByte(':')
+		buf.Write(extra[key])
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,75 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type ExtendedPet struct {
+	Name  string                     `json:"name"`
+	Extra map[string]json.RawMessage `json:"-" polyextra:"true"`
+}
+
+type ExtendedHousehold struct {
+	Pets []ExtendedPet `poly:"pet"`
+}
+
+func TestWithExtraFields(t *testing.T) {
+	input := []byte(`[
+		{"type":"pet", "Name":"Fido", "x-vendor":{"chip":123}, "color":"brown"},
+		{"type":"pet", "name":"Rex"}
+	]`)
+
+	var result ExtendedHousehold
+	err := UnmarshalWithOptions(input, &result, WithExtraFields())
+	assert.NoError(t, err)
+	assert.Equal(t, []ExtendedPet{
+		{Name: "Fido", Extra: map[string]json.RawMessage{
+			"x-vendor": json.RawMessage(`{"chip":123}`),
+			"color":    json.RawMessage(`"brown"`),
+		}},
+		{Name: "Rex"},
+	}, result.Pets)
+
+	bytes, err := MarshalWithOptions(result, WithExtraFields(), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"pet","name":"Fido","color":"brown","x-vendor":{"chip":123}},{"type":"pet","name":"Rex"}]`, string(bytes))
+
+	// Without the option, the extra keys are neither captured nor emitted.
+	var plain ExtendedHousehold
+	err = Unmarshal(input, &plain)
+	assert.NoError(t, err)
+	assert.Nil(t, plain.Pets[0].Extra)
+	bytes, err = Marshal(result)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"name":"Fido"},{"name":"Rex"}]`, string(bytes))
+}
+
+func TestWithExtraFields_TypeKeys(t *testing.T) {
+	var result ExtendedHousehold
+	err := UnmarshalWithOptions([]byte(`[{"kind":"pet", "name":"Fido", "type":"dog"}]`), &result, WithExtraFields(), WithProfile(Profile{DiscriminatorKey: "kind"}))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]json.RawMessage{"type": json.RawMessage(`"dog"`)}, result.Pets[0].Extra)
+}
+
+func TestWithExtraFields_Errors(t *testing.T) {
+	type untagged struct {
+		Extra map[string]json.RawMessage `polyextra:"true"`
+	}
+	type mistyped struct {
+		Extra map[string]any `json:"-" polyextra:"true"`
+	}
+
+	var withUntagged struct {
+		Pets []untagged `poly:"pet"`
+	}
+	err := UnmarshalWithOptions([]byte(`[{"type":"pet"}]`), &withUntagged, WithExtraFields())
+	assert.EqualError(t, err, "polyextra field Extra of poly.untagged must be tagged `json:\"-\"`")
+
+	var withMistyped struct {
+		Pets []mistyped `poly:"pet"`
+	}
+	err = UnmarshalWithOptions([]byte(`[{"type":"pet"}]`), &withMistyped, WithExtraFields())
+	assert.EqualError(t, err, "polyextra field Extra of poly.mistyped must be a map[string]json.RawMessage")
+}
@@ -0,0 +1,93 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// parsePet is a hand-written parser for pets, which are encoded in the legacy
+// layout {"type":"pet","v":"name/species"}.
+func parsePet(raw json.RawMessage) (any, error) {
+	var legacy struct {
+		V string `json:"v"`
+	}
+	err := json.Unmarshal(raw, &legacy)
+	if err != nil {
+		return nil, err
+	}
+	name, species, _ := bytes.Cut([]byte(legacy.V), []byte("/"))
+	return Pet{Name: string(name), Species: string(species)}, nil
+}
+
+func TestUnmarshalWithOptions_FieldDecoder(t *testing.T) {
+	input := []byte(`[{"type":"person","name":"John"},{"type":"pet","v":"Fido/dog"},{"type":"water","provider":"City"}]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result,
+		WithFieldDecoder("pet", parsePet),
+		WithFieldDecoder("water", func(raw json.RawMessage) (any, error) {
+			return &WaterService{Provider: "Well"}, nil
+		}),
+		WithBatchAllocation())
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido", Species: "dog"}}, result.Pets)
+	assert.Equal(t, &WaterService{Provider: "Well"}, result.Water)
+}
+
+func TestUnmarshalWithOptions_FieldDecoderErrors(t *testing.T) {
+	input := []byte(`[{"type":"pet"}]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithFieldDecoder("pet", func(raw json.RawMessage) (any, error) {
+		return nil, errors.New("bad pet")
+	}))
+	assert.EqualError(t, err, "bad pet")
+
+	err = UnmarshalWithOptions(input, &result, WithFieldDecoder("pet", func(raw json.RawMessage) (any, error) {
+		return Person{}, nil
+	}))
+	assert.EqualError(t, err, `decoder for "pet" returned poly.Person, expected poly.Pet`)
+
+	err = UnmarshalWithOptions(input, &result, WithFieldDecoder("pet", func(raw json.RawMessage) (any, error) {
+		return nil, nil
+	}))
+	assert.EqualError(t, err, `decoder for "pet" returned nil, expected poly.Pet`)
+}
+
+func TestMarshalWithOptions_FieldEncoder(t *testing.T) {
+	input := Residence{
+		People: []Person{{Name: "John", Age: 30}},
+		Pets:   []Pet{{Name: "Fido", Species: "dog"}},
+	}
+
+	var seen []any
+	result, err := MarshalWithOptions(input,
+		WithDiscriminator("type"),
+		WithFieldEncoder("pet", func(v any) (json.RawMessage, error) {
+			seen = append(seen, v)
+			pet := v.(Pet)
+			return json.RawMessage(`{"v": "` + pet.Name + "/" + pet.Species + `"}`), nil
+		}),
+		WithRawCompact())
+	assert.NoError(t, err)
+	assert.Equal(t, []any{Pet{Name: "Fido", Species: "dog"}}, seen)
+	assert.JSONEq(t, `[{"type":"person","name":"John","age":30},{"type":"pet","v":"Fido/dog"}]`, string(result))
+}
+
+func TestMarshalWithOptions_FieldEncoderErrors(t *testing.T) {
+	input := Residence{Pets: []Pet{{Name: "Fido"}}}
+
+	_, err := MarshalWithOptions(input, WithFieldEncoder("pet", func(v any) (json.RawMessage, error) {
+		return nil, errors.New("bad pet")
+	}))
+	assert.EqualError(t, err, "bad pet")
+
+	_, err = MarshalWithOptions(input, WithFieldEncoder("pet", func(v any) (json.RawMessage, error) {
+		return json.RawMessage(`{"v":`), nil
+	}))
+	assert.EqualError(t, err, `encoder for "pet" returned invalid JSON: "{\"v\":"`)
+}
@@ -0,0 +1,90 @@
+package poly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// ErrElementTimeout is returned, wrapped in an ElementError, when decoding a
+// single element takes longer than allowed by WithElementTimeout.
+var ErrElementTimeout = errors.New("element decode timed out")
+
+// ElementError reports a failure that happened while decoding a specific
+// element, such as a panic in its UnmarshalJSON implementation that was
+// recovered because of WithPanicRecovery, or exceeding the time allowed by
+// WithElementTimeout.
+type ElementError struct {
+	// Index is the position of the element in the array or source.
+	Index int
+	// TypeName is the polymorphic type name of the element.
+	TypeName string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error returns the description of the error, including the element it
+// happened on.
+func (e *ElementError) Error() string {
+	return fmt.Sprintf("element %d of type %q: %v", e.Index, e.TypeName, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ElementError) Unwrap() error {
+	return e.Err
+}
+
+// guardedDecodeElement works like decodeElement, but applies the panic
+// recovery and the time limit configured in the options.
+func guardedDecodeElement(o *options, raw json.RawMessage, elemType reflect.Type, index int, typeName string) (reflect.Value, error) {
+	if o.elementTimeout <= 0 {
+		return recoveringDecodeElement(o, reflect.New(elemType), raw, index, typeName)
+	}
+
+	// The decoding can't be interrupted, so it is run on its own goroutine
+	// which is abandoned if it takes too long. A panic on that goroutine is
+	// always recovered so that it can be passed back, and raised on the
+	// calling goroutine unless panics are to be recovered.
+	type result struct {
+		v         reflect.Value
+		err       error
+		recovered any
+	}
+	done := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			r.recovered = recover()
+			done <- r
+		}()
+		r.v, r.err = recoveringDecodeElement(o, reflect.New(elemType), raw, index, typeName)
+	}()
+
+	timer := time.NewTimer(o.elementTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		if r.recovered != nil {
+			panic(r.recovered)
+		}
+		return r.v, r.err
+	case <-timer.C:
+		return reflect.Value{}, &ElementError{Index: index, TypeName: typeName, Err: ErrElementTimeout}
+	}
+}
+
+// recoveringDecodeElement calls decodeElementWithOptions, turning any panic
+// into an ElementError if recoverPanics is set in the options.
+func recoveringDecodeElement(o *options, newSub reflect.Value, raw json.RawMessage, index int, typeName string) (v reflect.Value, err error) {
+	if o.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				v = reflect.Value{}
+				err = &ElementError{Index: index, TypeName: typeName, Err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+	}
+	return decodeElementWithOptions(o, newSub, raw, index, typeName)
+}
@@ -0,0 +1,68 @@
+package poly
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type Panicky struct{}
+
+func (p *Panicky) UnmarshalJSON([]byte) error {
+	panic("bad element")
+}
+
+type Slow struct{}
+
+func (s *Slow) UnmarshalJSON([]byte) error {
+	time.Sleep(200 * time.Millisecond)
+	return nil
+}
+
+type Guarded struct {
+	Person  Person  `poly:"person"`
+	Panicky Panicky `poly:"panicky"`
+	Slow    Slow    `poly:"slow"`
+}
+
+func TestUnmarshalWithOptions_PanicRecovery(t *testing.T) {
+	input := []byte(`[{"type":"person","name":"John"},{"type":"panicky"}]`)
+
+	var result Guarded
+	assert.Panics(t, func() {
+		_ = Unmarshal(input, &result)
+	})
+
+	err := UnmarshalWithOptions(input, &result, WithPanicRecovery())
+	assert.EqualError(t, err, `element 1 of type "panicky": panic: bad element`)
+	var elementErr *ElementError
+	assert.True(t, errors.As(err, &elementErr))
+	assert.Equal(t, 1, elementErr.Index)
+	assert.Equal(t, "panicky", elementErr.TypeName)
+}
+
+func TestUnmarshalWithOptions_ElementTimeout(t *testing.T) {
+	input := []byte(`[{"type":"person","name":"John"},{"type":"slow"}]`)
+
+	var result Guarded
+	err := UnmarshalWithOptions(input, &result, WithElementTimeout(10*time.Millisecond))
+	assert.ErrorIs(t, err, ErrElementTimeout)
+	assert.EqualError(t, err, `element 1 of type "slow": element decode timed out`)
+	assert.Equal(t, "John", result.Person.Name)
+
+	err = UnmarshalWithOptions(input, &result, WithElementTimeout(time.Second))
+	assert.NoError(t, err)
+}
+
+func TestUnmarshalWithOptions_ElementTimeoutPanics(t *testing.T) {
+	input := []byte(`[{"type":"panicky"}]`)
+
+	var result Guarded
+	assert.PanicsWithValue(t, "bad element", func() {
+		_ = UnmarshalWithOptions(input, &result, WithElementTimeout(time.Second))
+	})
+
+	err := UnmarshalWithOptions(input, &result, WithElementTimeout(time.Second), WithPanicRecovery())
+	assert.EqualError(t, err, `element 0 of type "panicky": panic: bad element`)
+}
@@ -0,0 +1,173 @@
+package poly
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ElementHash is the content hash of an element of a polymorphic JSON array.
+type ElementHash struct {
+	// Index is the position of the element in the array.
+	Index int
+	// TypeName is the polymorphic type name of the element.
+	TypeName string
+	// Hash is the hex-encoded SHA-256 hash of the canonical encoding of the
+	// element.
+	Hash string
+}
+
+// Hashes returns the content hash of every element of the raw JSON array,
+// with the type name of each element determined by the typeLocator as in
+// UnmarshalCustom, or by the DefaultLocator if it is nil. The hashes are
+// stable: they are computed over a canonical encoding of the elements, so they
+// don't depend on the whitespace or on the order of the keys of objects.
+// Numbers are compared as they are written, so 1 and 1.0 hash differently.
+// This is useful for cache invalidation and for sync engines that need to know
+// which elements changed.
+func Hashes(rawJson []byte, typeLocator reflect.Type) ([]ElementHash, error) {
+	if typeLocator == nil {
+		typeLocator = DefaultLocator
+	}
+	resolve, err := locatorResolver(typeLocator, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	hashes := []ElementHash{}
+	_, err = forEachElement(NewArraySource(rawJson), 0, resolve, func(index int, typeName string, raw json.RawMessage) error {
+		canonical, err := canonicalJSON(raw)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(canonical)
+		hashes = append(hashes, ElementHash{Index: index, TypeName: typeName, Hash: hex.EncodeToString(sum[:])})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// canonicalJSON returns the canonical encoding of the JSON value, which has no
+// insignificant whitespace and the keys of its objects in sorted order.
+func canonicalJSON(raw json.RawMessage) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+	// Maps are encoded with their keys in sorted order.
+	return json.Marshal(v)
+}
+
+// ChangeKind is the kind of an ElementChange.
+type ChangeKind int
+
+const (
+	// ElementAdded is an element that is only in the new array.
+	ElementAdded ChangeKind = iota
+	// ElementRemoved is an element that is only in the old array.
+	ElementRemoved
+	// ElementModified is an element whose content is different in the new
+	// array.
+	ElementModified
+)
+
+// String returns the name of the kind of change.
+func (k ChangeKind) String() string {
+	switch k {
+	case ElementAdded:
+		return "added"
+	case ElementRemoved:
+		return "removed"
+	case ElementModified:
+		return "modified"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// ElementChange describes an element that differs between two arrays.
+type ElementChange struct {
+	// Kind is the kind of the change.
+	Kind ChangeKind
+	// TypeName is the polymorphic type name of the element.
+	TypeName string
+	// OldIndex is the position of the element in the old array, or -1 if it
+	// was added.
+	OldIndex int
+	// NewIndex is the position of the element in the new array, or -1 if it
+	// was removed.
+	NewIndex int
+}
+
+// CompareHashes returns the changes between the elements of two arrays, given
+// by their hashes. Elements with the same type name and content are unchanged
+// wherever they are in the arrays. Of the rest, an element of the old array
+// and one of the new array with the same type name at the same position are
+// modified, and the others were removed or added. The changes are ordered by
+// their position in the new array, followed by the removed elements.
+func CompareHashes(oldHashes []ElementHash, newHashes []ElementHash) []ElementChange {
+	type content struct {
+		typeName string
+		hash     string
+	}
+	unmatched := map[content][]int{}
+	for _, h := range oldHashes {
+		c := content{h.TypeName, h.Hash}
+		unmatched[c] = append(unmatched[c], h.Index)
+	}
+	removed := map[int]ElementHash{}
+	for _, h := range oldHashes {
+		removed[h.Index] = h
+	}
+	var added []ElementHash
+	for _, h := range newHashes {
+		c := content{h.TypeName, h.Hash}
+		if indexes := unmatched[c]; len(indexes) > 0 {
+			delete(removed, indexes[0])
+			unmatched[c] = indexes[1:]
+			continue
+		}
+		added = append(added, h)
+	}
+
+	changes := []ElementChange{}
+	for _, h := range added {
+		if old, ok := removed[h.Index]; ok && old.TypeName == h.TypeName {
+			delete(removed, h.Index)
+			changes = append(changes, ElementChange{Kind: ElementModified, TypeName: h.TypeName, OldIndex: h.Index, NewIndex: h.Index})
+			continue
+		}
+		changes = append(changes, ElementChange{Kind: ElementAdded, TypeName: h.TypeName, OldIndex: -1, NewIndex: h.Index})
+	}
+	var removedIndexes []int
+	for index := range removed {
+		removedIndexes = append(removedIndexes, index)
+	}
+	sort.Ints(removedIndexes)
+	for _, index := range removedIndexes {
+		changes = append(changes, ElementChange{Kind: ElementRemoved, TypeName: removed[index].TypeName, OldIndex: index, NewIndex: -1})
+	}
+	return changes
+}
+
+// Compare returns the changes between the elements of two raw JSON arrays, as
+// with CompareHashes, using the typeLocator as in Hashes.
+func Compare(oldJson []byte, newJson []byte, typeLocator reflect.Type) ([]ElementChange, error) {
+	oldHashes, err := Hashes(oldJson, typeLocator)
+	if err != nil {
+		return nil, err
+	}
+	newHashes, err := Hashes(newJson, typeLocator)
+	if err != nil {
+		return nil, err
+	}
+	return CompareHashes(oldHashes, newHashes), nil
+}
@@ -0,0 +1,69 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHashes(t *testing.T) {
+	hashes, err := Hashes([]byte(`[
+		{"type":"person", "name":"John", "age":30},
+		{"type":"pet", "name":"Fido"},
+		{"age": 30, "name": "John", "type": "person"}
+	]`), nil)
+	assert.NoError(t, err)
+	assert.Len(t, hashes, 3)
+	assert.Equal(t, 0, hashes[0].Index)
+	assert.Equal(t, "person", hashes[0].TypeName)
+	assert.Equal(t, "pet", hashes[1].TypeName)
+	assert.Len(t, hashes[0].Hash, 64)
+
+	// Whitespace and the order of the keys don't matter.
+	assert.Equal(t, hashes[0].Hash, hashes[2].Hash)
+	assert.NotEqual(t, hashes[0].Hash, hashes[1].Hash)
+
+	// Numbers are compared as written.
+	a, err := Hashes([]byte(`[{"type":"person","age":1}]`), nil)
+	assert.NoError(t, err)
+	b, err := Hashes([]byte(`[{"type":"person","age":1.0}]`), nil)
+	assert.NoError(t, err)
+	assert.NotEqual(t, a[0].Hash, b[0].Hash)
+
+	_, err = Hashes([]byte(`{}`), nil)
+	assert.Error(t, err)
+}
+
+func TestCompare(t *testing.T) {
+	oldJson := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"pet", "name":"Fido"},
+		{"type":"pet", "name":"Rex"},
+		{"type":"person", "name":"Jane"}
+	]`)
+	newJson := []byte(`[
+		{"type":"pet", "name":"Fido"},
+		{"type":"person", "name":"John"},
+		{"type":"pet", "name":"Spot"},
+		{"type":"person", "name":"Jack"},
+		{"type":"pet", "name":"Max"}
+	]`)
+	changes, err := Compare(oldJson, newJson, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ElementChange{
+		{Kind: ElementModified, TypeName: "pet", OldIndex: 2, NewIndex: 2},
+		{Kind: ElementModified, TypeName: "person", OldIndex: 3, NewIndex: 3},
+		{Kind: ElementAdded, TypeName: "pet", OldIndex: -1, NewIndex: 4},
+	}, changes)
+
+	changes, err = Compare(newJson, oldJson, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, ElementRemoved, changes[len(changes)-1].Kind)
+	assert.Equal(t, 4, changes[len(changes)-1].OldIndex)
+
+	changes, err = Compare(oldJson, oldJson, nil)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+
+	assert.Equal(t, "modified", ElementModified.String())
+	assert.Equal(t, "ChangeKind(7)", ChangeKind(7).String())
+}
@@ -0,0 +1,135 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// manifestKey is the key of the manifest element that WithManifest puts at the
+// start of an array, as in {"@manifest":[["person",17],["pet",15]]}.
+const manifestKey = "@manifest"
+
+// withManifest returns the encoded elements preceded by the manifest element,
+// which lists the type name and the length in bytes of each of them.
+func withManifest(encoded []json.RawMessage, indexedObjects []indexedObject) ([]json.RawMessage, error) {
+	entries := make([][2]any, len(encoded))
+	for i, e := range encoded {
+		entries[i] = [2]any{indexedObjects[i].TypeName, len(e)}
+	}
+	manifest, err := json.Marshal(map[string]any{manifestKey: entries})
+	if err != nil {
+		return nil, err
+	}
+	return append([]json.RawMessage{manifest}, encoded...), nil
+}
+
+// manifestSource is an ElementSource over the elements of a JSON array that
+// starts with a manifest element. The elements are cut from the array by their
+// lengths, and their type names are taken from the manifest, so that neither
+// the array nor the elements need to be scanned. An array without a manifest is
+// read as with an arraySource.
+type manifestSource struct {
+	rawJson    []byte
+	objectMode ObjectMode
+	parsed     bool
+	err        error
+	elements   []SourceElement
+	array      ElementSource
+	next       int
+}
+
+// newManifestSource returns a manifestSource over the raw JSON, which handles a
+// top-level object according to the mode.
+func newManifestSource(rawJson []byte, objectMode ObjectMode) *manifestSource {
+	return &manifestSource{rawJson: rawJson, objectMode: objectMode}
+}
+
+// Next implements the ElementSource interface.
+func (s *manifestSource) Next() (SourceElement, error) {
+	if !s.parsed {
+		s.parsed = true
+		s.err = s.parse()
+	}
+	if s.err != nil {
+		return SourceElement{}, s.err
+	}
+	if s.array != nil {
+		return s.array.Next()
+	}
+	if s.next >= len(s.elements) {
+		return SourceElement{}, io.EOF
+	}
+	e := s.elements[s.next]
+	s.next++
+	return e, nil
+}
+
+// parse reads the manifest and cuts the elements out of the array, or falls
+// back on an arraySource if the array doesn't start with a manifest.
+func (s *manifestSource) parse() error {
+	manifest, offset, ok := readManifest(s.rawJson)
+	if !ok {
+		s.array = newArraySource(s.rawJson, s.objectMode)
+		return nil
+	}
+
+	data := s.rawJson
+	for i, entry := range manifest {
+		var typeName string
+		var length int
+		if json.Unmarshal(entry[0], &typeName) != nil || json.Unmarshal(entry[1], &length) != nil || length <= 0 {
+			return fmt.Errorf("manifest entry %d is not a type name and a length", i)
+		}
+		offset = skipSpace(data, offset)
+		if offset >= len(data) || data[offset] != ',' {
+			return fmt.Errorf("manifest does not match the array at offset %d", offset)
+		}
+		offset = skipSpace(data, offset+1)
+		if offset+length > len(data) {
+			return fmt.Errorf("manifest entry %d of %d bytes runs past the end of the array", i, length)
+		}
+		s.elements = append(s.elements, SourceElement{Raw: data[offset : offset+length], TypeName: typeName})
+		offset += length
+	}
+	offset = skipSpace(data, offset)
+	if offset >= len(data) || data[offset] != ']' || len(bytes.TrimSpace(data[offset+1:])) > 0 {
+		return fmt.Errorf("manifest does not match the array at offset %d", offset)
+	}
+	return nil
+}
+
+// readManifest reads the manifest element at the start of the raw JSON array,
+// returning its entries and the offset just past it, or false if the array
+// doesn't start with one.
+func readManifest(rawJson []byte) ([][2]json.RawMessage, int, bool) {
+	dec := json.NewDecoder(bytes.NewReader(rawJson))
+	token, err := dec.Token()
+	if delim, ok := token.(json.Delim); err != nil || !ok || delim != '[' || !dec.More() {
+		return nil, 0, false
+	}
+	var first map[string]json.RawMessage
+	if dec.Decode(&first) != nil || len(first) != 1 {
+		return nil, 0, false
+	}
+	var manifest [][2]json.RawMessage
+	if json.Unmarshal(first[manifestKey], &manifest) != nil {
+		return nil, 0, false
+	}
+	return manifest, int(dec.InputOffset()), true
+}
+
+// skipSpace returns the offset of the first byte of the data from the offset on
+// that isn't JSON whitespace.
+func skipSpace(data []byte, offset int) int {
+	for offset < len(data) {
+		switch data[offset] {
+		case ' ', '\t', '\n', '\r':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
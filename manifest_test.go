@@ -0,0 +1,68 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithManifest(t *testing.T) {
+	residence := Residence{
+		People: []Person{{Name: "John"}},
+		Pets:   []Pet{{Name: "Fido"}},
+	}
+	data, err := MarshalWithOptions(residence, WithDiscriminator("type"), WithManifest())
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"@manifest":[["person",31],["pet",28]]},{"type":"person","name":"John"},{"type":"pet","name":"Fido"}]`, string(data))
+
+	var decoded Residence
+	err = UnmarshalWithOptions(data, &decoded, WithManifest())
+	assert.NoError(t, err)
+	assert.Equal(t, residence.People, decoded.People)
+	assert.Equal(t, residence.Pets, decoded.Pets)
+
+	// The type names come from the manifest rather than from the elements.
+	decoded = Residence{}
+	err = UnmarshalWithOptions([]byte(`[{"@manifest":[["pet",15]]}, {"name":"Rex"} ]`), &decoded, WithManifest())
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Rex"}}, decoded.Pets)
+
+	// Arrays without a manifest are read as usual.
+	decoded = Residence{}
+	err = UnmarshalWithOptions([]byte(`[{"type":"pet","name":"Rex"}]`), &decoded, WithManifest())
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Rex"}}, decoded.Pets)
+
+	// Without the option, the manifest is an element of no interest.
+	decoded = Residence{}
+	err = UnmarshalWithOptions(data, &decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, residence.People, decoded.People)
+}
+
+func TestWithManifest_Mismatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   string
+	}{
+		{"short", `[{"@manifest":[["pet",10]]},{"name":"Rex"}]`, "manifest does not match the array at offset 38"},
+		{"long", `[{"@manifest":[["pet",20]]},{"name":"Rex"}]`, "manifest entry 0 of 20 bytes runs past the end of the array"},
+		{"missing", `[{"@manifest":[["pet",14],["pet",14]]},{"name":"Rex"}]`, "manifest does not match the array at offset 53"},
+		{"extra", `[{"@manifest":[]},{"name":"Rex"}]`, "manifest does not match the array at offset 17"},
+		{"entry", `[{"@manifest":[[1,2]]},{"name":"Rex"}]`, "manifest entry 0 is not a type name and a length"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := UnmarshalWithOptions([]byte(tt.input), &Residence{}, WithManifest())
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func TestBuilder_Manifest(t *testing.T) {
+	b := NewBuilder(Residence{}, WithDiscriminator("type"), WithManifest())
+	Add(b, Pet{Name: "Fido"})
+	data, err := b.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"@manifest":[["pet",28]]},{"type":"pet","name":"Fido"}]`, string(data))
+}
@@ -0,0 +1,80 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// KeySettable is an interface that should be implemented by an element type if
+// it needs to know the key under which the element was found by UnmarshalMap.
+type KeySettable interface {
+	// SetKey is called with the key of the element in the JSON object. It is
+	// called after the element is unmarshalled.
+	SetKey(key string)
+}
+
+// UnmarshalMap works like UnmarshalWithOptions, but for polymorphic elements
+// that are the values of a JSON object rather than the elements of an array,
+// such as {"id1":{"type":"dog",...},"id2":{"type":"cat",...}}. The type name of
+// each value is determined with the type locator as usual, and the values are
+// put into the fields of the target. Element types that implement KeySettable
+// are told the key they were found under, since the target fields don't keep
+// it. The elements are indexed in the order of the keys.
+//
+// Example usage:
+//
+//	type Pack struct {
+//	    Dogs []Dog `poly:"dog"`
+//	    Cats []Cat `poly:"cat"`
+//	}
+//
+//	func (d *Dog) SetKey(key string) { d.ID = key }
+//
+//	err := poly.UnmarshalMap(data, &pack)
+func UnmarshalMap(rawJson []byte, target any, opts ...Option) error {
+	keys, values, err := splitObject(rawJson)
+	if err != nil {
+		return err
+	}
+	elements := make([]SourceElement, len(values))
+	for i, value := range values {
+		elements[i] = SourceElement{Raw: value}
+	}
+	o := newOptions(opts)
+	o.elementKeys = keys
+	return unmarshalSource(NewSliceSource(elements), target, o)
+}
+
+// splitObject returns the keys of the JSON object, in order, and their values.
+// A JSON null is an empty object.
+func splitObject(rawJson []byte) ([]string, []json.RawMessage, error) {
+	if !json.Valid(rawJson) {
+		var v any
+		return nil, nil, json.Unmarshal(rawJson, &v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(rawJson))
+	t, _ := dec.Token()
+	if t == nil {
+		return nil, nil, nil
+	}
+	if t != json.Delim('{') {
+		return nil, nil, fmt.Errorf("JSON is not an object")
+	}
+	var keys []string
+	var values []json.RawMessage
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key.(string))
+		values = append(values, value)
+	}
+	return keys, values, nil
+}
@@ -0,0 +1,64 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type KeyedPet struct {
+	ID   string `json:"-"`
+	Name string `json:"name"`
+}
+
+func (p *KeyedPet) SetKey(key string) {
+	p.ID = key
+}
+
+type KeyedHousehold struct {
+	People []Person   `poly:"person"`
+	Pets   []KeyedPet `poly:"pet"`
+	Water  *KeyedPet  `poly:"water"`
+}
+
+func TestUnmarshalMap(t *testing.T) {
+	input := []byte(`{
+		"p1": {"type":"person", "name":"John"},
+		"id2": {"type":"pet", "name":"Fido"},
+		"id1": {"type":"pet", "name":"Rex"},
+		"x": {"type":"unknown"},
+		"w": {"type":"water", "name":"City"}
+	}`)
+
+	var result KeyedHousehold
+	err := UnmarshalMap(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, KeyedHousehold{
+		People: []Person{{Name: "John"}},
+		Pets:   []KeyedPet{{ID: "id2", Name: "Fido"}, {ID: "id1", Name: "Rex"}},
+		Water:  &KeyedPet{ID: "w", Name: "City"},
+	}, result)
+
+	result = KeyedHousehold{}
+	err = UnmarshalMap(input, &result, WithBatchAllocation())
+	assert.NoError(t, err)
+	assert.Equal(t, []KeyedPet{{ID: "id2", Name: "Fido"}, {ID: "id1", Name: "Rex"}}, result.Pets)
+}
+
+func TestUnmarshalMap_Empty(t *testing.T) {
+	var result KeyedHousehold
+	assert.NoError(t, UnmarshalMap([]byte(`{}`), &result))
+	assert.NoError(t, UnmarshalMap([]byte(`null`), &result))
+	assert.Equal(t, KeyedHousehold{}, result)
+}
+
+func TestUnmarshalMap_Errors(t *testing.T) {
+	var result KeyedHousehold
+	err := UnmarshalMap([]byte(`[{"type":"pet"}]`), &result)
+	assert.EqualError(t, err, "JSON is not an object")
+
+	err = UnmarshalMap([]byte(`{"a":`), &result)
+	assert.Error(t, err)
+
+	err = UnmarshalMap([]byte(`{"a":{"type":"pet","name":1}}`), &result)
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// MappingConfig is a data-driven mapping of type names to the places their
+// elements are decoded into. It is usually kept in a configuration file and
+// loaded into a Mapping; in JSON it looks like:
+//
+//	{
+//	    "fields": {"labrador": "Dogs", "siamese": "Cats"},
+//	    "types": {"labrador": "Dog", "siamese": "Cat"}
+//	}
+//
+// Other configuration formats, such as YAML, can be decoded into a
+// MappingConfig with their own libraries and given to Mapping.Set.
+type MappingConfig struct {
+	// Fields maps type names to the Go names of the target fields their
+	// elements are put into, as with WithFieldOverride. A field that is
+	// listed no longer receives the type name of its tag unless that is
+	// listed as well.
+	Fields map[string]string `json:"fields,omitempty"`
+
+	// Types maps type names to the names of the Go types, from the catalog of
+	// the Mapping, that their elements are decoded into when unmarshalling
+	// into an Accumulator, as with WithRegistry.
+	Types map[string]string `json:"types,omitempty"`
+}
+
+// Mapping holds a MappingConfig that can be replaced at runtime, so that
+// operators can accept newly added upstream types without redeploying. The
+// Go types that the configuration may name are added to the catalog of the
+// Mapping with AddType, as the configuration can only refer to them by name.
+//
+// Each unmarshalling uses the configuration that is current when WithMapping
+// is applied, so a reload never affects an unmarshalling in progress. A
+// Mapping is safe for concurrent use.
+type Mapping struct {
+	mu       sync.RWMutex
+	catalog  map[string]reflect.Type
+	config   MappingConfig
+	registry *Registry
+}
+
+// NewMapping creates a new Mapping with an empty catalog and configuration.
+func NewMapping() *Mapping {
+	return &Mapping{
+		catalog:  map[string]reflect.Type{},
+		registry: NewRegistry(),
+	}
+}
+
+// AddType adds the type of the prototype to the catalog under the name of the
+// Go type, e.g. "Dog" for `Dog{}`, so that the configuration can map type names
+// to it. The prototype must be a struct or a pointer to a struct. An error is
+// returned if it isn't, or if a different type with the same name is already
+// in the catalog.
+func (m *Mapping) AddType(prototype any) error {
+	t := reflect.TypeOf(prototype)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || t.Name() == "" {
+		return fmt.Errorf("prototype for the mapping catalog must be a named struct, got %T", prototype)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.catalog[t.Name()]; ok && existing != t {
+		return fmt.Errorf("mapping catalog already has a type named %q: %v", t.Name(), existing)
+	}
+	m.catalog[t.Name()] = t
+	return nil
+}
+
+// Load reads a MappingConfig in JSON from the reader and makes it the current
+// configuration. If the configuration can't be read or is invalid, an error is
+// returned and the current configuration is kept.
+func (m *Mapping) Load(r io.Reader) error {
+	var config MappingConfig
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&config)
+	if err != nil {
+		return fmt.Errorf("invalid mapping configuration: %w", err)
+	}
+	return m.Set(config)
+}
+
+// Set makes the configuration the current one. An error is returned, and the
+// current configuration is kept, if it has an empty type name or field name,
+// or if it maps a type name to a Go type that isn't in the catalog.
+func (m *Mapping) Set(config MappingConfig) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fields := map[string]string{}
+	for typeName, fieldName := range config.Fields {
+		if typeName == "" || fieldName == "" {
+			return fmt.Errorf("mapping configuration maps %q to field %q", typeName, fieldName)
+		}
+		fields[typeName] = fieldName
+	}
+	types := map[string]string{}
+	registry := NewRegistry()
+	for typeName, goName := range config.Types {
+		t, ok := m.catalog[goName]
+		if typeName == "" || !ok {
+			return fmt.Errorf("mapping configuration maps %q to type %q, which is not in the catalog", typeName, goName)
+		}
+		types[typeName] = goName
+		err := registry.add(typeName, t)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.config = MappingConfig{Fields: fields, Types: types}
+	m.registry = registry
+	return nil
+}
+
+// Config returns a copy of the current configuration.
+func (m *Mapping) Config() MappingConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	config := MappingConfig{
+		Fields: map[string]string{},
+		Types:  map[string]string{},
+	}
+	for typeName, fieldName := range m.config.Fields {
+		config.Fields[typeName] = fieldName
+	}
+	for typeName, goName := range m.config.Types {
+		config.Types[typeName] = goName
+	}
+	return config
+}
+
+// Registry returns a Registry of the type names of the current configuration
+// and their Go types, e.g. for a Router. It isn't updated by later reloads.
+func (m *Mapping) Registry() *Registry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.registry
+}
+
+// WithMapping makes unmarshalling use the current configuration of the
+// Mapping: the type names in its Fields are put into the given target fields
+// as with WithFieldOverride, and those in its Types are decoded into the
+// given Go types when the target implements Accumulator, as with
+// WithRegistry. The configuration is read when the option is applied, so each
+// call of UnmarshalWithOptions sees the latest one.
+//
+// Example usage:
+//
+//	mapping := poly.NewMapping()
+//	_ = mapping.AddType(Dog{})
+//	err := mapping.Load(configFile)
+//	...
+//	err = poly.UnmarshalWithOptions(data, &kennel, poly.WithMapping(mapping))
+func WithMapping(m *Mapping) Option {
+	return func(o *options) {
+		m.mu.RLock()
+		defer m.mu.RUnlock()
+		typeNames := make([]string, 0, len(m.config.Fields))
+		for typeName := range m.config.Fields {
+			typeNames = append(typeNames, typeName)
+		}
+		sort.Strings(typeNames)
+		for _, typeName := range typeNames {
+			WithFieldOverride(typeName, m.config.Fields[typeName])(o)
+		}
+		if len(m.config.Types) > 0 {
+			o.registry = m.registry
+		}
+	}
+}
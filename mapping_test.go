@@ -0,0 +1,104 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWithMapping_Fields(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"human", "name":"Jane"},
+		{"type":"pet", "name":"Fido"},
+		{"type":"animal", "name":"Rex"}
+	]`)
+	mapping := NewMapping()
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithMapping(mapping))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+
+	// Reloading the configuration accepts the new type names.
+	err = mapping.Load(strings.NewReader(`{"fields": {"person": "People", "human": "People", "pet": "Pets", "animal": "Pets"}}`))
+	assert.NoError(t, err)
+	result = Residence{}
+	err = UnmarshalWithOptions(input, &result, WithMapping(mapping))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Jane"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Rex"}}, result.Pets)
+
+	err = mapping.Load(strings.NewReader(`{"fields": {"human": "Humans"}}`))
+	assert.NoError(t, err)
+	err = UnmarshalWithOptions(input, &result, WithMapping(mapping))
+	assert.EqualError(t, err, `field Humans for type name "human" does not exist in the target`)
+}
+
+func TestWithMapping_Types(t *testing.T) {
+	input := []byte(`[{"type":"human", "name":"Jane"}, {"type":"animal", "name":"Rex"}]`)
+	mapping := NewMapping()
+	assert.NoError(t, mapping.AddType(Person{}))
+	assert.NoError(t, mapping.AddType(&Pet{}))
+
+	err := mapping.Set(MappingConfig{Types: map[string]string{"human": "Person"}})
+	assert.NoError(t, err)
+	list := &lockedList{}
+	err = UnmarshalWithOptions(input, list, WithMapping(mapping))
+	assert.NoError(t, err)
+	assert.Equal(t, []any{&Person{Name: "Jane"}}, list.elements)
+
+	err = mapping.Set(MappingConfig{Types: map[string]string{"human": "Person", "animal": "Pet"}})
+	assert.NoError(t, err)
+	list = &lockedList{}
+	err = UnmarshalWithOptions(input, list, WithMapping(mapping))
+	assert.NoError(t, err)
+	assert.Equal(t, []any{&Person{Name: "Jane"}, &Pet{Name: "Rex"}}, list.elements)
+
+	v, err := mapping.Registry().Decode("animal", []byte(`{"name":"Rex"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &Pet{Name: "Rex"}, v)
+}
+
+func TestMapping_Invalid(t *testing.T) {
+	mapping := NewMapping()
+	assert.NoError(t, mapping.AddType(Person{}))
+	assert.NoError(t, mapping.Set(MappingConfig{Fields: map[string]string{"human": "People"}}))
+
+	err := mapping.AddType(42)
+	assert.EqualError(t, err, "prototype for the mapping catalog must be a named struct, got int")
+
+	err = mapping.Set(MappingConfig{Types: map[string]string{"animal": "Pet"}})
+	assert.EqualError(t, err, `mapping configuration maps "animal" to type "Pet", which is not in the catalog`)
+
+	err = mapping.Set(MappingConfig{Fields: map[string]string{"animal": ""}})
+	assert.EqualError(t, err, `mapping configuration maps "animal" to field ""`)
+
+	err = mapping.Load(strings.NewReader(`{"field": {}}`))
+	assert.ErrorContains(t, err, "invalid mapping configuration")
+
+	// The configuration is kept when a new one is rejected.
+	assert.Equal(t, MappingConfig{Fields: map[string]string{"human": "People"}, Types: map[string]string{}}, mapping.Config())
+}
+
+func TestWithMapping_Concurrent(t *testing.T) {
+	input := []byte(`[{"type":"human", "name":"Jane"}]`)
+	mapping := NewMapping()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = mapping.Set(MappingConfig{Fields: map[string]string{"human": "People"}})
+		}()
+		go func() {
+			defer wg.Done()
+			var result Residence
+			assert.NoError(t, UnmarshalWithOptions(input, &result, WithMapping(mapping)))
+		}()
+	}
+	wg.Wait()
+}
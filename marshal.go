@@ -1,7 +1,10 @@
 package poly
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"reflect"
 	"sort"
@@ -18,10 +21,30 @@ var indexGettableType = reflect.TypeOf([]IndexGettable{}).Elem()
 
 // indexedObject is a wrapper around the value type that also contains
 // the index of the object. This is used to sort the objects based on the index
-// provided by the IndexGettable interface.
+// provided by the IndexGettable interface. The name of the field the object
+// came from and its polymorphic type name are kept to be able to apply the
+// relative ordering constraints and to report errors about it.
 type indexedObject struct {
-	Index int
-	Value any
+	Index    int
+	Value    any
+	Field    string
+	TypeName string
+	Indexed  bool
+	// Positional is set for the element of a positional field, such as
+	// `poly:"#0"`, which must be emitted at its Index.
+	Positional bool
+	// Emit is the type name that the element is emitted with, if the field
+	// is tagged with another one than its type name, as in
+	// `poly:"dog,emit=canine"`.
+	Emit string
+}
+
+// wireName returns the type name that the element is emitted with.
+func (item indexedObject) wireName() string {
+	if item.Emit != "" {
+		return item.Emit
+	}
+	return item.TypeName
 }
 
 // Marshal takes an input object of any type and serializes it into a JSON
@@ -56,9 +79,209 @@ type indexedObject struct {
 // useful for situations where a more compact or custom JSON representation is
 // desired for complex data structures.
 func Marshal(obj any) ([]byte, error) {
-	flattenedObjs := Flatten(obj)
+	return MarshalWithOptions(obj)
+}
+
+// MarshalWithOptions works like Marshal, but allows the marshalling behavior
+// to be adjusted with the given options, e.g. WithStrictIndices.
+func MarshalWithOptions(obj any, opts ...Option) (result []byte, err error) {
+	o := newOptions(opts)
+
+	var indexedObjects []indexedObject
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.Encoded(len(indexedObjects), err)
+		}()
+	}
+
+	indexedObjects, err = flattenObjects(obj, o)
+	if err != nil {
+		return nil, err
+	}
+	indexedObjects = append(indexedObjects, syntheticObjects(obj, o)...)
+	return joinObjects(indexedObjects, o)
+}
+
+// joinObjects encodes the flattened elements and joins them into the document
+// that the options ask for: an array, or an object keyed by type name with
+// ObjectKeyed, preceded by a manifest and wrapped in an envelope if they are
+// configured.
+func joinObjects(indexedObjects []indexedObject, o *options) ([]byte, error) {
+	if len(indexedObjects) == 0 {
+		empty := []byte("[]")
+		if o.objectMode == ObjectKeyed {
+			empty = []byte("{}")
+		}
+		if o.envelope != nil {
+			return o.envelope.wrap(empty)
+		}
+		if o.objectMode == ObjectKeyed {
+			return empty, nil
+		}
+		// Match what json.Marshal does for an empty flattened slice.
+		return []byte("null"), nil
+	}
+	encoded, err := encodeElements(indexedObjects, o)
+	if err != nil {
+		return nil, err
+	}
+	var items []byte
+	if o.objectMode == ObjectKeyed {
+		if o.manifest {
+			return nil, fmt.Errorf("a manifest can't be emitted in a keyed object")
+		}
+		items, err = joinKeyed(encoded, indexedObjects)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if o.manifest {
+			encoded, err = withManifest(encoded, indexedObjects)
+			if err != nil {
+				return nil, err
+			}
+		}
+		items = joinElements(encoded)
+	}
+	if o.envelope != nil {
+		return o.envelope.wrap(items)
+	}
+	return items, nil
+}
+
+// encodeElements encodes each of the flattened elements, adding the
+// discriminator if one is configured.
+func encodeElements(indexedObjects []indexedObject, o *options) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, 0, len(indexedObjects))
+	for _, item := range indexedObjects {
+		encoded, err := encodeItem(item, len(result), o)
+		if err != nil {
+			return nil, err
+		}
+		if o.metrics != nil {
+			o.metrics.ElementEncoded(item.TypeName, len(encoded))
+		}
+		result = append(result, encoded)
+	}
+	return result, nil
+}
+
+// encodeItem encodes a flattened element as it is emitted at the given
+// position of the array: sealed, wrapped in its payload key, with its
+// discriminator, wrapped in its external tag and with its provenance, as the
+// options ask for them.
+func encodeItem(item indexedObject, position int, o *options) ([]byte, error) {
+	wireName := item.wireName()
+	encoded, err := encodeElement(item.Value, item.TypeName, wireName, o)
+	if err != nil {
+		return nil, unsupportedValueError(item, err)
+	}
+	encoded, err = sealElement(encoded, item.TypeName, o)
+	if err != nil {
+		return nil, err
+	}
+	if o.payloadKey != "" && wireName != "" {
+		encoded, err = wrapInObject(encoded, o.payloadKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.discriminatorKey != "" && wireName != "" {
+		encoded, err = injectDiscriminator(encoded, o.discriminatorKey, wireName, o.typeCodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.externalTags && wireName != "" {
+		encoded, err = wrapInObject(encoded, wireName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.provenance != nil {
+		return wrapProvenance(encoded, *o.provenance, position, wireName)
+	}
+	return encoded, nil
+}
+
+// unsupportedValueError returns the error that encoding the element failed
+// with, wrapped in an UnsupportedValueError if encoding/json found the element
+// to hold a value that it can't encode.
+func unsupportedValueError(item indexedObject, err error) error {
+	var typeErr *json.UnsupportedTypeError
+	var valueErr *json.UnsupportedValueError
+	switch {
+	case errors.As(err, &typeErr):
+		return &UnsupportedValueError{Field: item.Field, Type: typeErr.Type, Err: err}
+	case errors.As(err, &valueErr):
+		unsupported := &UnsupportedValueError{Field: item.Field, Err: err}
+		if valueErr.Value.IsValid() {
+			unsupported.Type = valueErr.Value.Type()
+		}
+		return unsupported
+	}
+	return err
+}
+
+// encodeElement returns the JSON encoding of a flattened element of the given
+// type name, with its type field filled in with the wire name, which is the
+// type name it is emitted with, if the options ask for it. Raw elements, held
+// in json.RawMessage fields, are emitted verbatim unless the options ask for
+// them to be compacted or indented, and so is the output of the field encoder
+// for the type name, if there is one.
+func encodeElement(value any, typeName string, wireName string, o *options) ([]byte, error) {
+	if o.typeFields && wireName != "" {
+		var err error
+		value, err = withTypeField(value, wireName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var raw json.RawMessage
+	if fieldEncoder, ok := o.fieldEncoders[typeName]; ok {
+		var err error
+		raw, err = fieldEncoder(reflect.Indirect(reflect.ValueOf(value)).Interface())
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("encoder for %q returned invalid JSON: %q", typeName, raw)
+		}
+	} else {
+		switch v := value.(type) {
+		case json.RawMessage:
+			raw = v
+		case *json.RawMessage:
+			raw = *v
+		default:
+			encoded, err := json.Marshal(value)
+			if err != nil || !o.extraFields {
+				return encoded, err
+			}
+			return mergeExtra(encoded, value)
+		}
 
-	return json.Marshal(flattenedObjs)
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("raw element is not valid JSON: %q", raw)
+		}
+	}
+	var buf bytes.Buffer
+	switch o.rawFormat {
+	case rawCompact:
+		err := json.Compact(&buf, raw)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case rawIndent:
+		err := json.Indent(&buf, raw, o.rawIndentPrefix, o.rawIndent)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return raw, nil
 }
 
 // Flatten takes an input object of any type and flattens the input object by
@@ -72,6 +295,11 @@ func Marshal(obj any) ([]byte, error) {
 // that does not implement the IndexGettable interface will be sorted to the end
 // using the same rules.
 //
+// Fields holding pointers, including chains of pointers such as **T, and
+// fields of interface types are followed to the value they refer to, and the
+// same is done for the elements of slices. Nil pointers and interfaces are
+// skipped, as are zero values unless the WithIncludeZeroValues option is given.
+//
 // This does not marshal them into JSON, unlike Marshal, and can be used
 // if there is a need to do any custom JSON serialization by your own code.
 //
@@ -86,28 +314,96 @@ func Marshal(obj any) ([]byte, error) {
 // Returns:
 // - ([]any): A flattened representation of the input object with all the
 // fields of the original object returned as a slice.
+//
+// Flatten returns nil if the object can't be flattened, such as when the input
+// is nil or not a struct, or when the relative ordering constraints given by
+// the `before` and `after` tag options can't be satisfied.
+//
+// Deprecated: Use FlattenWithOptions, which returns an error instead.
 func Flatten(obj any) []any {
+	flattenedObjs, err := flatten(obj, newOptions(nil))
+	if err != nil {
+		return nil
+	}
+	return flattenedObjs
+}
+
+// FlattenWithOptions works like Flatten, but allows the flattening behavior
+// to be adjusted with the given options. An error is returned if the
+// flattened objects do not satisfy the constraints imposed by the options.
+func FlattenWithOptions(obj any, opts ...Option) ([]any, error) {
+	return flatten(obj, newOptions(opts))
+}
+
+// flatten is the implementation behind Flatten and FlattenWithOptions.
+func flatten(obj any, o *options) ([]any, error) {
+	indexedObjects, err := flattenObjects(obj, o)
+	if err != nil {
+		return nil, err
+	}
+	return values(indexedObjects), nil
+}
 
-	sourceType := reflect.TypeOf(obj)
-	sourceValue := reflect.ValueOf(obj)
+// values returns the values of the indexed objects. A nil slice is returned if
+// there are none.
+func values(indexedObjects []indexedObject) []any {
+	var flattenedObjs []any
+	for _, item := range indexedObjects {
+		flattenedObjs = append(flattenedObjs, item.Value)
+	}
+	return flattenedObjs
+}
 
-	if sourceType.Kind() == reflect.Pointer {
-		sourceType = sourceType.Elem()
-		sourceValue = sourceValue.Elem()
+// flattenObjects extracts the objects to emit from obj, in the order they
+// should be emitted, along with their indexes and type names.
+func flattenObjects(obj any, o *options) ([]indexedObject, error) {
+	sourceType, sourceValue, err := marshalInput(obj)
+	if err != nil {
+		return nil, err
 	}
 
 	needToSort := false
+	hasPositions := false
 	indexedObjects := make([]indexedObject, 0)
+	relativeOrder := map[string]tagOptions{}
+	typeNames := map[string]bool{}
 
+	_, err = findRestField(sourceType, o.tagKeys)
+	if err != nil {
+		return nil, err
+	}
 	for i := 0; i < sourceType.NumField(); i++ {
 		field := sourceType.Field(i)
-		fieldType := field.Type
-		fieldValue := sourceValue.Field(i)
+		if field.Type == elementOrderType || isExcludedField(field, o.tagKeys) {
+			continue
+		}
+		if isRestField(field, o.tagKeys) {
+			// The unmatched elements are emitted again as they are, after
+			// the others unless they are ordered otherwise.
+			rest, err := splitRest(field, sourceValue.Field(i), o.tagKeys)
+			if err != nil {
+				return nil, err
+			}
+			indexedObjects = append(indexedObjects, rest...)
+			continue
+		}
+
+		typeName, opts, err := fieldTypeName(field, o.tagKeys)
+		if err != nil {
+			return nil, err
+		}
+		emit := opts.emit
+		if len(opts.after) > 0 || len(opts.before) > 0 {
+			relativeOrder[typeName] = opts
+		}
+		typeNames[typeName] = true
 
-		zeroObj := false
-		if fieldValue.IsZero() {
-			zeroObj = true
+		fieldValue, ok := derefValue(sourceValue.Field(i))
+		if !ok {
+			continue
 		}
+		fieldType := fieldValue.Type()
+		zeroObj := fieldValue.IsZero()
 
 		if fieldType.Kind() == reflect.Struct {
 			// If we have a concrete object, that may cause issues
@@ -118,54 +414,238 @@ func Flatten(obj any) []any {
 			ptrValue := reflect.New(fieldType)
 			ptrValue.Elem().Set(fieldValue)
 			fieldValue = ptrValue
-			fieldType = reflect.TypeOf(fieldValue)
+			fieldType = ptrValue.Type()
 		}
 
-		if fieldType.Kind() == reflect.Slice {
+		if elements, ok := containerElements(fieldValue); ok {
+			for _, element := range elements {
+				elemVal, ok := derefValue(reflect.ValueOf(element))
+				if ok && element != nil && (o.includeZeroValues || !elemVal.IsZero()) {
+					indexedObject := indexedObjectForValue(field.Name, typeName, elemVal)
+					indexedObject.Emit = emit
+					needToSort = needToSort || indexedObject.Indexed
+					indexedObjects = append(indexedObjects, indexedObject)
+				}
+			}
+		} else if fieldType.Kind() == reflect.Slice && fieldType != rawMessageType {
 			for i := 0; i < fieldValue.Len(); i++ {
-				sliceVal := fieldValue.Index(i)
-				if !sliceVal.IsZero() {
-					indexedObject, itemSortable := indexedObjectForValue(sliceVal)
-					needToSort = needToSort || itemSortable
+				sliceVal, ok := derefValue(fieldValue.Index(i))
+				if ok && (o.includeZeroValues || !sliceVal.IsZero()) {
+					indexedObject := indexedObjectForValue(field.Name, typeName, sliceVal)
+					indexedObject.Emit = emit
+					needToSort = needToSort || indexedObject.Indexed
 					indexedObjects = append(indexedObjects, indexedObject)
 				}
 			}
+		} else if position, ok := positionIndex(typeName); ok {
+			// The element of a tuple is emitted even if it is zero, to
+			// keep the others at their positions, and without a type name.
+			indexedObject := indexedObjectForValue(field.Name, "", fieldValue)
+			indexedObject.Index = position
+			indexedObject.Indexed = true
+			indexedObject.Positional = true
+			needToSort = true
+			hasPositions = true
+			indexedObjects = append(indexedObjects, indexedObject)
 		} else {
-			if !zeroObj {
-				indexedObject, itemSortable := indexedObjectForValue(fieldValue)
-				needToSort = needToSort || itemSortable
+			if o.includeZeroValues || !zeroObj {
+				indexedObject := indexedObjectForValue(field.Name, typeName, fieldValue)
+				indexedObject.Emit = emit
+				needToSort = needToSort || indexedObject.Indexed
 				indexedObjects = append(indexedObjects, indexedObject)
 			}
 		}
 	}
 
+	if len(o.omitters) > 0 {
+		indexedObjects = omitDefaults(indexedObjects, o.omitters)
+	}
+
+	if o.strictIndices {
+		err := validateStrictIndices(indexedObjects)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if needToSort {
 		sort.SliceStable(indexedObjects, func(i, j int) bool {
 			return indexedObjects[i].Index < indexedObjects[j].Index
 		})
 	}
 
-	var flattenedObjs []any
-	for _, item := range indexedObjects {
-		flattenedObjs = append(flattenedObjs, item.Value)
+	if len(relativeOrder) > 0 {
+		var err error
+		indexedObjects, err = applyRelativeOrder(indexedObjects, relativeOrder, typeNames)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return flattenedObjs
+	if hasPositions {
+		err := validateTuplePositions(indexedObjects)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return indexedObjects, nil
+}
+
+// joinKeyed joins the encoded elements into an object whose keys are the type
+// names the elements are emitted with, each holding the array of the elements
+// of its type in order. The keys are in the order of the first element of
+// each type. An error is returned for an element without a type name, which
+// has no key to go under.
+func joinKeyed(encoded []json.RawMessage, indexedObjects []indexedObject) ([]byte, error) {
+	var keys []string
+	elements := map[string][]json.RawMessage{}
+	for i, e := range encoded {
+		key := indexedObjects[i].wireName()
+		if key == "" {
+			return nil, fmt.Errorf("element %d has no type name to key it by", i)
+		}
+		if _, ok := elements[key]; !ok {
+			keys = append(keys, key)
+		}
+		elements[key] = append(elements[key], e)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(joinElements(elements[key]))
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// derefValue follows interfaces and chains of pointers until it reaches a
+// value that is neither, or the last pointer of a chain if it points to a
+// struct, which is kept so that IndexGettable implementations with pointer
+// receivers are found. Pointers to anything else, such as a *json.RawMessage,
+// a *string or a pointer to a slice, are followed to the value itself, so that
+// it is emitted, iterated or found to be zero as if the field held the value.
+// False is returned if a nil interface or pointer is encountered on the way,
+// since there is nothing to emit for it.
+func derefValue(v reflect.Value) (reflect.Value, bool) {
+	for {
+		switch v.Kind() {
+		case reflect.Interface:
+			if v.IsNil() {
+				return v, false
+			}
+			v = v.Elem()
+		case reflect.Pointer:
+			if v.IsNil() {
+				return v, false
+			}
+			if v.Elem().Kind() == reflect.Struct {
+				return v, true
+			}
+			v = v.Elem()
+		default:
+			return v, true
+		}
+	}
 }
 
 // indexedObjectForValue takes a reflect.Value and returns a
 // indexedObject object with the value and index of the object. If the
 // object does not implement the IndexGettable interface, the index is set to
-// MaxInt and the needToSort flag is set to false.
-func indexedObjectForValue(sliceVal reflect.Value) (indexedObject, bool) {
+// MaxInt and the Indexed flag is set to false.
+func indexedObjectForValue(fieldName string, typeName string, sliceVal reflect.Value) indexedObject {
 	sortItem := indexedObject{
-		Index: math.MaxInt,
-		Value: sliceVal.Interface(),
+		Index:    math.MaxInt,
+		Value:    sliceVal.Interface(),
+		Field:    fieldName,
+		TypeName: typeName,
 	}
-	needToSort := false
 	if sliceVal.CanConvert(indexGettableType) {
-		needToSort = true
+		sortItem.Indexed = true
 		sortItem.Index = sliceVal.Convert(indexGettableType).Interface().(IndexGettable).GetIndex()
 	}
-	return sortItem, needToSort
+	return sortItem
+}
+
+// omitDefaults removes the objects that the omitter for their type name
+// reports as holding the default value for the type. This is used to
+// implement WithOmitDefault and WithOmitPrototype.
+func omitDefaults(indexedObjects []indexedObject, omitters map[string]func(v any) bool) []indexedObject {
+	kept := indexedObjects[:0]
+	for _, item := range indexedObjects {
+		if isDefault, ok := omitters[item.TypeName]; ok && isDefault(reflect.Indirect(reflect.ValueOf(item.Value)).Interface()) {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// validateStrictIndices verifies that every object reports a unique,
+// non-negative index. This is used to implement WithStrictIndices.
+func validateStrictIndices(indexedObjects []indexedObject) error {
+	seen := map[int]string{}
+	for _, item := range indexedObjects {
+		if !item.Indexed {
+			return fmt.Errorf("element of field %s does not implement IndexGettable", item.Field)
+		}
+		if item.Index < 0 {
+			return fmt.Errorf("element of field %s has negative index %d", item.Field, item.Index)
+		}
+		if other, ok := seen[item.Index]; ok {
+			return fmt.Errorf("elements of fields %s and %s have the same index %d", other, item.Field, item.Index)
+		}
+		seen[item.Index] = item.Field
+	}
+	return nil
+}
+
+// injectDiscriminator adds the type name of an element under the given key to
+// its JSON encoding, placing it first. If the element already has the key, for
+// instance because the struct carries its own discriminator field, the
+// encoding is returned unchanged.
+func injectDiscriminator(encoded []byte, key string, typeName string, codes map[int64]string) ([]byte, error) {
+	var object map[string]json.RawMessage
+	err := json.Unmarshal(encoded, &object)
+	if err != nil || object == nil {
+		return nil, fmt.Errorf("cannot add a discriminator to %q element that is not a JSON object", typeName)
+	}
+	if _, ok := object[key]; ok {
+		return encoded, nil
+	}
+
+	keyJson, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	var value any = typeName
+	if code, ok := typeCode(codes, typeName); ok {
+		value = code
+	}
+	typeNameJson, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	buf.Write(keyJson)
+	buf.WriteByte(':')
+	buf.Write(typeNameJson)
+	rest := bytes.TrimSpace(encoded[1:])
+	if len(object) > 0 {
+		buf.WriteByte(',')
+	}
+	buf.Write(rest)
+	return buf.Bytes(), nil
 }
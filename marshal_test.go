@@ -1,6 +1,7 @@
 package poly
 
 import (
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -41,3 +42,341 @@ func TestMarshalPoly(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, `[{"ValueC":105},{"ValueC":23},{"ValueA":"A"},{"ValueA":"B"},{"ValueB":42},{"ValueB":43}]`, string(bytes))
 }
+
+type StrictIndexed struct {
+	First  TypeInt
+	Second []*TypeInt
+}
+
+func TestMarshalWithOptions_StrictIndices(t *testing.T) {
+	in := StrictIndexed{
+		First:  TypeInt{ValueC: 1, index: 2},
+		Second: []*TypeInt{{ValueC: 2, index: 0}, {ValueC: 3, index: 1}},
+	}
+
+	bytes, err := MarshalWithOptions(in, WithStrictIndices())
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueC":2},{"ValueC":3},{"ValueC":1}]`, string(bytes))
+}
+
+func TestMarshalWithOptions_StrictIndicesDuplicate(t *testing.T) {
+	in := StrictIndexed{
+		First:  TypeInt{ValueC: 1, index: 1},
+		Second: []*TypeInt{{ValueC: 2, index: 0}, {ValueC: 3, index: 1}},
+	}
+
+	_, err := MarshalWithOptions(in, WithStrictIndices())
+	assert.EqualError(t, err, "elements of fields First and Second have the same index 1")
+
+	// Without the option the duplicate index is tolerated.
+	bytes, err := Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueC":2},{"ValueC":1},{"ValueC":3}]`, string(bytes))
+}
+
+func TestMarshalWithOptions_StrictIndicesNegative(t *testing.T) {
+	in := StrictIndexed{
+		First: TypeInt{ValueC: 1, index: -1},
+	}
+
+	_, err := MarshalWithOptions(in, WithStrictIndices())
+	assert.EqualError(t, err, "element of field First has negative index -1")
+}
+
+func TestMarshalWithOptions_StrictIndicesMissing(t *testing.T) {
+	in := SlicesABC{
+		TypeString: []TypeString{{ValueA: "A"}},
+		TypeInt:    TypeInt{ValueC: 23, index: 2},
+	}
+
+	_, err := MarshalWithOptions(in, WithStrictIndices())
+	assert.EqualError(t, err, "element of field TypeString does not implement IndexGettable")
+}
+
+type Report struct {
+	Summary TypeString  `poly:"summary,after=detail"`
+	Details []TypeFloat `poly:"detail"`
+	Header  *TypeInt    `poly:"header,before=summary"`
+}
+
+func TestMarshal_RelativeOrder(t *testing.T) {
+	in := Report{
+		Summary: TypeString{ValueA: "total"},
+		Details: []TypeFloat{{ValueB: 1}, {ValueB: 2}},
+		Header:  &TypeInt{ValueC: 3, index: 0},
+	}
+
+	bytes, err := Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueC":3},{"ValueB":1},{"ValueB":2},{"ValueA":"total"}]`, string(bytes))
+}
+
+func TestMarshal_RelativeOrderLarge(t *testing.T) {
+	in := Report{Summary: TypeString{ValueA: "total"}}
+	for i := 1; i <= 100000; i++ {
+		in.Details = append(in.Details, TypeFloat{ValueB: float32(i)})
+	}
+
+	flattened, err := FlattenWithOptions(in)
+	assert.NoError(t, err)
+	assert.Len(t, flattened, 100001)
+	assert.Equal(t, TypeFloat{ValueB: 1}, flattened[0])
+	assert.Equal(t, &TypeString{ValueA: "total"}, flattened[100000])
+}
+
+type CircularReport struct {
+	Summary TypeString  `poly:"summary,after=detail"`
+	Details []TypeFloat `poly:"detail,after=summary"`
+}
+
+func TestMarshal_RelativeOrderCircular(t *testing.T) {
+	in := CircularReport{
+		Summary: TypeString{ValueA: "total"},
+	}
+
+	_, err := Marshal(in)
+	assert.EqualError(t, err, `ordering constraints on "detail" are circular`)
+	assert.Nil(t, Flatten(in))
+	_, err = FlattenWithOptions(in)
+	assert.EqualError(t, err, `ordering constraints on "detail" are circular`)
+}
+
+type UnknownOrderReport struct {
+	Summary TypeString `poly:"summary,after=missing"`
+}
+
+func TestMarshal_RelativeOrderUnknownType(t *testing.T) {
+	_, err := Marshal(UnknownOrderReport{})
+	assert.EqualError(t, err, `"summary" must be after unknown type "missing"`)
+}
+
+func TestMarshalWithOptions_Discriminator(t *testing.T) {
+	in := SlicesABC{
+		TypeString: []TypeString{{ValueA: "A"}},
+		TypeBravo:  []TypeFloat{{ValueB: 42}},
+		TypeInt:    TypeInt{ValueC: 23, index: 2},
+		TypeIntP:   &TypeInt{ValueC: 105, index: 1},
+	}
+
+	bytes, err := MarshalWithOptions(in, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"TypeIntP","ValueC":105},{"type":"TypeInt","ValueC":23},{"type":"TypeString","ValueA":"A"},{"type":"TypeFloat","ValueB":42}]`, string(bytes))
+
+	// The output can be read back without the elements carrying a type field.
+	var out SlicesABC
+	assert.NoError(t, Unmarshal(bytes, &out))
+	assert.Equal(t, in.TypeString, out.TypeString)
+	assert.Equal(t, in.TypeBravo, out.TypeBravo)
+	assert.Equal(t, 23, out.TypeInt.ValueC)
+	assert.Equal(t, 105, out.TypeIntP.ValueC)
+}
+
+type SelfTyped struct {
+	Type string `json:"type"`
+}
+
+type Discriminated struct {
+	Typed   SelfTyped `poly:"typed"`
+	Empty   *struct{} `poly:"empty"`
+	Strings []string  `poly:"string"`
+}
+
+func TestMarshalWithOptions_DiscriminatorEdgeCases(t *testing.T) {
+	in := Discriminated{
+		Typed: SelfTyped{Type: "custom"},
+		Empty: &struct{}{},
+	}
+
+	// Elements that carry their own discriminator are left alone, and empty
+	// objects just get the discriminator.
+	bytes, err := MarshalWithOptions(in, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"custom"},{"type":"empty"}]`, string(bytes))
+
+	bytes, err = MarshalWithOptions(Discriminated{}, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `null`, string(bytes))
+
+	_, err = MarshalWithOptions(Discriminated{Strings: []string{"x"}}, WithDiscriminator("type"))
+	assert.EqualError(t, err, `cannot add a discriminator to "string" element that is not a JSON object`)
+}
+
+type Indirect struct {
+	TypeString  any
+	TypeInt     **TypeInt
+	TypeFloat   []any
+	TypeStringP *any `poly:"TypeString"`
+}
+
+func TestFlatten_Indirect(t *testing.T) {
+	ti := &TypeInt{ValueC: 7, index: 0}
+	var str any = TypeString{ValueA: "B"}
+	in := Indirect{
+		TypeString:  TypeString{ValueA: "A"},
+		TypeInt:     &ti,
+		TypeFloat:   []any{TypeFloat{ValueB: 1}, nil, &TypeFloat{ValueB: 2}},
+		TypeStringP: &str,
+	}
+
+	flattened := Flatten(in)
+	assert.Equal(t, []any{ti, &TypeString{ValueA: "A"}, TypeFloat{ValueB: 1}, &TypeFloat{ValueB: 2}, &TypeString{ValueA: "B"}}, flattened)
+
+	bytes, err := Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueC":7},{"ValueA":"A"},{"ValueB":1},{"ValueB":2},{"ValueA":"B"}]`, string(bytes))
+}
+
+func TestFlatten_IndirectNil(t *testing.T) {
+	var nilInt *TypeInt
+	var nilAny any
+	in := Indirect{
+		TypeInt:     &nilInt,
+		TypeStringP: &nilAny,
+	}
+	assert.Nil(t, Flatten(in))
+
+	flattened, err := FlattenWithOptions(in, WithIncludeZeroValues())
+	assert.NoError(t, err)
+	assert.Nil(t, flattened)
+}
+
+type PointersToBuiltins struct {
+	Raw     *json.RawMessage   `poly:"raw"`
+	RawList []*json.RawMessage `poly:"rawList"`
+	Name    *string            `poly:"name"`
+	Counts  *[]int             `poly:"count"`
+	Floats  *[]TypeFloat       `poly:"TypeFloat"`
+	Empty   *string            `poly:"empty"`
+	Nil     *json.RawMessage   `poly:"nil"`
+	NilList []*json.RawMessage `poly:"nilList"`
+}
+
+func TestFlatten_PointersToBuiltins(t *testing.T) {
+	raw := json.RawMessage(`{"type":"raw"}`)
+	item := json.RawMessage(`{"type":"rawList"}`)
+	name := "John"
+	empty := ""
+	counts := []int{1, 0, 2}
+	floats := []TypeFloat{{ValueB: 1}}
+	in := PointersToBuiltins{
+		Raw:     &raw,
+		RawList: []*json.RawMessage{&item, nil},
+		Name:    &name,
+		Counts:  &counts,
+		Floats:  &floats,
+		Empty:   &empty,
+		NilList: []*json.RawMessage{nil},
+	}
+
+	flattened := Flatten(in)
+	assert.Equal(t, []any{raw, item, "John", 1, 2, TypeFloat{ValueB: 1}}, flattened)
+
+	bytes, err := Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"raw"},{"type":"rawList"},"John",1,2,{"ValueB":1}]`, string(bytes))
+
+	// The pointers to zero values are skipped like the zero values, but nil
+	// pointers are always skipped.
+	flattened, err = FlattenWithOptions(in, WithIncludeZeroValues())
+	assert.NoError(t, err)
+	assert.Equal(t, []any{raw, item, "John", 1, 0, 2, TypeFloat{ValueB: 1}, ""}, flattened)
+}
+
+func TestMarshalWithOptions_IncludeZeroValues(t *testing.T) {
+	in := SlicesABC{
+		TypeString: []TypeString{{}, {ValueA: "A"}},
+	}
+
+	bytes, err := Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueA":"A"}]`, string(bytes))
+
+	bytes, err = MarshalWithOptions(in, WithIncludeZeroValues())
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueC":0},{"ValueA":""},{"ValueA":"A"}]`, string(bytes))
+}
+
+type Opaque struct {
+	Header  TypeString        `poly:"header"`
+	Payload []json.RawMessage `poly:"payload"`
+}
+
+func TestMarshalWithOptions_Raw(t *testing.T) {
+	in := Opaque{
+		Header: TypeString{ValueA: "A"},
+		Payload: []json.RawMessage{
+			json.RawMessage(`{"type": "payload", "n": [1, 2]}`),
+		},
+	}
+
+	bytes, err := Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueA":"A"},{"type": "payload", "n": [1, 2]}]`, string(bytes))
+
+	bytes, err = MarshalWithOptions(in, WithRawCompact())
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueA":"A"},{"type":"payload","n":[1,2]}]`, string(bytes))
+
+	bytes, err = MarshalWithOptions(in, WithRawIndent("", " "))
+	assert.NoError(t, err)
+	assert.Equal(t, "[{\"ValueA\":\"A\"},{\n \"type\": \"payload\",\n \"n\": [\n  1,\n  2\n ]\n}]", string(bytes))
+
+	in.Payload = append(in.Payload, json.RawMessage(`{"broken`))
+	_, err = Marshal(in)
+	assert.EqualError(t, err, `raw element is not valid JSON: "{\"broken"`)
+}
+
+func TestMarshalWithOptions_OmitDefault(t *testing.T) {
+	in := SlicesABC{
+		TypeString: []TypeString{{ValueA: "default"}, {ValueA: "A"}},
+		TypeBravo:  []TypeFloat{{ValueB: 1}, {ValueB: 2}},
+		TypeIntP:   &TypeInt{ValueC: -1},
+	}
+
+	bytes, err := MarshalWithOptions(in,
+		WithOmitPrototype("TypeString", TypeString{ValueA: "default"}),
+		WithOmitPrototype("TypeIntP", &TypeInt{ValueC: -1}),
+		WithOmitDefault("TypeFloat", func(v any) bool {
+			return v.(TypeFloat).ValueB < 2
+		}))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueA":"A"},{"ValueB":2}]`, string(bytes))
+
+	bytes, err = Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"ValueC":-1},{"ValueA":"default"},{"ValueA":"A"},{"ValueB":1},{"ValueB":2}]`, string(bytes))
+}
+
+type MigratingKennel struct {
+	Dogs []Pet `poly:"dog,hound,emit=canine"`
+	Cats []Pet `poly:"cat"`
+}
+
+func TestMarshalWithOptions_Emit(t *testing.T) {
+	kennel := MigratingKennel{
+		Dogs: []Pet{{Name: "Fido"}},
+		Cats: []Pet{{Name: "Tom"}},
+	}
+
+	bytes, err := MarshalWithOptions(kennel, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"canine","name":"Fido"},{"type":"cat","name":"Tom"}]`, string(bytes))
+
+	bytes, err = MarshalWithOptions(kennel, WithExternalTagging())
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"canine":{"name":"Fido"}},{"cat":{"name":"Tom"}}]`, string(bytes))
+
+	// The emitted type name is not accepted unless it is an alias as well.
+	var result MigratingKennel
+	err = Unmarshal([]byte(`[{"type":"canine","name":"Rex"},{"type":"hound","name":"Fido"},{"type":"dog","name":"Max"}]`), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Max"}}, result.Dogs)
+
+	doc, err := ParseDocument[MigratingKennel]([]byte(`[{"type":"dog","name":"Max"}]`), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	doc.Value.Dogs[0].Species = "dog"
+	doc.Value.Dogs = append(doc.Value.Dogs, Pet{Name: "Rex"})
+	bytes, err = doc.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"canine","name":"Max","species":"dog"},{"type":"canine","name":"Rex"}]`, string(bytes))
+}
@@ -0,0 +1,169 @@
+package poly
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrNilInput is returned when the value to marshal or flatten is nil or a nil
+// pointer.
+var ErrNilInput = errors.New("nil value cannot be marshalled")
+
+// ErrUnsupportedValue is returned, wrapped in an UnsupportedValueError, when
+// the value to marshal or flatten isn't a struct, or holds a value that can't
+// be encoded as JSON, such as a channel or a function.
+var ErrUnsupportedValue = errors.New("unsupported value")
+
+// UnsupportedValueError reports a value that can't be marshalled, either the
+// value given to marshal itself or part of one of its elements.
+type UnsupportedValueError struct {
+	// Field is the path of Go field names from the value given to marshal to
+	// the unsupported value, such as "Pets.Feeder", or empty if the value
+	// given is itself unsupported.
+	Field string
+	// Type is the type of the unsupported value, if it is known.
+	Type reflect.Type
+	// Err is the error returned by encoding/json, if it found the value to
+	// be unsupported while encoding it.
+	Err error
+}
+
+// Error returns the description of the error, including the field it
+// happened on.
+func (e *UnsupportedValueError) Error() string {
+	detail := fmt.Sprintf("cannot marshal %v", e.Type)
+	if e.Err != nil {
+		detail = e.Err.Error()
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%v: %s", ErrUnsupportedValue, detail)
+	}
+	return fmt.Sprintf("field %s: %v: %s", e.Field, ErrUnsupportedValue, detail)
+}
+
+// Is reports whether the target is ErrUnsupportedValue, so that errors.Is
+// matches it as well as the error from encoding/json.
+func (e *UnsupportedValueError) Is(target error) bool {
+	return target == ErrUnsupportedValue
+}
+
+// Unwrap returns the error from encoding/json, if there is one.
+func (e *UnsupportedValueError) Unwrap() error {
+	return e.Err
+}
+
+// CanMarshal reports whether the value can be marshalled with the options,
+// without marshalling it. It returns ErrNilInput if the value is nil or a nil
+// pointer, and an UnsupportedValueError if it isn't a struct or if any of its
+// fields that hold elements has a type that can't be encoded as JSON, such as
+// a channel. The struct tags are checked as Marshal checks them, so an error
+// is also returned for a tag that can't be parsed, for rest fields of the wrong
+// type or more than one of them, and for relative ordering constraints that
+// refer to unknown types or are circular. The types are checked rather than the values, so a field of an
+// interface type is assumed to be fine, and an error can still be returned by
+// Marshal, for instance by a MarshalJSON method.
+func CanMarshal(obj any, opts ...Option) error {
+	o := newOptions(opts)
+	sourceType, _, err := marshalInput(obj)
+	if err != nil {
+		return err
+	}
+	_, err = findRestField(sourceType, o.tagKeys)
+	if err != nil {
+		return err
+	}
+	relativeOrder := map[string]tagOptions{}
+	typeNames := map[string]bool{}
+	for i := 0; i < sourceType.NumField(); i++ {
+		field := sourceType.Field(i)
+		if field.Type == elementOrderType || isExcludedField(field, o.tagKeys) || isRestField(field, o.tagKeys) {
+			continue
+		}
+		typeName, tagOpts, err := fieldTypeName(field, o.tagKeys)
+		if err != nil {
+			return err
+		}
+		typeNames[typeName] = true
+		if len(tagOpts.after) > 0 || len(tagOpts.before) > 0 {
+			relativeOrder[typeName] = tagOpts
+		}
+		if path, t := unsupportedType(field.Type, map[reflect.Type]bool{}); t != nil {
+			return &UnsupportedValueError{Field: field.Name + path, Type: t}
+		}
+	}
+	_, err = orderPredecessors(relativeOrder, typeNames)
+	return err
+}
+
+// marshalInput returns the struct type and value of the value to marshal,
+// following a pointer to it.
+func marshalInput(obj any) (reflect.Type, reflect.Value, error) {
+	sourceType := reflect.TypeOf(obj)
+	sourceValue := reflect.ValueOf(obj)
+	if sourceType == nil {
+		return nil, reflect.Value{}, ErrNilInput
+	}
+	if sourceType.Kind() == reflect.Pointer {
+		if sourceValue.IsNil() {
+			return nil, reflect.Value{}, ErrNilInput
+		}
+		sourceType = sourceType.Elem()
+		sourceValue = sourceValue.Elem()
+	}
+	if sourceType.Kind() != reflect.Struct {
+		return nil, reflect.Value{}, &UnsupportedValueError{Type: reflect.TypeOf(obj)}
+	}
+	return sourceType, sourceValue, nil
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// unsupportedType returns the first type within t that encoding/json can't
+// encode, along with the path of field names that leads to it from t, such as
+// ".Feeder". A nil type is returned if there is none. The types that encode
+// themselves are assumed to be fine.
+func unsupportedType(t reflect.Type, visiting map[reflect.Type]bool) (string, reflect.Type) {
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+		return "", nil
+	}
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return "", t
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return unsupportedType(t.Elem(), visiting)
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !t.Key().Implements(textMarshalerType) {
+				return "", t
+			}
+		}
+		return unsupportedType(t.Elem(), visiting)
+	case reflect.Struct:
+		if visiting[t] {
+			return "", nil
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Tag.Get("json") == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			if path, bad := unsupportedType(f.Type, visiting); bad != nil {
+				return "." + f.Name + path, bad
+			}
+		}
+	}
+	return "", nil
+}
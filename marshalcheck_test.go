@@ -0,0 +1,128 @@
+package poly
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+type Feeder struct {
+	Name   string        `json:"name"`
+	Signal chan struct{} `json:"signal"`
+}
+
+type Farm struct {
+	Feeders []Feeder `poly:"feeder"`
+	Pets    []Pet    `poly:"pet"`
+}
+
+type Gauge struct {
+	Reading float64 `json:"reading"`
+}
+
+type Station struct {
+	Gauges []Gauge `poly:"gauge"`
+}
+
+type GuardedFarm struct {
+	mu      sync.Mutex
+	visits  int
+	feeders []Feeder
+	Pets    []Pet `poly:"pet"`
+}
+
+func TestMarshal_NilInput(t *testing.T) {
+	_, err := Marshal(nil)
+	assert.ErrorIs(t, err, ErrNilInput)
+	_, err = Marshal((*Residence)(nil))
+	assert.ErrorIs(t, err, ErrNilInput)
+	_, err = FlattenWithOptions(nil)
+	assert.ErrorIs(t, err, ErrNilInput)
+	assert.Nil(t, Flatten(nil))
+	assert.Nil(t, Flatten(42))
+}
+
+func TestMarshal_UnsupportedValue(t *testing.T) {
+	_, err := Marshal(42)
+	assert.ErrorIs(t, err, ErrUnsupportedValue)
+	assert.EqualError(t, err, "unsupported value: cannot marshal int")
+	_, err = Marshal(&[]Pet{})
+	assert.EqualError(t, err, "unsupported value: cannot marshal *[]poly.Pet")
+
+	_, err = Marshal(Farm{Feeders: []Feeder{{Name: "A", Signal: make(chan struct{})}}})
+	var unsupported *UnsupportedValueError
+	assert.True(t, errors.As(err, &unsupported))
+	assert.Equal(t, "Feeders", unsupported.Field)
+	assert.Equal(t, reflect.TypeOf(make(chan struct{})), unsupported.Type)
+	assert.ErrorIs(t, err, ErrUnsupportedValue)
+
+	_, err = Marshal(Station{Gauges: []Gauge{{Reading: math.NaN()}}})
+	assert.ErrorIs(t, err, ErrUnsupportedValue)
+	var jsonErr *json.UnsupportedValueError
+	assert.True(t, errors.As(err, &jsonErr))
+	assert.Contains(t, err.Error(), "field Gauges: unsupported value: ")
+}
+
+func TestCanMarshal(t *testing.T) {
+	assert.NoError(t, CanMarshal(Residence{}))
+	assert.NoError(t, CanMarshal(&Residence{}))
+	assert.ErrorIs(t, CanMarshal(nil), ErrNilInput)
+	assert.ErrorIs(t, CanMarshal((*Residence)(nil)), ErrNilInput)
+	assert.EqualError(t, CanMarshal("dog"), "unsupported value: cannot marshal string")
+
+	// The types are checked even if there are no elements.
+	err := CanMarshal(Farm{})
+	assert.EqualError(t, err, "field Feeders.Signal: unsupported value: cannot marshal chan struct {}")
+
+	type Hidden struct {
+		Feeders []Feeder `poly:"-"`
+		Pets    []Pet    `poly:"pet"`
+	}
+	assert.NoError(t, CanMarshal(Hidden{}))
+
+	type Callbacks struct {
+		Handlers map[string]func() `poly:"handlers"`
+		Sets     map[Pet]bool      `poly:"sets"`
+	}
+	err = CanMarshal(Callbacks{})
+	assert.EqualError(t, err, "field Handlers: unsupported value: cannot marshal func()")
+}
+
+func TestCanMarshal_Tags(t *testing.T) {
+	// CanMarshal fails on the same struct tags as Marshal.
+	type Misspelled struct {
+		Pets []Pet `poly:"pet,aftr=person"`
+	}
+	type BadRest struct {
+		Pets []Pet `poly:"pet"`
+		Rest int   `poly:"*"`
+	}
+	for _, v := range []any{Misspelled{}, BadRest{}, CircularReport{}, UnknownOrderReport{}} {
+		_, marshalErr := Marshal(v)
+		assert.Error(t, marshalErr)
+		assert.Equal(t, marshalErr, CanMarshal(v))
+	}
+	assert.EqualError(t, CanMarshal(Misspelled{}), `field Pets: unknown tag option "aftr"`)
+	assert.NoError(t, CanMarshal(Report{}))
+}
+
+func TestMarshal_UnexportedFields(t *testing.T) {
+	farm := &GuardedFarm{
+		visits:  2,
+		feeders: []Feeder{{Name: "A", Signal: make(chan struct{})}},
+		Pets:    []Pet{{Name: "Fido"}},
+	}
+	assert.NoError(t, CanMarshal(farm))
+
+	data, err := Marshal(farm)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"name":"Fido"}]`, string(data))
+
+	flattened, err := FlattenWithOptions(farm)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{Pet{Name: "Fido"}}, flattened)
+}
@@ -0,0 +1,64 @@
+package poly
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrMemoryLimit is returned, wrapped in a MemoryLimitError, when unmarshalling
+// would use more memory than allowed by WithMemoryLimit.
+var ErrMemoryLimit = errors.New("memory limit exceeded")
+
+// MemoryLimitError reports that unmarshalling was stopped because decoding an
+// element would have taken the approximate memory used by the call over the
+// limit given with WithMemoryLimit.
+type MemoryLimitError struct {
+	// Limit is the memory limit in bytes.
+	Limit int
+	// Used is the approximate memory in bytes that would have been used by
+	// the call if the element had been decoded.
+	Used int
+	// Index is the position of the element in the array or source.
+	Index int
+	// TypeName is the polymorphic type name of the element.
+	TypeName string
+}
+
+// Error returns the description of the error, including the element it
+// happened on.
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("element %d of type %q: %v: about %d bytes used of %d", e.Index, e.TypeName, ErrMemoryLimit, e.Used, e.Limit)
+}
+
+// Unwrap returns ErrMemoryLimit.
+func (e *MemoryLimitError) Unwrap() error {
+	return ErrMemoryLimit
+}
+
+// memoryBudget tracks the approximate memory used by an unmarshalling against
+// its limit. A limit of zero means that there is no limit.
+type memoryBudget struct {
+	limit int
+	used  int
+}
+
+// charge adds the approximate memory needed to decode an element into a value
+// of the element type, which is the size of the value itself plus that of its
+// JSON, as its strings and slices are about as large as the JSON they are
+// decoded from. A nil element type charges only the JSON, as for the copies of
+// raw elements. An error is returned, and nothing is charged, if the limit
+// would be exceeded.
+func (m *memoryBudget) charge(index int, typeName string, size int, elemType reflect.Type) error {
+	if m.limit <= 0 {
+		return nil
+	}
+	if elemType != nil {
+		size += int(elemType.Size())
+	}
+	if m.used+size > m.limit {
+		return &MemoryLimitError{Limit: m.limit, Used: m.used + size, Index: index, TypeName: typeName}
+	}
+	m.used += size
+	return nil
+}
@@ -0,0 +1,56 @@
+package poly
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalWithOptions_MemoryLimit(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"pet", "name":"Fido"},
+		{"type":"pet", "name":"Rex"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithMemoryLimit(1<<20))
+	assert.NoError(t, err)
+	assert.Len(t, result.Pets, 2)
+
+	result = Residence{}
+	err = UnmarshalWithOptions(input, &result, WithMemoryLimit(100))
+	assert.True(t, errors.Is(err, ErrMemoryLimit))
+	var limitErr *MemoryLimitError
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, 100, limitErr.Limit)
+	assert.Greater(t, limitErr.Used, 100)
+	assert.Equal(t, "pet", limitErr.TypeName)
+	assert.Equal(t, 1, limitErr.Index)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Empty(t, result.Pets)
+}
+
+func TestUnmarshalWithOptions_MemoryLimitRest(t *testing.T) {
+	type withRest struct {
+		People []Person        `poly:"person"`
+		Rest   json.RawMessage `poly:"!rest"`
+	}
+	input := []byte(`[{"type":"unknown", "padding":"` + strings.Repeat("x", 200) + `"}]`)
+
+	var result withRest
+	err := UnmarshalWithOptions(input, &result, WithMemoryLimit(100))
+	assert.ErrorIs(t, err, ErrMemoryLimit)
+	assert.EqualError(t, err, `element 0 of type "unknown": memory limit exceeded: about 232 bytes used of 100`)
+}
+
+func TestUnmarshalWithOptions_MemoryLimitAccumulator(t *testing.T) {
+	input := []byte(`[{"type":"person", "name":"John"}, {"type":"pet", "name":"Fido"}]`)
+
+	list := &lockedList{}
+	err := UnmarshalWithOptions(input, list, WithRegistry(accumulatorRegistry()), WithMemoryLimit(100))
+	assert.ErrorIs(t, err, ErrMemoryLimit)
+	assert.Len(t, list.elements, 1)
+}
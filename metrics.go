@@ -0,0 +1,32 @@
+package poly
+
+// Metrics is a hook that is notified of the work done by MarshalWithOptions
+// and UnmarshalWithOptions when it is given with the WithMetrics option. This
+// allows wiring the library into a monitoring system; the polymetrics
+// sub-package provides ready-made implementations.
+//
+// The methods are called synchronously from the marshalling and unmarshalling
+// functions, so implementations must be quick and, if those functions are
+// called concurrently, safe for concurrent use.
+type Metrics interface {
+	// ElementDecoded is called for each element that is unmarshalled into the
+	// target, with its type name and the size of its JSON in bytes.
+	ElementDecoded(typeName string, size int)
+
+	// ElementUnmatched is called for each element that is skipped because its
+	// type name doesn't match any field of the target. The type name is empty
+	// if the TypeLocator didn't find one.
+	ElementUnmatched(typeName string, size int)
+
+	// Decoded is called once for each unmarshalling with the number of
+	// elements in the JSON array and the error, if any.
+	Decoded(elements int, err error)
+
+	// ElementEncoded is called for each element that is marshalled, with its
+	// type name and the size of its JSON in bytes.
+	ElementEncoded(typeName string, size int)
+
+	// Encoded is called once for each marshalling with the number of elements
+	// that were marshalled and the error, if any.
+	Encoded(elements int, err error)
+}
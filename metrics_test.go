@@ -0,0 +1,79 @@
+package poly
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// recordingMetrics is a Metrics implementation that records every call.
+type recordingMetrics struct {
+	calls []string
+}
+
+func (m *recordingMetrics) ElementDecoded(typeName string, size int) {
+	m.calls = append(m.calls, fmt.Sprintf("decoded %s %d", typeName, size))
+}
+
+func (m *recordingMetrics) ElementUnmatched(typeName string, size int) {
+	m.calls = append(m.calls, fmt.Sprintf("unmatched %s %d", typeName, size))
+}
+
+func (m *recordingMetrics) Decoded(elements int, err error) {
+	m.calls = append(m.calls, fmt.Sprintf("done decoding %d %v", elements, err))
+}
+
+func (m *recordingMetrics) ElementEncoded(typeName string, size int) {
+	m.calls = append(m.calls, fmt.Sprintf("encoded %s %d", typeName, size))
+}
+
+func (m *recordingMetrics) Encoded(elements int, err error) {
+	m.calls = append(m.calls, fmt.Sprintf("done encoding %d %v", elements, err))
+}
+
+func TestMetrics_Unmarshal(t *testing.T) {
+	in := `[{"type":"TypeString","ValueA":"A"},{"type":"nope"},{"ValueA":"B"}]`
+	m := &recordingMetrics{}
+
+	var result SlicesABC
+	err := UnmarshalWithOptions([]byte(in), &result, WithMetrics(m))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"decoded TypeString 34",
+		"unmatched nope 15",
+		"unmatched  14",
+		"done decoding 3 <nil>",
+	}, m.calls)
+
+	m = &recordingMetrics{}
+	err = UnmarshalWithOptions([]byte(`{}`), &result, WithMetrics(m))
+	assert.Error(t, err)
+	assert.Len(t, m.calls, 1)
+	assert.Equal(t, "done decoding 0 JSON is not an array", m.calls[0])
+}
+
+func TestMetrics_Marshal(t *testing.T) {
+	in := SlicesABC{
+		TypeString: []TypeString{{ValueA: "A"}},
+		TypeIntP:   &TypeInt{ValueC: 105, index: 1},
+	}
+	m := &recordingMetrics{}
+
+	_, err := MarshalWithOptions(in, WithMetrics(m))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"encoded TypeIntP 14",
+		"encoded TypeString 14",
+		"done encoding 2 <nil>",
+	}, m.calls)
+}
+
+func TestUnmarshalWithOptions_Locator(t *testing.T) {
+	var result SlicesABC
+	err := UnmarshalWithOptions([]byte(`[{"type":"TypeString","ValueA":"A"}]`), &result, WithLocator(DefaultLocator))
+	assert.NoError(t, err)
+	assert.Len(t, result.TypeString, 1)
+
+	err = UnmarshalWithOptions([]byte(`[{"type":"TypeString","ValueA":"A"}]`), &result, WithLocator(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// UnmarshalMulti works like Unmarshal, but decodes the JSON array into several
+// targets at once. The type name of each element is resolved only once, and
+// the element is then delivered to every target that has a field for it. This
+// gives different subsystems, such as auditing, billing, and a projection,
+// each their own typed view from a single parse of the payload. Every target
+// must be a pointer to a struct; Accumulator targets aren't supported.
+//
+// Example usage:
+//
+//	var audit AuditView
+//	var billing BillingView
+//	err := poly.UnmarshalMulti(data, &audit, &billing)
+func UnmarshalMulti(rawJson []byte, targets ...any) error {
+	return UnmarshalMultiWithOptions(rawJson, targets)
+}
+
+// UnmarshalMultiWithOptions works like UnmarshalMulti, but allows the
+// unmarshalling behavior to be adjusted with the given options, which apply to
+// all of the targets.
+func UnmarshalMultiWithOptions(rawJson []byte, targets []any, opts ...Option) (err error) {
+	o := newOptions(opts)
+	if len(rawJson) == 0 {
+		return nil
+	}
+
+	count := 0
+	if o.metrics != nil {
+		defer func() {
+			o.metrics.Decoded(count, err)
+		}()
+	}
+	if o.report != nil {
+		o.report.reset()
+		start := time.Now()
+		defer func() {
+			o.report.Elements = count
+			o.report.Duration = time.Since(start)
+		}()
+	}
+
+	decoders := make([]*decoder, len(targets))
+	for i, target := range targets {
+		if _, ok := target.(Accumulator); ok {
+			return fmt.Errorf("target %d of type %T is an Accumulator, which UnmarshalMulti doesn't support", i, target)
+		}
+		decoders[i], err = newDecoder(target, o)
+		if err != nil {
+			return err
+		}
+	}
+	resolve, err := optionsResolver(o)
+	if err != nil {
+		return err
+	}
+
+	count, err = forEachElement(wrapSource(newArraySource(rawJson, o.objectMode), o), o.firstIndex, resolve, func(index int, typeName string, raw json.RawMessage) error {
+		for _, d := range decoders {
+			err := d.element(index, typeName, raw)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, d := range decoders {
+		err = d.finish(count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
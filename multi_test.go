@@ -0,0 +1,72 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type PeopleView struct {
+	People []Person `poly:"person"`
+}
+
+type PetsView struct {
+	Pets  []Pet           `poly:"pet"`
+	Owner *Person         `poly:"person"`
+	Rest  json.RawMessage `poly:"!rest"`
+}
+
+func TestUnmarshalMulti(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"pet", "name":"Fido"},
+		{"type":"location", "address":"123 Main St"}
+	]`)
+
+	var people PeopleView
+	var pets PetsView
+	var residence Residence
+	err := UnmarshalMulti(input, &people, &pets, &residence)
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, people.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, pets.Pets)
+	assert.Equal(t, &Person{Name: "John"}, pets.Owner)
+	assert.JSONEq(t, `[{"type":"location", "address":"123 Main St"}]`, string(pets.Rest))
+	assert.Equal(t, Residence{
+		Location: Location{Address: "123 Main St"},
+		People:   []Person{{Name: "John"}},
+		Pets:     []Pet{{Name: "Fido"}},
+	}, residence)
+
+	// The type names are resolved once for all of the targets.
+	resolved := 0
+	people = PeopleView{}
+	err = UnmarshalMultiWithOptions(input, []any{&people, &pets}, WithExternalResolver(ExternalResolverFunc(func(index int) (string, error) {
+		resolved++
+		return "person", nil
+	})))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, resolved)
+	assert.Len(t, people.People, 3)
+}
+
+func TestUnmarshalMulti_ExternalTagging(t *testing.T) {
+	input := []byte(`[{"person":{"name":"John"}}, {"pet":{"name":"Fido"}}]`)
+
+	var people PeopleView
+	var pets PetsView
+	err := UnmarshalMultiWithOptions(input, []any{&people, &pets}, WithExternalTagging())
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, people.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, pets.Pets)
+	assert.Equal(t, &Person{Name: "John"}, pets.Owner)
+}
+
+func TestUnmarshalMulti_Errors(t *testing.T) {
+	var people PeopleView
+	err := UnmarshalMulti([]byte(`[]`), &people, &lockedList{})
+	assert.EqualError(t, err, "target 1 of type *poly.lockedList is an Accumulator, which UnmarshalMulti doesn't support")
+
+	err = UnmarshalMulti([]byte(`[{"type":"person","name":1}]`), &people)
+	assert.Error(t, err)
+}
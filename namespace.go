@@ -0,0 +1,73 @@
+package poly
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// TrimTypePrefix returns a type name transform for WithTypeNameTransform that
+// removes the first of the prefixes that the type name starts with, such as
+// the namespace of fully qualified type names:
+//
+//	poly.WithTypeNameTransform(poly.TrimTypePrefix("com.example.", "org.example."))
+func TrimTypePrefix(prefixes ...string) func(typeName string) string {
+	return func(typeName string) string {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(typeName, prefix) {
+				return typeName[len(prefix):]
+			}
+		}
+		return typeName
+	}
+}
+
+// TrimTypeSuffix returns a type name transform for WithTypeNameTransform that
+// removes the first of the suffixes that the type name ends with, such as a
+// version:
+//
+//	poly.WithTypeNameTransform(poly.TrimTypeSuffix("/v1", "/v2"))
+func TrimTypeSuffix(suffixes ...string) func(typeName string) string {
+	return func(typeName string) string {
+		for _, suffix := range suffixes {
+			if strings.HasSuffix(typeName, suffix) {
+				return typeName[:len(typeName)-len(suffix)]
+			}
+		}
+		return typeName
+	}
+}
+
+// transformResolver wraps a resolver to apply the transforms, in order, to the
+// type names it finds. Elements without a type name are left alone.
+func transformResolver(transforms []func(typeName string) string, resolve resolver) resolver {
+	return func(index int, raw json.RawMessage) (string, error) {
+		typeName, err := resolve(index, raw)
+		if err != nil || typeName == "" {
+			return typeName, err
+		}
+		for _, transform := range transforms {
+			typeName = transform(typeName)
+		}
+		return typeName, nil
+	}
+}
+
+// transformSource wraps an ElementSource to apply the transforms, in order, to
+// the type names that come with its elements, such as the keys of externally
+// tagged elements, which are never passed to a resolver.
+type transformSource struct {
+	src        ElementSource
+	transforms []func(typeName string) string
+}
+
+// Next implements the ElementSource interface.
+func (s transformSource) Next() (SourceElement, error) {
+	e, err := s.src.Next()
+	if err != nil || e.TypeName == "" {
+		return e, err
+	}
+	for _, transform := range s.transforms {
+		e.TypeName = transform(e.TypeName)
+	}
+	return e, nil
+}
@@ -0,0 +1,53 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshal_TypeNameTransform(t *testing.T) {
+	in := []byte(`[
+		{"type":"com.example.person","name":"John"},
+		{"type":"org.example.pet/v2","name":"Fido"},
+		{"type":"pet","name":"Rex"},
+		{"type":"com.example.animal/v1","name":"Tom"},
+		{"type":"net.example.person","name":"?"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(in, &result,
+		WithTypeNameTransform(TrimTypePrefix("com.example.", "org.example.")),
+		WithTypeNameTransform(TrimTypeSuffix("/v1", "/v2")),
+		WithVocabulary(map[string][]string{"pet": {"animal"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Rex"}, {Name: "Tom"}}, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalWithOptions([]byte(`[{"type":"PERSON","name":"John"},{"name":"?"}]`), &result, WithTypeNameTransform(strings.ToLower))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+
+	result = Residence{}
+	err = UnmarshalWithOptions([]byte(`[{"Person":{"name":"John"}},{"com.example.pet":{"name":"Fido"}}]`), &result,
+		WithExternalTagging(),
+		WithTypeNameTransform(strings.ToLower),
+		WithTypeNameTransform(TrimTypePrefix("com.example.")))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalCSV(strings.NewReader("kind,name\nPERSON,John\n"), &result, "kind", WithTypeNameTransform(strings.ToLower))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+}
+
+func TestTrimType(t *testing.T) {
+	assert.Equal(t, "dog", TrimTypePrefix("a.", "a.b.")("a.dog"))
+	assert.Equal(t, "b.dog", TrimTypePrefix("a.", "a.b.")("a.b.dog"))
+	assert.Equal(t, "x.dog", TrimTypePrefix("a.")("x.dog"))
+	assert.Equal(t, "dog", TrimTypeSuffix("/v1")("dog/v1"))
+	assert.Equal(t, "dog/v3", TrimTypeSuffix("/v1")("dog/v3"))
+}
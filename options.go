@@ -0,0 +1,1054 @@
+package poly
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Option configures the optional behaviors of the functions that accept
+// options, such as MarshalWithOptions. Options are applied in the order they
+// are given, so later options override earlier ones where they conflict.
+type Option func(*options)
+
+// options holds the configuration assembled from a list of Option values.
+type options struct {
+	// strictIndices requires every flattened element to report a unique,
+	// non-negative index through the IndexGettable interface.
+	strictIndices bool
+
+	// includeZeroValues keeps elements with zero values when flattening.
+	includeZeroValues bool
+
+	// omitters report whether an element of their type name holds the
+	// default value for the type, in which case it is left out when
+	// flattening.
+	omitters map[string]func(v any) bool
+
+	// synthetic computes the elements that are added after those of the
+	// target when marshalling.
+	synthetic func(target any) []any
+
+	// discriminatorKey is the key under which the type name of each element
+	// is added when marshalling. Nothing is added if it is empty.
+	discriminatorKey string
+
+	// envelope is the object the flattened array is wrapped in, if any.
+	envelope *envelope
+
+	// rawFormat controls how raw elements are emitted when marshalling,
+	// with rawIndentPrefix and rawIndent used for rawIndent.
+	rawFormat       rawFormat
+	rawIndentPrefix string
+	rawIndent       string
+
+	// typeLocator determines the type name of each element when
+	// unmarshalling.
+	typeLocator reflect.Type
+
+	// typeKeys, if set, are the keys that the type name of each element is
+	// read from when unmarshalling, in place of the typeLocator.
+	typeKeys []string
+
+	// defaultType is the type name of the field that receives the elements
+	// whose type names match no field, in place of the default tag option.
+	defaultType string
+
+	// manifest makes marshalling put a manifest of the elements at the start
+	// of the array, and unmarshalling use it.
+	manifest bool
+
+	// strategy is how the elements of a JSON array are read and decoded,
+	// with the thresholds used by StrategyAuto and for the number of workers.
+	strategy   Strategy
+	thresholds AutoThresholds
+
+	// workers, if more than one, is the number of goroutines the elements
+	// are decoded on when the parallel strategy is used.
+	workers int
+
+	// conflicts, if set, decides the type name of the elements whose keys
+	// hold different type names.
+	conflicts func(found []Discriminator) (string, error)
+
+	// typeCodes maps the numeric type codes of the elements to their type
+	// names.
+	typeCodes map[int64]string
+
+	// typeResolver, if set, returns the type name of each element from its
+	// JSON when unmarshalling, in place of the typeKeys and the typeLocator.
+	typeResolver func(raw json.RawMessage) (string, error)
+
+	// fieldOverrides maps type names to the names of the target fields they
+	// are unmarshalled into, taking precedence over the struct tags.
+	fieldOverrides []fieldOverride
+
+	// registry provides the types of the elements when unmarshalling into an
+	// Accumulator.
+	registry *Registry
+
+	// predicates decide whether the elements of their type names are
+	// decoded.
+	predicates map[string]func(raw json.RawMessage) bool
+
+	// extraFields makes the fields of the element structs that are tagged
+	// with `polyextra:"true"` keep the keys the structs don't know.
+	extraFields bool
+
+	// sealers transform the JSON of the elements of their type names when
+	// marshalling, and reverse it when unmarshalling.
+	sealers map[string]sealer
+
+	// fieldDecoders decode the elements of their type names in place of
+	// encoding/json.
+	fieldDecoders map[string]func(raw json.RawMessage) (any, error)
+
+	// fieldEncoders encode the elements of their type names in place of
+	// encoding/json.
+	fieldEncoders map[string]func(v any) (json.RawMessage, error)
+
+	// useNumber decodes the numbers in interface values as json.Number.
+	useNumber bool
+
+	// defaultTags makes the `default` tags of the element fields provide
+	// the values of the fields missing from the JSON.
+	defaultTags bool
+
+	// defaulters are called with each decoded element of their type name.
+	defaulters map[string]func(v any)
+
+	// resolveReferences sets the `polyref` fields of the elements once they
+	// are all decoded.
+	resolveReferences bool
+
+	// batchAllocation decodes the elements of non-pointer slice fields in
+	// place.
+	batchAllocation bool
+
+	// reset clears the fields of the target that receive elements before
+	// unmarshalling into it.
+	reset bool
+
+	// recoverPanics turns panics while decoding an element into errors.
+	recoverPanics bool
+
+	// elementTimeout limits the time spent decoding a single element. There
+	// is no limit if it is zero.
+	elementTimeout time.Duration
+
+	// tagKeys are the keys of the struct tags that map the fields of the
+	// target to type names, in order of preference.
+	tagKeys []string
+
+	// typeFields makes the type fields of the element structs, tagged with
+	// `polytype:"true"`, determine and carry the type names.
+	typeFields bool
+
+	// duckTyping makes the elements without a type name be matched to the
+	// target fields by the keys they hold.
+	duckTyping bool
+
+	// externalTags makes each element an object whose only key is the type
+	// name of the element and whose value is the element itself.
+	externalTags bool
+
+	// payloadKey, if set, is the key of the elements that holds their
+	// payload, next to their type name.
+	payloadKey string
+
+	// provenance, if set, holds the keys of the objects that the elements
+	// are wrapped in with their positions and type names.
+	provenance *ProvenanceKeys
+
+	// objectMode selects how a top-level object is unmarshalled.
+	objectMode ObjectMode
+
+	// vocabulary maps canonical type names to the aliases that are accepted
+	// for them when unmarshalling.
+	vocabulary map[string][]string
+
+	// typeNameTransforms are applied in order to the type names found when
+	// unmarshalling, before they are translated with the vocabulary.
+	typeNameTransforms []func(typeName string) string
+
+	// externalResolver provides out-of-band type names by element index.
+	externalResolver ExternalResolver
+
+	// locatorCache caches the type names of small elements.
+	locatorCache *LocatorCache
+
+	// orderSink is told the original order of the elements when
+	// unmarshalling, as if the target implemented OrderSettable. It is used
+	// internally, by Document.
+	orderSink OrderSettable
+
+	// partial is set when only a part of an array is decoded, starting with
+	// the element at firstIndex, so that the ordering constraints, which
+	// need all of it, can't be checked. It is used internally, by
+	// UnmarshalPartial.
+	partial    bool
+	firstIndex int
+
+	// elementKeys are the keys of the elements by index, which are given to
+	// the elements that implement KeySettable. It is used internally, by
+	// UnmarshalMap.
+	elementKeys []string
+
+	// elementIDs, if set, is the policy of the IDs given to the elements
+	// that implement IDSettable.
+	elementIDs *IDPolicy
+
+	// metrics is notified of the elements that are encoded and decoded.
+	metrics Metrics
+
+	// report is filled in with the statistics of each unmarshalling.
+	report *DecodeReport
+
+	// memoryLimit is the approximate memory in bytes that an unmarshalling
+	// may use, or zero for no limit.
+	memoryLimit int
+}
+
+// rawFormat is how raw elements are emitted when marshalling.
+type rawFormat int
+
+const (
+	// rawVerbatim emits raw elements exactly as they are.
+	rawVerbatim rawFormat = iota
+	// rawCompact removes the insignificant whitespace from raw elements.
+	rawCompact
+	// rawIndent indents raw elements.
+	rawIndent
+)
+
+// fieldOverride is a mapping given with WithFieldOverride.
+type fieldOverride struct {
+	typeName  string
+	fieldName string
+}
+
+// newOptions builds the options structure from a list of Option values.
+func newOptions(opts []Option) *options {
+	o := &options{
+		tagKeys:     []string{defaultTagKey},
+		typeLocator: DefaultLocator,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithStrictIndices makes marshalling fail if the ordering of the elements is
+// ambiguous. With this option every element must implement the IndexGettable
+// interface, must report a non-negative index, and no two elements may report
+// the same index. Without it, elements sharing an index are interleaved in the
+// order they were encountered, which can hide bugs in the index bookkeeping.
+func WithStrictIndices() Option {
+	return func(o *options) {
+		o.strictIndices = true
+	}
+}
+
+// WithIncludeZeroValues makes marshalling and flattening keep the elements
+// that have zero values, such as an empty struct in a field or in a slice,
+// which are skipped by default. Nil pointers and nil interfaces are always
+// skipped, as there is no element to emit for them, including pointers that
+// lead to a nil pointer or a nil interface.
+func WithIncludeZeroValues() Option {
+	return func(o *options) {
+		o.includeZeroValues = true
+	}
+}
+
+// WithOmitDefault makes marshalling and flattening leave out the elements of
+// the given type name for which isDefault returns true. This keeps the output
+// minimal when elements commonly hold a value that the reader assumes anyway,
+// which Go's notion of a zero value doesn't capture. isDefault is called with
+// the element itself, not a pointer to it, e.g. Dog rather than *Dog.
+func WithOmitDefault(typeName string, isDefault func(v any) bool) Option {
+	return func(o *options) {
+		if o.omitters == nil {
+			o.omitters = map[string]func(v any) bool{}
+		}
+		o.omitters[typeName] = isDefault
+	}
+}
+
+// WithSyntheticElements makes marshalling add the elements computed by the
+// function after those of the target, for derived elements such as summaries,
+// checksums or counts of the other elements that don't belong in the domain
+// structs. The function is called with the value being marshalled. Its
+// elements are emitted as they are unless they are wrapped in a
+// SyntheticElement, which gives them a type name:
+//
+//	poly.WithSyntheticElements(func(target any) []any {
+//	    r := target.(Residence)
+//	    return []any{poly.SyntheticElement{TypeName: "summary", Value: Summary{People: len(r.People)}}}
+//	})
+//
+// The elements are added by MarshalWithOptions, MarshalChunks and Demux, and
+// by Bind and JSONColumn, which marshal with MarshalWithOptions. They aren't
+// added by FlattenWithOptions or by a Builder.
+func WithSyntheticElements(synthetic func(target any) []any) Option {
+	return func(o *options) {
+		o.synthetic = synthetic
+	}
+}
+
+// WithOmitPrototype works like WithOmitDefault, but leaves out the elements of
+// the given type name that are deeply equal to the prototype, which may be
+// given either as a value or as a pointer.
+func WithOmitPrototype(typeName string, prototype any) Option {
+	want := reflect.Indirect(reflect.ValueOf(prototype)).Interface()
+	return WithOmitDefault(typeName, func(v any) bool {
+		return reflect.DeepEqual(v, want)
+	})
+}
+
+// WithDiscriminator makes marshalling add the polymorphic type name of each
+// element to its JSON object under the given key, e.g. "type". This saves the
+// element structs from having to carry a field for the discriminator. The type
+// name is the one that Unmarshal would use to find the field, so the output
+// can be read back directly. Elements that already have the key are left as
+// they are, and elements that are not JSON objects cause an error.
+func WithDiscriminator(key string) Option {
+	return func(o *options) {
+		o.discriminatorKey = key
+	}
+}
+
+// WithEnvelope makes marshalling wrap the flattened array into an object
+// that carries metadata such as a version or a timestamp, for example
+//
+//	{"version":1,"generated_at":"2024-01-02T15:04:05Z","items":[...]}
+//
+// The object is the JSON encoding of meta, which must encode to a JSON object
+// or be nil, with the array added under itemsKey after its own keys. An empty
+// array is emitted as [] rather than null.
+func WithEnvelope(meta any, itemsKey string) Option {
+	return func(o *options) {
+		o.envelope = &envelope{meta: meta, itemsKey: itemsKey}
+	}
+}
+
+// WithRawCompact makes marshalling remove the insignificant whitespace from
+// the elements held in json.RawMessage fields, which are otherwise emitted
+// verbatim.
+func WithRawCompact() Option {
+	return func(o *options) {
+		o.rawFormat = rawCompact
+	}
+}
+
+// WithRawIndent makes marshalling indent the elements held in json.RawMessage
+// fields, which are otherwise emitted verbatim, in the same way as
+// json.Indent with the given prefix and indent.
+func WithRawIndent(prefix string, indent string) Option {
+	return func(o *options) {
+		o.rawFormat = rawIndent
+		o.rawIndentPrefix = prefix
+		o.rawIndent = indent
+	}
+}
+
+// WithLocator sets the TypeLocator used to determine the type name of each
+// element when unmarshalling. It follows the same rules as the typeLocator
+// parameter of UnmarshalCustom. The default is DefaultLocator.
+func WithLocator(typeLocator reflect.Type) Option {
+	return func(o *options) {
+		o.typeLocator = typeLocator
+		o.typeKeys = nil
+		o.typeResolver = nil
+	}
+}
+
+// WithTypeKeys makes unmarshalling read the type name of each element from the
+// first of the keys that holds a non-empty string, in place of the
+// TypeLocator. It is the DefaultLocator with a configurable list of keys, so
+// producers that use other discriminators, such as "kind" or "$type", don't
+// need a TypeLocator of their own. The keys are matched exactly, and
+// DefaultTypeKeys returns the keys of the DefaultLocator to extend:
+//
+//	poly.WithTypeKeys(append(poly.DefaultTypeKeys(), "kind", "$type")...)
+//
+// As with the DefaultLocator, the type codes and the conflicts policy in the
+// options apply to the keys.
+func WithTypeKeys(keys ...string) Option {
+	return func(o *options) {
+		o.typeKeys = keys
+		o.typeResolver = nil
+	}
+}
+
+// WithResolver sets a function that determines the type name of each element
+// from its JSON when unmarshalling, in place of the TypeLocator. It follows the
+// same rules as the resolve parameter of UnmarshalWithResolver.
+func WithResolver(resolve func(raw json.RawMessage) (string, error)) Option {
+	return func(o *options) {
+		o.typeResolver = resolve
+		o.typeKeys = nil
+	}
+}
+
+// WithTypePath makes unmarshalling read the type name of each element from a
+// nested path of keys separated by dots, such as "meta.kind" for elements like
+// {"meta":{"kind":"dog"},...}, in place of the TypeLocator. A key that is a
+// number selects the element of an array at that position. An element without
+// a string at the end of the path is of no interest. This only applies to
+// unmarshalling; WithDiscriminator adds the type name at the top level.
+func WithTypePath(path string) Option {
+	return WithResolver(pathResolver(strings.Split(path, ".")))
+}
+
+// WithTypePointer works like WithTypePath, but takes the location of the type
+// name as an RFC 6901 JSON Pointer, such as "/attributes/type" for elements
+// like {"attributes":{"type":"dog"},...}. Keys that hold slashes or dots can be
+// given with the escapes of JSON Pointers, as in "/meta/content~1type" for the
+// key "content/type". Unmarshalling fails if the pointer isn't valid.
+func WithTypePointer(pointer string) Option {
+	path, err := parsePointer(pointer)
+	if err != nil {
+		return WithResolver(func(raw json.RawMessage) (string, error) {
+			return "", err
+		})
+	}
+	return WithResolver(pathResolver(path))
+}
+
+// WithCompositeKeys makes unmarshalling read the type name of each element from
+// several keys, whose values are joined with slashes, in place of the
+// TypeLocator. For instance, with WithCompositeKeys("kind", "version") the
+// element {"kind":"dog","version":"v2"} is of type "dog/v2" and is decoded into
+// the field tagged `poly:"dog/v2"`. The keys may hold strings or numbers, and
+// those that are missing are left out of the type name, so that an element
+// without a version is of type "dog". This only applies to unmarshalling, as
+// with WithTypePath; implement CompositeTypeLocator for anything more
+// involved.
+func WithCompositeKeys(keys ...string) Option {
+	return WithResolver(compositeResolver(keys))
+}
+
+// WithTagKey sets the key of the struct tags that map the fields of the target
+// to type names, which is "poly" by default. This allows frameworks that embed
+// this library to use their own tag namespace, such as `event:"created"`,
+// without colliding with other tools that already use `poly`. It applies to
+// marshalling and unmarshalling alike, as well as to DescribeTarget,
+// ExportContract, Find and First.
+func WithTagKey(key string) Option {
+	return WithTagKeys(key)
+}
+
+// WithTagKeys works like WithTagKey, but with several tag keys in order of
+// preference. Each field is mapped by the first of the tags it carries. This
+// allows the same target struct to carry the mappings of several vocabularies,
+// such as two generations of an API, and the one to use to be selected for
+// each call:
+//
+//	type Residence struct {
+//	    Dogs []Dog    `poly:"dog" polyv2:"canine"`
+//	    Home Location `poly:"location"`
+//	}
+//
+//	err := poly.UnmarshalWithOptions(v2Data, &residence, poly.WithTagKeys("polyv2", "poly"))
+//
+// Here the Home field keeps its `poly` mapping for both generations.
+func WithTagKeys(keys ...string) Option {
+	return func(o *options) {
+		o.tagKeys = keys
+	}
+}
+
+// WithTypeFields makes the element structs carry their own type names in a
+// string field tagged with `polytype:"true"`, removing the need for a separate
+// TypeLocator in the common case:
+//
+//	type Dog struct {
+//	    Kind string `json:"kind" polytype:"true"`
+//	    Name string `json:"name"`
+//	}
+//
+// When unmarshalling, the type name of each element is read from the JSON keys
+// of the type fields of the element structs of the target, in the order of the
+// fields, instead of with the TypeLocator. If none of the element structs has a
+// type field the TypeLocator is used as usual. When marshalling, an empty type
+// field is filled in with the type name of the element before it is encoded,
+// without modifying the element itself.
+func WithTypeFields() Option {
+	return func(o *options) {
+		o.typeFields = true
+	}
+}
+
+// WithDuckTyping makes unmarshalling match the elements that have no type name,
+// as many payloads have no discriminator at all, to the target field whose
+// element struct best fits the keys they hold. An element goes to the field
+// whose struct knows the most of its keys, such as an element with a species
+// to the field of Pet rather than that of Person, and among those, to the one
+// whose struct has the fewest other keys. An element that fits several fields
+// equally well, or none at all, is of no interest. Fields of raw elements are
+// never matched this way.
+//
+// The elements that do have a type name are matched by it as usual, and the
+// keys are compared as encoding/json does, without regard to case.
+func WithDuckTyping() Option {
+	return func(o *options) {
+		o.duckTyping = true
+	}
+}
+
+// WithExternalTagging makes every element of the array an object whose only key
+// is the type name of the element and whose value is the element itself, such
+// as [{"dog":{"name":"Rex"}},{"cat":{"name":"Tom"}}], which many APIs use. When
+// unmarshalling, the key is used as the type name and the value is decoded;
+// elements that aren't objects with a single key have their type name
+// resolved as usual. When marshalling, each element is wrapped in an object
+// under its type name, and WithDiscriminator is then rarely needed. Elements
+// without a type name, such as those of a `!rest` field, are emitted as they
+// are.
+func WithExternalTagging() Option {
+	return func(o *options) {
+		o.externalTags = true
+	}
+}
+
+// WithAdjacentTagging makes every element of the array an object that holds
+// its type name and, under the payload key, the element itself, such as
+// [{"type":"dog","data":{"name":"Rex"}}]. When unmarshalling, the type name is
+// resolved from the whole element as usual, and the payload is decoded;
+// elements without the payload key are decoded as they are. When marshalling,
+// each element is wrapped in an object under the payload key, and the
+// discriminator given with WithDiscriminator is added next to it.
+func WithAdjacentTagging(payloadKey string) Option {
+	return func(o *options) {
+		o.payloadKey = payloadKey
+	}
+}
+
+// WithProvenance wraps every element of the array in an object that also
+// holds its position and its type name, such as
+// [{"_idx":0,"_type":"dog","value":{"name":"Rex"}}], for pipelines that must
+// preserve the provenance of the elements through systems that reorder arrays.
+// The keys can be changed with the ProvenanceKeys, and the empty ones take their
+// defaults:
+//
+//	poly.WithProvenance(poly.ProvenanceKeys{Index: "seq"})
+//
+// When marshalling, the position is that of the element in the output. When
+// unmarshalling, the elements are put back in the order of their positions and
+// decoded from their values with the type names they hold; elements that
+// aren't wrapped are decoded as they are, after the others. Since the elements
+// may come in any order, they are all read before the first one is decoded. An
+// error is returned for a wrapped element without an integer position.
+func WithProvenance(keys ProvenanceKeys) Option {
+	return func(o *options) {
+		keys = keys.withDefaults()
+		o.provenance = &keys
+	}
+}
+
+// WithElementIDs makes unmarshalling give each element that implements
+// IDSettable a stable ID, computed with ElementID from its type name, its
+// content, and, depending on the policy, its position in the array. The
+// content is canonicalized first, so the whitespace and the order of the keys
+// don't change the ID.
+func WithElementIDs(policy IDPolicy) Option {
+	return func(o *options) {
+		o.elementIDs = &policy
+	}
+}
+
+// WithObjectMode selects how unmarshalling handles JSON whose top-level value
+// is an object rather than an array: with ObjectError, the default, it is
+// rejected with ErrNotArray, with ObjectWrap it is decoded as an array holding
+// only the object, and with ObjectKeyed its keys are the type names of the
+// elements in its values. This applies to UnmarshalWithOptions and
+// ParseDocument; the other sources always return ErrNotArray.
+//
+// With ObjectKeyed, MarshalWithOptions emits the elements in the same form, as
+// an object with an array of the elements of each type name, such as
+// {"person":[{...},{...}],"pet":[{...}]}, with the keys in the order of the
+// first element of each type. Every element must then have a type name, and
+// the element order across types is not kept. The other modes don't change
+// marshalling.
+func WithObjectMode(mode ObjectMode) Option {
+	return func(o *options) {
+		o.objectMode = mode
+	}
+}
+
+// WithVocabulary makes unmarshalling accept other type names for the
+// elements, such as localized or provider-specific discriminator values, in
+// addition to the type names of the target fields. The vocabulary maps each
+// canonical type name to its aliases, so it can be maintained as data rather
+// than code:
+//
+//	poly.WithVocabulary(map[string][]string{
+//	    "dog": {"hund", "chien"},
+//	})
+//
+// It can be given more than once to combine vocabularies, but an alias may be
+// given for only one canonical type name. Marshalling always uses the
+// canonical type names.
+func WithVocabulary(vocabulary map[string][]string) Option {
+	return func(o *options) {
+		if o.vocabulary == nil {
+			o.vocabulary = map[string][]string{}
+		}
+		for typeName, aliases := range vocabulary {
+			o.vocabulary[typeName] = append(o.vocabulary[typeName], aliases...)
+		}
+	}
+}
+
+// WithTypeMapping is like WithVocabulary, but takes the inverse table, which
+// maps each type name found in the JSON to the type name of the target field
+// that the element goes to. This is the form that discriminator mappings of
+// producers usually come in:
+//
+//	poly.WithTypeMapping(map[string]string{
+//	    "hund":  "dog",
+//	    "chien": "dog",
+//	})
+//
+// A type name of the JSON can also be mapped to another type name of the
+// target, which overrides its own field. The mapping can be combined with
+// vocabularies, under the same rule that an alias may be given for only one
+// canonical type name.
+func WithTypeMapping(mapping map[string]string) Option {
+	return func(o *options) {
+		if o.vocabulary == nil {
+			o.vocabulary = map[string][]string{}
+		}
+		for alias, typeName := range mapping {
+			o.vocabulary[typeName] = append(o.vocabulary[typeName], alias)
+		}
+	}
+}
+
+// WithTypeNameTransform makes unmarshalling apply the transform to the type
+// name of each element before it is matched against the target fields, for
+// producers that emit fully qualified type names or type URIs, such as
+// "com.example.dog/v2". TrimTypePrefix and TrimTypeSuffix cover the common
+// cases, and the option can be given more than once to apply several
+// transforms in order:
+//
+//	poly.UnmarshalWithOptions(data, &kennel,
+//	    poly.WithTypeNameTransform(poly.TrimTypePrefix("com.example.")),
+//	    poly.WithTypeNameTransform(poly.TrimTypeSuffix("/v2")))
+//
+// The transforms apply to the type names that come with the elements as well,
+// such as the keys of externally tagged elements and the type column of CSV
+// input. The transformed type names are then translated with the vocabulary,
+// if any. Marshalling is not affected.
+func WithTypeNameTransform(transform func(typeName string) string) Option {
+	return func(o *options) {
+		o.typeNameTransforms = append(o.typeNameTransforms, transform)
+	}
+}
+
+// WithDiscriminatorConflicts sets the policy for the elements that hold
+// different type names under several of the keys that type names are read
+// from, such as {"type":"dog","@type":"cat"}. Without it, the first of the keys
+// in order of priority wins. The policy is given the keys that hold a type name
+// in order of priority, and returns the type name to use or an error that
+// stops the unmarshalling. RejectConflicts and PreferKeys are policies for the
+// common cases:
+//
+//	poly.WithDiscriminatorConflicts(poly.PreferKeys("@type"))
+//
+// It applies to the keys of WithTypeFields and of a Profile, and to the
+// TypeLocators that are DiscriminatorReporters, such as the DefaultLocator.
+func WithDiscriminatorConflicts(policy func(found []Discriminator) (string, error)) Option {
+	return func(o *options) {
+		o.conflicts = policy
+	}
+}
+
+// WithTypeCodes maps numeric type codes to type names, for protocols that
+// identify the type of each element with a number, such as {"type":3}:
+//
+//	poly.WithTypeCodes(map[int64]string{
+//	    1: "person",
+//	    3: "pet",
+//	})
+//
+// When unmarshalling, the codes returned by a TypeCodeLocator, such as the
+// DefaultCodeLocator, and the integers found under the keys of WithTypeFields
+// or of a Profile are translated into type names. A code that isn't mapped is
+// given its decimal form as its type name, such as "7". When marshalling, the
+// discriminator added by WithDiscriminator holds the code of the type name in
+// place of the name, or the lowest code if the type name has several. It can
+// be given more than once to combine mappings.
+func WithTypeCodes(codes map[int64]string) Option {
+	return func(o *options) {
+		if o.typeCodes == nil {
+			o.typeCodes = map[int64]string{}
+		}
+		for code, typeName := range codes {
+			o.typeCodes[code] = typeName
+		}
+	}
+}
+
+// WithExternalResolver makes unmarshalling ask the given ExternalResolver for
+// the type name of each element before looking in the element itself. This
+// supports protocols that carry some of the type information out of band.
+func WithExternalResolver(r ExternalResolver) Option {
+	return func(o *options) {
+		o.externalResolver = r
+	}
+}
+
+// WithLocatorCache makes unmarshalling look up the type names of small elements
+// in the given cache before using the type locator, and remember the ones it
+// resolves. This speeds up feeds where the same few elements repeat many
+// times. See LocatorCache for the details.
+func WithLocatorCache(cache *LocatorCache) Option {
+	return func(o *options) {
+		o.locatorCache = cache
+	}
+}
+
+// WithMetrics makes marshalling and unmarshalling report what they do to the
+// given Metrics implementation.
+func WithMetrics(m Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithDecodeReport makes unmarshalling fill in the report with the number of
+// elements, bytes and time spent decoding for each type name, and with the
+// elements that didn't match the target. Anything already in the report is
+// replaced. The report must not be shared by unmarshallings running
+// concurrently.
+func WithDecodeReport(report *DecodeReport) Option {
+	return func(o *options) {
+		o.report = report
+	}
+}
+
+// WithMemoryLimit limits the approximate memory in bytes that a single
+// unmarshalling may use for the elements it decodes, including the copies of
+// raw and unmatched elements it keeps. If decoding an element would exceed the
+// limit, the unmarshalling stops before decoding it and a MemoryLimitError
+// wrapping ErrMemoryLimit is returned. This protects multi-tenant services from
+// a single oversized payload. The accounting is an estimate based on the sizes
+// of the element types and of the JSON of the elements, rather than a
+// measurement of the actual allocations.
+func WithMemoryLimit(bytes int) Option {
+	return func(o *options) {
+		o.memoryLimit = bytes
+	}
+}
+
+// WithFieldOverride makes unmarshalling put the elements with the given type
+// name into the target field with the given Go name, instead of the field
+// whose `poly` tag or name matches the type name. This allows the same target
+// struct to be used with sources that use different names for the same types,
+// without changing its tags. The field then no longer receives the elements
+// of the type name from its tag. The option may be given several times for
+// the same field to have it receive several type names. An error is returned
+// when unmarshalling if the target has no such field.
+func WithFieldOverride(typeName string, fieldName string) Option {
+	return func(o *options) {
+		o.fieldOverrides = append(o.fieldOverrides, fieldOverride{typeName: typeName, fieldName: fieldName})
+	}
+}
+
+// WithRegistry sets the Registry that provides the types to decode the
+// elements into when unmarshalling into a target that implements Accumulator.
+func WithRegistry(registry *Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithFieldDecoder makes unmarshalling decode the elements of the given type
+// name with the decoder function instead of encoding/json, for instance to use
+// a hand-written parser or a different codec for a few performance-critical
+// types while the rest of the target uses the default path. The function must
+// return a value of the element type of the field the type name maps to, or a
+// pointer to one. The `default` tags don't apply to these elements, but any
+// defaulter registered with WithDefaulter does.
+func WithFieldDecoder(typeName string, decoder func(raw json.RawMessage) (any, error)) Option {
+	return func(o *options) {
+		if o.fieldDecoders == nil {
+			o.fieldDecoders = map[string]func(raw json.RawMessage) (any, error){}
+		}
+		o.fieldDecoders[typeName] = decoder
+	}
+}
+
+// WithFieldEncoder makes marshalling encode the elements with the given type
+// name with the encoder function instead of encoding/json. This allows for
+// special formatting of individual element types, such as a fixed number of
+// decimal places or a legacy layout, without a MarshalJSON method on the type.
+// The encoder is called with the element itself, never a pointer to it, and
+// must return valid JSON, which is emitted as it is apart from the formatting
+// asked for by WithRawCompact or WithRawIndent. The discriminator added by
+// WithDiscriminator is still injected into its output.
+func WithFieldEncoder(typeName string, encoder func(v any) (json.RawMessage, error)) Option {
+	return func(o *options) {
+		if o.fieldEncoders == nil {
+			o.fieldEncoders = map[string]func(v any) (json.RawMessage, error){}
+		}
+		o.fieldEncoders[typeName] = encoder
+	}
+}
+
+// WithFieldPredicate makes unmarshalling decode the elements of the given type
+// name only if the predicate returns true for their JSON, such as when they
+// belong to the right tenant. The other elements are skipped without being
+// decoded, and are counted as unmatched by the metrics and the decode report,
+// but they aren't kept in a `!rest` field since their type is known. For the
+// elements of a batch, the predicate is called for each of the items.
+//
+// Example usage:
+//
+//	poly.WithFieldPredicate("person", func(raw json.RawMessage) bool {
+//	    return bytes.Contains(raw, []byte(`"tenant":"acme"`))
+//	})
+func WithFieldPredicate(typeName string, predicate func(raw json.RawMessage) bool) Option {
+	return func(o *options) {
+		if o.predicates == nil {
+			o.predicates = map[string]func(raw json.RawMessage) bool{}
+		}
+		o.predicates[typeName] = predicate
+	}
+}
+
+// WithExtraFields preserves the keys of the elements that their Go structs
+// don't know, such as vendor extensions, so that a round trip doesn't silently
+// drop them. When unmarshalling, those keys are captured in the field of the
+// element struct that is tagged with `polyextra:"true"`, which must be a
+// map[string]json.RawMessage that is also tagged `json:"-"`. When
+// marshalling, the keys in that field are emitted again after the keys of the
+// struct. The keys that the type name is read from aren't captured, except
+// when it is read with WithResolver or WithTypePath.
+//
+// Example usage:
+//
+//	type Dog struct {
+//	    Name  string                     `json:"name"`
+//	    Extra map[string]json.RawMessage `json:"-" polyextra:"true"`
+//	}
+func WithExtraFields() Option {
+	return func(o *options) {
+		o.extraFields = true
+	}
+}
+
+// WithSealer registers functions that transform the JSON of the elements of
+// the given type name, such as to encrypt sensitive element types or to redact
+// personal information within otherwise plaintext arrays. When marshalling,
+// seal is applied to the JSON of each element of the type name, and must
+// return valid JSON; the discriminator, if any, is added to the sealed element
+// afterwards. When unmarshalling, open is applied to the JSON of each element
+// of the type name before it is decoded. Either function may be nil to
+// transform in one direction only, as for redaction.
+//
+// Since the type of a sealed element must still be resolved to know how to
+// open it, the sealed element must be an object that carries the type name
+// where the type locator finds it, for instance by marshalling with
+// WithDiscriminator.
+//
+// Example usage:
+//
+//	poly.WithSealer("person",
+//	    func(raw json.RawMessage) (json.RawMessage, error) {
+//	        return json.Marshal(map[string][]byte{"sealed": encrypt(raw)})
+//	    },
+//	    func(raw json.RawMessage) (json.RawMessage, error) {
+//	        var sealed struct{ Sealed []byte `json:"sealed"` }
+//	        err := json.Unmarshal(raw, &sealed)
+//	        if err != nil {
+//	            return nil, err
+//	        }
+//	        return decrypt(sealed.Sealed)
+//	    })
+func WithSealer(typeName string, seal func(raw json.RawMessage) (json.RawMessage, error), open func(raw json.RawMessage) (json.RawMessage, error)) Option {
+	return func(o *options) {
+		if o.sealers == nil {
+			o.sealers = map[string]sealer{}
+		}
+		o.sealers[typeName] = sealer{seal: seal, open: open}
+	}
+}
+
+// WithUseNumber makes unmarshalling decode the numbers in interface values of
+// the elements, such as the values of a map[string]any field or an element
+// decoded into a map, as json.Number rather than float64. A json.Number keeps
+// the number exactly as it was written and is marshalled back the same way,
+// so large integers and decimal amounts survive a round trip through Unmarshal
+// and Marshal without losing precision. Fields with a concrete type, such as
+// float64 or *big.Int, are decoded as usual.
+func WithUseNumber() Option {
+	return func(o *options) {
+		o.useNumber = true
+	}
+}
+
+// WithDefaultTags makes unmarshalling honor the `default` tags on the fields
+// of the element structs, such as `default:"10"`. Each field with the tag is
+// set to its default before the element is decoded, so it keeps the default
+// only if the field is missing from the JSON. The tag of a string field is used
+// as it is, and the tag of any other field is parsed as JSON, e.g.
+// `default:"[1, 2]"`. The fields of nested structs are handled as well.
+func WithDefaultTags() Option {
+	return func(o *options) {
+		o.defaultTags = true
+	}
+}
+
+// WithDefaulter registers a function that is called with a pointer to each
+// decoded element of the given type name when unmarshalling, so that it can
+// fill in domain defaults for the optional fields. It is called after the
+// element is decoded and after any `default` tags are applied.
+func WithDefaulter(typeName string, defaulter func(v any)) Option {
+	return func(o *options) {
+		if o.defaulters == nil {
+			o.defaulters = map[string]func(v any){}
+		}
+		o.defaulters[typeName] = defaulter
+	}
+}
+
+// WithReferenceResolution makes unmarshalling link the decoded elements to
+// each other once they are all decoded. A pointer field of an element struct
+// tagged with `polyref`, giving the type name of the referenced elements and
+// the name of their identity field, is set to the element with the identity
+// held by the key field. The key field is named after the pointer field and
+// the identity field unless the key option names it:
+//
+//	type Pet struct {
+//	    OwnerID string  `json:"ownerId"`
+//	    Owner   *Person `json:"-" polyref:"person,ID"`
+//	    Vet     *Person `json:"-" polyref:"person,ID,key=VetRef"`
+//	    VetRef  string  `json:"vet"`
+//	}
+//
+// References with a zero key are left nil, and a reference to an element that
+// doesn't exist is an error.
+func WithReferenceResolution() Option {
+	return func(o *options) {
+		o.resolveReferences = true
+	}
+}
+
+// WithBatchAllocation makes unmarshalling decode the elements of slice fields
+// that hold the elements themselves, rather than pointers to them, directly
+// into the backing array of the slice. This avoids allocating every element on
+// its own, which greatly reduces the pressure on the allocator for arrays with
+// many thousands of elements. It has no effect on other fields, nor when
+// WithElementTimeout is given.
+func WithBatchAllocation() Option {
+	return func(o *options) {
+		o.batchAllocation = true
+	}
+}
+
+// WithReset makes unmarshalling clear the fields of the target that receive
+// elements, including any field that collects the unmatched elements, before
+// decoding into it. By default, unmarshalling into a target that already holds
+// elements appends to its slice fields and overwrites its other fields, which
+// suits accumulating several arrays into one target; with this option the
+// target holds only the elements of the array, as when a target is reused
+// between calls. The fields that aren't mapped to type names are left alone.
+func WithReset() Option {
+	return func(o *options) {
+		o.reset = true
+	}
+}
+
+// WithDefaultType makes unmarshalling decode the elements whose type names
+// don't match any field of the target into the field of the given type name,
+// rather than skipping them. It takes the place of the default tag option, as
+// in `poly:"item,default"`, which does the same for the field it is on. The
+// elements without a type name are still skipped, and the ones that are
+// decoded into the field aren't kept in a field for the unmatched elements.
+func WithDefaultType(typeName string) Option {
+	return func(o *options) {
+		o.defaultType = typeName
+	}
+}
+
+// WithManifest makes marshalling put a manifest element at the start of the
+// array, which lists the type name and the length in bytes of every element:
+//
+//	[{"@manifest":[["person",17],["pet",15]]},{"type":"person",...},{...}]
+//
+// When unmarshalling, an array that starts with a manifest is cut into its
+// elements by their lengths, and their type names are taken from the manifest,
+// so that the TypeLocator isn't needed and only the elements of the target
+// fields are scanned. This is meant for traffic between services that trust
+// each other: a manifest that doesn't fit the array is an error, but one that
+// gives wrong type names can't be detected. Arrays without a manifest are read
+// as usual, and the manifest doesn't count as an element, so the indexes of the
+// elements are the same with and without it. Without this option, the manifest
+// is an element without a type name.
+//
+// When unmarshalling, the manifest takes precedence over WithStrategy. It
+// applies to MarshalWithOptions and Builder, and to UnmarshalWithOptions and
+// UnmarshalWithResolver.
+func WithManifest() Option {
+	return func(o *options) {
+		o.manifest = true
+	}
+}
+
+// WithStrategy sets the way unmarshalling reads and decodes the elements of a
+// JSON array, which is StrategyBatch by default. StrategyAuto chooses between
+// the batch, streaming and parallel strategies for each array, so that the
+// same options give good performance for small and large payloads alike:
+//
+//	err := poly.UnmarshalWithOptions(data, &result, poly.WithStrategy(poly.StrategyAuto))
+//
+// With the parallel strategy, elements are decoded on several goroutines, so
+// the UnmarshalJSON methods of the element types, and the functions given with
+// WithFieldDecoder and WithDefaulter, may be called concurrently. Elements of
+// fields with the items tag option or that hold raw JSON, of type names with a
+// sealer or a predicate, of fields decoded in place with WithBatchAllocation,
+// and every element when WithMemoryLimit is given, are decoded one after the
+// other as with the batch strategy. This applies to UnmarshalWithOptions and
+// UnmarshalWithResolver; the other ways of unmarshalling read and decode the
+// elements as they always do.
+func WithStrategy(strategy Strategy) Option {
+	return func(o *options) {
+		o.strategy = strategy
+	}
+}
+
+// WithAutoThresholds sets the thresholds that StrategyAuto chooses a strategy
+// by, and the number of workers of StrategyParallel. A zero field keeps its
+// default value.
+func WithAutoThresholds(thresholds AutoThresholds) Option {
+	return func(o *options) {
+		o.thresholds = thresholds
+	}
+}
+
+// WithPanicRecovery makes unmarshalling recover from panics raised while
+// decoding an element, typically by a custom UnmarshalJSON implementation of
+// the element type. The panic is returned as an ElementError identifying the
+// element instead of taking down the calling goroutine.
+func WithPanicRecovery() Option {
+	return func(o *options) {
+		o.recoverPanics = true
+	}
+}
+
+// WithElementTimeout limits the time unmarshalling may spend decoding a single
+// element. If the limit is exceeded, an ElementError wrapping
+// ErrElementTimeout is returned. Decoding can't be interrupted, so the
+// goroutine decoding the element keeps running in the background until it
+// finishes; its result is discarded. Since every element is then decoded on
+// its own goroutine, this adds some overhead and is meant for inputs that may
+// contain pathological elements.
+func WithElementTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.elementTimeout = d
+	}
+}
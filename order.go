@@ -0,0 +1,171 @@
+package poly
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+)
+
+// applyRelativeOrder reorders the indexed objects so that the relative
+// ordering constraints declared with the `before` and `after` tag options are
+// satisfied. The reordering is a stable topological sort: an object is only
+// moved if it has to be, and otherwise keeps its place relative to the other
+// objects, including the ordering that was established by the indexes.
+//
+// The relativeOrder map holds the tag options of every type name that declared
+// a constraint. The typeNames map holds every type name of the object being
+// flattened, which is used to catch constraints that refer to unknown types.
+func applyRelativeOrder(indexedObjects []indexedObject, relativeOrder map[string]tagOptions, typeNames map[string]bool) ([]indexedObject, error) {
+	predecessors, err := orderPredecessors(relativeOrder, typeNames)
+	if err != nil {
+		return nil, err
+	}
+
+	// The objects of each type name are queued in order, and a type name is
+	// blocked until all the objects of its predecessors have been emitted.
+	// Predecessors without objects don't block anything.
+	queues := map[string][]int{}
+	var typeOrder []string
+	for i, item := range indexedObjects {
+		if _, ok := queues[item.TypeName]; !ok {
+			typeOrder = append(typeOrder, item.TypeName)
+		}
+		queues[item.TypeName] = append(queues[item.TypeName], i)
+	}
+	blocking := map[string]int{}
+	successors := map[string][]string{}
+	for typeName, preds := range predecessors {
+		if len(queues[typeName]) == 0 {
+			continue
+		}
+		seen := map[string]bool{}
+		for _, pred := range preds {
+			if len(queues[pred]) == 0 || seen[pred] {
+				continue
+			}
+			seen[pred] = true
+			blocking[typeName]++
+			successors[pred] = append(successors[pred], typeName)
+		}
+	}
+
+	// This is Kahn's algorithm over the type names, which repeatedly emits
+	// the earliest object among the heads of the queues that aren't
+	// blocked. Since the constraints are acyclic, every object is emitted.
+	ready := &positionHeap{}
+	for _, typeName := range typeOrder {
+		if blocking[typeName] == 0 {
+			heap.Push(ready, queues[typeName][0])
+		}
+	}
+	ordered := make([]indexedObject, 0, len(indexedObjects))
+	for ready.Len() > 0 {
+		item := indexedObjects[heap.Pop(ready).(int)]
+		ordered = append(ordered, item)
+		queue := queues[item.TypeName][1:]
+		queues[item.TypeName] = queue
+		if len(queue) > 0 {
+			heap.Push(ready, queue[0])
+			continue
+		}
+		for _, succ := range successors[item.TypeName] {
+			blocking[succ]--
+			if blocking[succ] == 0 {
+				heap.Push(ready, queues[succ][0])
+			}
+		}
+	}
+
+	return ordered, nil
+}
+
+// positionHeap is a min-heap of positions in a slice, implementing
+// heap.Interface.
+type positionHeap []int
+
+func (h positionHeap) Len() int           { return len(h) }
+func (h positionHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h positionHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *positionHeap) Push(x any) {
+	*h = append(*h, x.(int))
+}
+
+func (h *positionHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// orderPredecessors maps each type name of the relative ordering constraints
+// to the type names whose elements must all be emitted before any of its own
+// elements. An error is returned if a constraint refers to a type name that
+// isn't in typeNames, or if the constraints are circular.
+func orderPredecessors(relativeOrder map[string]tagOptions, typeNames map[string]bool) (map[string][]string, error) {
+	predecessors := map[string][]string{}
+	for typeName, opts := range relativeOrder {
+		for _, other := range opts.after {
+			if !typeNames[other] {
+				return nil, fmt.Errorf("%q must be after unknown type %q", typeName, other)
+			}
+			predecessors[typeName] = append(predecessors[typeName], other)
+		}
+		for _, other := range opts.before {
+			if !typeNames[other] {
+				return nil, fmt.Errorf("%q must be before unknown type %q", typeName, other)
+			}
+			predecessors[other] = append(predecessors[other], typeName)
+		}
+	}
+	err := checkOrderCycles(predecessors)
+	if err != nil {
+		return nil, err
+	}
+	return predecessors, nil
+}
+
+// checkOrderCycles verifies that the ordering constraints do not contradict
+// each other, e.g. `a` after `b` and `b` after `a`, which could never be
+// satisfied.
+func checkOrderCycles(predecessors map[string][]string) error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+
+	var visit func(typeName string) error
+	visit = func(typeName string) error {
+		switch state[typeName] {
+		case visiting:
+			return fmt.Errorf("ordering constraints on %q are circular", typeName)
+		case visited:
+			return nil
+		}
+		state[typeName] = visiting
+		for _, pred := range predecessors[typeName] {
+			err := visit(pred)
+			if err != nil {
+				return err
+			}
+		}
+		state[typeName] = visited
+		return nil
+	}
+
+	// Visit in a fixed order so that the error reported is deterministic.
+	typeNames := make([]string, 0, len(predecessors))
+	for typeName := range predecessors {
+		typeNames = append(typeNames, typeName)
+	}
+	sort.Strings(typeNames)
+	for _, typeName := range typeNames {
+		err := visit(typeName)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Budget limits how much of a JSON array is decoded by a single call to
+// UnmarshalPartial. A limit of zero means that there is no limit.
+type Budget struct {
+	// MaxElements is the largest number of elements to decode.
+	MaxElements int
+	// MaxBytes is the largest total size of the JSON of the elements to
+	// decode. At least one element is decoded even if it is larger, so that
+	// every call makes progress.
+	MaxBytes int
+}
+
+// UnmarshalPartial works like UnmarshalWithOptions, but decodes only as many
+// elements of the raw JSON array as the budget allows, starting where the
+// previous call left off. This allows giant arrays to be processed in chunks
+// within per-request memory or time budgets.
+//
+// The token is empty on the first call, and is then the continuation token
+// returned by the previous call for the same array. Once the end of the array
+// is reached the returned token is empty. The token is opaque, but it is a
+// plain string, so it can be handed to a client to resume from in a later
+// request. The indexes given to IndexSettable elements are their positions in
+// the whole array.
+//
+// The target may be the same for every call, to collect all the elements, or
+// a new one for each chunk. As each call sees only a part of the array, the
+// `first` and `last` ordering constraints aren't checked, and a `!rest` field
+// receives the unmatched elements of the chunk.
+//
+// Example usage:
+//
+//	var token string
+//	for {
+//	    var chunk Residence
+//	    token, err = poly.UnmarshalPartial(data, &chunk, token, poly.Budget{MaxElements: 100})
+//	    if err != nil { ... }
+//	    process(chunk)
+//	    if token == "" {
+//	        break
+//	    }
+//	}
+func UnmarshalPartial(rawJson []byte, target any, token string, budget Budget, opts ...Option) (string, error) {
+	src := &partialSource{rawJson: rawJson, budget: budget}
+	if token != "" {
+		var err error
+		src.pos, src.index, err = parseContinuationToken(token, len(rawJson))
+		if err != nil {
+			return "", err
+		}
+		src.started = true
+	}
+
+	o := newOptions(opts)
+	o.partial = true
+	o.firstIndex = src.index
+	err := unmarshalSource(src, target, o)
+	if err != nil {
+		return "", err
+	}
+	if !src.done {
+		// Look ahead so that no token is returned for an empty remainder.
+		_, err = src.atEnd(src.skipSpace(src.pos))
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+	}
+	if src.done {
+		return "", nil
+	}
+	return formatContinuationToken(src.pos, src.index+src.count, len(rawJson)), nil
+}
+
+// formatContinuationToken encodes the byte offset in the array to resume from,
+// the index of the next element and the size of the array into a token.
+func formatContinuationToken(pos int, index int, size int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d.%d", pos, index, size)))
+}
+
+// parseContinuationToken decodes a token made by formatContinuationToken for
+// an array of the given size.
+func parseContinuationToken(token string, size int) (int, int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid continuation token")
+	}
+	var pos, index, tokenSize int
+	_, err = fmt.Sscanf(string(decoded), "%d.%d.%d", &pos, &index, &tokenSize)
+	if err != nil || pos <= 0 || pos > size || index < 0 {
+		return 0, 0, fmt.Errorf("invalid continuation token")
+	}
+	if tokenSize != size {
+		return 0, 0, fmt.Errorf("continuation token is for a different array")
+	}
+	return pos, index, nil
+}
+
+// partialSource is an ElementSource over the elements of a JSON array from the
+// byte offset pos, which provides elements until the budget is used up.
+type partialSource struct {
+	rawJson []byte
+	budget  Budget
+
+	// pos is the offset of the next element, or of the comma before it once
+	// started is set. index is the index of the element at pos.
+	pos     int
+	index   int
+	started bool
+
+	// count and size are the number and the total size of the elements provided
+	// so far, and done is set once the end of the array is reached.
+	count int
+	size  int
+	done  bool
+}
+
+// Next implements the ElementSource interface.
+func (s *partialSource) Next() (SourceElement, error) {
+	if s.done || (s.budget.MaxElements > 0 && s.count >= s.budget.MaxElements) {
+		return SourceElement{}, io.EOF
+	}
+
+	pos := s.skipSpace(s.pos)
+	if !s.started {
+		if pos >= len(s.rawJson) || s.rawJson[pos] != '[' {
+			return SourceElement{}, ErrNotArray
+		}
+		pos = s.skipSpace(pos + 1)
+	}
+	end, err := s.atEnd(pos)
+	if err != nil || end {
+		return SourceElement{}, err
+	}
+	if s.started {
+		if pos >= len(s.rawJson) || s.rawJson[pos] != ',' {
+			return SourceElement{}, fmt.Errorf("expected ',' or ']' at offset %d of the JSON array", pos)
+		}
+		pos = s.skipSpace(pos + 1)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(s.rawJson[pos:]))
+	var raw json.RawMessage
+	err = dec.Decode(&raw)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return SourceElement{}, err
+	}
+	if s.budget.MaxBytes > 0 && s.count > 0 && s.size+len(raw) > s.budget.MaxBytes {
+		return SourceElement{}, io.EOF
+	}
+
+	s.pos = pos + int(dec.InputOffset())
+	s.started = true
+	s.count++
+	s.size += len(raw)
+	return SourceElement{Raw: raw}, nil
+}
+
+// atEnd reports whether the array ends at pos, in which case done is set and
+// io.EOF is returned. Nothing but whitespace may follow the array.
+func (s *partialSource) atEnd(pos int) (bool, error) {
+	if pos >= len(s.rawJson) || s.rawJson[pos] != ']' {
+		return false, nil
+	}
+	if s.skipSpace(pos+1) != len(s.rawJson) {
+		return true, fmt.Errorf("unexpected data after the JSON array at offset %d", pos+1)
+	}
+	s.done = true
+	return true, io.EOF
+}
+
+// skipSpace returns the offset of the first byte from pos that isn't JSON
+// whitespace.
+func (s *partialSource) skipSpace(pos int) int {
+	for pos < len(s.rawJson) {
+		switch s.rawJson[pos] {
+		case ' ', '\t', '\n', '\r':
+			pos++
+		default:
+			return pos
+		}
+	}
+	return pos
+}
@@ -0,0 +1,81 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnmarshalPartial(t *testing.T) {
+	input := []byte(` [ {"type":"TypeString","ValueA":"a"}, {"type":"TypeString","ValueA":"b"},
+		{"type":"TypeInt","ValueC":1} ,{"type":"TypeString","ValueA":"c"} ] `)
+
+	var result SlicesABC
+	var chunks []int
+	token := ""
+	for {
+		before := len(result.TypeString)
+		var err error
+		token, err = UnmarshalPartial(input, &result, token, Budget{MaxElements: 2})
+		assert.NoError(t, err)
+		chunks = append(chunks, len(result.TypeString)-before)
+		if token == "" {
+			break
+		}
+	}
+	assert.Equal(t, []int{2, 1}, chunks)
+	assert.Equal(t, []TypeString{{ValueA: "a"}, {ValueA: "b"}, {ValueA: "c"}}, result.TypeString)
+	assert.Equal(t, 2, result.TypeInt.index)
+}
+
+func TestUnmarshalPartial_Bytes(t *testing.T) {
+	input := []byte(`[{"type":"TypeString","ValueA":"a"},{"type":"TypeString","ValueA":"bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},{"type":"TypeString","ValueA":"c"}]`)
+
+	// The second element doesn't fit with the first, but is decoded on its
+	// own even though it is over the budget.
+	var sizes []int
+	token := ""
+	for {
+		var chunk SlicesABC
+		var err error
+		token, err = UnmarshalPartial(input, &chunk, token, Budget{MaxBytes: 70})
+		assert.NoError(t, err)
+		sizes = append(sizes, len(chunk.TypeString))
+		if token == "" {
+			break
+		}
+	}
+	assert.Equal(t, []int{1, 1, 1}, sizes)
+}
+
+func TestUnmarshalPartial_Unlimited(t *testing.T) {
+	var result SlicesABC
+	token, err := UnmarshalPartial([]byte(`[{"type":"TypeString","ValueA":"a"}]`), &result, "", Budget{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", token)
+	assert.Len(t, result.TypeString, 1)
+
+	token, err = UnmarshalPartial([]byte(` [ ] `), &result, "", Budget{})
+	assert.NoError(t, err)
+	assert.Equal(t, "", token)
+}
+
+func TestUnmarshalPartial_Errors(t *testing.T) {
+	input := []byte(`[{"type":"TypeString"},{"type":"TypeString"}]`)
+	var result SlicesABC
+
+	token, err := UnmarshalPartial(input, &result, "", Budget{MaxElements: 1})
+	assert.NoError(t, err)
+	_, err = UnmarshalPartial(append(input, ' '), &result, token, Budget{})
+	assert.EqualError(t, err, "continuation token is for a different array")
+	_, err = UnmarshalPartial(input, &result, "bogus", Budget{})
+	assert.EqualError(t, err, "invalid continuation token")
+
+	_, err = UnmarshalPartial([]byte(`{}`), &result, "", Budget{})
+	assert.EqualError(t, err, "JSON is not an array")
+	_, err = UnmarshalPartial([]byte(`[{"type":"TypeString"} {}]`), &result, "", Budget{})
+	assert.EqualError(t, err, "expected ',' or ']' at offset 23 of the JSON array")
+	_, err = UnmarshalPartial([]byte(`[] []`), &result, "", Budget{})
+	assert.EqualError(t, err, "unexpected data after the JSON array at offset 2")
+	_, err = UnmarshalPartial([]byte(`[{"type":"TypeString"},`), &result, "", Budget{})
+	assert.Error(t, err)
+}
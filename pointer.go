@@ -0,0 +1,34 @@
+package poly
+
+import (
+	"fmt"
+	"strings"
+)
+
+// pointerUnescaper replaces the escapes of the keys of JSON Pointers with the
+// characters they stand for.
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parsePointer splits an RFC 6901 JSON Pointer into the keys it is made of,
+// with the escapes ~1 and ~0 replaced by the slash and the tilde they stand
+// for. The pointer must refer to a value inside the element, so the empty
+// pointer, which refers to the element itself, is not valid.
+func parsePointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %q must start with a slash", pointer)
+	}
+	keys := strings.Split(pointer[1:], "/")
+	for i, key := range keys {
+		for j := 0; j < len(key); j++ {
+			if key[j] != '~' {
+				continue
+			}
+			if j+1 == len(key) || (key[j+1] != '0' && key[j+1] != '1') {
+				return nil, fmt.Errorf("JSON pointer %q has an invalid escape", pointer)
+			}
+			j++
+		}
+		keys[i] = pointerUnescaper.Replace(key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,52 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnmarshalWithOptions_TypePointer(t *testing.T) {
+	in := []byte(`[
+		{"attributes":{"type":"person"},"name":"John"},
+		{"attributes":{"content/type":"pet","~type":"person"},"name":"Fido"},
+		{"attributes":{"tags":[{"kind":"pet"}]},"name":"Rex"},
+		{"attributes":"pet","name":"?"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(in, &result, WithTypePointer("/attributes/type"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Empty(t, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalWithOptions(in, &result, WithTypePointer("/attributes/content~1type"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalWithOptions(in, &result, WithTypePointer("/attributes/~0type"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "Fido"}}, result.People)
+
+	result = Residence{}
+	err = UnmarshalWithOptions(in, &result, WithTypePointer("/attributes/tags/0/kind"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Rex"}}, result.Pets)
+
+	err = UnmarshalWithOptions(in, &result, WithTypePointer("attributes/type"))
+	assert.EqualError(t, err, `JSON pointer "attributes/type" must start with a slash`)
+	err = UnmarshalWithOptions(in, &result, WithTypePointer("/attributes/~2type"))
+	assert.EqualError(t, err, `JSON pointer "/attributes/~2type" has an invalid escape`)
+}
+
+func TestParsePointer(t *testing.T) {
+	keys, err := parsePointer("/a~1b/~01/")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a/b", "~1", ""}, keys)
+
+	_, err = parsePointer("")
+	assert.Error(t, err)
+	_, err = parsePointer("/a~")
+	assert.Error(t, err)
+}
@@ -0,0 +1,265 @@
+// Package polybench provides workload generators and timing harnesses for the
+// poly package, so that projects using it can measure the decoding of their
+// own target shapes against library versions and options, such as streaming
+// versus batch or parallel versus serial decoding, when tuning production
+// decoders.
+package polybench
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gburgyan/go-poly"
+	"github.com/gburgyan/go-poly/polytest"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Workload is a polymorphic JSON document along with the type of the target
+// struct it is decoded into.
+type Workload struct {
+	// Name identifies the workload in benchmark names and results.
+	Name string
+	// Data is the JSON array that is decoded.
+	Data []byte
+	// Elements is the number of elements in the array.
+	Elements int
+
+	targetType reflect.Type
+}
+
+// NewWorkload generates a workload of n random elements for the target struct,
+// which may be a struct or a pointer to one, with polytest.Generate. The same
+// seed always generates the same workload, so results can be compared across
+// runs. NewWorkload panics if the target is not a struct.
+func NewWorkload(name string, target any, n int, seed int64) Workload {
+	w, err := WorkloadFrom(name, target, polytest.Generate(target, n, seed))
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
+
+// WorkloadFrom creates a workload from an existing document, such as a sample
+// of production traffic, that is decoded into the target struct, which may be
+// a struct or a pointer to one. An error is returned if the target is not a
+// struct or if the data is not a JSON array.
+func WorkloadFrom(name string, target any, data []byte) (Workload, error) {
+	t := reflect.TypeOf(target)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return Workload{}, fmt.Errorf("target of workload %q must be a struct, got %T", name, target)
+	}
+	var elements []json.RawMessage
+	err := json.Unmarshal(data, &elements)
+	if err != nil {
+		return Workload{}, fmt.Errorf("data of workload %q is not a JSON array: %w", name, err)
+	}
+	return Workload{
+		Name:       name,
+		Data:       data,
+		Elements:   len(elements),
+		targetType: t,
+	}, nil
+}
+
+// NewTarget returns a pointer to a new, empty target struct of the workload.
+func (w Workload) NewTarget() any {
+	return reflect.New(w.targetType).Interface()
+}
+
+// Mode selects how a Scenario decodes the workload.
+type Mode int
+
+const (
+	// Batch decodes the whole document at once with poly.UnmarshalWithOptions.
+	Batch Mode = iota
+	// Streaming decodes the document one element at a time from a reader
+	// with poly.UnmarshalSource and poly.NewReaderAtSource.
+	Streaming
+)
+
+// String returns the name of the mode.
+func (m Mode) String() string {
+	switch m {
+	case Batch:
+		return "batch"
+	case Streaming:
+		return "streaming"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// Scenario is a way of decoding a workload that is measured.
+type Scenario struct {
+	// Name identifies the scenario in benchmark names and results. If it is
+	// empty, a name is made from the mode and whether it is parallel.
+	Name string
+	// Mode selects batch or streaming decoding.
+	Mode Mode
+	// Parallel decodes the workload from several goroutines at the same
+	// time, to measure the throughput under contention.
+	Parallel bool
+	// Options are passed to every decoding.
+	Options []poly.Option
+}
+
+// name returns the name of the scenario.
+func (s Scenario) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	if s.Parallel {
+		return s.Mode.String() + "-parallel"
+	}
+	return s.Mode.String()
+}
+
+// decode decodes the workload once as the scenario describes.
+func (s Scenario) decode(w Workload) error {
+	target := w.NewTarget()
+	if s.Mode == Streaming {
+		src := poly.NewReaderAtSource(bytes.NewReader(w.Data), int64(len(w.Data)))
+		return poly.UnmarshalSource(src, target, s.Options...)
+	}
+	return poly.UnmarshalWithOptions(w.Data, target, s.Options...)
+}
+
+// Scenarios returns the scenarios that cover every combination of batch and
+// streaming, and serial and parallel decoding, each with the given options.
+func Scenarios(opts ...poly.Option) []Scenario {
+	var scenarios []Scenario
+	for _, mode := range []Mode{Batch, Streaming} {
+		for _, parallel := range []bool{false, true} {
+			scenarios = append(scenarios, Scenario{Mode: mode, Parallel: parallel, Options: opts})
+		}
+	}
+	return scenarios
+}
+
+// Benchmark runs each scenario against the workload as a sub-benchmark of b,
+// named after the workload and the scenario. Besides the time per operation,
+// the throughput is reported in bytes per second and as elements per second.
+// An error from decoding fails the benchmark.
+//
+// Example usage:
+//
+//	func BenchmarkResidence(b *testing.B) {
+//	    w := polybench.NewWorkload("residence", Residence{}, 1000, 1)
+//	    polybench.Benchmark(b, w, polybench.Scenarios()...)
+//	}
+func Benchmark(b *testing.B, w Workload, scenarios ...Scenario) {
+	for _, s := range scenarios {
+		s := s
+		b.Run(w.Name+"/"+s.name(), func(b *testing.B) {
+			b.SetBytes(int64(len(w.Data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			if s.Parallel {
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						err := s.decode(w)
+						if err != nil {
+							b.Error(err)
+							return
+						}
+					}
+				})
+			} else {
+				for i := 0; i < b.N; i++ {
+					err := s.decode(w)
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			elapsed := time.Since(start)
+			if elapsed > 0 {
+				b.ReportMetric(float64(w.Elements*b.N)/elapsed.Seconds(), "elements/s")
+			}
+		})
+	}
+}
+
+// Result is the outcome of measuring a scenario with Measure.
+type Result struct {
+	// Workload and Scenario are the names of what was measured.
+	Workload string
+	Scenario string
+	// Iterations is the number of times the workload was decoded.
+	Iterations int
+	// Duration is the total wall-clock time of the decoding.
+	Duration time.Duration
+}
+
+// PerOp returns the average time of decoding the workload once.
+func (r Result) PerOp() time.Duration {
+	if r.Iterations == 0 {
+		return 0
+	}
+	return r.Duration / time.Duration(r.Iterations)
+}
+
+// String returns a one-line summary of the result.
+func (r Result) String() string {
+	return fmt.Sprintf("%s/%s: %d iterations in %v, %v/op", r.Workload, r.Scenario, r.Iterations, r.Duration, r.PerOp())
+}
+
+// Measure decodes the workload the given number of times as the scenario
+// describes and returns how long it took. It is the counterpart of Benchmark
+// for use outside of `go test`, such as in a command that compares options
+// against a sample of production traffic. A parallel scenario spreads the
+// iterations over GOMAXPROCS goroutines. The first error from decoding stops
+// the measurement and is returned.
+func Measure(w Workload, s Scenario, iterations int) (Result, error) {
+	result := Result{
+		Workload:   w.Name,
+		Scenario:   s.name(),
+		Iterations: iterations,
+	}
+	start := time.Now()
+	if !s.Parallel {
+		for i := 0; i < iterations; i++ {
+			err := s.decode(w)
+			if err != nil {
+				return Result{}, err
+			}
+		}
+		result.Duration = time.Since(start)
+		return result, nil
+	}
+
+	work := make(chan struct{}, iterations)
+	for i := 0; i < iterations; i++ {
+		work <- struct{}{}
+	}
+	close(work)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i := 0; i < runtime.GOMAXPROCS(0); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range work {
+				err := s.decode(w)
+				if err != nil {
+					once.Do(func() { firstErr = err })
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return Result{}, firstErr
+	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
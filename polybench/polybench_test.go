@@ -0,0 +1,80 @@
+package polybench
+
+import (
+	"github.com/gburgyan/go-poly"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type Animal struct {
+	Name  string `json:"name"`
+	Legs  int    `json:"legs"`
+	Notes string `json:"notes"`
+}
+
+type Zoo struct {
+	Dogs   []Animal `poly:"dog"`
+	Cats   []Animal `poly:"cat"`
+	Keeper *Animal  `poly:"keeper"`
+}
+
+func TestNewWorkload(t *testing.T) {
+	w := NewWorkload("zoo", &Zoo{}, 50, 1)
+	assert.Equal(t, "zoo", w.Name)
+	assert.Equal(t, 50, w.Elements)
+
+	target := w.NewTarget()
+	assert.IsType(t, &Zoo{}, target)
+	assert.NoError(t, poly.Unmarshal(w.Data, target))
+	zoo := target.(*Zoo)
+	assert.Equal(t, 49, len(zoo.Dogs)+len(zoo.Cats))
+	assert.NotNil(t, zoo.Keeper)
+
+	assert.Equal(t, w, NewWorkload("zoo", Zoo{}, 50, 1))
+}
+
+func TestWorkloadFrom(t *testing.T) {
+	w, err := WorkloadFrom("sample", Zoo{}, []byte(`[{"type":"dog","name":"Rex"},{"type":"cat"}]`))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, w.Elements)
+
+	_, err = WorkloadFrom("sample", 42, []byte(`[]`))
+	assert.EqualError(t, err, `target of workload "sample" must be a struct, got int`)
+
+	_, err = WorkloadFrom("sample", Zoo{}, []byte(`{}`))
+	assert.ErrorContains(t, err, `data of workload "sample" is not a JSON array`)
+}
+
+func TestScenarios(t *testing.T) {
+	var names []string
+	for _, s := range Scenarios() {
+		names = append(names, s.name())
+	}
+	assert.Equal(t, []string{"batch", "batch-parallel", "streaming", "streaming-parallel"}, names)
+	assert.Equal(t, "custom", Scenario{Name: "custom"}.name())
+}
+
+func TestMeasure(t *testing.T) {
+	w := NewWorkload("zoo", Zoo{}, 20, 1)
+	for _, s := range Scenarios() {
+		result, err := Measure(w, s, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, 10, result.Iterations)
+		assert.Equal(t, "zoo", result.Workload)
+		assert.Equal(t, s.name(), result.Scenario)
+		assert.Greater(t, result.PerOp(), time.Duration(0))
+	}
+
+	// Decoding errors are reported.
+	bad, err := WorkloadFrom("bad", Zoo{}, []byte(`[{"type":"dog","legs":"four"}]`))
+	assert.NoError(t, err)
+	_, err = Measure(bad, Scenario{}, 1)
+	assert.Error(t, err)
+	_, err = Measure(bad, Scenario{Parallel: true}, 4)
+	assert.Error(t, err)
+}
+
+func BenchmarkZoo(b *testing.B) {
+	Benchmark(b, NewWorkload("zoo", Zoo{}, 200, 1), Scenarios()...)
+}
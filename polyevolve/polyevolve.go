@@ -0,0 +1,428 @@
+// Package polyevolve reconciles the element structs of different versions of
+// a polymorphic payload, following rules like those of Avro schema evolution.
+// Given the struct that old payloads were written with and the struct they are
+// now read into, it determines whether the two are compatible, and transforms
+// the elements of old payloads so that they decode into the new struct.
+//
+// The fields of the structs are matched by their JSON names. A field of the
+// reader struct can list the names it had before in a `polyalias` tag, as in
+// `polyalias:"fullName,name"`, so that renamed fields are carried over.
+package polyevolve
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gburgyan/go-poly"
+	"reflect"
+	"strings"
+)
+
+// ChangeKind is the kind of a Change.
+type ChangeKind int
+
+const (
+	// FieldAdded is a field of the reader that the writer doesn't have.
+	FieldAdded ChangeKind = iota
+	// FieldRemoved is a field of the writer that the reader doesn't have.
+	FieldRemoved
+	// FieldRenamed is a field of the reader that has one of its aliases in
+	// the writer.
+	FieldRenamed
+	// FieldRetyped is a field whose type is different in the reader.
+	FieldRetyped
+)
+
+// String returns the name of the kind of change.
+func (k ChangeKind) String() string {
+	switch k {
+	case FieldAdded:
+		return "added"
+	case FieldRemoved:
+		return "removed"
+	case FieldRenamed:
+		return "renamed"
+	case FieldRetyped:
+		return "retyped"
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change describes a difference between the writer and the reader struct.
+type Change struct {
+	// Kind is the kind of the change.
+	Kind ChangeKind
+	// Field is the JSON name of the field in the reader, or in the writer if
+	// it was removed.
+	Field string
+	// From is the JSON name of the field in the writer if it was renamed.
+	From string
+	// Compatible is set if payloads written with the writer can still be
+	// read with the reader despite the change.
+	Compatible bool
+	// Reason describes the change.
+	Reason string
+}
+
+// String returns a description of the change.
+func (c Change) String() string {
+	return fmt.Sprintf("%q: %s", c.Field, c.Reason)
+}
+
+// Evolution holds the differences between the struct that elements were
+// written with and the struct they are read into. It is safe for concurrent
+// use once created.
+type Evolution struct {
+	reader  reflect.Type
+	changes []Change
+	// renames maps the JSON names of the renamed fields in the writer to
+	// their names in the reader, and removed holds the names of the fields
+	// that the reader doesn't have.
+	renames map[string]string
+	removed map[string]bool
+	// defaults holds the JSON of the default values of the added fields that
+	// have a `default` tag, by their names.
+	defaults map[string]json.RawMessage
+}
+
+// New compares the writer struct, that the elements were written with, with
+// the reader struct, that they are read into. Either may be a struct or a
+// pointer to one, and only their types are used. The changes are sorted by the
+// order of the fields in the reader, followed by the removed fields.
+//
+// A field that the reader adds is compatible if it is optional: if it is a
+// pointer, a slice, a map or an interface, if it is tagged omitempty, or if it
+// has a `default` tag whose value is then used for the elements that don't
+// have it. Removed and renamed fields are always compatible, and a field whose
+// type changed is compatible if any JSON value of the old type can be decoded
+// into the new one, such as an integer into a floating-point number.
+func New(writer any, reader any) (*Evolution, error) {
+	writerType, err := structType("writer", writer)
+	if err != nil {
+		return nil, err
+	}
+	readerType, err := structType("reader", reader)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Evolution{
+		reader:   readerType,
+		renames:  map[string]string{},
+		removed:  map[string]bool{},
+		defaults: map[string]json.RawMessage{},
+	}
+	writerFields := map[string]field{}
+	var writerOrder []string
+	for _, f := range jsonFields(writerType) {
+		writerFields[f.name] = f
+		writerOrder = append(writerOrder, f.name)
+	}
+	matched := map[string]bool{}
+	for _, r := range jsonFields(readerType) {
+		w, ok := writerFields[r.name]
+		from := ""
+		if !ok {
+			for _, alias := range r.aliases {
+				if w, ok = writerFields[alias]; ok && !matched[alias] {
+					from = alias
+					break
+				}
+				ok = false
+			}
+		}
+		if !ok {
+			err = e.added(r)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		matched[w.name] = true
+		if from != "" {
+			e.renames[from] = r.name
+			e.changes = append(e.changes, Change{Kind: FieldRenamed, Field: r.name, From: from, Compatible: true, Reason: fmt.Sprintf("renamed from %q", from)})
+		}
+		if w.typ != r.typ {
+			e.changes = append(e.changes, Change{
+				Kind:       FieldRetyped,
+				Field:      r.name,
+				From:       from,
+				Compatible: convertible(w.typ, r.typ),
+				Reason:     fmt.Sprintf("type changed from %v to %v", w.typ, r.typ),
+			})
+		}
+	}
+	for _, name := range writerOrder {
+		if !matched[name] {
+			e.removed[name] = true
+			e.changes = append(e.changes, Change{Kind: FieldRemoved, Field: name, Compatible: true, Reason: "removed"})
+		}
+	}
+	return e, nil
+}
+
+// added records a field of the reader that the writer doesn't have.
+func (e *Evolution) added(r field) error {
+	c := Change{Kind: FieldAdded, Field: r.name, Compatible: r.optional, Reason: "added"}
+	if r.hasDefault {
+		value := json.RawMessage(r.defaultValue)
+		if r.typ.Kind() == reflect.String {
+			value, _ = json.Marshal(r.defaultValue)
+		}
+		if !json.Valid(value) {
+			return fmt.Errorf("invalid default %q for field %s of %v", r.defaultValue, r.goName, e.reader)
+		}
+		e.defaults[r.name] = value
+		c.Compatible = true
+		c.Reason = "added with a default"
+	}
+	if !c.Compatible {
+		c.Reason = "added without a default"
+	}
+	e.changes = append(e.changes, c)
+	return nil
+}
+
+// Changes returns all the differences between the writer and the reader.
+func (e *Evolution) Changes() []Change {
+	return append([]Change(nil), e.changes...)
+}
+
+// Incompatible returns the changes that can make elements written with the
+// writer unreadable with the reader. It is empty if the structs are compatible.
+func (e *Evolution) Incompatible() []Change {
+	var result []Change
+	for _, c := range e.changes {
+		if !c.Compatible {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// Compatible reports whether every element written with the writer can be
+// read with the reader.
+func (e *Evolution) Compatible() bool {
+	return len(e.Incompatible()) == 0
+}
+
+// Transform rewrites an element written with the writer for the reader: the
+// renamed fields are moved to their new names, the removed fields are dropped,
+// and the added fields with a default are set to it if they are missing. A
+// field that already has its new name is left as it is.
+func (e *Evolution) Transform(raw json.RawMessage) (json.RawMessage, error) {
+	var object map[string]json.RawMessage
+	err := json.Unmarshal(raw, &object)
+	if err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return raw, nil
+	}
+	for from, to := range e.renames {
+		value, ok := object[from]
+		if !ok {
+			continue
+		}
+		delete(object, from)
+		if _, exists := object[to]; !exists {
+			object[to] = value
+		}
+	}
+	for name := range e.removed {
+		delete(object, name)
+	}
+	for name, value := range e.defaults {
+		if _, ok := object[name]; !ok {
+			object[name] = value
+		}
+	}
+	return json.Marshal(object)
+}
+
+// Decode transforms an element written with the writer and decodes it into a
+// new instance of the reader. The returned value is a pointer to the reader
+// struct.
+func (e *Evolution) Decode(raw json.RawMessage) (any, error) {
+	transformed, err := e.Transform(raw)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(e.reader)
+	err = json.Unmarshal(transformed, v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// Option returns an option that decodes the elements of the type name with
+// Decode when unmarshalling, so that old payloads can be read into the current
+// target struct:
+//
+//	evolution, err := polyevolve.New(PersonV1{}, Person{})
+//	...
+//	err = poly.UnmarshalWithOptions(data, &residence, evolution.Option("person"))
+func (e *Evolution) Option(typeName string) poly.Option {
+	return poly.WithFieldDecoder(typeName, e.Decode)
+}
+
+// field is a field of a struct as it appears in JSON.
+type field struct {
+	name         string
+	goName       string
+	typ          reflect.Type
+	optional     bool
+	aliases      []string
+	hasDefault   bool
+	defaultValue string
+}
+
+// structType returns the struct type of the value, which may be a struct or a
+// pointer to one.
+func structType(role string, v any) (reflect.Type, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%s must be a struct, got %T", role, v)
+	}
+	return t, nil
+}
+
+// jsonFields returns the fields of the struct type under their JSON names,
+// following the rules of encoding/json for the names and for embedded structs.
+// The fields of an embedded struct don't replace the fields of the outer
+// struct with the same names.
+func jsonFields(t reflect.Type) []field {
+	var fields []field
+	seen := map[string]bool{}
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, options, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					defer add(ft)
+					continue
+				}
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			fl := field{name: name, goName: f.Name, typ: f.Type}
+			switch f.Type.Kind() {
+			case reflect.Pointer, reflect.Slice, reflect.Map, reflect.Interface:
+				fl.optional = true
+			}
+			for _, option := range strings.Split(options, ",") {
+				if option == "omitempty" {
+					fl.optional = true
+				}
+			}
+			if aliases, ok := f.Tag.Lookup("polyalias"); ok {
+				for _, alias := range strings.Split(aliases, ",") {
+					if alias = strings.TrimSpace(alias); alias != "" {
+						fl.aliases = append(fl.aliases, alias)
+					}
+				}
+			}
+			fl.defaultValue, fl.hasDefault = f.Tag.Lookup("default")
+			fields = append(fields, fl)
+		}
+	}
+	add(t)
+	return fields
+}
+
+// jsonKind is the kind of JSON value that a Go type is encoded as.
+type jsonKind int
+
+const (
+	jsonAny jsonKind = iota
+	jsonString
+	jsonInteger
+	jsonNumber
+	jsonBool
+	jsonArray
+	jsonObject
+)
+
+// kindOf returns the kind of JSON value that the type is encoded as.
+func kindOf(t reflect.Type) jsonKind {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) || reflect.PointerTo(t).Implements(reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()) {
+		return jsonAny
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return jsonString
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return jsonInteger
+	case reflect.Float32, reflect.Float64:
+		return jsonNumber
+	case reflect.Bool:
+		return jsonBool
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// Byte slices are encoded as base64 strings.
+			return jsonString
+		}
+		return jsonArray
+	case reflect.Struct, reflect.Map:
+		return jsonObject
+	}
+	return jsonAny
+}
+
+// convertible reports whether the JSON values of the old type can be decoded
+// into the new type. Only the kinds of the values are compared, so that int32
+// can become int64, but not the other way around as the values might not fit.
+func convertible(from reflect.Type, to reflect.Type) bool {
+	fromKind, toKind := kindOf(from), kindOf(to)
+	switch {
+	case toKind == jsonAny:
+		return true
+	case fromKind == jsonInteger && toKind == jsonNumber:
+		return true
+	case fromKind != toKind:
+		return false
+	case fromKind == jsonInteger:
+		return integerWidth(to) >= integerWidth(from)
+	}
+	return true
+}
+
+// integerWidth returns a measure of the range of an integer type, where the
+// unsigned types are narrower than the signed types that can hold them.
+func integerWidth(t reflect.Type) int {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	bits := t.Bits()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return bits * 2
+	}
+	return bits*2 - 1
+}
@@ -0,0 +1,107 @@
+package polyevolve
+
+import (
+	"encoding/json"
+	"github.com/gburgyan/go-poly"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type PersonV1 struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Age      int32  `json:"age"`
+	Nickname string `json:"nickname"`
+}
+
+type PersonV2 struct {
+	Type     string   `json:"type"`
+	FullName string   `json:"fullName" polyalias:"name"`
+	Age      float64  `json:"age"`
+	Country  string   `json:"country" default:"US"`
+	Score    int      `json:"score" default:"10"`
+	Tags     []string `json:"tags"`
+}
+
+type Household struct {
+	People []*PersonV2 `poly:"person"`
+}
+
+func TestNew_Changes(t *testing.T) {
+	e, err := New(PersonV1{}, &PersonV2{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Change{
+		{Kind: FieldRenamed, Field: "fullName", From: "name", Compatible: true, Reason: `renamed from "name"`},
+		{Kind: FieldRetyped, Field: "age", Compatible: true, Reason: "type changed from int32 to float64"},
+		{Kind: FieldAdded, Field: "country", Compatible: true, Reason: "added with a default"},
+		{Kind: FieldAdded, Field: "score", Compatible: true, Reason: "added with a default"},
+		{Kind: FieldAdded, Field: "tags", Compatible: true, Reason: "added"},
+		{Kind: FieldRemoved, Field: "nickname", Compatible: true, Reason: "removed"},
+	}, e.Changes())
+	assert.True(t, e.Compatible())
+	assert.Empty(t, e.Incompatible())
+}
+
+func TestNew_Incompatible(t *testing.T) {
+	type Writer struct {
+		Age   int64  `json:"age"`
+		Count uint16 `json:"count"`
+	}
+	type Reader struct {
+		Age   int32  `json:"age"`
+		Count int32  `json:"count"`
+		Code  string `json:"code"`
+		Notes string `json:"notes,omitempty"`
+	}
+	e, err := New(Writer{}, Reader{})
+	assert.NoError(t, err)
+	assert.False(t, e.Compatible())
+	incompatible := e.Incompatible()
+	assert.Len(t, incompatible, 2)
+	assert.Equal(t, `"age": type changed from int64 to int32`, incompatible[0].String())
+	assert.Equal(t, `"code": added without a default`, incompatible[1].String())
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New("person", PersonV2{})
+	assert.EqualError(t, err, "writer must be a struct, got string")
+	_, err = New(PersonV1{}, nil)
+	assert.EqualError(t, err, "reader must be a struct, got <nil>")
+
+	type BadDefault struct {
+		Count int `json:"count" default:"many"`
+	}
+	_, err = New(PersonV1{}, BadDefault{})
+	assert.EqualError(t, err, `invalid default "many" for field Count of polyevolve.BadDefault`)
+}
+
+func TestTransform(t *testing.T) {
+	e, err := New(PersonV1{}, PersonV2{})
+	assert.NoError(t, err)
+
+	out, err := e.Transform(json.RawMessage(`{"type":"person","name":"Alice","age":30,"nickname":"Al"}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"person","fullName":"Alice","age":30,"country":"US","score":10}`, string(out))
+
+	// Values that are already there are kept.
+	out, err = e.Transform(json.RawMessage(`{"name":"Alice","fullName":"Alice Smith","country":"CA"}`))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"fullName":"Alice Smith","country":"CA","score":10}`, string(out))
+
+	_, err = e.Transform(json.RawMessage(`[1]`))
+	assert.Error(t, err)
+}
+
+func TestOption(t *testing.T) {
+	e, err := New(PersonV1{}, PersonV2{})
+	assert.NoError(t, err)
+
+	in := `[{"type":"person","name":"Alice","age":30},{"type":"person","name":"Bob","country":"FR"}]`
+	var household Household
+	err = poly.UnmarshalWithOptions([]byte(in), &household, e.Option("person"))
+	assert.NoError(t, err)
+	assert.Equal(t, []*PersonV2{
+		{Type: "person", FullName: "Alice", Age: 30, Country: "US", Score: 10},
+		{Type: "person", FullName: "Bob", Country: "FR", Score: 10},
+	}, household.People)
+}
@@ -0,0 +1,190 @@
+// Package polymetrics provides implementations of the poly.Metrics hook that
+// expose the work done by the poly package to monitoring systems.
+package polymetrics
+
+import (
+	"expvar"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// untyped is the key used for elements without a type name.
+const untyped = "(untyped)"
+
+// DefaultBuckets are the upper bounds, in bytes, of the buckets of the element
+// size histograms.
+var DefaultBuckets = []int{64, 256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// Expvar is a poly.Metrics implementation that keeps its counters in expvar
+// variables. Publish it to have it show up under /debug/vars, or use it as an
+// expvar.Var in a map of your own.
+//
+// The variables are:
+//   - decodes, decodeErrors, encodes, encodeErrors: the number of calls and of
+//     failed calls.
+//   - elementsDecoded, elementsUnmatched, elementsEncoded: the number of
+//     elements per type name.
+//   - decodedSizes, encodedSizes: histograms of the element sizes per type name.
+//
+// An Expvar is safe for concurrent use.
+type Expvar struct {
+	root expvar.Map
+
+	decodes, decodeErrors expvar.Int
+	encodes, encodeErrors expvar.Int
+
+	elementsDecoded, elementsUnmatched, elementsEncoded expvar.Map
+
+	decodedSizes, encodedSizes histograms
+}
+
+// NewExpvar creates a new Expvar with all counters at zero.
+func NewExpvar() *Expvar {
+	e := &Expvar{}
+	e.root.Init()
+	e.elementsDecoded.Init()
+	e.elementsUnmatched.Init()
+	e.elementsEncoded.Init()
+	e.decodedSizes.Init()
+	e.encodedSizes.Init()
+
+	e.root.Set("decodes", &e.decodes)
+	e.root.Set("decodeErrors", &e.decodeErrors)
+	e.root.Set("encodes", &e.encodes)
+	e.root.Set("encodeErrors", &e.encodeErrors)
+	e.root.Set("elementsDecoded", &e.elementsDecoded)
+	e.root.Set("elementsUnmatched", &e.elementsUnmatched)
+	e.root.Set("elementsEncoded", &e.elementsEncoded)
+	e.root.Set("decodedSizes", &e.decodedSizes)
+	e.root.Set("encodedSizes", &e.encodedSizes)
+	return e
+}
+
+// Publish publishes the variables under the given name with expvar.Publish,
+// which panics if the name is already in use.
+func (e *Expvar) Publish(name string) {
+	expvar.Publish(name, e)
+}
+
+// String returns the variables as a JSON object, implementing expvar.Var.
+func (e *Expvar) String() string {
+	return e.root.String()
+}
+
+// ElementDecoded implements poly.Metrics.
+func (e *Expvar) ElementDecoded(typeName string, size int) {
+	e.elementsDecoded.Add(key(typeName), 1)
+	e.decodedSizes.observe(key(typeName), size)
+}
+
+// ElementUnmatched implements poly.Metrics.
+func (e *Expvar) ElementUnmatched(typeName string, size int) {
+	e.elementsUnmatched.Add(key(typeName), 1)
+}
+
+// Decoded implements poly.Metrics.
+func (e *Expvar) Decoded(elements int, err error) {
+	e.decodes.Add(1)
+	if err != nil {
+		e.decodeErrors.Add(1)
+	}
+}
+
+// ElementEncoded implements poly.Metrics.
+func (e *Expvar) ElementEncoded(typeName string, size int) {
+	e.elementsEncoded.Add(key(typeName), 1)
+	e.encodedSizes.observe(key(typeName), size)
+}
+
+// Encoded implements poly.Metrics.
+func (e *Expvar) Encoded(elements int, err error) {
+	e.encodes.Add(1)
+	if err != nil {
+		e.encodeErrors.Add(1)
+	}
+}
+
+// key returns the key to use for a type name.
+func key(typeName string) string {
+	if typeName == "" {
+		return untyped
+	}
+	return typeName
+}
+
+// histograms is an expvar.Map of a Histogram per type name.
+type histograms struct {
+	expvar.Map
+	mu sync.Mutex
+}
+
+// observe records a size in the histogram for the type name, creating the
+// histogram if needed.
+func (h *histograms) observe(typeName string, size int) {
+	v, ok := h.Get(typeName).(*Histogram)
+	if !ok {
+		h.mu.Lock()
+		v, ok = h.Get(typeName).(*Histogram)
+		if !ok {
+			v = NewHistogram(DefaultBuckets)
+			h.Set(typeName, v)
+		}
+		h.mu.Unlock()
+	}
+	v.Observe(size)
+}
+
+// Histogram counts observed values in buckets. It implements expvar.Var and
+// is safe for concurrent use.
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []int
+	buckets []int64
+	count   int64
+	sum     int64
+}
+
+// NewHistogram creates a Histogram with the given bucket upper bounds, which
+// must be in increasing order. Values above the last bound are counted in an
+// extra overflow bucket.
+func NewHistogram(bounds []int) *Histogram {
+	return &Histogram{
+		bounds:  bounds,
+		buckets: make([]int64, len(bounds)+1),
+	}
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(v int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.buckets[i]++
+	h.count++
+	h.sum += int64(v)
+}
+
+// String returns the histogram as a JSON object with the count, the sum, and
+// the number of values in each bucket keyed by its upper bound.
+func (h *Histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `{"count":%d,"sum":%d,"buckets":{`, h.count, h.sum)
+	for i, n := range h.buckets {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		if i < len(h.bounds) {
+			fmt.Fprintf(&sb, `"%d":%d`, h.bounds[i], n)
+		} else {
+			fmt.Fprintf(&sb, `"+Inf":%d`, n)
+		}
+	}
+	sb.WriteString("}}")
+	return sb.String()
+}
@@ -0,0 +1,61 @@
+package polymetrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"github.com/gburgyan/go-poly"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var _ poly.Metrics = &Expvar{}
+
+type Dog struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type Animals struct {
+	Dogs []Dog `poly:"dog"`
+}
+
+func TestExpvar(t *testing.T) {
+	m := NewExpvar()
+
+	in := `[{"type":"dog","name":"Rover"},{"type":"cat"},{"name":"?"}]`
+	var animals Animals
+	assert.NoError(t, poly.UnmarshalWithOptions([]byte(in), &animals, poly.WithMetrics(m)))
+	assert.Error(t, poly.UnmarshalWithOptions([]byte(`{}`), &animals, poly.WithMetrics(m)))
+	_, err := poly.MarshalWithOptions(animals, poly.WithMetrics(m))
+	assert.NoError(t, err)
+
+	var vars map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(m.String()), &vars))
+	assert.Equal(t, float64(2), vars["decodes"])
+	assert.Equal(t, float64(1), vars["decodeErrors"])
+	assert.Equal(t, float64(1), vars["encodes"])
+	assert.Equal(t, float64(0), vars["encodeErrors"])
+	assert.Equal(t, map[string]any{"dog": float64(1)}, vars["elementsDecoded"])
+	assert.Equal(t, map[string]any{"cat": float64(1), "(untyped)": float64(1)}, vars["elementsUnmatched"])
+	assert.Equal(t, map[string]any{"dog": float64(1)}, vars["elementsEncoded"])
+
+	sizes := vars["decodedSizes"].(map[string]any)["dog"].(map[string]any)
+	assert.Equal(t, float64(1), sizes["count"])
+	assert.Equal(t, float64(29), sizes["sum"])
+	assert.Equal(t, float64(1), sizes["buckets"].(map[string]any)["64"])
+}
+
+func TestExpvar_Publish(t *testing.T) {
+	m := NewExpvar()
+	m.Publish("polymetrics_test")
+	assert.Equal(t, m, expvar.Get("polymetrics_test"))
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram([]int{10, 100})
+	h.Observe(5)
+	h.Observe(10)
+	h.Observe(50)
+	h.Observe(500)
+	assert.Equal(t, `{"count":4,"sum":565,"buckets":{"10":2,"100":1,"+Inf":1}}`, h.String())
+}
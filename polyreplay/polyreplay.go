@@ -0,0 +1,209 @@
+// Package polyreplay replays a stream of polymorphic events, as kept by an
+// event-sourced system, onto an aggregate. Each event is decoded into the
+// struct registered for its type name in a poly.Registry and handed to the
+// aggregate, in the order of the stream. A replay that stops, whether because
+// of an error or because the process was stopped, can be resumed from the
+// Checkpoint it reached without applying any event twice.
+package polyreplay
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/gburgyan/go-poly"
+	"io"
+)
+
+// Aggregate is the state that the events are applied to.
+type Aggregate interface {
+	// Apply applies a single event to the aggregate. The event is a pointer
+	// to the struct registered for its type name, e.g. *Deposited. Returning
+	// an error stops the replay, and the error is returned from it.
+	Apply(event any) error
+}
+
+// Checkpoint is the position in a stream up to which the events have been
+// applied. It is meant to be stored along with the aggregate, such as in a
+// snapshot, and passed to Replayer.Replay to resume the replay.
+type Checkpoint struct {
+	// Position is the number of elements of the stream that have been
+	// handled, including the ones that were skipped because their type
+	// names aren't registered.
+	Position int `json:"position"`
+}
+
+// Replayer replays streams of events onto aggregates. The streams are either
+// JSON arrays or newline-delimited JSON, with one event per line, and the
+// type names of the events are resolved with the options, as with
+// poly.UnmarshalWithOptions. Events whose type names aren't in the registry
+// are skipped.
+//
+// A Replayer must not be modified while Replay is running, but once it is
+// set up it can replay many streams concurrently.
+type Replayer struct {
+	registry *poly.Registry
+	options  []poly.Option
+	every    int
+	save     func(Checkpoint) error
+}
+
+// New creates a Replayer that decodes the events with the types from the
+// registry.
+//
+//	registry := poly.NewRegistry()
+//	poly.Register[Deposited](registry, "deposited")
+//	poly.Register[Withdrawn](registry, "withdrawn")
+//	replayer := polyreplay.New(registry)
+func New(registry *poly.Registry, opts ...poly.Option) *Replayer {
+	return &Replayer{
+		registry: registry,
+		options:  opts,
+	}
+}
+
+// SaveEvery makes Replay call save with the checkpoint after every n elements
+// of the stream, so that a long replay that is interrupted doesn't start over.
+// An error returned by save stops the replay. A replay that finishes doesn't
+// call save with its final checkpoint; it is returned from Replay instead.
+func (r *Replayer) SaveEvery(n int, save func(Checkpoint) error) {
+	r.every = n
+	r.save = save
+}
+
+// Replay applies the events of the stream to the aggregate, starting after the
+// ones up to the checkpoint, which is the zero Checkpoint to replay the whole
+// stream. The events before the checkpoint are read, but neither decoded nor
+// applied.
+//
+// The checkpoint that the replay reached is returned along with the error, if
+// any. If the replay stopped at an event, because it couldn't be decoded or
+// applied, the event is not included, so resuming from the checkpoint starts
+// with that event again.
+func (r *Replayer) Replay(stream io.Reader, aggregate Aggregate, from Checkpoint) (Checkpoint, error) {
+	src := &eventSource{
+		reader:   bufio.NewReader(stream),
+		skip:     from.Position,
+		every:    r.every,
+		save:     r.save,
+		position: from.Position,
+	}
+	opts := append([]poly.Option{poly.WithRegistry(r.registry)}, r.options...)
+	err := poly.UnmarshalSource(src, applier{aggregate}, opts...)
+	return Checkpoint{Position: src.position}, err
+}
+
+// applier adapts an Aggregate to the poly.Accumulator interface.
+type applier struct {
+	aggregate Aggregate
+}
+
+// Add implements the poly.Accumulator interface.
+func (a applier) Add(typeName string, v any) error {
+	return a.aggregate.Apply(v)
+}
+
+// eventSource is a poly.ElementSource over the events of a JSON array or of
+// newline-delimited JSON. It keeps track of the position up to which the
+// events have been handled: an event is handled once the next one is asked
+// for, since the elements of a source are decoded and applied one at a time.
+type eventSource struct {
+	reader *bufio.Reader
+	dec    *json.Decoder
+	// skip is the number of events at the start of the stream that are
+	// read, but not provided.
+	skip  int
+	every int
+	save  func(Checkpoint) error
+	// read is the number of events read from the stream so far.
+	read int
+	// position is the number of events that have been handled.
+	position int
+	started  bool
+	array    bool
+}
+
+// Next implements the poly.ElementSource interface.
+func (s *eventSource) Next() (poly.SourceElement, error) {
+	if s.read > s.skip {
+		err := s.handled()
+		if err != nil {
+			return poly.SourceElement{}, err
+		}
+	}
+	for {
+		raw, err := s.nextEvent()
+		if err != nil {
+			if err == io.EOF && s.read > s.position {
+				s.position = s.read
+			}
+			return poly.SourceElement{}, err
+		}
+		s.read++
+		if s.read > s.skip {
+			return poly.SourceElement{Raw: raw}, nil
+		}
+	}
+}
+
+// handled records that the last event that was provided has been handled, and
+// saves the checkpoint if it is due.
+func (s *eventSource) handled() error {
+	s.position = s.read
+	if s.save != nil && s.every > 0 && s.position%s.every == 0 {
+		return s.save(Checkpoint{Position: s.position})
+	}
+	return nil
+}
+
+// nextEvent reads the JSON of the next event from the stream. It returns io.EOF
+// at the end of the stream.
+func (s *eventSource) nextEvent() (json.RawMessage, error) {
+	if !s.started {
+		s.started = true
+		err := s.start()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.array && !s.dec.More() {
+		_, err := s.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	var raw json.RawMessage
+	err := s.dec.Decode(&raw)
+	if err != nil {
+		if err == io.EOF && s.array {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return raw, nil
+}
+
+// start determines whether the stream is a JSON array, and reads its opening
+// bracket if it is. Anything else, including an empty stream, is read as
+// newline-delimited JSON.
+func (s *eventSource) start() error {
+	for {
+		b, err := s.reader.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if b[0] != ' ' && b[0] != '\t' && b[0] != '\r' && b[0] != '\n' {
+			s.array = b[0] == '['
+			break
+		}
+		_, _ = s.reader.ReadByte()
+	}
+	s.dec = json.NewDecoder(s.reader)
+	if s.array {
+		_, err := s.dec.Token()
+		return err
+	}
+	return nil
+}
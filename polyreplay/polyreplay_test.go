@@ -0,0 +1,122 @@
+package polyreplay
+
+import (
+	"errors"
+	"github.com/gburgyan/go-poly"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type Deposited struct {
+	Amount int `json:"amount"`
+}
+
+type Withdrawn struct {
+	Amount int `json:"amount"`
+}
+
+type Account struct {
+	Balance int
+	Events  int
+}
+
+func (a *Account) Apply(event any) error {
+	switch e := event.(type) {
+	case *Deposited:
+		a.Balance += e.Amount
+	case *Withdrawn:
+		if e.Amount > a.Balance {
+			return errors.New("insufficient funds")
+		}
+		a.Balance -= e.Amount
+	}
+	a.Events++
+	return nil
+}
+
+func newReplayer(t *testing.T) *Replayer {
+	registry := poly.NewRegistry()
+	assert.NoError(t, poly.Register[Deposited](registry, "deposited"))
+	assert.NoError(t, poly.Register[Withdrawn](registry, "withdrawn"))
+	return New(registry)
+}
+
+func TestReplay(t *testing.T) {
+	streams := map[string]string{
+		"array": `[
+			{"type":"deposited","amount":100},
+			{"type":"renamed","name":"savings"},
+			{"type":"withdrawn","amount":30}
+		]`,
+		"ndjson": `{"type":"deposited","amount":100}
+{"type":"renamed","name":"savings"}
+{"type":"withdrawn","amount":30}
+`,
+	}
+	for name, stream := range streams {
+		t.Run(name, func(t *testing.T) {
+			var account Account
+			checkpoint, err := newReplayer(t).Replay(strings.NewReader(stream), &account, Checkpoint{})
+			assert.NoError(t, err)
+			assert.Equal(t, Checkpoint{Position: 3}, checkpoint)
+			assert.Equal(t, Account{Balance: 70, Events: 2}, account)
+		})
+	}
+
+	var account Account
+	checkpoint, err := newReplayer(t).Replay(strings.NewReader(" "), &account, Checkpoint{})
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{}, checkpoint)
+	checkpoint, err = newReplayer(t).Replay(strings.NewReader("[]"), &account, Checkpoint{})
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{}, checkpoint)
+}
+
+func TestReplay_Resume(t *testing.T) {
+	stream := `{"type":"deposited","amount":100}
+{"type":"withdrawn","amount":150}
+{"type":"deposited","amount":100}
+`
+	replayer := newReplayer(t)
+	var account Account
+	checkpoint, err := replayer.Replay(strings.NewReader(stream), &account, Checkpoint{})
+	assert.EqualError(t, err, "insufficient funds")
+	assert.Equal(t, Checkpoint{Position: 1}, checkpoint)
+	assert.Equal(t, Account{Balance: 100, Events: 1}, account)
+
+	// A deposit arrives in the meantime, and the replay resumes with the failed event.
+	account.Balance += 100
+	checkpoint, err = replayer.Replay(strings.NewReader(stream), &account, checkpoint)
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Position: 3}, checkpoint)
+	assert.Equal(t, Account{Balance: 150, Events: 3}, account)
+
+	checkpoint, err = replayer.Replay(strings.NewReader(`[{"type":"deposited","amount":1},{"type":"deposited",`), &account, Checkpoint{})
+	assert.Error(t, err)
+	assert.Equal(t, Checkpoint{Position: 1}, checkpoint)
+}
+
+func TestReplay_SaveEvery(t *testing.T) {
+	stream := strings.Repeat(`{"type":"deposited","amount":1}`+"\n", 5)
+	replayer := newReplayer(t)
+	var saved []Checkpoint
+	replayer.SaveEvery(2, func(c Checkpoint) error {
+		saved = append(saved, c)
+		return nil
+	})
+	var account Account
+	checkpoint, err := replayer.Replay(strings.NewReader(stream), &account, Checkpoint{})
+	assert.NoError(t, err)
+	assert.Equal(t, Checkpoint{Position: 5}, checkpoint)
+	assert.Equal(t, []Checkpoint{{Position: 2}, {Position: 4}}, saved)
+
+	replayer.SaveEvery(3, func(c Checkpoint) error {
+		return errors.New("disk full")
+	})
+	account = Account{}
+	checkpoint, err = replayer.Replay(strings.NewReader(stream), &account, Checkpoint{Position: 1})
+	assert.EqualError(t, err, "disk full")
+	assert.Equal(t, Checkpoint{Position: 3}, checkpoint)
+	assert.Equal(t, 2, account.Balance)
+}
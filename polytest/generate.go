@@ -0,0 +1,219 @@
+package polytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gburgyan/go-poly"
+	"math/rand"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// TypeKey is the discriminator key that Generate adds to each element. It is
+// one of the keys recognized by poly.GenericTypeLocator, so the documents can
+// be read with poly.Unmarshal.
+const TypeKey = "type"
+
+// maxDepth limits how deeply nested values Generate creates for recursive or
+// deeply nested element types.
+const maxDepth = 4
+
+// Generate produces a random, valid polymorphic JSON array for the target
+// struct, which may be a struct or a pointer to one. This is useful for fuzzing
+// consumers of a mapping and for load-testing decoders.
+//
+// The array contains n elements where possible, with at least one element for
+// each mapped type name when n allows it. Only the constraints of the struct
+// tags are respected: a field that isn't a slice gets at most one element, so
+// fewer than n elements are generated if there aren't any slice fields to hold
+// the rest, and the elements of `first` and `last` fields are placed at the
+// start and the end of the array. Options given when unmarshalling, such as
+// predicates, aren't known to Generate, and the random content may repeat the
+// keys of fields tagged with dedupe.
+//
+// The content of each element is random, and it carries its type name under
+// TypeKey. Raw fields get a random JSON object. Fields whose elements aren't
+// encoded as JSON objects, such as strings, can't carry the type name and are
+// skipped. The same seed always produces the same document.
+//
+// Generate panics if the target is not a struct, since that is a mistake in the
+// calling test.
+func Generate(target any, n int, seed int64) []byte {
+	fields, err := poly.DescribeTarget(target)
+	if err != nil {
+		panic(err)
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	// Decide how many elements each field gets: first one each, and then the
+	// remainder spread randomly over the slice fields.
+	counts := make([]int, len(fields))
+	var sliceFields []int
+	total := 0
+	for i, f := range fields {
+		if !encodesAsObject(f.Type) {
+			continue
+		}
+		if total < n {
+			counts[i] = 1
+			total++
+		}
+		if f.Slice {
+			sliceFields = append(sliceFields, i)
+		}
+	}
+	for ; total < n && len(sliceFields) > 0; total++ {
+		counts[sliceFields[rng.Intn(len(sliceFields))]]++
+	}
+
+	var first, middle, last []json.RawMessage
+	for i, f := range fields {
+		for j := 0; j < counts[i]; j++ {
+			element, ok := generateElement(f, rng)
+			if !ok {
+				continue
+			}
+			switch {
+			case f.First:
+				first = append(first, element)
+			case f.Last:
+				last = append(last, element)
+			default:
+				middle = append(middle, element)
+			}
+		}
+	}
+	rng.Shuffle(len(middle), func(i, j int) {
+		middle[i], middle[j] = middle[j], middle[i]
+	})
+
+	elements := append(append(first, middle...), last...)
+	if elements == nil {
+		elements = []json.RawMessage{}
+	}
+	document, err := json.Marshal(elements)
+	if err != nil {
+		panic(err)
+	}
+	return document
+}
+
+var (
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// encodesAsObject reports whether values of the type are encoded as JSON
+// objects, which can carry the discriminator. Types that encode themselves
+// are assumed to, and are skipped by generateElement if they don't.
+func encodesAsObject(t reflect.Type) bool {
+	if t == rawMessageType {
+		return true
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType) {
+		return true
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct || t.Kind() == reflect.Map
+}
+
+// generateElement creates the JSON for a random element of the field,
+// including the discriminator. False is returned if the element isn't encoded
+// as a JSON object.
+func generateElement(f poly.TargetField, rng *rand.Rand) (json.RawMessage, bool) {
+	v := reflect.New(f.Type).Elem()
+	fillRandom(v, rng, 0)
+	encoded, err := json.Marshal(v.Interface())
+	if err != nil {
+		panic(fmt.Errorf("generating %q element: %w", f.TypeName, err))
+	}
+
+	var object map[string]any
+	if json.Unmarshal(encoded, &object) != nil || object == nil {
+		return nil, false
+	}
+	object[TypeKey] = f.TypeName
+	element, err := json.Marshal(object)
+	if err != nil {
+		panic(fmt.Errorf("generating %q element: %w", f.TypeName, err))
+	}
+	return element, true
+}
+
+// fillRandom sets v, which must be settable, to a random value of its type.
+func fillRandom(v reflect.Value, rng *rand.Rand, depth int) {
+	if depth > maxDepth {
+		return
+	}
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		v.Set(reflect.ValueOf(time.Unix(rng.Int63n(4_000_000_000), 0).UTC()))
+		return
+	}
+	if v.Type() == rawMessageType {
+		raw, _ := json.Marshal(map[string]string{randomString(rng): randomString(rng)})
+		v.SetBytes(raw)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(rng.Intn(2) == 1)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(rng.Int63n(100))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(uint64(rng.Int63n(100)))
+	case reflect.Float32, reflect.Float64:
+		// Keep the values exactly representable so they survive a round trip.
+		v.SetFloat(float64(rng.Intn(10000)) / 4)
+	case reflect.String:
+		v.SetString(randomString(rng))
+	case reflect.Pointer:
+		p := reflect.New(v.Type().Elem())
+		fillRandom(p.Elem(), rng, depth+1)
+		v.Set(p)
+	case reflect.Slice:
+		s := reflect.MakeSlice(v.Type(), rng.Intn(3)+1, 3)
+		for i := 0; i < s.Len(); i++ {
+			fillRandom(s.Index(i), rng, depth+1)
+		}
+		v.Set(s)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fillRandom(v.Index(i), rng, depth+1)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		m := reflect.MakeMap(v.Type())
+		for i := rng.Intn(3) + 1; i > 0; i-- {
+			key := reflect.New(v.Type().Key()).Elem()
+			key.SetString(randomString(rng))
+			value := reflect.New(v.Type().Elem()).Elem()
+			fillRandom(value, rng, depth+1)
+			m.SetMapIndex(key, value)
+		}
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if !f.IsExported() || f.Tag.Get("json") == "-" {
+				continue
+			}
+			fillRandom(v.Field(i), rng, depth+1)
+		}
+	}
+}
+
+// randomString returns a short random lowercase string.
+func randomString(rng *rand.Rand) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz"
+	var sb strings.Builder
+	for i := rng.Intn(8) + 1; i > 0; i-- {
+		sb.WriteByte(letters[rng.Intn(len(letters))])
+	}
+	return sb.String()
+}
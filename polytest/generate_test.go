@@ -0,0 +1,93 @@
+package polytest
+
+import (
+	"encoding/json"
+	"github.com/gburgyan/go-poly"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Header struct {
+	Title string `json:"title"`
+}
+
+type Entry struct {
+	ID     int               `json:"id"`
+	Score  float64           `json:"score"`
+	Tags   []string          `json:"tags"`
+	Labels map[string]string `json:"labels"`
+	Nested *Header           `json:"nested"`
+}
+
+type Generated struct {
+	Header  Header  `poly:"header,first"`
+	Entries []Entry `poly:"entry"`
+	Notes   []Entry `poly:"note"`
+	Footer  *Header `poly:"footer,last"`
+}
+
+func TestGenerate(t *testing.T) {
+	document := Generate(Generated{}, 20, 42)
+
+	var elements []poly.GenericTypeLocator
+	assert.NoError(t, json.Unmarshal(document, &elements))
+	assert.Len(t, elements, 20)
+	assert.Equal(t, "header", elements[0].TypeName())
+	assert.Equal(t, "footer", elements[19].TypeName())
+
+	var decoded Generated
+	assert.NoError(t, poly.Unmarshal(document, &decoded))
+	assert.NotEmpty(t, decoded.Header.Title)
+	assert.NotNil(t, decoded.Footer)
+	assert.NotEmpty(t, decoded.Entries)
+	assert.NotEmpty(t, decoded.Notes)
+	assert.Equal(t, 18, len(decoded.Entries)+len(decoded.Notes))
+
+	// The same seed generates the same document.
+	assert.Equal(t, document, Generate(&Generated{}, 20, 42))
+	assert.NotEqual(t, document, Generate(Generated{}, 20, 43))
+}
+
+func TestGenerate_ScalarLimits(t *testing.T) {
+	type scalars struct {
+		Header Header  `poly:"header"`
+		Footer *Header `poly:"footer"`
+	}
+
+	// Without slice fields there is room for only one element per field.
+	var elements []json.RawMessage
+	assert.NoError(t, json.Unmarshal(Generate(scalars{}, 10, 1), &elements))
+	assert.Len(t, elements, 2)
+
+	assert.NoError(t, json.Unmarshal(Generate(scalars{}, 1, 1), &elements))
+	assert.Len(t, elements, 1)
+
+	assert.Equal(t, "[]", string(Generate(scalars{}, 0, 1)))
+}
+
+func TestGenerate_RawAndNonObjectFields(t *testing.T) {
+	type mixed struct {
+		Raw     []json.RawMessage `poly:"raw"`
+		Payload json.RawMessage   `poly:"payload"`
+		Names   []string          `poly:"name"`
+		Counts  []int             `poly:"count"`
+		Entries []Entry           `poly:"entry"`
+	}
+
+	document := Generate(mixed{}, 10, 7)
+	var elements []poly.GenericTypeLocator
+	assert.NoError(t, json.Unmarshal(document, &elements))
+	assert.Len(t, elements, 10)
+
+	var decoded mixed
+	assert.NoError(t, poly.Unmarshal(document, &decoded))
+	assert.NotEmpty(t, decoded.Raw)
+	assert.NotEmpty(t, decoded.Payload)
+	assert.NotEmpty(t, decoded.Entries)
+	assert.Empty(t, decoded.Names)
+	assert.Empty(t, decoded.Counts)
+}
+
+func TestGenerate_InvalidTarget(t *testing.T) {
+	assert.Panics(t, func() { Generate("not a struct", 1, 1) })
+}
@@ -0,0 +1,186 @@
+// Package polytest provides helpers for testing polymorphic JSON mappings
+// built with the poly package, so that projects using it don't need to write
+// their own comparison logic.
+package polytest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gburgyan/go-poly"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// TestingT is the subset of testing.TB that the assertions need. Both
+// *testing.T and *testing.B satisfy it.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Update controls whether AssertGolden rewrites the golden files instead of
+// comparing against them. It defaults to true if the POLYTEST_UPDATE
+// environment variable is set to a non-empty value.
+var Update = os.Getenv("POLYTEST_UPDATE") != ""
+
+// AssertRoundTrip marshals the target with poly.Marshal, unmarshals the result
+// into a fresh value of the same type with poly.Unmarshal, and verifies that
+// the two values are deeply equal. The target may be a struct or a pointer to
+// one. Since poly.Marshal does not add type discriminators, the elements of the
+// target must carry their own for the round trip to succeed.
+//
+// It returns whether the assertion succeeded.
+func AssertRoundTrip(t TestingT, target any) bool {
+	t.Helper()
+
+	encoded, err := poly.Marshal(target)
+	if err != nil {
+		t.Errorf("marshalling %T failed: %v", target, err)
+		return false
+	}
+
+	targetType := reflect.TypeOf(target)
+	isPtr := targetType.Kind() == reflect.Pointer
+	if isPtr {
+		targetType = targetType.Elem()
+	}
+	decoded := reflect.New(targetType)
+	err = poly.Unmarshal(encoded, decoded.Interface())
+	if err != nil {
+		t.Errorf("unmarshalling %T failed: %v\njson: %s", target, err, encoded)
+		return false
+	}
+
+	var got any
+	if isPtr {
+		got = decoded.Interface()
+	} else {
+		got = decoded.Elem().Interface()
+	}
+	if !reflect.DeepEqual(target, got) {
+		t.Errorf("round trip of %T is not equal\nexpected: %#v\nactual:   %#v\njson: %s", target, target, got, encoded)
+		return false
+	}
+	return true
+}
+
+// AssertEquivalentJSON verifies that two polymorphic JSON arrays contain the
+// same elements, regardless of their order. Elements are compared by their
+// content after normalizing the formatting and the order of the keys, and any
+// differences are reported along with the type name of the element as
+// determined by poly.GenericTypeLocator.
+//
+// It returns whether the assertion succeeded.
+func AssertEquivalentJSON(t TestingT, expected, actual []byte) bool {
+	t.Helper()
+
+	expectedElements, err := canonicalElements(expected)
+	if err != nil {
+		t.Errorf("expected JSON is not a valid array: %v", err)
+		return false
+	}
+	actualElements, err := canonicalElements(actual)
+	if err != nil {
+		t.Errorf("actual JSON is not a valid array: %v", err)
+		return false
+	}
+
+	counts := map[string]int{}
+	for _, e := range expectedElements {
+		counts[e]++
+	}
+	for _, e := range actualElements {
+		counts[e]--
+	}
+
+	var problems []string
+	for e, count := range counts {
+		for ; count > 0; count-- {
+			problems = append(problems, fmt.Sprintf("missing %s element: %s", elementTypeName(e), e))
+		}
+		for ; count < 0; count++ {
+			problems = append(problems, fmt.Sprintf("unexpected %s element: %s", elementTypeName(e), e))
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		t.Errorf("JSON arrays are not equivalent:\n%s", strings.Join(problems, "\n"))
+		return false
+	}
+	return true
+}
+
+// AssertGolden compares a polymorphic JSON array against the golden file
+// testdata/<name>.golden using the same rules as AssertEquivalentJSON. If
+// Update is set, the golden file is written with the indented JSON instead.
+//
+// It returns whether the assertion succeeded.
+func AssertGolden(t TestingT, name string, actual []byte) bool {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if Update {
+		var indented bytes.Buffer
+		err := json.Indent(&indented, actual, "", "  ")
+		if err != nil {
+			t.Errorf("actual JSON is not valid: %v", err)
+			return false
+		}
+		indented.WriteByte('\n')
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, indented.Bytes(), 0o644)
+		}
+		if err != nil {
+			t.Errorf("updating golden file %s failed: %v", path, err)
+			return false
+		}
+		return true
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("reading golden file %s failed: %v", path, err)
+		return false
+	}
+	return AssertEquivalentJSON(t, expected, actual)
+}
+
+// canonicalElements decodes a JSON array and returns the canonical JSON of
+// each of its elements. Re-encoding the generic representation of an element
+// sorts its keys and removes insignificant whitespace.
+func canonicalElements(rawJson []byte) ([]string, error) {
+	var elements []json.RawMessage
+	err := json.Unmarshal(rawJson, &elements)
+	if err != nil {
+		return nil, err
+	}
+	canonical := make([]string, len(elements))
+	for i, e := range elements {
+		var v any
+		err = json.Unmarshal(e, &v)
+		if err != nil {
+			return nil, err
+		}
+		c, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		canonical[i] = string(c)
+	}
+	return canonical, nil
+}
+
+// elementTypeName returns a description of the type of a canonical element for
+// use in messages.
+func elementTypeName(element string) string {
+	var locator poly.GenericTypeLocator
+	if json.Unmarshal([]byte(element), &locator) == nil && locator.TypeName() != "" {
+		return fmt.Sprintf("%q", locator.TypeName())
+	}
+	return "untyped"
+}
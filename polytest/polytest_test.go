@@ -0,0 +1,106 @@
+package polytest
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// recorder is a TestingT that records the failures instead of reporting them.
+type recorder struct {
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+type Dog struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+type Cat struct {
+	Type  string `json:"type"`
+	Lives int    `json:"lives"`
+}
+
+type Animals struct {
+	Dogs []Dog `poly:"dog"`
+	Cat  *Cat  `poly:"cat"`
+}
+
+// Untyped has elements that don't carry a discriminator, so it can't survive a
+// round trip.
+type Untyped struct {
+	Dogs []struct{ Name string } `poly:"dog"`
+}
+
+func TestAssertRoundTrip(t *testing.T) {
+	animals := Animals{
+		Dogs: []Dog{{Type: "dog", Name: "Rover"}, {Type: "dog", Name: "Rex"}},
+		Cat:  &Cat{Type: "cat", Lives: 9},
+	}
+	assert.True(t, AssertRoundTrip(t, animals))
+	assert.True(t, AssertRoundTrip(t, &animals))
+
+	r := &recorder{}
+	untyped := Untyped{Dogs: []struct{ Name string }{{Name: "Rover"}}}
+	assert.False(t, AssertRoundTrip(r, untyped))
+	assert.Len(t, r.errors, 1)
+	assert.Contains(t, r.errors[0], "round trip of polytest.Untyped is not equal")
+}
+
+func TestAssertEquivalentJSON(t *testing.T) {
+	a := `[{"type":"dog","name":"Rover"},{"type":"cat","lives":9},{"type":"dog","name":"Rex"}]`
+	b := `[
+		{"lives": 9, "type": "cat"},
+		{"name": "Rex", "type": "dog"},
+		{"name": "Rover", "type": "dog"}
+	]`
+	assert.True(t, AssertEquivalentJSON(t, []byte(a), []byte(b)))
+
+	r := &recorder{}
+	c := `[{"type":"dog","name":"Rover"},{"type":"dog","name":"Rover"},{"name":"untyped"}]`
+	assert.False(t, AssertEquivalentJSON(r, []byte(a), []byte(c)))
+	assert.Equal(t, []string{"JSON arrays are not equivalent:\n" +
+		`missing "cat" element: {"lives":9,"type":"cat"}` + "\n" +
+		`missing "dog" element: {"name":"Rex","type":"dog"}` + "\n" +
+		`unexpected "dog" element: {"name":"Rover","type":"dog"}` + "\n" +
+		`unexpected untyped element: {"name":"untyped"}`}, r.errors)
+
+	r = &recorder{}
+	assert.False(t, AssertEquivalentJSON(r, []byte(a), []byte(`{}`)))
+	assert.Len(t, r.errors, 1)
+}
+
+func TestAssertGolden(t *testing.T) {
+	actual := []byte(`[{"type":"cat","lives":9},{"type":"dog","name":"Rover"}]`)
+	assert.True(t, AssertGolden(t, "animals", actual))
+
+	r := &recorder{}
+	assert.False(t, AssertGolden(r, "missing", actual))
+	assert.Len(t, r.errors, 1)
+}
+
+func TestAssertGolden_Update(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer func() { _ = os.Chdir(wd) }()
+
+	Update = true
+	defer func() { Update = false }()
+
+	actual := []byte(`[{"type":"dog","name":"Rover"}]`)
+	assert.True(t, AssertGolden(t, "written", actual))
+
+	written, err := os.ReadFile(filepath.Join(dir, "testdata", "written.golden"))
+	assert.NoError(t, err)
+	assert.Equal(t, "[\n  {\n    \"type\": \"dog\",\n    \"name\": \"Rover\"\n  }\n]\n", string(written))
+}
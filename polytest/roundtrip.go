@@ -0,0 +1,151 @@
+package polytest
+
+import (
+	"fmt"
+	"github.com/gburgyan/go-poly"
+	"reflect"
+	"sort"
+)
+
+// Difference describes a value that was lost or changed in a round trip.
+type Difference struct {
+	// Path locates the value within the target, e.g. `People[1].Name`.
+	Path string
+	// Expected is the value in the original target.
+	Expected any
+	// Actual is the value after the round trip.
+	Actual any
+}
+
+// String returns a human-readable description of the difference.
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: expected %#v, got %#v", d.Path, d.Expected, d.Actual)
+}
+
+// CheckRoundTrip marshals the target with the type names injected under
+// TypeKey, unmarshals the result into a fresh value of the same type, and
+// returns the differences between the two. An empty result means that nothing
+// was lost. The target may be a struct or a pointer to one.
+//
+// Unexported fields are not compared since they can't be carried by JSON. The
+// returned error is only set if the target can't be marshalled or the result
+// can't be unmarshalled.
+func CheckRoundTrip(target any) ([]Difference, error) {
+	encoded, err := poly.MarshalWithOptions(target, poly.WithDiscriminator(TypeKey))
+	if err != nil {
+		return nil, err
+	}
+
+	expected := reflect.ValueOf(target)
+	if expected.Kind() == reflect.Pointer {
+		expected = expected.Elem()
+	}
+	actual := reflect.New(expected.Type())
+	err = poly.Unmarshal(encoded, actual.Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []Difference
+	diffValues(expected.Type().Name(), expected, actual.Elem(), &diffs)
+	return diffs, nil
+}
+
+// AssertLosslessRoundTrip checks the target with CheckRoundTrip and reports
+// every difference that was found.
+//
+// It returns whether the assertion succeeded.
+func AssertLosslessRoundTrip(t TestingT, target any) bool {
+	t.Helper()
+
+	diffs, err := CheckRoundTrip(target)
+	if err != nil {
+		t.Errorf("round trip of %T failed: %v", target, err)
+		return false
+	}
+	for _, d := range diffs {
+		t.Errorf("round trip of %T lost data at %s", target, d)
+	}
+	return len(diffs) == 0
+}
+
+// diffValues compares two values of the same type and appends a Difference
+// for each value that doesn't match.
+func diffValues(path string, expected, actual reflect.Value, diffs *[]Difference) {
+	report := func() {
+		*diffs = append(*diffs, Difference{
+			Path:     path,
+			Expected: expected.Interface(),
+			Actual:   actual.Interface(),
+		})
+	}
+
+	switch expected.Kind() {
+	case reflect.Struct:
+		for i := 0; i < expected.NumField(); i++ {
+			f := expected.Type().Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			diffValues(path+"."+f.Name, expected.Field(i), actual.Field(i), diffs)
+		}
+	case reflect.Pointer, reflect.Interface:
+		if expected.IsNil() || actual.IsNil() {
+			if expected.IsNil() != actual.IsNil() {
+				report()
+			}
+			return
+		}
+		if expected.Kind() == reflect.Interface && expected.Elem().Type() != actual.Elem().Type() {
+			report()
+			return
+		}
+		diffValues(path, expected.Elem(), actual.Elem(), diffs)
+	case reflect.Slice, reflect.Array:
+		// A nil slice and an empty one are considered equal since JSON
+		// doesn't distinguish between the two for omitted elements.
+		if expected.Len() != actual.Len() {
+			report()
+			return
+		}
+		for i := 0; i < expected.Len(); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), expected.Index(i), actual.Index(i), diffs)
+		}
+	case reflect.Map:
+		keys := map[any]reflect.Value{}
+		for _, k := range expected.MapKeys() {
+			keys[k.Interface()] = k
+		}
+		for _, k := range actual.MapKeys() {
+			keys[k.Interface()] = k
+		}
+		sorted := make([]reflect.Value, 0, len(keys))
+		for _, k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			return fmt.Sprint(sorted[i].Interface()) < fmt.Sprint(sorted[j].Interface())
+		})
+		for _, k := range sorted {
+			keyPath := fmt.Sprintf("%s[%#v]", path, k.Interface())
+			ev := expected.MapIndex(k)
+			av := actual.MapIndex(k)
+			if !ev.IsValid() || !av.IsValid() {
+				d := Difference{Path: keyPath}
+				if ev.IsValid() {
+					d.Expected = ev.Interface()
+				}
+				if av.IsValid() {
+					d.Actual = av.Interface()
+				}
+				*diffs = append(*diffs, d)
+				continue
+			}
+			diffValues(keyPath, ev, av, diffs)
+		}
+	default:
+		if !reflect.DeepEqual(expected.Interface(), actual.Interface()) {
+			report()
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package polytest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Person struct {
+	Name   string            `json:"name"`
+	Age    int               `json:"-"`
+	Labels map[string]string `json:"labels,omitempty"`
+	index  int
+}
+
+type Pet struct {
+	Name string `json:"name"`
+}
+
+type Household struct {
+	People []Person `poly:"person"`
+	Pet    *Pet     `poly:"pet"`
+}
+
+func TestCheckRoundTrip(t *testing.T) {
+	household := Household{
+		People: []Person{{Name: "John", index: 5}, {Name: "Mary", Labels: map[string]string{"role": "owner"}}},
+		Pet:    &Pet{Name: "Rover"},
+	}
+
+	// The unexported index isn't compared.
+	diffs, err := CheckRoundTrip(household)
+	assert.NoError(t, err)
+	assert.Empty(t, diffs)
+	assert.True(t, AssertLosslessRoundTrip(t, &household))
+}
+
+func TestCheckRoundTrip_Lossy(t *testing.T) {
+	household := Household{
+		People: []Person{{Name: "John", Age: 35}},
+	}
+
+	diffs, err := CheckRoundTrip(household)
+	assert.NoError(t, err)
+	assert.Equal(t, []Difference{{Path: "Household.People[0].Age", Expected: 35, Actual: 0}}, diffs)
+	assert.Equal(t, "Household.People[0].Age: expected 35, got 0", diffs[0].String())
+
+	r := &recorder{}
+	assert.False(t, AssertLosslessRoundTrip(r, household))
+	assert.Equal(t, []string{"round trip of polytest.Household lost data at Household.People[0].Age: expected 35, got 0"}, r.errors)
+}
+
+func TestCheckRoundTrip_Error(t *testing.T) {
+	type invalid struct {
+		Strings []string `poly:"string"`
+	}
+	_, err := CheckRoundTrip(invalid{Strings: []string{"x"}})
+	assert.Error(t, err)
+
+	r := &recorder{}
+	assert.False(t, AssertLosslessRoundTrip(r, invalid{Strings: []string{"x"}}))
+	assert.Len(t, r.errors, 1)
+}
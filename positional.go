@@ -0,0 +1,69 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// positionIndex returns the position in the array that a type name of the
+// form "#N", as in `poly:"#0"`, refers to. False is returned for any other type
+// name.
+func positionIndex(typeName string) (int, bool) {
+	if len(typeName) < 2 || typeName[0] != '#' {
+		return 0, false
+	}
+	for _, c := range typeName[1:] {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	position, err := strconv.Atoi(typeName[1:])
+	if err != nil {
+		return 0, false
+	}
+	return position, true
+}
+
+// positionalFields returns the type names of the positional fields of the
+// target by the positions they are tagged with. An error is returned if a
+// positional field can hold more than one element.
+func positionalFields(targetFields map[string]fieldLookup) (map[int]string, error) {
+	positions := map[int]string{}
+	for typeName, fl := range targetFields {
+		position, ok := positionIndex(typeName)
+		if !ok {
+			continue
+		}
+		if fl.slice || fl.container || fl.items != "" {
+			return nil, fmt.Errorf("positional field %s must hold a single element", fl.goName)
+		}
+		positions[position] = typeName
+	}
+	return positions, nil
+}
+
+// positionalResolver wraps a resolver to give the elements at the positions of
+// the positional fields the type names of those fields, whatever their
+// content. Their type names aren't resolved at all, so the elements of a tuple
+// can be any JSON value.
+func positionalResolver(positions map[int]string, resolve resolver) resolver {
+	return func(index int, raw json.RawMessage) (string, error) {
+		if typeName, ok := positions[index]; ok {
+			return typeName, nil
+		}
+		return resolve(index, raw)
+	}
+}
+
+// validateTuplePositions verifies that the elements of the positional fields are
+// emitted at their positions, which requires the positions to be taken by
+// them from the first one on.
+func validateTuplePositions(indexedObjects []indexedObject) error {
+	for i, item := range indexedObjects {
+		if item.Positional && item.Index != i {
+			return fmt.Errorf("positional field %s would be emitted at position %d instead of %d", item.Field, i, item.Index)
+		}
+	}
+	return nil
+}
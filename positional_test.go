@@ -0,0 +1,64 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type TupleRecord struct {
+	Location Location `poly:"#0"`
+	Person   Person   `poly:"#1"`
+	Pet      *Pet     `poly:"#2"`
+	Rooms    int      `poly:"#3"`
+}
+
+func TestUnmarshal_Positional(t *testing.T) {
+	in := []byte(`[{"address":"123 Main St"},{"type":"pet","name":"John"},{"name":"Fido"},4]`)
+
+	var result TupleRecord
+	err := Unmarshal(in, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, TupleRecord{
+		Location: Location{Address: "123 Main St"},
+		Person:   Person{Name: "John"},
+		Pet:      &Pet{Name: "Fido"},
+		Rooms:    4,
+	}, result)
+
+	bytes, err := MarshalWithOptions(result, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"address":"123 Main St"},{"name":"John"},{"name":"Fido"},4]`, string(bytes))
+
+	// The zero elements of a tuple are emitted to keep its shape.
+	bytes, err = Marshal(TupleRecord{Person: Person{Name: "Jane"}, Pet: &Pet{}})
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"address":""},{"name":"Jane"},{},0]`, string(bytes))
+	_, err = Marshal(TupleRecord{})
+	assert.EqualError(t, err, "positional field Rooms would be emitted at position 2 instead of 3")
+}
+
+func TestUnmarshal_PositionalMixed(t *testing.T) {
+	type Header struct {
+		Version int `json:"version"`
+	}
+	type Message struct {
+		Header Header   `poly:"#0"`
+		People []Person `poly:"person"`
+	}
+
+	in := []byte(`[{"version":2},{"type":"person","name":"John"},{"type":"person","name":"Jane"}]`)
+	var result Message
+	err := Unmarshal(in, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, Message{Header: Header{Version: 2}, People: []Person{{Name: "John"}, {Name: "Jane"}}}, result)
+
+	bytes, err := MarshalWithOptions(result, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"version":2},{"type":"person","name":"John"},{"type":"person","name":"Jane"}]`, string(bytes))
+
+	type Invalid struct {
+		People []Person `poly:"#1"`
+	}
+	err = Unmarshal(in, &Invalid{})
+	assert.EqualError(t, err, "positional field People must hold a single element")
+}
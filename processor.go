@@ -0,0 +1,106 @@
+package poly
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Processor is a type-safe, event-processing front end over the polymorphic
+// type resolution. Instead of unmarshalling a JSON array into the fields of a
+// target struct, each element of the array is decoded into the type given to
+// the handler that is registered for its type name, and the handler is
+// invoked with it.
+//
+// Register handlers with the On function before calling Process. A Processor
+// must not be modified while Process is running, but once all the handlers are
+// registered it is safe to call Process concurrently.
+//
+// Example usage:
+//
+//	proc := poly.NewProcessor(poly.DefaultLocator)
+//	poly.On(proc, "dog", func(d Dog) error { ... })
+//	poly.On(proc, "cat", func(c *Cat) error { ... })
+//	err := proc.Process(jsonData)
+type Processor struct {
+	typeLocator reflect.Type
+	handlers    map[string][]elementHandler
+}
+
+// elementHandler is a type-erased handler registered with On.
+type elementHandler struct {
+	// elemType is the type to decode the element into.
+	elemType reflect.Type
+	// ptr is set if the handler takes a pointer to elemType.
+	ptr bool
+	// invoke calls the typed handler with the decoded value.
+	invoke func(v reflect.Value) error
+}
+
+// NewProcessor creates a new Processor that uses the typeLocator to determine
+// the type name of each element. The typeLocator follows the same rules as in
+// UnmarshalCustom; use DefaultLocator for the common type discriminators.
+func NewProcessor(typeLocator reflect.Type) *Processor {
+	return &Processor{
+		typeLocator: typeLocator,
+		handlers:    map[string][]elementHandler{},
+	}
+}
+
+// On registers a handler on the Processor for the elements with the given
+// type name. Each such element is decoded into a new value of type T, which
+// may be a struct or a pointer to a struct, and passed to the handler. If more
+// than one handler is registered for the same type name, each of them gets its
+// own decoded value and they are invoked in the order they were registered.
+func On[T any](proc *Processor, typeName string, handler func(T) error) {
+	elemType := reflect.TypeOf((*T)(nil)).Elem()
+	h := elementHandler{
+		elemType: elemType,
+		invoke: func(v reflect.Value) error {
+			return handler(v.Interface().(T))
+		},
+	}
+	if elemType.Kind() == reflect.Pointer {
+		h.ptr = true
+		h.elemType = elemType.Elem()
+	}
+	proc.handlers[typeName] = append(proc.handlers[typeName], h)
+}
+
+// Process goes through each of the elements of the raw JSON array in order,
+// decoding each one for which there is a registered handler and invoking the
+// handler. Elements without a handler are skipped. Processing stops at the
+// first error, either from decoding an element or returned by a handler, and
+// that error is returned.
+func (p *Processor) Process(rawJson []byte) error {
+	if len(rawJson) == 0 {
+		return nil
+	}
+	return p.ProcessSource(NewArraySource(rawJson))
+}
+
+// ProcessSource works like Process, but reads the elements from the given
+// ElementSource instead of a JSON array.
+func (p *Processor) ProcessSource(src ElementSource) error {
+	resolve, err := locatorResolver(p.typeLocator, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = forEachElement(src, 0, resolve, func(index int, typeName string, raw json.RawMessage) error {
+		for _, h := range p.handlers[typeName] {
+			newSub, err := decodeElement(raw, h.elemType, index)
+			if err != nil {
+				return err
+			}
+			if !h.ptr {
+				newSub = newSub.Elem()
+			}
+			err = h.invoke(newSub)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,73 @@
+package poly
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestProcessor_Process(t *testing.T) {
+	in := `
+[
+	{"type": "person", "name": "John"},
+	{"type": "pet", "name": "Rover"},
+	{"type": "unknown"},
+	{"type": "person", "name": "Mary"},
+	{"type": "int", "ValueC": 42}
+]`
+	proc := NewProcessor(DefaultLocator)
+
+	var people []string
+	On(proc, "person", func(p Person) error {
+		people = append(people, p.Name)
+		return nil
+	})
+	var pets []*Pet
+	On(proc, "pet", func(p *Pet) error {
+		pets = append(pets, p)
+		return nil
+	})
+	var ints []*TypeInt
+	On(proc, "int", func(i *TypeInt) error {
+		ints = append(ints, i)
+		return nil
+	})
+
+	err := proc.Process([]byte(in))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"John", "Mary"}, people)
+	assert.Len(t, pets, 1)
+	assert.Equal(t, "Rover", pets[0].Name)
+	assert.Len(t, ints, 1)
+	assert.Equal(t, 42, ints[0].ValueC)
+	assert.Equal(t, 4, ints[0].index)
+}
+
+func TestProcessor_HandlerError(t *testing.T) {
+	in := `[{"type": "person", "name": "John"}, {"type": "person", "name": "Mary"}]`
+	proc := NewProcessor(DefaultLocator)
+
+	calls := 0
+	On(proc, "person", func(p Person) error {
+		calls++
+		return errors.New("boom")
+	})
+
+	err := proc.Process([]byte(in))
+	assert.EqualError(t, err, "boom")
+	assert.Equal(t, 1, calls)
+}
+
+func TestProcessor_DecodeError(t *testing.T) {
+	in := `[{"type": "person", "name": 42}]`
+	proc := NewProcessor(DefaultLocator)
+	On(proc, "person", func(p Person) error { return nil })
+
+	err := proc.Process([]byte(in))
+	assert.Error(t, err)
+}
+
+func TestProcessor_Empty(t *testing.T) {
+	proc := NewProcessor(DefaultLocator)
+	assert.NoError(t, proc.Process(nil))
+}
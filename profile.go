@@ -0,0 +1,71 @@
+package poly
+
+import (
+	"reflect"
+)
+
+// Profile bundles the configuration of a wire format so that the same settings
+// are used for marshalling and unmarshalling, keeping the encoding and the
+// decoding consistent. Profiles for the formats of well-known services can be
+// shipped as presets and applied with WithProfile.
+//
+// Example usage:
+//
+//	var StripeProfile = poly.Profile{
+//	    Name:             "stripe",
+//	    DiscriminatorKey: "object",
+//	}
+//
+//	bytes, err := poly.MarshalWithOptions(events, poly.WithProfile(StripeProfile))
+//	err = poly.UnmarshalWithOptions(bytes, &events, poly.WithProfile(StripeProfile))
+type Profile struct {
+	// Name identifies the profile in messages and configuration.
+	Name string
+
+	// DiscriminatorKey is the key under which the type name of each element
+	// is added when marshalling, as with WithDiscriminator. Unless a Locator
+	// is given, the type name of each element is also read from this key
+	// when unmarshalling.
+	DiscriminatorKey string
+
+	// Locator is the TypeLocator used when unmarshalling, as with
+	// WithLocator. If it is nil, the type names are read from the
+	// DiscriminatorKey, or with the DefaultLocator if that is empty as well.
+	Locator reflect.Type
+
+	// TagKeys are the keys of the struct tags that map the fields of the
+	// target to type names, in order of preference, as with WithTagKeys. If
+	// it is empty, the tag keys are left as they are.
+	TagKeys []string
+
+	// StrictIndices makes marshalling require unambiguous ordering, as with
+	// WithStrictIndices.
+	StrictIndices bool
+
+	// Options are any further options of the profile. They are applied after
+	// the settings above, so they take precedence over them.
+	Options []Option
+}
+
+// WithProfile applies the settings of the profile. Options given after it
+// override the settings of the profile, so a profile can be adjusted for a
+// single call.
+func WithProfile(p Profile) Option {
+	return func(o *options) {
+		o.discriminatorKey = p.DiscriminatorKey
+		switch {
+		case p.Locator != nil:
+			WithLocator(p.Locator)(o)
+		case p.DiscriminatorKey != "":
+			o.typeKeys = []string{p.DiscriminatorKey}
+			o.typeResolver = nil
+		}
+		if len(p.TagKeys) > 0 {
+			o.tagKeys = p.TagKeys
+		}
+		o.strictIndices = p.StrictIndices
+		for _, opt := range p.Options {
+			opt(o)
+		}
+	}
+}
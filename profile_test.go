@@ -0,0 +1,58 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+var kindProfile = Profile{
+	Name:             "kind",
+	DiscriminatorKey: "kind",
+}
+
+func TestProfile_RoundTrip(t *testing.T) {
+	in := Residence{
+		Location: Location{Address: "123 Main St"},
+		People:   []Person{{Name: "John"}},
+	}
+
+	bytes, err := MarshalWithOptions(in, WithProfile(kindProfile))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"kind":"location","address":"123 Main St"},{"kind":"person","name":"John"}]`, string(bytes))
+
+	var out Residence
+	err = UnmarshalWithOptions(bytes, &out, WithProfile(kindProfile))
+	assert.NoError(t, err)
+	assert.Equal(t, in, out)
+
+	// The default locator doesn't know about "kind".
+	out = Residence{}
+	err = UnmarshalWithOptions(bytes, &out)
+	assert.NoError(t, err)
+	assert.Equal(t, Residence{}, out)
+}
+
+func TestProfile_Settings(t *testing.T) {
+	strict := Profile{
+		Name:          "strict",
+		StrictIndices: true,
+		Locator:       reflect.TypeOf(countingLocator{}),
+		Options:       []Option{WithIncludeZeroValues()},
+	}
+
+	_, err := MarshalWithOptions(SlicesABC{TypeString: []TypeString{{ValueA: "A"}}}, WithProfile(strict))
+	assert.EqualError(t, err, "element of field TypeString does not implement IndexGettable")
+
+	o := newOptions([]Option{WithProfile(strict)})
+	assert.True(t, o.strictIndices)
+	assert.True(t, o.includeZeroValues)
+	assert.Equal(t, reflect.TypeOf(countingLocator{}), o.typeLocator)
+	assert.Nil(t, o.typeKeys)
+
+	// Later options take precedence.
+	o = newOptions([]Option{WithProfile(kindProfile), WithDiscriminator("type"), WithLocator(DefaultLocator)})
+	assert.Equal(t, "type", o.discriminatorKey)
+	assert.Equal(t, DefaultLocator, o.typeLocator)
+	assert.Nil(t, o.typeKeys)
+}
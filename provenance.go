@@ -0,0 +1,175 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// ProvenanceKeys are the keys of the objects that WithProvenance wraps the
+// elements in. The keys that are empty take their default values.
+type ProvenanceKeys struct {
+	// Index is the key of the position of the element in the array, "_idx"
+	// by default.
+	Index string
+	// Type is the key of the type name of the element, "_type" by default.
+	Type string
+	// Value is the key of the element itself, "value" by default.
+	Value string
+}
+
+// withDefaults returns the keys with the empty ones set to their defaults.
+func (k ProvenanceKeys) withDefaults() ProvenanceKeys {
+	if k.Index == "" {
+		k.Index = "_idx"
+	}
+	if k.Type == "" {
+		k.Type = "_type"
+	}
+	if k.Value == "" {
+		k.Value = "value"
+	}
+	return k
+}
+
+// wrapProvenance returns the encoded element at the position wrapped in an
+// object with its position and type name. The type name is left out if it is
+// empty, as it is for the unmatched elements of a rest field.
+func wrapProvenance(encoded []byte, keys ProvenanceKeys, position int, typeName string) ([]byte, error) {
+	var buf bytes.Buffer
+	writeKey := func(key string) error {
+		keyJson, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		buf.Write(keyJson)
+		buf.WriteByte(':')
+		return nil
+	}
+	buf.WriteByte('{')
+	err := writeKey(keys.Index)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(strconv.Itoa(position))
+	buf.WriteByte(',')
+	if typeName != "" {
+		err = writeKey(keys.Type)
+		if err != nil {
+			return nil, err
+		}
+		typeJson, err := json.Marshal(typeName)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(typeJson)
+		buf.WriteByte(',')
+	}
+	err = writeKey(keys.Value)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(encoded)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// provenanceSource wraps an ElementSource whose elements were wrapped by
+// WithProvenance to provide them in the order of their positions, with the
+// value of each as the element and its type name. Since the elements may have
+// been reordered, they are all read from the source before the first one is
+// provided.
+type provenanceSource struct {
+	src      ElementSource
+	keys     ProvenanceKeys
+	elements []SourceElement
+	err      error
+	read     bool
+}
+
+// provenanceElement is an element read by a provenanceSource along with its
+// position.
+type provenanceElement struct {
+	element  SourceElement
+	position int
+	wrapped  bool
+}
+
+// Next implements the ElementSource interface. Elements without the value key
+// are provided as they are, after the wrapped ones.
+func (s *provenanceSource) Next() (SourceElement, error) {
+	if !s.read {
+		s.read = true
+		s.elements, s.err = s.readAll()
+	}
+	if len(s.elements) == 0 {
+		if s.err != nil {
+			return SourceElement{}, s.err
+		}
+		return SourceElement{}, io.EOF
+	}
+	e := s.elements[0]
+	s.elements = s.elements[1:]
+	return e, nil
+}
+
+// readAll reads the elements of the source and sorts them by their positions.
+// The elements read before an error are still returned, along with it.
+func (s *provenanceSource) readAll() ([]SourceElement, error) {
+	var read []provenanceElement
+	var readErr error
+	for index := 0; ; index++ {
+		e, err := s.src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+		p, err := s.unwrap(e)
+		if err != nil {
+			readErr = fmt.Errorf("element %d: %w", index, err)
+			break
+		}
+		read = append(read, p)
+	}
+	sort.SliceStable(read, func(i, j int) bool {
+		if read[i].wrapped != read[j].wrapped {
+			return read[i].wrapped
+		}
+		return read[i].position < read[j].position
+	})
+	elements := make([]SourceElement, len(read))
+	for i, p := range read {
+		elements[i] = p.element
+	}
+	return elements, readErr
+}
+
+// unwrap returns the element wrapped in e along with its position.
+func (s *provenanceSource) unwrap(e SourceElement) (provenanceElement, error) {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(e.Raw, &object) != nil {
+		return provenanceElement{element: e}, nil
+	}
+	value, ok := object[s.keys.Value]
+	if !ok {
+		return provenanceElement{element: e}, nil
+	}
+	p := provenanceElement{element: SourceElement{Raw: value, TypeName: e.TypeName}, wrapped: true}
+	err := json.Unmarshal(object[s.keys.Index], &p.position)
+	if err != nil || object[s.keys.Index] == nil {
+		return p, fmt.Errorf("%q is not the position of the element", s.keys.Index)
+	}
+	if p.element.TypeName == "" {
+		var typeName string
+		if json.Unmarshal(object[s.keys.Type], &typeName) == nil {
+			p.element.TypeName = typeName
+		}
+	}
+	return p, nil
+}
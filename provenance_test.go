@@ -0,0 +1,49 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMarshal_Provenance(t *testing.T) {
+	residence := Residence{
+		Location: Location{Address: "123 Main St"},
+		People:   []Person{{Name: "John"}},
+		Pets:     []Pet{{Name: "Fido"}, {Name: "Rex"}},
+	}
+	bytes, err := MarshalWithOptions(residence, WithProvenance(ProvenanceKeys{}))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"_idx":0,"_type":"location","value":{"address":"123 Main St"}},`+
+		`{"_idx":1,"_type":"person","value":{"name":"John"}},`+
+		`{"_idx":2,"_type":"pet","value":{"name":"Fido"}},`+
+		`{"_idx":3,"_type":"pet","value":{"name":"Rex"}}]`, string(bytes))
+
+	var result Residence
+	assert.NoError(t, UnmarshalWithOptions(bytes, &result, WithProvenance(ProvenanceKeys{})))
+	assert.Equal(t, residence, result)
+
+	bytes, err = MarshalWithOptions(Residence{People: []Person{{Name: "John"}}}, WithProvenance(ProvenanceKeys{Index: "seq", Value: "data"}))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"seq":0,"_type":"person","data":{"name":"John"}}]`, string(bytes))
+}
+
+func TestUnmarshal_Provenance(t *testing.T) {
+	// The array was reordered on the way.
+	in := []byte(`[
+		{"_idx":2,"_type":"pet","value":{"name":"Rex"}},
+		{"type":"pet","name":"Tom"},
+		{"_idx":0,"_type":"pet","value":{"name":"Fido"}},
+		{"_idx":1,"value":{"type":"person","name":"John"}}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(in, &result, WithProvenance(ProvenanceKeys{}))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Rex"}, {Name: "Tom"}}, result.Pets)
+
+	err = UnmarshalWithOptions([]byte(`[{"_idx":"first","_type":"pet","value":{}}]`), &result, WithProvenance(ProvenanceKeys{}))
+	assert.EqualError(t, err, `element 0: "_idx" is not the position of the element`)
+	err = UnmarshalWithOptions([]byte(`[{"_type":"pet","value":{}}]`), &result, WithProvenance(ProvenanceKeys{}))
+	assert.EqualError(t, err, `element 0: "_idx" is not the position of the element`)
+}
@@ -0,0 +1,106 @@
+package poly
+
+import (
+	"reflect"
+)
+
+// Find returns all the elements of type T held by the fields of the target,
+// which is a struct or a pointer to a struct that has been unmarshalled into.
+// This saves generic processing code from having to know which fields of the
+// target hold the elements it is interested in.
+//
+// The elements are returned in the order of the fields, and in the order of the
+// elements within slice fields. Nil pointers and zero values are skipped, as
+// when marshalling. T may be an interface, in which case every element that
+// implements it is returned, or a pointer type. If T is a pointer, pass a
+// pointer to the target to get pointers to the elements stored in it rather than
+// to copies. The fields of embedded structs are searched as well, so that
+// targets composed of other targets can be queried as a whole, but the fields
+// tagged `poly:"-"` aren't. Of the options, only WithTagKey and WithTagKeys
+// apply, to give the tags that exclude fields.
+//
+// Example usage:
+//
+//	for _, dog := range poly.Find[Dog](&result) {
+//	    ...
+//	}
+func Find[T any](target any, opts ...Option) []T {
+	var found []T
+	findElements(reflect.ValueOf(target), reflect.TypeOf((*T)(nil)).Elem(), newOptions(opts).tagKeys, func(v reflect.Value) bool {
+		found = append(found, v.Interface().(T))
+		return true
+	})
+	return found
+}
+
+// First returns the first element of type T held by the fields of the target,
+// following the same rules as Find, with the same options. False is returned
+// if there is no such element.
+func First[T any](target any, opts ...Option) (T, bool) {
+	var first T
+	ok := false
+	findElements(reflect.ValueOf(target), reflect.TypeOf((*T)(nil)).Elem(), newOptions(opts).tagKeys, func(v reflect.Value) bool {
+		first = v.Interface().(T)
+		ok = true
+		return false
+	})
+	return first, ok
+}
+
+// findElements calls found with every element of type t held by the fields of
+// the struct v, or the struct v points to, that the tags with the tag keys
+// don't exclude, until found returns false. False is returned if the search
+// was stopped.
+func findElements(v reflect.Value, t reflect.Type, tagKeys []string, found func(v reflect.Value) bool) bool {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return true
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if isExcludedField(field, tagKeys) {
+			continue
+		}
+		fieldValue := v.Field(i)
+
+		if fieldValue.Kind() == reflect.Slice && fieldValue.Type() != rawMessageType {
+			for j := 0; j < fieldValue.Len(); j++ {
+				if !matchElement(fieldValue.Index(j), t, found) {
+					return false
+				}
+			}
+		} else if !matchElement(fieldValue, t, found) {
+			return false
+		}
+
+		if field.Anonymous && !findElements(fieldValue, t, tagKeys, found) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchElement calls found with the element v if it is of type t, either
+// directly, by dereferencing it, or by taking its address. The result of found
+// is returned, or true if the element doesn't match.
+func matchElement(v reflect.Value, t reflect.Type, found func(v reflect.Value) bool) bool {
+	v, ok := derefValue(v)
+	if !ok || v.IsZero() {
+		return true
+	}
+	switch {
+	case v.Type().AssignableTo(t):
+		return found(v)
+	case v.Kind() == reflect.Pointer && v.Elem().Type().AssignableTo(t):
+		return found(v.Elem())
+	case v.CanAddr() && v.Addr().Type().AssignableTo(t):
+		return found(v.Addr())
+	}
+	return true
+}
@@ -0,0 +1,87 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Household struct {
+	Residence
+	Pets  []Pet   `poly:"pet"`
+	Guest *Person `poly:"guest"`
+}
+
+func TestFind(t *testing.T) {
+	h := Household{
+		Residence: Residence{
+			Location: Location{Address: "123 Main St"},
+			People:   []Person{{Name: "John"}, {Name: "Jane"}},
+		},
+		Pets:  []Pet{{Name: "Fido"}},
+		Guest: &Person{Name: "Bob"},
+	}
+
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Jane"}, {Name: "Bob"}}, Find[Person](h))
+	assert.Equal(t, []Pet{{Name: "Fido"}}, Find[Pet](&h))
+	assert.Nil(t, Find[WaterService](h))
+
+	// Pointers refer to the elements of the target itself.
+	people := Find[*Person](&h)
+	assert.Len(t, people, 3)
+	people[0].Age = 42
+	assert.Equal(t, 42, h.People[0].Age)
+	assert.Same(t, h.Guest, people[2])
+
+	p, ok := First[Person](h)
+	assert.True(t, ok)
+	assert.Equal(t, "John", p.Name)
+
+	_, ok = First[WaterService](h)
+	assert.False(t, ok)
+}
+
+type Named interface {
+	GetName() string
+}
+
+func (p Person) GetName() string {
+	return p.Name
+}
+
+func (p *Pet) GetName() string {
+	return p.Name
+}
+
+func TestFind_Interface(t *testing.T) {
+	h := &Household{
+		Residence: Residence{
+			People: []Person{{Name: "John"}},
+		},
+		Pets: []Pet{{Name: "Fido"}},
+	}
+
+	var names []string
+	for _, n := range Find[Named](h) {
+		names = append(names, n.GetName())
+	}
+	assert.Equal(t, []string{"John", "Fido"}, names)
+}
+
+type EventLog struct {
+	Created []Person `event:"created"`
+	Cache   []Person `event:"-"`
+}
+
+func TestFind_TagKey(t *testing.T) {
+	log := EventLog{
+		Created: []Person{{Name: "John"}},
+		Cache:   []Person{{Name: "Stale"}},
+	}
+
+	assert.Equal(t, []Person{{Name: "John"}}, Find[Person](log, WithTagKey("event")))
+	assert.Len(t, Find[Person](log), 2)
+
+	p, ok := First[Person](EventLog{Cache: log.Cache}, WithTagKey("event"))
+	assert.False(t, ok)
+	assert.Equal(t, Person{}, p)
+}
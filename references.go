@@ -0,0 +1,177 @@
+package poly
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// reference is a field of an element struct that is tagged with `polyref`,
+// such as
+//
+//	Owner *Person `json:"-" polyref:"person,ID"`
+//
+// which is set to the element of type name "person" whose ID field is equal to
+// the OwnerID field of the element. The field holding the identity of the
+// referenced element is named after the reference field and the identity
+// field, unless it is given with the key option, as in
+// `polyref:"person,ID,key=OwnerRef"`.
+type reference struct {
+	// name is the name of the reference field and index its index.
+	name  string
+	index int
+	// keyIndex is the index of the field of the element that holds the
+	// identity of the referenced element.
+	keyIndex []int
+	// target is the field of the target struct holding the referenced
+	// elements, and idIndex is the index of their identity field.
+	target  fieldLookup
+	idIndex []int
+}
+
+// parseRefTag splits a `polyref` struct tag into the type name of the
+// referenced elements, the name of their identity field and the name of the
+// field of the referencing element holding the identity, which is empty unless
+// given with the key option.
+func parseRefTag(tag string) (string, string, string) {
+	parts := strings.Split(tag, ",")
+	var idName, keyName string
+	for i, part := range parts[1:] {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if found && key == "key" {
+			keyName = value
+		} else if i == 0 {
+			idName = key
+		}
+	}
+	return parts[0], idName, keyName
+}
+
+// elementReferences returns the references declared by the fields of the
+// element struct type, checking them against the fields of the target.
+func elementReferences(elemType reflect.Type, targetFields map[string]fieldLookup) ([]reference, error) {
+	var refs []reference
+	for i := 0; i < elemType.NumField(); i++ {
+		f := elemType.Field(i)
+		tag, ok := f.Tag.Lookup("polyref")
+		if !ok {
+			continue
+		}
+		typeName, idName, keyName := parseRefTag(tag)
+		target, ok := targetFields[typeName]
+		if !ok || target.raw || target.fieldType.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("reference field %s of %v refers to type name %q, which has no struct field in the target", f.Name, elemType, typeName)
+		}
+		if f.Type != reflect.PointerTo(target.fieldType) {
+			return nil, fmt.Errorf("reference field %s of %v must be a %v", f.Name, elemType, reflect.PointerTo(target.fieldType))
+		}
+		idField, ok := target.fieldType.FieldByName(idName)
+		if !ok {
+			return nil, fmt.Errorf("reference identity field %s does not exist in %v", idName, target.fieldType)
+		}
+		if !idField.Type.Comparable() {
+			return nil, fmt.Errorf("reference identity field %s of %v is not comparable", idName, target.fieldType)
+		}
+		if keyName == "" {
+			keyName = f.Name + idName
+		}
+		keyField, ok := elemType.FieldByName(keyName)
+		if !ok {
+			return nil, fmt.Errorf("reference key field %s does not exist in %v", keyName, elemType)
+		}
+		if keyField.Type != idField.Type {
+			return nil, fmt.Errorf("reference key field %s of %v must be a %v like %s of %v", keyName, elemType, idField.Type, idName, target.fieldType)
+		}
+		refs = append(refs, reference{
+			name:     f.Name,
+			index:    i,
+			keyIndex: keyField.Index,
+			target:   target,
+			idIndex:  idField.Index,
+		})
+	}
+	return refs, nil
+}
+
+// resolveReferences sets the reference fields of all the elements decoded into
+// the target to point to the elements they refer to. This is done once all the
+// elements are decoded, as slices may be reallocated while they are appended
+// to. A reference whose key is the zero value is left nil, and a reference to
+// an element that doesn't exist is an error. If several elements have the same
+// identity, the first one is referred to.
+func resolveReferences(targetValue reflect.Value, targetFields map[string]fieldLookup) error {
+	elements := map[string]map[any]reflect.Value{}
+	elementsFor := func(ref reference) map[any]reflect.Value {
+		key := ref.target.goName + "." + fmt.Sprint(ref.idIndex)
+		byID, ok := elements[key]
+		if !ok {
+			byID = map[any]reflect.Value{}
+			forEachTargetElement(targetValue.Field(ref.target.index), ref.target, func(elem reflect.Value) error {
+				id := elem.Elem().FieldByIndex(ref.idIndex).Interface()
+				if _, ok := byID[id]; !ok {
+					byID[id] = elem
+				}
+				return nil
+			})
+			elements[key] = byID
+		}
+		return byID
+	}
+
+	done := map[string]bool{}
+	for _, fl := range sortedFieldLookups(targetFields) {
+		if done[fl.goName] || fl.raw || fl.fieldType.Kind() != reflect.Struct {
+			continue
+		}
+		done[fl.goName] = true
+		refs, err := elementReferences(fl.fieldType, targetFields)
+		if err != nil {
+			return err
+		}
+		if len(refs) == 0 {
+			continue
+		}
+		err = forEachTargetElement(targetValue.Field(fl.index), fl, func(elem reflect.Value) error {
+			for _, ref := range refs {
+				key := elem.Elem().FieldByIndex(ref.keyIndex)
+				if key.IsZero() {
+					continue
+				}
+				referenced, ok := elementsFor(ref)[key.Interface()]
+				if !ok {
+					return fmt.Errorf("reference field %s of %v refers to %q %v, which does not exist", ref.name, fl.fieldType, ref.target.name, key.Interface())
+				}
+				elem.Elem().Field(ref.index).Set(referenced)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forEachTargetElement calls fn with a pointer to each of the elements held by
+// the field of the target, skipping nil pointers.
+func forEachTargetElement(field reflect.Value, fl fieldLookup, fn func(elem reflect.Value) error) error {
+	visit := func(v reflect.Value) error {
+		if !fl.ptr {
+			return fn(v.Addr())
+		}
+		if v.IsNil() {
+			return nil
+		}
+		return fn(v)
+	}
+	if !fl.slice {
+		return visit(field)
+	}
+	for i := 0; i < field.Len(); i++ {
+		err := visit(field.Index(i))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type refPerson struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type refPet struct {
+	Name    string     `json:"name"`
+	OwnerID string     `json:"ownerId"`
+	Owner   *refPerson `json:"-" polyref:"person,ID"`
+	VetRef  string     `json:"vet"`
+	Vet     *refPerson `json:"-" polyref:"person,ID,key=VetRef"`
+}
+
+type refHousehold struct {
+	People []refPerson `poly:"person"`
+	Pets   []*refPet   `poly:"pet"`
+}
+
+func TestUnmarshalWithOptions_References(t *testing.T) {
+	input := []byte(`[
+		{"type":"pet","name":"Fido","ownerId":"p2","vet":"p1"},
+		{"type":"person","id":"p1","name":"Alice"},
+		{"type":"person","id":"p2","name":"Bob"},
+		{"type":"pet","name":"Stray"}
+	]`)
+
+	var result refHousehold
+	err := UnmarshalWithOptions(input, &result, WithReferenceResolution())
+	assert.NoError(t, err)
+	assert.Len(t, result.Pets, 2)
+	assert.Same(t, &result.People[1], result.Pets[0].Owner)
+	assert.Same(t, &result.People[0], result.Pets[0].Vet)
+	assert.Nil(t, result.Pets[1].Owner)
+	assert.Nil(t, result.Pets[1].Vet)
+
+	// Without the option the references are left alone.
+	result = refHousehold{}
+	err = Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Nil(t, result.Pets[0].Owner)
+}
+
+func TestUnmarshalWithOptions_ReferenceNotFound(t *testing.T) {
+	input := []byte(`[{"type":"pet","name":"Fido","ownerId":"p9"}]`)
+
+	var result refHousehold
+	err := UnmarshalWithOptions(input, &result, WithReferenceResolution())
+	assert.EqualError(t, err, `reference field Owner of poly.refPet refers to "person" p9, which does not exist`)
+}
+
+func TestUnmarshalWithOptions_InvalidReferences(t *testing.T) {
+	input := []byte(`[{"type":"pet","name":"Fido"}]`)
+
+	var wrongType struct {
+		Pets []struct {
+			Owner   *refPet `polyref:"person,ID"`
+			OwnerID string
+		} `poly:"pet"`
+		People []refPerson `poly:"person"`
+	}
+	err := UnmarshalWithOptions(input, &wrongType, WithReferenceResolution())
+	assert.ErrorContains(t, err, "reference field Owner of struct")
+	assert.ErrorContains(t, err, "must be a *poly.refPerson")
+
+	var missingType struct {
+		Pets []refPet `poly:"pet"`
+	}
+	err = UnmarshalWithOptions(input, &missingType, WithReferenceResolution())
+	assert.EqualError(t, err, `reference field Owner of poly.refPet refers to type name "person", which has no struct field in the target`)
+
+	var missingKey struct {
+		Pets []struct {
+			Owner *refPerson `polyref:"person,ID"`
+		} `poly:"pet"`
+		People []refPerson `poly:"person"`
+	}
+	err = UnmarshalWithOptions(input, &missingKey, WithReferenceResolution())
+	assert.ErrorContains(t, err, "reference key field OwnerID does not exist")
+
+	var missingID struct {
+		Pets []struct {
+			Owner   *refPerson `polyref:"person,Key"`
+			OwnerID string
+		} `poly:"pet"`
+		People []refPerson `poly:"person"`
+	}
+	err = UnmarshalWithOptions(input, &missingID, WithReferenceResolution())
+	assert.EqualError(t, err, "reference identity field Key does not exist in poly.refPerson")
+}
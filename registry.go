@@ -0,0 +1,95 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Registry maps polymorphic type names to the Go struct types that elements
+// with those type names are decoded into. It is used by the parts of the
+// library that decode elements without a target struct whose fields define
+// the mapping, such as the Router.
+//
+// A Registry is safe for concurrent use.
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string]reflect.Type
+}
+
+// NewRegistry creates a new, empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		types: map[string]reflect.Type{},
+	}
+}
+
+// Register adds the type of the prototype to the registry under the given type
+// name. The prototype must be a struct or a pointer to a struct; only its type
+// is used, so the zero value is the usual choice, e.g. `Dog{}`. An error is
+// returned if the prototype is not a struct or if the type name has already
+// been registered.
+func (r *Registry) Register(typeName string, prototype any) error {
+	t := reflect.TypeOf(prototype)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("prototype for %q must be a struct, got %T", typeName, prototype)
+	}
+	return r.add(typeName, t)
+}
+
+// Register adds the struct type T to the registry under the given type name.
+// It works like Registry.Register, but takes the type as a type parameter
+// rather than through a prototype value:
+//
+//	err := poly.Register[Dog](registry, "dog")
+//
+// T must be the struct type itself. Unlike with a prototype, a pointer to a
+// struct is an error, so that the registry always holds the types that the
+// elements are decoded into.
+func Register[T any](r *Registry, typeName string) error {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("type for %q must be a struct, got %v", typeName, t)
+	}
+	return r.add(typeName, t)
+}
+
+// add adds the struct type to the registry under the given type name, unless
+// the type name has already been registered.
+func (r *Registry) add(typeName string, t reflect.Type) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.types[typeName]; ok {
+		return fmt.Errorf("type name %q is already registered to %v", typeName, existing)
+	}
+	r.types[typeName] = t
+	return nil
+}
+
+// Lookup returns the struct type registered under the given type name.
+func (r *Registry) Lookup(typeName string) (reflect.Type, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, ok := r.types[typeName]
+	return t, ok
+}
+
+// Decode creates a new instance of the struct type registered under the given
+// type name and unmarshals the raw JSON into it. The returned value is a
+// pointer to the new instance, e.g. *Dog. An error is returned if the type name
+// isn't registered or if the JSON can't be unmarshalled.
+func (r *Registry) Decode(typeName string, raw json.RawMessage) (any, error) {
+	t, ok := r.Lookup(typeName)
+	if !ok {
+		return nil, fmt.Errorf("type name %q is not registered", typeName)
+	}
+	v, err := decodeElement(raw, t, 0)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
@@ -0,0 +1,53 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"reflect"
+	"testing"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	reg := NewRegistry()
+	assert.NoError(t, reg.Register("person", Person{}))
+	assert.NoError(t, reg.Register("pet", &Pet{}))
+
+	pt, ok := reg.Lookup("pet")
+	assert.True(t, ok)
+	assert.Equal(t, reflect.TypeOf(Pet{}), pt)
+
+	_, ok = reg.Lookup("unknown")
+	assert.False(t, ok)
+
+	assert.EqualError(t, reg.Register("person", Pet{}), `type name "person" is already registered to poly.Person`)
+	assert.EqualError(t, reg.Register("string", ""), `prototype for "string" must be a struct, got string`)
+	assert.EqualError(t, reg.Register("nil", nil), `prototype for "nil" must be a struct, got <nil>`)
+}
+
+func TestRegister(t *testing.T) {
+	reg := NewRegistry()
+	assert.NoError(t, Register[Person](reg, "person"))
+
+	pt, ok := reg.Lookup("person")
+	assert.True(t, ok)
+	assert.Equal(t, reflect.TypeOf(Person{}), pt)
+
+	assert.EqualError(t, Register[Pet](reg, "person"), `type name "person" is already registered to poly.Person`)
+	assert.EqualError(t, Register[*Pet](reg, "pet"), `type for "pet" must be a struct, got *poly.Pet`)
+	assert.EqualError(t, Register[string](reg, "string"), `type for "string" must be a struct, got string`)
+	assert.EqualError(t, Register[any](reg, "any"), `type for "any" must be a struct, got interface {}`)
+}
+
+func TestRegistry_Decode(t *testing.T) {
+	reg := NewRegistry()
+	assert.NoError(t, reg.Register("person", Person{}))
+
+	v, err := reg.Decode("person", []byte(`{"type":"person","name":"John"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &Person{Name: "John"}, v)
+
+	_, err = reg.Decode("pet", []byte(`{}`))
+	assert.EqualError(t, err, `type name "pet" is not registered`)
+
+	_, err = reg.Decode("person", []byte(`{"name":42}`))
+	assert.Error(t, err)
+}
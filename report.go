@@ -0,0 +1,55 @@
+package poly
+
+import (
+	"time"
+)
+
+// DecodeReport describes what an unmarshalling did, grouped by type name. It
+// is filled in when it is given with the WithDecodeReport option, which makes
+// investigating the performance of a workload possible without wrapping the
+// library with external instrumentation.
+type DecodeReport struct {
+	// Elements is the number of elements read.
+	Elements int
+	// Types holds the statistics of the elements that were decoded, by type
+	// name.
+	Types map[string]TypeStats
+	// Unmatched is the number of elements that were skipped because their
+	// type name didn't match any field of the target, and UnmatchedBytes is
+	// the total size of their JSON.
+	Unmatched      int
+	UnmatchedBytes int
+	// Duration is the time the whole unmarshalling took.
+	Duration time.Duration
+}
+
+// TypeStats holds the statistics of the decoded elements of a type name.
+type TypeStats struct {
+	// Elements is the number of elements decoded.
+	Elements int
+	// Bytes is the total size of the JSON of the elements.
+	Bytes int
+	// Duration is the total time spent decoding the elements.
+	Duration time.Duration
+}
+
+// reset prepares the report for a new unmarshalling.
+func (r *DecodeReport) reset() {
+	*r = DecodeReport{Types: map[string]TypeStats{}}
+}
+
+// decoded records an element of the type name that was decoded, of the given
+// size, which took the time since start.
+func (r *DecodeReport) decoded(typeName string, size int, start time.Time) {
+	stats := r.Types[typeName]
+	stats.Elements++
+	stats.Bytes += size
+	stats.Duration += time.Since(start)
+	r.Types[typeName] = stats
+}
+
+// unmatched records an element that was skipped.
+func (r *DecodeReport) unmatched(size int) {
+	r.Unmatched++
+	r.UnmatchedBytes += size
+}
@@ -0,0 +1,35 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUnmarshalWithOptions_DecodeReport(t *testing.T) {
+	input := []byte(`[{"type":"person","name":"John"},{"type":"person","name":"Jane"},{"type":"pet","name":"Fido"},{"type":"starship"},{}]`)
+
+	report := DecodeReport{Unmatched: 42}
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithDecodeReport(&report))
+	assert.NoError(t, err)
+
+	assert.Equal(t, 5, report.Elements)
+	assert.Equal(t, 2, report.Unmatched)
+	assert.Equal(t, len(`{"type":"starship"}{}`), report.UnmatchedBytes)
+	assert.Len(t, report.Types, 2)
+	assert.Equal(t, 2, report.Types["person"].Elements)
+	assert.Equal(t, len(`{"type":"person","name":"John"}{"type":"person","name":"Jane"}`), report.Types["person"].Bytes)
+	assert.Equal(t, 1, report.Types["pet"].Elements)
+	assert.Positive(t, report.Duration)
+	assert.GreaterOrEqual(t, report.Duration, report.Types["person"].Duration+report.Types["pet"].Duration)
+}
+
+func TestUnmarshalWithOptions_DecodeReportAccumulator(t *testing.T) {
+	var report DecodeReport
+	acc := &lockedList{}
+	err := UnmarshalWithOptions([]byte(`[{"type":"pet"},{"type":"location"}]`), acc, WithRegistry(accumulatorRegistry()), WithDecodeReport(&report))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Elements)
+	assert.Equal(t, 1, report.Unmatched)
+	assert.Equal(t, 1, report.Types["pet"].Elements)
+}
@@ -0,0 +1,217 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+)
+
+// resolver determines the polymorphic type name of an element from its index
+// and the JSON that identifies its type. An empty type name means that the
+// element is of no interest.
+type resolver func(index int, raw json.RawMessage) (string, error)
+
+// locatorResolver returns a resolver that unmarshals the JSON into a new
+// instance of the typeLocator and asks it for the type name, for the parts of
+// a composite type name, or for the type code that is translated with the
+// codes. If there is a conflicts policy and the typeLocator is a
+// DiscriminatorReporter, the policy handles the elements with conflicting type
+// names. An error is returned if the typeLocator implements none of the
+// TypeLocator, CompositeTypeLocator and TypeCodeLocator interfaces.
+func locatorResolver(typeLocator reflect.Type, codes map[int64]string, conflicts func(found []Discriminator) (string, error)) (resolver, error) {
+	// Verify that the typeLocator is suitable.
+	if typeLocator == nil || !(reflect.PointerTo(typeLocator).AssignableTo(typeLocatorType) || reflect.PointerTo(typeLocator).AssignableTo(compositeTypeLocatorType) || reflect.PointerTo(typeLocator).AssignableTo(typeCodeLocatorType)) {
+		return nil, fmt.Errorf("typeLocator not assignable to a TypeLocator")
+	}
+	return func(index int, raw json.RawMessage) (string, error) {
+		locatorPtr := reflect.New(typeLocator)
+		err := json.Unmarshal(raw, locatorPtr.Interface())
+		if err != nil {
+			return "", err
+		}
+		locator := locatorPtr.Interface()
+		if l, ok := locator.(DiscriminatorReporter); ok && conflicts != nil {
+			if found := l.Discriminators(); len(found) > 0 {
+				return resolveConflicts(index, found, conflicts)
+			}
+		}
+		if l, ok := locator.(TypeLocator); ok {
+			if typeName := l.TypeName(); typeName != "" {
+				return typeName, nil
+			}
+		}
+		if l, ok := locator.(CompositeTypeLocator); ok {
+			if typeName := compositeTypeName(l.CompositeTypeName()); typeName != "" {
+				return typeName, nil
+			}
+		}
+		if l, ok := locator.(TypeCodeLocator); ok {
+			if code, ok := l.TypeCode(); ok {
+				return codeTypeName(codes, code), nil
+			}
+		}
+		return "", nil
+	}, nil
+}
+
+// keyResolver returns a resolver that reads the type name from the first of
+// the keys that holds a non-empty string in the element. If there are codes,
+// a key that holds an integer type code is translated with them as well. If
+// there is a conflicts policy, it handles the elements whose keys hold
+// different type names.
+func keyResolver(keys []string, codes map[int64]string, conflicts func(found []Discriminator) (string, error)) resolver {
+	return func(index int, raw json.RawMessage) (string, error) {
+		var object map[string]json.RawMessage
+		err := json.Unmarshal(raw, &object)
+		if err != nil {
+			return "", err
+		}
+		var found []Discriminator
+		for _, key := range keys {
+			var typeName string
+			var code *int64
+			if json.Unmarshal(object[key], &typeName) == nil && typeName != "" {
+				found = append(found, Discriminator{Key: key, Value: typeName})
+			} else if len(codes) > 0 && json.Unmarshal(object[key], &code) == nil && code != nil {
+				found = append(found, Discriminator{Key: key, Value: codeTypeName(codes, *code)})
+			} else {
+				continue
+			}
+			if conflicts == nil {
+				break
+			}
+		}
+		return resolveConflicts(index, found, conflicts)
+	}
+}
+
+// pathResolver returns a function that reads the type name from the nested
+// objects of the element along the path of keys. A key that is a number
+// selects the element of an array at that position instead. An element
+// without a string at the end of the path has no type name, but an error is
+// returned if the element itself isn't an object.
+func pathResolver(path []string) func(raw json.RawMessage) (string, error) {
+	return func(raw json.RawMessage) (string, error) {
+		for i, key := range path {
+			var object map[string]json.RawMessage
+			err := json.Unmarshal(raw, &object)
+			if err != nil {
+				var array []json.RawMessage
+				position, convErr := strconv.Atoi(key)
+				if i > 0 && convErr == nil && json.Unmarshal(raw, &array) == nil && position >= 0 && position < len(array) {
+					raw = array[position]
+					continue
+				}
+				if i > 0 {
+					return "", nil
+				}
+				return "", err
+			}
+			raw = object[key]
+			if raw == nil {
+				return "", nil
+			}
+		}
+		var typeName string
+		if json.Unmarshal(raw, &typeName) != nil {
+			return "", nil
+		}
+		return typeName, nil
+	}
+}
+
+// optionsResolver returns the resolver for the type resolver function, the type
+// keys or, if there are neither, the typeLocator in the options, going through
+// the LocatorCache if one is given, and consulting the ExternalResolver first
+// if one is given. The type names found are transformed with the type name
+// transforms and then translated with the vocabulary, if any.
+func optionsResolver(o *options) (resolver, error) {
+	var resolve resolver
+	if o.typeResolver != nil {
+		typeResolver := o.typeResolver
+		resolve = func(index int, raw json.RawMessage) (string, error) {
+			return typeResolver(raw)
+		}
+	} else if len(o.typeKeys) > 0 {
+		resolve = keyResolver(o.typeKeys, o.typeCodes, o.conflicts)
+	} else {
+		var err error
+		resolve, err = locatorResolver(o.typeLocator, o.typeCodes, o.conflicts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if o.locatorCache != nil {
+		resolve = o.locatorCache.wrap(resolve)
+	}
+	if o.externalResolver != nil {
+		resolve = externalResolver(o.externalResolver, resolve)
+	}
+	if len(o.typeNameTransforms) > 0 {
+		resolve = transformResolver(o.typeNameTransforms, resolve)
+	}
+	if len(o.vocabulary) > 0 {
+		return vocabularyResolver(o.vocabulary, resolve)
+	}
+	return resolve, nil
+}
+
+// vocabularyResolver wraps a resolver to translate the aliases in the
+// vocabulary, which maps canonical type names to their aliases, into the
+// canonical type names. An error is returned if an alias is given for more
+// than one canonical type name.
+func vocabularyResolver(vocabulary map[string][]string, resolve resolver) (resolver, error) {
+	canonical := map[string]string{}
+	for typeName, aliases := range vocabulary {
+		for _, alias := range aliases {
+			if existing, ok := canonical[alias]; ok && existing != typeName {
+				if existing > typeName {
+					existing, typeName = typeName, existing
+				}
+				return nil, fmt.Errorf("type name %q is an alias of both %q and %q", alias, existing, typeName)
+			}
+			canonical[alias] = typeName
+		}
+	}
+	return func(index int, raw json.RawMessage) (string, error) {
+		typeName, err := resolve(index, raw)
+		if err != nil {
+			return "", err
+		}
+		if translated, ok := canonical[typeName]; ok {
+			return translated, nil
+		}
+		return typeName, nil
+	}, nil
+}
+
+// forEachElement reads every element from the source, resolves its type name,
+// and calls fn with the index of the element, its type name, and its JSON. The
+// index of the first element of the source is firstIndex, which is 0 unless
+// the source is a part of a larger array. It stops at the first error, and
+// returns the number of elements that were read along with the error, if any.
+func forEachElement(src ElementSource, firstIndex int, resolve resolver, fn func(index int, typeName string, raw json.RawMessage) error) (int, error) {
+	for count := 0; ; count++ {
+		e, err := src.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		index := firstIndex + count
+		typeName := e.TypeName
+		if typeName == "" {
+			typeName, err = resolve(index, e.locator())
+			if err != nil {
+				return count + 1, err
+			}
+		}
+		err = fn(index, typeName, e.Raw)
+		if err != nil {
+			return count + 1, err
+		}
+	}
+}
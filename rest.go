@@ -0,0 +1,148 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// restTypeName is the name in the `poly` tag of the field that receives all
+// the elements that no other field matched, as in `poly:"!rest"`, and
+// catchAllTypeName is another name for it, as in `poly:"*"`.
+const (
+	restTypeName     = "!rest"
+	catchAllTypeName = "*"
+)
+
+var (
+	bytesType             = reflect.TypeOf([]byte{})
+	rawMessagesType       = reflect.TypeOf([]json.RawMessage{})
+	unmatchedElementsType = reflect.TypeOf([]UnmatchedElement{})
+)
+
+// UnmatchedElement is an element that no field of the target matched, as
+// collected by a field of type []UnmatchedElement tagged `poly:"*"`.
+type UnmatchedElement struct {
+	// TypeName is the type name of the element, which is empty if it has
+	// none.
+	TypeName string
+	// Index is the position of the element in the array.
+	Index int
+	// Raw is the JSON of the element, exactly as it was.
+	Raw json.RawMessage
+}
+
+// isRestField reports whether the struct field is tagged to receive the
+// unmatched elements.
+func isRestField(f reflect.StructField, tagKeys []string) bool {
+	return restTagName(f, tagKeys) != ""
+}
+
+// restTagName returns the name in the tag of the struct field if it is tagged
+// to receive the unmatched elements, and an empty string otherwise.
+func restTagName(f reflect.StructField, tagKeys []string) string {
+	tag, ok := lookupTag(f.Tag, tagKeys)
+	if !ok {
+		return ""
+	}
+	name, _, _ := parseTag(tag)
+	if name != restTypeName && name != catchAllTypeName {
+		return ""
+	}
+	return name
+}
+
+// findRestField returns the index of the field of the struct type that
+// receives the unmatched elements, or -1 if there is none. An error is
+// returned if there is more than one such field, or if it isn't one of the
+// types that can hold them.
+func findRestField(t reflect.Type, tagKeys []string) (int, error) {
+	index := -1
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := restTagName(f, tagKeys)
+		if name == "" || isExcludedField(f, tagKeys) {
+			continue
+		}
+		if index >= 0 {
+			return -1, fmt.Errorf("only one field may be tagged %q, found %s and %s", name, t.Field(index).Name, f.Name)
+		}
+		switch f.Type {
+		case rawMessageType, bytesType, rawMessagesType, unmatchedElementsType:
+		default:
+			return -1, fmt.Errorf("field %s tagged %q must be a json.RawMessage, a []byte, a []json.RawMessage or a []poly.UnmatchedElement", f.Name, name)
+		}
+		index = i
+	}
+	return index, nil
+}
+
+// setRest stores the unmatched elements in the field that receives them.
+func setRest(field reflect.Value, rest []UnmatchedElement) {
+	switch field.Type() {
+	case unmatchedElementsType:
+		field.Set(reflect.ValueOf(rest))
+	case rawMessagesType:
+		raws := make([]json.RawMessage, len(rest))
+		for i, e := range rest {
+			raws[i] = e.Raw
+		}
+		field.Set(reflect.ValueOf(raws))
+	default:
+		raws := make([]json.RawMessage, len(rest))
+		for i, e := range rest {
+			raws[i] = e.Raw
+		}
+		field.SetBytes(joinElements(raws))
+	}
+}
+
+// joinElements assembles the raw elements into a JSON array, keeping each of
+// them as it is.
+func joinElements(elements []json.RawMessage) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, e := range elements {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(e)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes()
+}
+
+// splitRest splits the unmatched elements held by the field that receives them
+// back into the elements to emit when marshalling. The elements have no type
+// name, since none of the fields matched them.
+func splitRest(f reflect.StructField, rest reflect.Value, tagKeys []string) ([]indexedObject, error) {
+	fieldName := f.Name
+	var elements []json.RawMessage
+	switch rest.Type() {
+	case unmatchedElementsType:
+		for _, e := range rest.Interface().([]UnmatchedElement) {
+			elements = append(elements, e.Raw)
+		}
+	case rawMessagesType:
+		elements = rest.Interface().([]json.RawMessage)
+	default:
+		if rest.Len() == 0 {
+			return nil, nil
+		}
+		err := json.Unmarshal(rest.Bytes(), &elements)
+		if err != nil {
+			return nil, fmt.Errorf("field %s tagged %q does not hold a JSON array: %w", fieldName, restTagName(f, tagKeys), err)
+		}
+	}
+	indexedObjects := make([]indexedObject, len(elements))
+	for i, e := range elements {
+		indexedObjects[i] = indexedObject{
+			Index: math.MaxInt,
+			Value: e,
+			Field: fieldName,
+		}
+	}
+	return indexedObjects, nil
+}
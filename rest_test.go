@@ -0,0 +1,109 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Understood struct {
+	People []Person        `poly:"person"`
+	Rest   json.RawMessage `poly:"!rest"`
+}
+
+func TestUnmarshal_Rest(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"starship", "name":"Enterprise"},
+		{"name":"untyped"},
+		{"type":"person", "name":"Jane"}
+	]`)
+
+	var result Understood
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Jane"}}, result.People)
+	assert.Equal(t, `[{"type":"starship", "name":"Enterprise"},{"name":"untyped"}]`, string(result.Rest))
+
+	// The unmatched elements are emitted again.
+	bytes, err := MarshalWithOptions(result, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"person","name":"John"},{"type":"person","name":"Jane"},{"type":"starship", "name":"Enterprise"},{"name":"untyped"}]`, string(bytes))
+
+	fields, err := DescribeTarget(result)
+	assert.NoError(t, err)
+	assert.Len(t, fields, 1)
+}
+
+func TestUnmarshal_RestBytes(t *testing.T) {
+	var result struct {
+		People []Person `poly:"person"`
+		Rest   []byte   `poly:"!rest"`
+	}
+	err := Unmarshal([]byte(`[{"type":"person", "name":"John"}]`), &result)
+	assert.NoError(t, err)
+	assert.Nil(t, result.Rest)
+
+	err = Unmarshal([]byte(`[{"type":"pet"}]`), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"pet"}]`, string(result.Rest))
+}
+
+func TestUnmarshal_RestInvalid(t *testing.T) {
+	var wrongType struct {
+		Rest string `poly:"!rest"`
+	}
+	err := Unmarshal([]byte(`[]`), &wrongType)
+	assert.EqualError(t, err, `field Rest tagged "!rest" must be a json.RawMessage, a []byte, a []json.RawMessage or a []poly.UnmatchedElement`)
+
+	var twice struct {
+		Rest  json.RawMessage `poly:"!rest"`
+		Other json.RawMessage `poly:"!rest"`
+	}
+	err = Unmarshal([]byte(`[]`), &twice)
+	assert.EqualError(t, err, `only one field may be tagged "!rest", found Rest and Other`)
+
+	_, err = Marshal(Understood{Rest: json.RawMessage(`{}`)})
+	assert.ErrorContains(t, err, `field Rest tagged "!rest" does not hold a JSON array`)
+}
+
+type CatchAll struct {
+	People    []Person           `poly:"person"`
+	Unmatched []UnmatchedElement `poly:"*"`
+}
+
+func TestUnmarshal_CatchAll(t *testing.T) {
+	input := []byte(`[{"type":"person","name":"John"},{"type":"pet", "name":"Fido"},{"name":"untyped"}]`)
+
+	var result CatchAll
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []UnmatchedElement{
+		{TypeName: "pet", Index: 1, Raw: json.RawMessage(`{"type":"pet", "name":"Fido"}`)},
+		{TypeName: "", Index: 2, Raw: json.RawMessage(`{"name":"untyped"}`)},
+	}, result.Unmatched)
+
+	bytes, err := Marshal(result)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"name":"John"},{"type":"pet", "name":"Fido"},{"name":"untyped"}]`, string(bytes))
+
+	var raws struct {
+		People    []Person          `poly:"person"`
+		Unmatched []json.RawMessage `poly:"*"`
+	}
+	err = Unmarshal(input, &raws)
+	assert.NoError(t, err)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`{"type":"pet", "name":"Fido"}`), json.RawMessage(`{"name":"untyped"}`)}, raws.Unmatched)
+
+	bytes, err = Marshal(raws)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"name":"John"},{"type":"pet", "name":"Fido"},{"name":"untyped"}]`, string(bytes))
+
+	var twice struct {
+		Rest  json.RawMessage    `poly:"!rest"`
+		Other []UnmatchedElement `poly:"*"`
+	}
+	err = Unmarshal([]byte(`[]`), &twice)
+	assert.EqualError(t, err, `only one field may be tagged "*", found Rest and Other`)
+}
@@ -0,0 +1,112 @@
+package poly
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrUnhandledType is returned, wrapped, by Router.Dispatch when there is no
+// handler for the type of a frame.
+var ErrUnhandledType = errors.New("no handler for type")
+
+// HandlerFunc handles a single decoded element. The value is a pointer to the
+// struct registered for the type name in the Router's Registry, e.g. *Dog.
+type HandlerFunc func(ctx context.Context, typeName string, v any) error
+
+// Middleware wraps a HandlerFunc to add behavior around it, such as logging,
+// authorization, or metrics.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Router dispatches individual polymorphic JSON objects, such as the frames
+// received over a WebSocket or the messages consumed from a message bus, to
+// handlers based on their type. For each frame the type name is resolved with
+// the type locator, the frame is decoded into the struct registered for that
+// type name in the Registry, and the handler registered for the type name is
+// invoked with it.
+//
+// Register handlers with Handle and global middleware with Use before calling
+// Dispatch. A Router must not be modified while Dispatch is running, but once it
+// is set up it is safe to call Dispatch concurrently.
+type Router struct {
+	registry    *Registry
+	typeLocator reflect.Type
+	middleware  []Middleware
+	routes      map[string]route
+}
+
+// route is a handler registered with Router.Handle, along with the middleware
+// specific to it.
+type route struct {
+	handler    HandlerFunc
+	middleware []Middleware
+}
+
+// NewRouter creates a new Router that decodes frames into the types from the
+// registry, using the typeLocator to determine the type name of each frame.
+// The typeLocator follows the same rules as in UnmarshalCustom.
+func NewRouter(registry *Registry, typeLocator reflect.Type) *Router {
+	return &Router{
+		registry:    registry,
+		typeLocator: typeLocator,
+		routes:      map[string]route{},
+	}
+}
+
+// Use adds middleware that is applied to every handler of the Router. The
+// middleware is applied in the order given, so the first one is the outermost,
+// and all of it wraps the middleware given for a specific route.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Handle registers the handler for the frames with the given type name, along
+// with middleware that only applies to this type. An error is returned if the
+// type name isn't in the Router's Registry, since such frames could never be
+// decoded.
+func (r *Router) Handle(typeName string, handler HandlerFunc, middleware ...Middleware) error {
+	if _, ok := r.registry.Lookup(typeName); !ok {
+		return fmt.Errorf("type name %q is not registered", typeName)
+	}
+	r.routes[typeName] = route{
+		handler:    handler,
+		middleware: middleware,
+	}
+	return nil
+}
+
+// Dispatch resolves the type of a single JSON object, decodes it, and invokes
+// the handler registered for its type through the middleware. An error
+// wrapping ErrUnhandledType is returned if there is no handler for the type.
+// Otherwise any error from decoding the frame or from the handler is
+// returned.
+func (r *Router) Dispatch(ctx context.Context, frame []byte) error {
+	resolve, err := locatorResolver(r.typeLocator, nil, nil)
+	if err != nil {
+		return err
+	}
+	typeName, err := resolve(0, frame)
+	if err != nil {
+		return err
+	}
+
+	rt, ok := r.routes[typeName]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnhandledType, typeName)
+	}
+
+	v, err := r.registry.Decode(typeName, frame)
+	if err != nil {
+		return err
+	}
+
+	h := rt.handler
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	return h(ctx, typeName, v)
+}
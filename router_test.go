@@ -0,0 +1,67 @@
+package poly
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRouter_Dispatch(t *testing.T) {
+	reg := NewRegistry()
+	assert.NoError(t, reg.Register("person", Person{}))
+	assert.NoError(t, reg.Register("pet", Pet{}))
+
+	var calls []string
+	tracing := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, typeName string, v any) error {
+				calls = append(calls, name+":"+typeName)
+				return next(ctx, typeName, v)
+			}
+		}
+	}
+
+	router := NewRouter(reg, DefaultLocator)
+	router.Use(tracing("outer"), tracing("inner"))
+
+	var people []*Person
+	err := router.Handle("person", func(ctx context.Context, typeName string, v any) error {
+		people = append(people, v.(*Person))
+		return nil
+	}, tracing("person"))
+	assert.NoError(t, err)
+
+	var pets []*Pet
+	err = router.Handle("pet", func(ctx context.Context, typeName string, v any) error {
+		pets = append(pets, v.(*Pet))
+		return nil
+	})
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	assert.NoError(t, router.Dispatch(ctx, []byte(`{"type":"person","name":"John"}`)))
+	assert.NoError(t, router.Dispatch(ctx, []byte(`{"type":"pet","name":"Rover"}`)))
+
+	assert.Equal(t, []*Person{{Name: "John"}}, people)
+	assert.Equal(t, []*Pet{{Name: "Rover"}}, pets)
+	assert.Equal(t, []string{"outer:person", "inner:person", "person:person", "outer:pet", "inner:pet"}, calls)
+}
+
+func TestRouter_Errors(t *testing.T) {
+	reg := NewRegistry()
+	assert.NoError(t, reg.Register("person", Person{}))
+	assert.NoError(t, reg.Register("pet", Pet{}))
+
+	router := NewRouter(reg, DefaultLocator)
+	noop := func(ctx context.Context, typeName string, v any) error { return nil }
+	assert.EqualError(t, router.Handle("fish", noop), `type name "fish" is not registered`)
+	assert.NoError(t, router.Handle("person", noop))
+
+	ctx := context.Background()
+	err := router.Dispatch(ctx, []byte(`{"type":"pet"}`))
+	assert.ErrorIs(t, err, ErrUnhandledType)
+	assert.EqualError(t, err, `no handler for type "pet"`)
+
+	assert.Error(t, router.Dispatch(ctx, []byte(`{"type":"person","name":42}`)))
+	assert.Error(t, router.Dispatch(ctx, []byte(`not valid JSON`)))
+}
@@ -0,0 +1,44 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// sealer transforms the JSON of the elements of a type name when marshalling,
+// and reverses the transformation when unmarshalling.
+type sealer struct {
+	seal func(raw json.RawMessage) (json.RawMessage, error)
+	open func(raw json.RawMessage) (json.RawMessage, error)
+}
+
+// sealElement returns the encoded element sealed with the sealer for the type
+// name, if there is one. The sealed element must be valid JSON.
+func sealElement(encoded []byte, typeName string, o *options) ([]byte, error) {
+	s, ok := o.sealers[typeName]
+	if !ok || s.seal == nil {
+		return encoded, nil
+	}
+	sealed, err := s.seal(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("sealing element of type %q: %w", typeName, err)
+	}
+	if !json.Valid(sealed) {
+		return nil, fmt.Errorf("sealer for %q returned invalid JSON: %q", typeName, sealed)
+	}
+	return sealed, nil
+}
+
+// openElement returns the raw element opened with the sealer for the type
+// name, if there is one.
+func openElement(raw json.RawMessage, index int, typeName string, o *options) (json.RawMessage, error) {
+	s, ok := o.sealers[typeName]
+	if !ok || s.open == nil {
+		return raw, nil
+	}
+	opened, err := s.open(raw)
+	if err != nil {
+		return nil, fmt.Errorf("opening element %d of type %q: %w", index, typeName, err)
+	}
+	return opened, nil
+}
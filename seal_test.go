@@ -0,0 +1,85 @@
+package poly
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// sealPerson hides the JSON of a person in an opaque field, standing in for
+// encryption.
+func sealPerson(raw json.RawMessage) (json.RawMessage, error) {
+	return json.Marshal(map[string][]byte{"sealed": raw})
+}
+
+func openPerson(raw json.RawMessage) (json.RawMessage, error) {
+	var sealed struct {
+		Sealed []byte `json:"sealed"`
+	}
+	err := json.Unmarshal(raw, &sealed)
+	if err != nil {
+		return nil, err
+	}
+	return sealed.Sealed, nil
+}
+
+func TestWithSealer(t *testing.T) {
+	residence := Residence{
+		People: []Person{{Name: "John"}},
+		Pets:   []Pet{{Name: "Fido"}},
+	}
+	sealer := WithSealer("person", sealPerson, openPerson)
+
+	bytes, err := MarshalWithOptions(residence, WithDiscriminator("type"), sealer)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type":"person","sealed":"eyJuYW1lIjoiSm9obiJ9"},
+		{"type":"pet","name":"Fido"}
+	]`, string(bytes))
+
+	var decoded Residence
+	err = UnmarshalWithOptions(bytes, &decoded, sealer)
+	assert.NoError(t, err)
+	assert.Equal(t, residence, decoded)
+
+	list := &lockedList{}
+	err = UnmarshalWithOptions(bytes, list, WithRegistry(accumulatorRegistry()), sealer)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{&Person{Name: "John"}, &Pet{Name: "Fido"}}, list.elements)
+}
+
+func TestWithSealer_Redaction(t *testing.T) {
+	redact := WithSealer("person", func(raw json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{"name":"REDACTED"}`), nil
+	}, nil)
+
+	bytes, err := MarshalWithOptions(Residence{People: []Person{{Name: "John"}}}, WithDiscriminator("type"), redact)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"person","name":"REDACTED"}]`, string(bytes))
+
+	var decoded Residence
+	err = UnmarshalWithOptions(bytes, &decoded, redact)
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "REDACTED"}}, decoded.People)
+}
+
+func TestWithSealer_Errors(t *testing.T) {
+	residence := Residence{People: []Person{{Name: "John"}}}
+
+	_, err := MarshalWithOptions(residence, WithSealer("person", func(raw json.RawMessage) (json.RawMessage, error) {
+		return json.RawMessage(`{`), nil
+	}, nil))
+	assert.EqualError(t, err, `sealer for "person" returned invalid JSON: "{"`)
+
+	_, err = MarshalWithOptions(residence, WithSealer("person", func(raw json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("no key")
+	}, nil))
+	assert.EqualError(t, err, `sealing element of type "person": no key`)
+
+	var decoded Residence
+	err = UnmarshalWithOptions([]byte(`[{"type":"person"}]`), &decoded, WithSealer("person", nil, func(raw json.RawMessage) (json.RawMessage, error) {
+		return nil, errors.New("no key")
+	}))
+	assert.EqualError(t, err, `opening element 0 of type "person": no key`)
+}
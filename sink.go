@@ -0,0 +1,96 @@
+package poly
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// ElementSink receives the elements of a stream one at a time, without
+// decoding them, as for feeding the producer of a message queue such as Kafka
+// or NATS. Since each element is only read once the sink has accepted the one
+// before it, a sink that blocks while its destination is busy slows the
+// stream down to its pace.
+type ElementSink interface {
+	// Accept is called with the type name and the raw JSON of each element,
+	// in order. The type name is empty for elements without one. Returning
+	// an error stops the stream, and the error is returned from it.
+	Accept(typeName string, raw json.RawMessage) error
+}
+
+// SinkFunc adapts a function to the ElementSink interface.
+type SinkFunc func(typeName string, raw json.RawMessage) error
+
+// Accept implements the ElementSink interface.
+func (f SinkFunc) Accept(typeName string, raw json.RawMessage) error {
+	return f(typeName, raw)
+}
+
+// StreamToSink reads the elements from the source, resolves their type names
+// with the options as UnmarshalSource does, and passes them to the sink. It
+// stops once the context is done, and returns the error of the context, so
+// the elements that haven't been read yet stay in the source. The elements are
+// passed on as the source provides them, apart from the unpacking of
+// externally and adjacently tagged elements; they are neither checked against
+// a target nor opened with the sealers.
+//
+// Use RouteSinks to send the elements of each type to a sink of its own.
+func StreamToSink(ctx context.Context, src ElementSource, sink ElementSink, opts ...Option) error {
+	o := newOptions(opts)
+	resolve, err := optionsResolver(o)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err = forEachElement(wrapSource(src, o), o.firstIndex, resolve, func(index int, typeName string, raw json.RawMessage) error {
+		err := sink.Accept(typeName, raw)
+		if err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+	return err
+}
+
+// RouteSinks returns an ElementSink that passes each element to the sink
+// routed for its type name. The sink routed for the empty type name is the
+// default, which receives the elements of the other types, including the ones
+// without a type name; without it, those elements are dropped.
+func RouteSinks(routes map[string]ElementSink) ElementSink {
+	return SinkFunc(func(typeName string, raw json.RawMessage) error {
+		sink, ok := routes[typeName]
+		if !ok || sink == nil {
+			sink = routes[""]
+			if sink == nil {
+				return nil
+			}
+		}
+		return sink.Accept(typeName, raw)
+	})
+}
+
+// ChannelSink returns an ElementSink that sends the elements to the channel,
+// for handing them to another goroutine, such as a pool of producers. With a
+// buffered channel, the stream runs ahead of the receivers by at most the
+// capacity of the channel. Accept blocks until the element is received or the
+// context is done, in which case it returns the error of the context.
+func ChannelSink(ctx context.Context, ch chan<- SinkElement) ElementSink {
+	return SinkFunc(func(typeName string, raw json.RawMessage) error {
+		select {
+		case ch <- SinkElement{TypeName: typeName, Raw: raw}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// SinkElement is an element sent by a ChannelSink.
+type SinkElement struct {
+	// TypeName is the type name of the element, which is empty if it has
+	// none.
+	TypeName string
+	// Raw is the JSON of the element.
+	Raw json.RawMessage
+}
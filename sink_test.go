@@ -0,0 +1,68 @@
+package poly
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestStreamToSink(t *testing.T) {
+	in := []byte(`[{"type":"person","name":"John"},{"type":"pet","name":"Fido"},{"name":"?"},{"type":"person","name":"Jane"}]`)
+
+	var people, others []string
+	sink := RouteSinks(map[string]ElementSink{
+		"person": SinkFunc(func(typeName string, raw json.RawMessage) error {
+			people = append(people, string(raw))
+			return nil
+		}),
+		"": SinkFunc(func(typeName string, raw json.RawMessage) error {
+			others = append(others, typeName+" "+string(raw))
+			return nil
+		}),
+	})
+	err := StreamToSink(context.Background(), NewArraySource(in), sink)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"type":"person","name":"John"}`, `{"type":"person","name":"Jane"}`}, people)
+	assert.Equal(t, []string{`pet {"type":"pet","name":"Fido"}`, ` {"name":"?"}`}, others)
+
+	var pets []string
+	err = StreamToSink(context.Background(), NewArraySource([]byte(`[{"Pet":{"name":"Fido"}},{"person":{}}]`)), RouteSinks(map[string]ElementSink{
+		"pet": SinkFunc(func(typeName string, raw json.RawMessage) error {
+			pets = append(pets, string(raw))
+			return nil
+		}),
+	}), WithExternalTagging(), WithTypeNameTransform(strings.ToLower))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"name":"Fido"}`}, pets)
+
+	count := 0
+	err = StreamToSink(context.Background(), NewArraySource(in), SinkFunc(func(typeName string, raw json.RawMessage) error {
+		count++
+		return errors.New("broker unavailable")
+	}))
+	assert.EqualError(t, err, "broker unavailable")
+	assert.Equal(t, 1, count)
+}
+
+func TestStreamToSink_Cancel(t *testing.T) {
+	in := []byte(`[{"type":"person","name":"John"},{"type":"pet","name":"Fido"},{"type":"person","name":"Jane"}]`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan SinkElement, 1)
+	done := make(chan error)
+	go func() {
+		done <- StreamToSink(ctx, NewArraySource(in), ChannelSink(ctx, ch))
+	}()
+	assert.Equal(t, "person", (<-ch).TypeName)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	err := StreamToSink(ctx, NewArraySource(in), SinkFunc(func(typeName string, raw json.RawMessage) error {
+		t.Fatal("no element is accepted once the context is done")
+		return nil
+	}))
+	assert.ErrorIs(t, err, context.Canceled)
+}
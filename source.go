@@ -0,0 +1,275 @@
+package poly
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// SourceElement is a single element read from an ElementSource.
+type SourceElement struct {
+	// Raw is the JSON of the element that is unmarshalled into the target.
+	Raw json.RawMessage
+
+	// Locator is the JSON that the TypeLocator is unmarshalled from to
+	// determine the type name of the element. If it is nil, Raw is used. This
+	// allows sources that keep the type information apart from the element,
+	// such as a database row with a separate type column, to provide it
+	// without having to merge it into the element.
+	Locator json.RawMessage
+
+	// TypeName is the type name of the element if the source already knows
+	// it. It is used as it is, without resolving the type name from either
+	// Locator or Raw, unless it is empty.
+	TypeName string
+}
+
+// locator returns the JSON to determine the type name of the element from.
+func (e SourceElement) locator() json.RawMessage {
+	if e.Locator != nil {
+		return e.Locator
+	}
+	return e.Raw
+}
+
+// ElementSource provides the elements that are routed to and decoded into a
+// target, one at a time. Implementing it allows the elements to come from
+// something other than a single JSON array, such as a directory with a file per
+// element, a batch of Kafka messages, or a set of database rows, while still
+// using the same routing and decoding as the rest of the library.
+type ElementSource interface {
+	// Next returns the next element. It returns io.EOF when there are no
+	// more elements, and any other error to abort the unmarshalling.
+	Next() (SourceElement, error)
+}
+
+// ErrNotArray is returned when the JSON to unmarshal is valid, but is not an
+// array, unless WithObjectMode says how to handle a top-level object.
+var ErrNotArray = errors.New("JSON is not an array")
+
+// ObjectMode selects how a top-level JSON object is handled by the functions
+// that unmarshal a JSON array. See WithObjectMode.
+type ObjectMode int
+
+const (
+	// ObjectError rejects a top-level object with ErrNotArray. This is the
+	// default.
+	ObjectError ObjectMode = iota
+	// ObjectWrap handles a top-level object as an array holding only that
+	// object.
+	ObjectWrap
+	// ObjectKeyed handles a top-level object as a map from type names to
+	// elements, such as {"person":{...},"pet":[{...},{...}]}. Each key is the
+	// type name of its value, or of each of the elements of its value if it is
+	// an array, and the elements are indexed in the order they appear.
+	ObjectKeyed
+)
+
+// arraySource is an ElementSource over the elements of a JSON array.
+type arraySource struct {
+	rawJson    []byte
+	objectMode ObjectMode
+	elements   []json.RawMessage
+	// typeNames are the type names of the elements, if they came from the
+	// keys of a top-level object.
+	typeNames []string
+	parsed    bool
+	parseErr  error
+	next      int
+}
+
+// NewArraySource returns an ElementSource that provides the elements of the
+// raw JSON array. This is the source used by Unmarshal. An error is returned by
+// the first call to Next if the JSON is not an array, which is ErrNotArray if
+// it is valid JSON nonetheless.
+func NewArraySource(rawJson []byte) ElementSource {
+	return newArraySource(rawJson, ObjectError)
+}
+
+// newArraySource works like NewArraySource, but handles a top-level object
+// according to the mode.
+func newArraySource(rawJson []byte, objectMode ObjectMode) *arraySource {
+	return &arraySource{rawJson: rawJson, objectMode: objectMode}
+}
+
+// Next implements the ElementSource interface.
+func (s *arraySource) Next() (SourceElement, error) {
+	err := s.parseOnce()
+	if err != nil {
+		return SourceElement{}, err
+	}
+	if s.next >= len(s.elements) {
+		return SourceElement{}, io.EOF
+	}
+	e := SourceElement{Raw: s.elements[s.next]}
+	if s.typeNames != nil {
+		e.TypeName = s.typeNames[s.next]
+	}
+	s.next++
+	return e, nil
+}
+
+// parseOnce splits the JSON into its elements the first time it is called,
+// and returns the error from doing so every time.
+func (s *arraySource) parseOnce() error {
+	if !s.parsed {
+		s.parsed = true
+		s.parseErr = s.parse()
+	}
+	return s.parseErr
+}
+
+// parse splits the JSON into its elements.
+func (s *arraySource) parse() error {
+	if len(s.rawJson) == 0 {
+		return nil
+	}
+	err := json.Unmarshal(s.rawJson, &s.elements)
+	if err == nil {
+		return nil
+	}
+	trimmed := bytes.TrimSpace(s.rawJson)
+	if !json.Valid(trimmed) {
+		return err
+	}
+	if trimmed[0] != '{' {
+		return ErrNotArray
+	}
+	switch s.objectMode {
+	case ObjectWrap:
+		s.elements = []json.RawMessage{trimmed}
+		return nil
+	case ObjectKeyed:
+		return s.parseKeyed(trimmed)
+	}
+	return ErrNotArray
+}
+
+// parseKeyed splits a top-level object into its elements, keeping the keys as
+// their type names.
+func (s *arraySource) parseKeyed(object []byte) error {
+	s.elements = nil
+	s.typeNames = []string{}
+	dec := json.NewDecoder(bytes.NewReader(object))
+	// The object is known to be valid, so only the keys and values need to
+	// be read.
+	_, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return err
+		}
+		if value[0] != '[' {
+			s.elements = append(s.elements, value)
+			s.typeNames = append(s.typeNames, key.(string))
+			continue
+		}
+		var elements []json.RawMessage
+		err = json.Unmarshal(value, &elements)
+		if err != nil {
+			return err
+		}
+		for _, e := range elements {
+			s.elements = append(s.elements, e)
+			s.typeNames = append(s.typeNames, key.(string))
+		}
+	}
+	return nil
+}
+
+// readerAtWindow is the size of the windows that a readerAtSource reads.
+const readerAtWindow = 64 << 10
+
+// readerAtSource is an ElementSource over the elements of a JSON array that is
+// read from an io.ReaderAt as it goes.
+type readerAtSource struct {
+	dec     *json.Decoder
+	started bool
+	done    bool
+}
+
+// NewReaderAtSource returns an ElementSource that provides the elements of the
+// JSON array in the first size bytes of r. The array is read in windows of
+// 64 KiB as the elements are needed, so that the whole document is never held
+// in memory at once. This makes it suitable for multi-gigabyte exports, for
+// instance from an *os.File or a memory-mapped file. Only the current element
+// is kept, so the memory used is bounded by the size of the largest element.
+// ErrNotArray is returned by the first call to Next if the JSON is not an
+// array.
+func NewReaderAtSource(r io.ReaderAt, size int64) ElementSource {
+	return &readerAtSource{
+		dec: json.NewDecoder(bufio.NewReaderSize(io.NewSectionReader(r, 0, size), readerAtWindow)),
+	}
+}
+
+// Next implements the ElementSource interface.
+func (s *readerAtSource) Next() (SourceElement, error) {
+	if s.done {
+		return SourceElement{}, io.EOF
+	}
+	if !s.started {
+		s.started = true
+		token, err := s.dec.Token()
+		if err == io.EOF {
+			// An empty document has no elements, as with Unmarshal.
+			s.done = true
+			return SourceElement{}, io.EOF
+		}
+		if err != nil {
+			return SourceElement{}, err
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return SourceElement{}, ErrNotArray
+		}
+	}
+
+	if !s.dec.More() {
+		// Consume the end of the array, which must be there.
+		_, err := s.dec.Token()
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return SourceElement{}, err
+		}
+		s.done = true
+		return SourceElement{}, io.EOF
+	}
+	var raw json.RawMessage
+	err := s.dec.Decode(&raw)
+	if err != nil {
+		return SourceElement{}, err
+	}
+	return SourceElement{Raw: raw}, nil
+}
+
+// sliceSource is an ElementSource over a slice of elements.
+type sliceSource struct {
+	elements []SourceElement
+	next     int
+}
+
+// NewSliceSource returns an ElementSource that provides the given elements.
+func NewSliceSource(elements []SourceElement) ElementSource {
+	return &sliceSource{elements: elements}
+}
+
+// Next implements the ElementSource interface.
+func (s *sliceSource) Next() (SourceElement, error) {
+	if s.next >= len(s.elements) {
+		return SourceElement{}, io.EOF
+	}
+	e := s.elements[s.next]
+	s.next++
+	return e, nil
+}
@@ -0,0 +1,229 @@
+package poly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalSource_Slice(t *testing.T) {
+	// The type information is kept apart from the element, like a database row
+	// with a type column.
+	src := NewSliceSource([]SourceElement{
+		{Raw: json.RawMessage(`{"ValueA":"A"}`), Locator: json.RawMessage(`{"type":"TypeString"}`)},
+		{Raw: json.RawMessage(`{"ValueC":42}`), Locator: json.RawMessage(`{"type":"TypeInt"}`)},
+		{Raw: json.RawMessage(`{"type":"TypeString","ValueA":"B"}`)},
+	})
+
+	var result SlicesABC
+	err := UnmarshalSource(src, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []TypeString{{ValueA: "A"}, {ValueA: "B"}}, result.TypeString)
+	assert.Equal(t, 42, result.TypeInt.ValueC)
+	assert.Equal(t, 1, result.TypeInt.index)
+}
+
+// failingSource returns its elements and then fails.
+type failingSource struct {
+	elements []json.RawMessage
+}
+
+func (s *failingSource) Next() (SourceElement, error) {
+	if len(s.elements) == 0 {
+		return SourceElement{}, errors.New("connection lost")
+	}
+	e := SourceElement{Raw: s.elements[0]}
+	s.elements = s.elements[1:]
+	return e, nil
+}
+
+func TestUnmarshalSource_Error(t *testing.T) {
+	src := &failingSource{elements: []json.RawMessage{json.RawMessage(`{"type":"TypeString","ValueA":"A"}`)}}
+
+	var result SlicesABC
+	err := UnmarshalSource(src, &result)
+	assert.EqualError(t, err, "connection lost")
+	assert.Len(t, result.TypeString, 1)
+}
+
+func TestUnmarshalSource_OrderingConstraints(t *testing.T) {
+	src := NewSliceSource([]SourceElement{
+		{Raw: json.RawMessage(`{"type":"person","name":"John"}`)},
+		{Raw: json.RawMessage(`{"type":"location","address":"123 Main"}`)},
+	})
+
+	var result OrderedResidence
+	err := UnmarshalSource(src, &result)
+	assert.EqualError(t, err, `"location" elements must be first in the array, found one at index 1`)
+}
+
+func TestArraySource(t *testing.T) {
+	src := NewArraySource([]byte(`[{"a":1}, {"b":2}]`))
+	e, err := src.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1}`, string(e.Raw))
+	e, err = src.Next()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"b":2}`, string(e.Raw))
+	_, err = src.Next()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = NewArraySource(nil).Next()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = NewArraySource([]byte(`{}`)).Next()
+	assert.Equal(t, ErrNotArray, err)
+
+	_, err = NewArraySource([]byte(`{`)).Next()
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNotArray, err)
+}
+
+func TestUnmarshalWithOptions_ObjectMode(t *testing.T) {
+	input := []byte(` {"type":"TypeString","ValueA":"A"} `)
+
+	var result SlicesABC
+	err := Unmarshal(input, &result)
+	assert.ErrorIs(t, err, ErrNotArray)
+	err = Unmarshal([]byte(`"TypeString"`), &result)
+	assert.ErrorIs(t, err, ErrNotArray)
+	err = UnmarshalWithOptions(input, &result, WithObjectMode(ObjectError))
+	assert.ErrorIs(t, err, ErrNotArray)
+
+	err = UnmarshalWithOptions(input, &result, WithObjectMode(ObjectWrap))
+	assert.NoError(t, err)
+	assert.Equal(t, []TypeString{{ValueA: "A"}}, result.TypeString)
+
+	// Arrays are unaffected by the mode.
+	result = SlicesABC{}
+	err = UnmarshalWithOptions([]byte(`[{"type":"TypeString","ValueA":"B"}]`), &result, WithObjectMode(ObjectWrap))
+	assert.NoError(t, err)
+	assert.Equal(t, []TypeString{{ValueA: "B"}}, result.TypeString)
+}
+
+func TestUnmarshalWithOptions_ObjectKeyed(t *testing.T) {
+	input := []byte(`{
+		"TypeInt": {"ValueC": 42},
+		"TypeString": [{"ValueA":"A"}, {"ValueA":"B"}],
+		"unknown": {"x": 1},
+		"TypeFloat": []
+	}`)
+
+	var result SlicesABC
+	err := UnmarshalWithOptions(input, &result, WithObjectMode(ObjectKeyed))
+	assert.NoError(t, err)
+	assert.Equal(t, []TypeString{{ValueA: "A"}, {ValueA: "B"}}, result.TypeString)
+	assert.Equal(t, 42, result.TypeInt.ValueC)
+	assert.Equal(t, 0, result.TypeInt.index)
+	assert.Nil(t, result.TypeBravo)
+
+	doc, err := ParseDocument[SlicesABC](input, WithObjectMode(ObjectKeyed))
+	assert.NoError(t, err)
+	assert.Len(t, doc.Value.TypeString, 2)
+	_, err = doc.Marshal()
+	assert.EqualError(t, err, "a Document can't be emitted as a keyed object")
+}
+
+func TestMarshalWithOptions_ObjectKeyed(t *testing.T) {
+	residence := Residence{
+		Location: Location{Address: "123 Main St"},
+		People:   []Person{{Name: "John"}, {Name: "Jane"}},
+		Pets:     []Pet{{Name: "Fido"}},
+	}
+
+	bytes, err := MarshalWithOptions(residence, WithObjectMode(ObjectKeyed))
+	assert.NoError(t, err)
+	assert.Equal(t, `{"location":[{"address":"123 Main St"}],"person":[{"name":"John"},{"name":"Jane"}],"pet":[{"name":"Fido"}]}`, string(bytes))
+
+	var result Residence
+	err = UnmarshalWithOptions(bytes, &result, WithObjectMode(ObjectKeyed))
+	assert.NoError(t, err)
+	assert.Equal(t, residence, result)
+
+	bytes, err = MarshalWithOptions(Residence{}, WithObjectMode(ObjectKeyed))
+	assert.NoError(t, err)
+	assert.Equal(t, `{}`, string(bytes))
+
+	_, err = MarshalWithOptions(residence, WithObjectMode(ObjectKeyed), WithManifest())
+	assert.EqualError(t, err, "a manifest can't be emitted in a keyed object")
+
+	b := NewBuilder(Residence{}, WithObjectMode(ObjectKeyed))
+	Add(b, Person{Name: "John"})
+	Add(b, Pet{Name: "Fido"})
+	Add(b, Person{Name: "Jane"})
+	bytes, err = b.Marshal()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"person":[{"name":"John"},{"name":"Jane"}],"pet":[{"name":"Fido"}]}`, string(bytes))
+
+	_, err = MarshalChunks(residence, 100, WithObjectMode(ObjectKeyed))
+	assert.EqualError(t, err, "a keyed object can't be split into chunks")
+
+	type Untyped struct {
+		People []Person          `poly:"person"`
+		Rest   []json.RawMessage `poly:"!rest"`
+	}
+	var untyped Untyped
+	err = UnmarshalWithOptions([]byte(`[{"type":"person","name":"John"},{"name":"?"}]`), &untyped)
+	assert.NoError(t, err)
+	_, err = MarshalWithOptions(untyped, WithObjectMode(ObjectKeyed))
+	assert.EqualError(t, err, "element 1 has no type name to key it by")
+}
+
+func TestProcessor_ProcessSource(t *testing.T) {
+	src := NewSliceSource([]SourceElement{
+		{Raw: json.RawMessage(`{"name":"John"}`), Locator: json.RawMessage(`{"type":"person"}`)},
+	})
+
+	proc := NewProcessor(DefaultLocator)
+	var people []Person
+	On(proc, "person", func(p Person) error {
+		people = append(people, p)
+		return nil
+	})
+	assert.NoError(t, proc.ProcessSource(src))
+	assert.Equal(t, []Person{{Name: "John"}}, people)
+}
+
+func TestUnmarshalSource_ReaderAt(t *testing.T) {
+	// Make the array span several windows.
+	var buf strings.Builder
+	buf.WriteString(" [")
+	for i := 0; i < 5000; i++ {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		fmt.Fprintf(&buf, `{"type":"TypeString","ValueA":"%d"}`, i)
+	}
+	buf.WriteString(`, {"type":"TypeInt","ValueC":42} ] `)
+	input := buf.String()
+
+	var result SlicesABC
+	err := UnmarshalSource(NewReaderAtSource(strings.NewReader(input), int64(len(input))), &result)
+	assert.NoError(t, err)
+	assert.Len(t, result.TypeString, 5000)
+	assert.Equal(t, "4999", result.TypeString[4999].ValueA)
+	assert.Equal(t, 5000, result.TypeInt.index)
+}
+
+func TestUnmarshalSource_ReaderAtErrors(t *testing.T) {
+	var result SlicesABC
+	err := UnmarshalSource(NewReaderAtSource(strings.NewReader(""), 0), &result)
+	assert.NoError(t, err)
+
+	input := `{"type":"TypeString"}`
+	err = UnmarshalSource(NewReaderAtSource(strings.NewReader(input), int64(len(input))), &result)
+	assert.EqualError(t, err, "JSON is not an array")
+
+	// Only the first size bytes are read, which cuts off the end of the array.
+	input = `[{"type":"TypeString"}]`
+	err = UnmarshalSource(NewReaderAtSource(strings.NewReader(input), int64(len(input)-1)), &result)
+	assert.Error(t, err)
+
+	input = `[{"type":"TypeString"},`
+	err = UnmarshalSource(NewReaderAtSource(strings.NewReader(input), int64(len(input))), &result)
+	assert.Error(t, err)
+}
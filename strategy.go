@@ -0,0 +1,207 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+)
+
+// Strategy is the way unmarshalling reads and decodes the elements of a JSON
+// array. It is set with WithStrategy.
+type Strategy int
+
+const (
+	// StrategyBatch splits the whole array into its elements, which are then
+	// decoded one after the other. This is the default.
+	StrategyBatch Strategy = iota
+	// StrategyStreaming reads the elements from the array one at a time as
+	// they are decoded, so that they aren't all held at once besides the
+	// array itself. It only applies to arrays; with an ObjectMode that
+	// accepts top-level objects, the batch strategy is used instead.
+	StrategyStreaming
+	// StrategyParallel splits the whole array into its elements, decodes
+	// them on several goroutines, and then stores them in the target in
+	// their original order.
+	StrategyParallel
+	// StrategyAuto chooses one of the other strategies for each array from
+	// its size and its number of elements, based on the AutoThresholds.
+	StrategyAuto
+)
+
+// String returns the name of the strategy.
+func (s Strategy) String() string {
+	switch s {
+	case StrategyBatch:
+		return "batch"
+	case StrategyStreaming:
+		return "streaming"
+	case StrategyParallel:
+		return "parallel"
+	case StrategyAuto:
+		return "auto"
+	}
+	return fmt.Sprintf("Strategy(%d)", int(s))
+}
+
+// AutoThresholds are the thresholds that StrategyAuto chooses a strategy by,
+// and the number of goroutines for StrategyParallel. A zero field takes its
+// default value.
+type AutoThresholds struct {
+	// StreamingBytes is the size of the arrays, in bytes, from which they
+	// are streamed. The default is 32 MiB.
+	StreamingBytes int
+	// ParallelElements is the number of elements of the arrays that aren't
+	// streamed from which they are decoded in parallel. The default is 1024.
+	ParallelElements int
+	// Workers is the number of goroutines that decode the elements in
+	// parallel. The default is runtime.GOMAXPROCS(0). Parallel decoding is
+	// never chosen with a single worker.
+	Workers int
+}
+
+// The default AutoThresholds.
+const (
+	defaultStreamingBytes   = 32 << 20
+	defaultParallelElements = 1024
+)
+
+// withDefaults returns the thresholds with the zero fields set to their
+// defaults.
+func (t AutoThresholds) withDefaults() AutoThresholds {
+	if t.StreamingBytes <= 0 {
+		t.StreamingBytes = defaultStreamingBytes
+	}
+	if t.ParallelElements <= 0 {
+		t.ParallelElements = defaultParallelElements
+	}
+	if t.Workers <= 0 {
+		t.Workers = runtime.GOMAXPROCS(0)
+	}
+	return t
+}
+
+// chooseStrategy returns the source of the elements of the raw JSON array for
+// the strategy of the options, along with the strategy to use, which is never
+// StrategyAuto.
+func chooseStrategy(rawJson []byte, o *options) (ElementSource, Strategy) {
+	t := o.thresholds.withDefaults()
+	strategy := o.strategy
+	if strategy == StrategyAuto && len(rawJson) >= t.StreamingBytes {
+		strategy = StrategyStreaming
+	}
+	if strategy == StrategyStreaming && o.objectMode == ObjectError {
+		return NewReaderAtSource(bytes.NewReader(rawJson), int64(len(rawJson))), StrategyStreaming
+	}
+
+	src := newArraySource(rawJson, o.objectMode)
+	switch strategy {
+	case StrategyAuto:
+		// An array that can't be split is left to report its error.
+		if t.Workers > 1 && src.parseOnce() == nil && len(src.elements) >= t.ParallelElements {
+			return src, StrategyParallel
+		}
+	case StrategyParallel:
+		return src, StrategyParallel
+	}
+	return src, StrategyBatch
+}
+
+// unmarshalStrategy unmarshals the raw JSON array into the target with the
+// strategy of the options.
+func unmarshalStrategy(rawJson []byte, target any, o *options) error {
+	src, strategy := chooseStrategy(rawJson, o)
+	if strategy == StrategyParallel {
+		parallel := *o
+		parallel.workers = o.thresholds.withDefaults().Workers
+		o = &parallel
+	}
+	return unmarshalSource(src, target, o)
+}
+
+// predecodedElement is the result of decoding an element ahead of storing it.
+type predecodedElement struct {
+	value     reflect.Value
+	err       error
+	recovered any
+}
+
+// decodeParallel reads all the elements of the source, decodes the ones that
+// can be decoded on their own on the workers of the options, and then passes
+// every element to element in order, which stores the decoded values. The
+// elements are stored, and any error is returned, as they would be without the
+// workers, and it returns the number of elements read along with the error.
+func (d *decoder) decodeParallel(src ElementSource, resolve resolver) (int, error) {
+	var elements []pendingElement
+	count, readErr := forEachElement(src, d.o.firstIndex, resolve, func(index int, typeName string, raw json.RawMessage) error {
+		elements = append(elements, pendingElement{index: index, typeName: typeName, raw: raw})
+		return nil
+	})
+
+	var jobs []int
+	for i, e := range elements {
+		if d.predecodable(e.typeName) {
+			jobs = append(jobs, i)
+		}
+	}
+	results := make([]predecodedElement, len(elements))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < d.o.workers && w < len(jobs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = d.predecode(elements[i])
+			}
+		}()
+	}
+	for _, i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	d.predecoded = make(map[int]predecodedElement, len(jobs))
+	for _, i := range jobs {
+		d.predecoded[elements[i].index] = results[i]
+	}
+	for i, e := range elements {
+		err := d.element(e.index, e.typeName, e.raw)
+		if err != nil {
+			return i + 1, err
+		}
+	}
+	return count, readErr
+}
+
+// predecodable reports whether the elements of the type name can be decoded
+// ahead of being stored, which is when nothing that store does before decoding
+// them, or the way it decodes them, depends on the elements before them.
+func (d *decoder) predecodable(typeName string) bool {
+	typeName = d.canonical(typeName)
+	fl, ok := d.targetFields[typeName]
+	if !ok || typeName == "" || fl.items != "" || fl.raw || d.o.memoryLimit > 0 {
+		return false
+	}
+	if _, ok := d.o.sealers[typeName]; ok {
+		return false
+	}
+	if _, ok := d.o.predicates[typeName]; ok {
+		return false
+	}
+	return !d.decodesInPlace(fl, typeName)
+}
+
+// predecode decodes an element, with any panic recovered so that it can be
+// raised on the goroutine that stores the element.
+func (d *decoder) predecode(e pendingElement) (p predecodedElement) {
+	defer func() {
+		p.recovered = recover()
+	}()
+	typeName := d.canonical(e.typeName)
+	p.value, p.err = guardedDecodeElement(d.o, e.raw, d.targetFields[typeName].fieldType, e.index, typeName)
+	return p
+}
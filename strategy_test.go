@@ -0,0 +1,89 @@
+package poly
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// residenceArray returns a JSON array of n people and pets, alternating.
+func residenceArray(n int) []byte {
+	var elements []string
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			elements = append(elements, fmt.Sprintf(`{"type":"person","name":"Person %d","age":%d}`, i, i))
+		} else {
+			elements = append(elements, fmt.Sprintf(`{"type":"pet","name":"Pet %d"}`, i))
+		}
+	}
+	return []byte("[" + strings.Join(elements, ",") + "]")
+}
+
+func TestChooseStrategy(t *testing.T) {
+	small := residenceArray(10)
+	tests := []struct {
+		name     string
+		data     []byte
+		opts     []Option
+		expected Strategy
+	}{
+		{"small", small, []Option{WithStrategy(StrategyAuto)}, StrategyBatch},
+		{"many elements", small, []Option{WithStrategy(StrategyAuto), WithAutoThresholds(AutoThresholds{ParallelElements: 10, Workers: 4})}, StrategyParallel},
+		{"one worker", small, []Option{WithStrategy(StrategyAuto), WithAutoThresholds(AutoThresholds{ParallelElements: 10, Workers: 1})}, StrategyBatch},
+		{"large", small, []Option{WithStrategy(StrategyAuto), WithAutoThresholds(AutoThresholds{StreamingBytes: 100, ParallelElements: 10, Workers: 4})}, StrategyStreaming},
+		{"large object", []byte(`{"type":"person"}`), []Option{WithStrategy(StrategyAuto), WithObjectMode(ObjectWrap), WithAutoThresholds(AutoThresholds{StreamingBytes: 10})}, StrategyBatch},
+		{"invalid", []byte(`[{`), []Option{WithStrategy(StrategyAuto), WithAutoThresholds(AutoThresholds{ParallelElements: 1, Workers: 4})}, StrategyBatch},
+		{"streaming", small, []Option{WithStrategy(StrategyStreaming)}, StrategyStreaming},
+		{"parallel", small, []Option{WithStrategy(StrategyParallel)}, StrategyParallel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, strategy := chooseStrategy(tt.data, newOptions(tt.opts))
+			assert.Equal(t, tt.expected, strategy)
+		})
+	}
+}
+
+func TestWithStrategy(t *testing.T) {
+	data := residenceArray(101)
+	var expected Residence
+	assert.NoError(t, Unmarshal(data, &expected))
+
+	for _, strategy := range []Strategy{StrategyBatch, StrategyStreaming, StrategyParallel, StrategyAuto} {
+		t.Run(strategy.String(), func(t *testing.T) {
+			var residence Residence
+			err := UnmarshalWithOptions(data, &residence, WithStrategy(strategy), WithAutoThresholds(AutoThresholds{ParallelElements: 100, Workers: 4}))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, residence)
+		})
+	}
+	assert.Equal(t, "Strategy(9)", Strategy(9).String())
+}
+
+func TestWithStrategy_Parallel(t *testing.T) {
+	opts := []Option{WithStrategy(StrategyParallel), WithAutoThresholds(AutoThresholds{Workers: 4})}
+
+	// The first error in the array is returned, as with the batch strategy.
+	input := []byte(`[{"type":"person","name":"John"},{"type":"person","age":"old"},{"type":"pet","name":5}]`)
+	var residence Residence
+	err := UnmarshalWithOptions(input, &residence, opts...)
+	assert.Error(t, err)
+	assert.Equal(t, Unmarshal(input, &Residence{}).Error(), err.Error())
+	assert.Equal(t, "John", residence.People[0].Name)
+
+	// Panics are raised on the calling goroutine, or recovered.
+	input = []byte(`[{"type":"person","name":"John"},{"type":"panicky"}]`)
+	assert.Panics(t, func() {
+		_ = UnmarshalWithOptions(input, &Guarded{}, opts...)
+	})
+	err = UnmarshalWithOptions(input, &Guarded{}, append(opts, WithPanicRecovery())...)
+	assert.EqualError(t, err, `element 1 of type "panicky": panic: bad element`)
+
+	// Elements that can't be decoded ahead are decoded in order.
+	var ordered Residence
+	err = UnmarshalWithOptions(residenceArray(20), &ordered, append(opts, WithBatchAllocation(), WithMemoryLimit(1<<20))...)
+	assert.NoError(t, err)
+	assert.Len(t, ordered.People, 10)
+	assert.Equal(t, "Pet 19", ordered.Pets[9].Name)
+}
@@ -0,0 +1,38 @@
+package poly
+
+import "math"
+
+// SyntheticElement is an element returned by the function given to
+// WithSyntheticElements along with its type name, so that it is encoded like
+// the elements of the target, with the discriminator added if one is
+// configured.
+type SyntheticElement struct {
+	// TypeName is the polymorphic type name of the element.
+	TypeName string
+	// Value is the element itself.
+	Value any
+}
+
+// syntheticObjects calls the function given with WithSyntheticElements, if
+// any, and returns the elements it computes for the value being marshalled.
+func syntheticObjects(obj any, o *options) []indexedObject {
+	if o.synthetic == nil {
+		return nil
+	}
+	var result []indexedObject
+	for _, element := range o.synthetic(obj) {
+		item := indexedObject{Index: math.MaxInt, Value: element}
+		switch e := element.(type) {
+		case SyntheticElement:
+			item.TypeName = e.TypeName
+			item.Value = e.Value
+		case *SyntheticElement:
+			item.TypeName = e.TypeName
+			item.Value = e.Value
+		}
+		if item.Value != nil {
+			result = append(result, item)
+		}
+	}
+	return result
+}
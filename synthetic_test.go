@@ -0,0 +1,54 @@
+package poly
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type ResidenceSummary struct {
+	People int `json:"people"`
+	Pets   int `json:"pets"`
+}
+
+func TestMarshal_SyntheticElements(t *testing.T) {
+	residence := Residence{
+		People: []Person{{Name: "John"}},
+		Pets:   []Pet{{Name: "Fido"}, {Name: "Rex"}},
+	}
+	var seen any
+	summarize := WithSyntheticElements(func(target any) []any {
+		seen = target
+		r := target.(Residence)
+		return []any{
+			SyntheticElement{TypeName: "summary", Value: ResidenceSummary{People: len(r.People), Pets: len(r.Pets)}},
+			&SyntheticElement{TypeName: "checksum", Value: json.RawMessage(`{"crc":42}`)},
+			json.RawMessage(`{"kind":"trailer"}`),
+			nil,
+		}
+	})
+
+	bytes, err := MarshalWithOptions(residence, summarize, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"type":"person","name":"John"},{"type":"pet","name":"Fido"},{"type":"pet","name":"Rex"},`+
+		`{"type":"summary","people":1,"pets":2},{"type":"checksum","crc":42},{"kind":"trailer"}]`, string(bytes))
+	assert.Equal(t, residence, seen)
+
+	// The synthetic elements are found even if the target has none.
+	bytes, err = MarshalWithOptions(Residence{}, summarize)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"people":0,"pets":0},{"crc":42},{"kind":"trailer"}]`, string(bytes))
+}
+
+func TestMarshalChunks_SyntheticElements(t *testing.T) {
+	residence := Residence{Pets: []Pet{{Name: "Fido"}}}
+	summarize := WithSyntheticElements(func(target any) []any {
+		return []any{SyntheticElement{TypeName: "summary", Value: ResidenceSummary{Pets: 1}}}
+	})
+
+	chunks, err := MarshalChunks(residence, 30, summarize)
+	assert.NoError(t, err)
+	assert.Len(t, chunks, 2)
+	assert.Equal(t, `[{"name":"Fido"}]`, string(chunks[0]))
+	assert.Equal(t, `[{"people":0,"pets":1}]`, string(chunks[1]))
+}
@@ -0,0 +1,84 @@
+package poly
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// externalTagSource wraps an ElementSource whose elements are externally
+// tagged, that is of the form {"dog":{...}}, to provide the value of each of
+// them along with the key as its type name.
+type externalTagSource struct {
+	src ElementSource
+}
+
+// Next implements the ElementSource interface. Elements that aren't objects
+// with a single key are provided as they are, for their type name to be
+// resolved as usual.
+func (s externalTagSource) Next() (SourceElement, error) {
+	e, err := s.src.Next()
+	if err != nil || e.TypeName != "" {
+		return e, err
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal(e.Raw, &object) != nil || len(object) != 1 {
+		return e, nil
+	}
+	for typeName, value := range object {
+		if typeName == "" {
+			break
+		}
+		e.Raw = value
+		e.TypeName = typeName
+		e.Locator = nil
+	}
+	return e, nil
+}
+
+// adjacentTagSource wraps an ElementSource whose elements are adjacently
+// tagged, that is of the form {"type":"dog","data":{...}}, to provide the
+// payload under the payload key of each of them as the element, while the type
+// name is still resolved from the whole element.
+type adjacentTagSource struct {
+	src        ElementSource
+	payloadKey string
+}
+
+// Next implements the ElementSource interface. Elements without the payload key
+// are provided as they are.
+func (s adjacentTagSource) Next() (SourceElement, error) {
+	e, err := s.src.Next()
+	if err != nil {
+		return e, err
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal(e.Raw, &object) != nil {
+		return e, nil
+	}
+	payload, ok := object[s.payloadKey]
+	if !ok {
+		return e, nil
+	}
+	if e.Locator == nil {
+		e.Locator = e.Raw
+	}
+	e.Raw = payload
+	return e, nil
+}
+
+// wrapInObject returns the encoded element wrapped in an object under the key,
+// such as the type name for external tagging or the payload key for adjacent
+// tagging.
+func wrapInObject(encoded []byte, key string) ([]byte, error) {
+	keyJson, err := json.Marshal(key)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	buf.Write(keyJson)
+	buf.WriteByte(':')
+	buf.Write(encoded)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,86 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWithExternalTagging(t *testing.T) {
+	input := []byte(`[
+		{"person": {"name":"John"}},
+		{"pet": {"name":"Fido", "species":"dog"}},
+		{"water": {"provider":"City"}},
+		{"type":"pet", "name":"Rex"},
+		{"unknown": {}}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithExternalTagging())
+	assert.NoError(t, err)
+	expected := Residence{
+		People: []Person{{Name: "John"}},
+		Pets:   []Pet{{Name: "Fido", Species: "dog"}, {Name: "Rex"}},
+		Water:  &WaterService{Provider: "City"},
+	}
+	assert.Equal(t, expected, result)
+
+	bytes, err := MarshalWithOptions(expected, WithExternalTagging())
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"person": {"name":"John"}},
+		{"pet": {"name":"Fido", "species":"dog"}},
+		{"pet": {"name":"Rex"}},
+		{"water": {"provider":"City"}}
+	]`, string(bytes))
+
+	list := &lockedList{}
+	err = UnmarshalWithOptions(input, list, WithRegistry(accumulatorRegistry()), WithExternalTagging())
+	assert.NoError(t, err)
+	assert.Len(t, list.elements, 3)
+}
+
+func TestDocument_ExternalTagging(t *testing.T) {
+	input := []byte(`[{"person":{"name":"John"}},{"pet":{"name":"Fido"}}]`)
+	doc, err := ParseDocument[Residence](input, WithExternalTagging())
+	assert.NoError(t, err)
+	doc.Value.People[0].Name = "Jane"
+	bytes, err := doc.Marshal()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"person":{"name":"Jane"}},{"pet":{"name":"Fido"}}]`, string(bytes))
+}
+
+func TestWithAdjacentTagging(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "data":{"name":"John"}},
+		{"type":"pet", "data":{"name":"Fido", "species":"dog"}},
+		{"type":"pet", "name":"Rex"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithAdjacentTagging("data"))
+	assert.NoError(t, err)
+	expected := Residence{
+		People: []Person{{Name: "John"}},
+		Pets:   []Pet{{Name: "Fido", Species: "dog"}, {Name: "Rex"}},
+	}
+	assert.Equal(t, expected, result)
+
+	bytes, err := MarshalWithOptions(expected, WithAdjacentTagging("data"), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type":"person", "data":{"name":"John"}},
+		{"type":"pet", "data":{"name":"Fido", "species":"dog"}},
+		{"type":"pet", "data":{"name":"Rex"}}
+	]`, string(bytes))
+
+	doc, err := ParseDocument[Residence](bytes, WithAdjacentTagging("data"), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	doc.Value.People[0].Name = "Jane"
+	bytes, err = doc.Marshal()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type":"person", "data":{"name":"Jane"}},
+		{"type":"pet", "data":{"name":"Fido", "species":"dog"}},
+		{"type":"pet", "data":{"name":"Rex"}}
+	]`, string(bytes))
+}
@@ -0,0 +1,146 @@
+package poly
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// tagOptions holds the options that can follow the type name in a `poly`
+// struct tag, such as `poly:"location,first"`.
+type tagOptions struct {
+	// aliases are the other type names of the elements of this type, such
+	// as their former names, that are accepted when unmarshalling.
+	aliases []string
+	// first requires every element of this type to appear before any other
+	// element in the JSON array.
+	first bool
+	// last requires every element of this type to appear after any other
+	// element in the JSON array.
+	last bool
+	// after lists the type names whose elements must all be emitted before
+	// the elements of this type when marshalling.
+	after []string
+	// before lists the type names whose elements must all be emitted after
+	// the elements of this type when marshalling.
+	before []string
+	// dedupe is the name of the field of the element struct that identifies
+	// the elements, so that duplicates can be dropped when unmarshalling.
+	dedupe string
+	// merge makes the duplicates found through dedupe be merged into the
+	// element that was decoded first instead of being dropped.
+	merge bool
+	// items is the key under which an element may hold a batch of
+	// sub-objects, each of which is decoded as an element of its own.
+	items string
+	// fallback makes the field receive the elements whose type names don't
+	// match any field.
+	fallback bool
+	// emit is the type name that the elements of this type are emitted with
+	// when marshalling, if it isn't the type name itself.
+	emit string
+}
+
+// defaultTagKey is the key of the struct tags that map the fields of the
+// target to type names unless WithTagKey gives another.
+const defaultTagKey = "poly"
+
+// lookupTag returns the value of the first of the struct tags with the given
+// keys that the field carries, or false if it carries none of them.
+func lookupTag(tag reflect.StructTag, keys []string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := tag.Lookup(key); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// isExcludedField reports whether the struct field is kept out of the mapping
+// altogether, because it is unexported, as with encoding/json, or because it is
+// tagged `poly:"-"`, or with the same value under another of the tag keys. As
+// with encoding/json, `poly:"-,"` maps the field to the type name "-" instead.
+func isExcludedField(f reflect.StructField, tagKeys []string) bool {
+	if !f.IsExported() {
+		return true
+	}
+	tag, ok := lookupTag(f.Tag, tagKeys)
+	return ok && tag == "-"
+}
+
+// fieldTypeName returns the type name of the struct field, given by its tag
+// or else by its name, along with the options of its tag. An error is returned
+// if the tag can't be parsed.
+func fieldTypeName(f reflect.StructField, tagKeys []string) (string, tagOptions, error) {
+	tag, ok := lookupTag(f.Tag, tagKeys)
+	if !ok {
+		return f.Name, tagOptions{}, nil
+	}
+	name, opts, err := parseTag(tag)
+	if err != nil {
+		return "", tagOptions{}, fmt.Errorf("field %s: %w", f.Name, err)
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, opts, nil
+}
+
+// defaultItemsKey is the key of the batch of sub-objects of an element when
+// the items tag option doesn't give one.
+const defaultItemsKey = "items"
+
+// parseTag splits a `poly` struct tag into the polymorphic type name and the
+// options that follow it. Options that take a value, such as `after=detail`,
+// may be repeated. The options of encoding/json, such as omitempty, are
+// ignored so that the `json` tags can be reused with WithTagKey. Any other
+// word is an alias of the type name, as in `poly:"dog,puppy,canine"`, and an
+// alias that is also the name of an option is given as `alias=first`. An
+// unknown option with a value, such as `afterr=detail`, is an error. If the
+// tag has no name, e.g. `poly:",first"`, the returned name is empty and the
+// caller should fall back on the field name.
+func parseTag(tag string) (string, tagOptions, error) {
+	var opts tagOptions
+	parts := strings.Split(tag, ",")
+	for _, part := range parts[1:] {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "first":
+			opts.first = true
+		case "last":
+			opts.last = true
+		case "after":
+			opts.after = append(opts.after, value)
+		case "before":
+			opts.before = append(opts.before, value)
+		case "dedupe":
+			opts.dedupe = value
+		case "merge":
+			opts.merge = true
+		case "items":
+			opts.items = value
+			if value == "" {
+				opts.items = defaultItemsKey
+			}
+		case "default":
+			opts.fallback = true
+		case "emit":
+			opts.emit = value
+		case "alias":
+			if value != "" {
+				opts.aliases = append(opts.aliases, value)
+			}
+		case "omitempty", "omitzero", "string":
+			// Options of encoding/json, for WithTagKey("json").
+		default:
+			if found {
+				return "", tagOptions{}, fmt.Errorf("unknown tag option %q", key)
+			}
+			if key == "" {
+				continue
+			}
+			opts.aliases = append(opts.aliases, key)
+		}
+	}
+	return parts[0], opts, nil
+}
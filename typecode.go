@@ -0,0 +1,62 @@
+package poly
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// TypeCodeLocator is an alternative to TypeLocator for elements whose type is
+// identified by a number, as in many binary and legacy protocols, such as
+// {"type":3}. It can be used wherever a TypeLocator can, and the codes are
+// translated into type names with the mapping given to WithTypeCodes. A type
+// that implements both interfaces is asked for its type code only when its
+// type name is empty.
+type TypeCodeLocator interface {
+	// TypeCode returns the numeric type code of the element, and false if it
+	// doesn't have one.
+	TypeCode() (int64, bool)
+}
+
+// typeCodeLocatorType is the type of the above interface.
+var typeCodeLocatorType = reflect.TypeOf([]TypeCodeLocator{}).Elem()
+
+// GenericTypeCodeLocator provides a default implementation of the
+// TypeCodeLocator that reads the type code from the "type" key.
+type GenericTypeCodeLocator struct {
+	Type *int64 `json:"type"`
+}
+
+// DefaultCodeLocator is the type of the default TypeCodeLocator.
+var DefaultCodeLocator = reflect.TypeOf(GenericTypeCodeLocator{})
+
+// TypeCode returns the type code represented by the receiver.
+func (t *GenericTypeCodeLocator) TypeCode() (int64, bool) {
+	if t.Type == nil {
+		return 0, false
+	}
+	return *t.Type, true
+}
+
+// codeTypeName returns the type name for the type code. A code without a type
+// name in the codes is named after its decimal form, so that it can still be
+// reported as unmatched, or be given a name with WithVocabulary.
+func codeTypeName(codes map[int64]string, code int64) string {
+	if typeName, ok := codes[code]; ok {
+		return typeName
+	}
+	return strconv.FormatInt(code, 10)
+}
+
+// typeCode returns the type code for the type name, which is the lowest one if
+// there are several, and false if it has none.
+func typeCode(codes map[int64]string, typeName string) (int64, bool) {
+	var code int64
+	found := false
+	for c, name := range codes {
+		if name == typeName && (!found || c < code) {
+			code = c
+			found = true
+		}
+	}
+	return code, found
+}
@@ -0,0 +1,59 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var residenceCodes = map[int64]string{
+	1: "person",
+	2: "pet",
+	3: "pet",
+}
+
+func TestWithTypeCodes(t *testing.T) {
+	input := []byte(`[
+		{"type":1, "name":"John"},
+		{"type":3, "name":"Fido"},
+		{"type":7, "name":"Unknown"},
+		{"name":"Untyped"}
+	]`)
+	var residence Residence
+	err := UnmarshalWithOptions(input, &residence, WithLocator(DefaultCodeLocator), WithTypeCodes(residenceCodes))
+	assert.NoError(t, err)
+	assert.Len(t, residence.People, 1)
+	assert.Equal(t, "John", residence.People[0].Name)
+	assert.Len(t, residence.Pets, 1)
+	assert.Equal(t, "Fido", residence.Pets[0].Name)
+
+	// Codes without a type name are named after their decimal form.
+	residence = Residence{}
+	err = UnmarshalWithOptions(input, &residence, WithLocator(DefaultCodeLocator), WithVocabulary(map[string][]string{"pet": {"7"}}))
+	assert.NoError(t, err)
+	assert.Len(t, residence.People, 0)
+	assert.Len(t, residence.Pets, 1)
+	assert.Equal(t, "Unknown", residence.Pets[0].Name)
+}
+
+func TestWithTypeCodes_Discriminator(t *testing.T) {
+	profile := Profile{DiscriminatorKey: "kind", Options: []Option{WithTypeCodes(residenceCodes)}}
+	residence := Residence{
+		People: []Person{{Name: "John"}},
+		Pets:   []Pet{{Name: "Fido"}},
+	}
+	bytes, err := MarshalWithOptions(residence, WithProfile(profile))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"kind":1,"name":"John"},{"kind":2,"name":"Fido"}]`, string(bytes))
+
+	var decoded Residence
+	err = UnmarshalWithOptions(bytes, &decoded, WithProfile(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, residence.People, decoded.People)
+	assert.Equal(t, residence.Pets, decoded.Pets)
+
+	// String type names are still accepted.
+	decoded = Residence{}
+	err = UnmarshalWithOptions([]byte(`[{"kind":"pet","name":"Rex"}]`), &decoded, WithProfile(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "Rex", decoded.Pets[0].Name)
+}
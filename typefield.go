@@ -0,0 +1,72 @@
+package poly
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// typeField finds the field of the element struct type that is tagged with
+// `polytype:"true"` as holding the type name of the element, and returns its
+// index and the JSON key it is encoded under. A nil index is returned if there
+// is no such field.
+func typeField(t reflect.Type) ([]int, string, error) {
+	if t.Kind() != reflect.Struct {
+		return nil, "", nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Tag.Get("polytype") != "true" {
+			continue
+		}
+		if f.Type.Kind() != reflect.String {
+			return nil, "", fmt.Errorf("polytype field %s of %v must be a string", f.Name, t)
+		}
+		key := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "-" {
+				return nil, "", fmt.Errorf("polytype field %s of %v is not encoded to JSON", f.Name, t)
+			}
+			if name != "" {
+				key = name
+			}
+		}
+		return f.Index, key, nil
+	}
+	return nil, "", nil
+}
+
+// typeFieldKeys returns the JSON keys of the type fields of the element
+// structs of the target fields, in the order of the fields and without
+// duplicates.
+func typeFieldKeys(targetFields map[string]fieldLookup) ([]string, error) {
+	var keys []string
+	seen := map[string]bool{}
+	for _, fl := range sortedFieldLookups(targetFields) {
+		index, key, err := typeField(fl.fieldType)
+		if err != nil {
+			return nil, err
+		}
+		if index != nil && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// withTypeField returns the element with its type field set to the type name if
+// it has one that is empty. The element itself is left unchanged, and a pointer
+// to a modified copy is returned instead.
+func withTypeField(value any, typeName string) (any, error) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	index, _, err := typeField(v.Type())
+	if err != nil || index == nil || !v.FieldByIndex(index).IsZero() {
+		return value, err
+	}
+	modified := reflect.New(v.Type())
+	modified.Elem().Set(v)
+	modified.Elem().FieldByIndex(index).SetString(typeName)
+	return modified.Interface(), nil
+}
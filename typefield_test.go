@@ -0,0 +1,75 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type Dog struct {
+	Kind string `json:"kind" polytype:"true"`
+	Name string `json:"name"`
+}
+
+type Cat struct {
+	Kind  string `polytype:"true"`
+	Lives int    `json:"lives"`
+}
+
+type Kennel struct {
+	Dogs []Dog `poly:"dog"`
+	Cats []Cat `poly:"cat"`
+}
+
+func TestUnmarshalWithOptions_TypeFields(t *testing.T) {
+	input := []byte(`[{"kind":"dog","name":"Fido"},{"Kind":"cat","lives":9},{"type":"dog","name":"Ignored"}]`)
+
+	var result Kennel
+	err := UnmarshalWithOptions(input, &result, WithTypeFields())
+	assert.NoError(t, err)
+	assert.Equal(t, Kennel{
+		Dogs: []Dog{{Kind: "dog", Name: "Fido"}},
+		Cats: []Cat{{Kind: "cat", Lives: 9}},
+	}, result)
+
+	// Without type fields the locator is used.
+	var residence Residence
+	err = UnmarshalWithOptions([]byte(`[{"type":"pet","name":"Fido"}]`), &residence, WithTypeFields())
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, residence.Pets)
+}
+
+func TestMarshalWithOptions_TypeFields(t *testing.T) {
+	input := Kennel{
+		Dogs: []Dog{{Name: "Fido"}, {Kind: "wolf", Name: "Grey"}},
+		Cats: []Cat{{Lives: 9}},
+	}
+
+	result, err := MarshalWithOptions(input, WithTypeFields())
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"kind":"dog","name":"Fido"},{"kind":"wolf","name":"Grey"},{"Kind":"cat","lives":9}]`, string(result))
+	assert.Equal(t, "", input.Dogs[0].Kind)
+
+	var decoded Kennel
+	err = UnmarshalWithOptions(result, &decoded, WithTypeFields())
+	assert.NoError(t, err)
+	assert.Equal(t, []Dog{{Kind: "dog", Name: "Fido"}}, decoded.Dogs)
+}
+
+func TestTypeFields_Invalid(t *testing.T) {
+	var notString struct {
+		Items []struct {
+			Kind int `polytype:"true"`
+		} `poly:"item"`
+	}
+	err := UnmarshalWithOptions([]byte(`[]`), &notString, WithTypeFields())
+	assert.ErrorContains(t, err, "polytype field Kind of struct")
+	assert.ErrorContains(t, err, "must be a string")
+
+	var notEncoded struct {
+		Items []struct {
+			Kind string `json:"-" polytype:"true"`
+		} `poly:"item"`
+	}
+	err = UnmarshalWithOptions([]byte(`[]`), &notEncoded, WithTypeFields())
+	assert.ErrorContains(t, err, "is not encoded to JSON")
+}
@@ -1,9 +1,12 @@
 package poly
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 )
 
 // TypeLocator needs to be implemented by whatever pre-deserializing type that is
@@ -21,7 +24,10 @@ type TypeLocator interface {
 var typeLocatorType = reflect.TypeOf([]TypeLocator{}).Elem()
 
 // GenericTypeLocator provides a default implementation of the TypeLocator that
-// handles common cases.
+// handles common cases. The type name is read from the first of the keys
+// "type", "@type", "Type", and "@Type" that holds one, in that order, which is
+// the order of DefaultTypeKeys. Use WithTypeKeys for another order, and
+// WithDiscriminatorConflicts to handle elements whose keys disagree.
 type GenericTypeLocator struct {
 	Type       string `json:"type,omitempty"`
 	TypeAt     string `json:"@type,omitempty"`
@@ -33,6 +39,13 @@ type GenericTypeLocator struct {
 // implementation of the unmarshaller.
 var DefaultLocator = reflect.TypeOf(GenericTypeLocator{})
 
+// DefaultTypeKeys returns the keys that the DefaultLocator reads the type name
+// from, in order of priority. The slice is a new one on each call, so it can
+// be extended for WithTypeKeys.
+func DefaultTypeKeys() []string {
+	return []string{"type", "@type", "Type", "@Type"}
+}
+
 // TypeName returns the name of the generic type represented by the receiver.
 func (t *GenericTypeLocator) TypeName() string {
 	if len(t.Type) > 0 {
@@ -61,11 +74,48 @@ type IndexSettable interface {
 	SetIndex(index int)
 }
 
+// rawMessageType is the type of json.RawMessage. Fields of this type collect
+// the raw JSON of their elements instead of decoding them.
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
 type fieldLookup struct {
+	name      string
+	goName    string
 	index     int
 	fieldType reflect.Type
-	kind      reflect.Kind
+	slice     bool
 	ptr       bool
+	// container is set if the field is a ContainerAppender that collects
+	// its elements, whose type is then fieldType.
+	container bool
+	raw       bool
+	first     bool
+	last      bool
+	// after and before are the type names that the elements of the field
+	// are emitted after and before when marshalling.
+	after  []string
+	before []string
+
+	// aliases are the other type names that the elements of the field are
+	// accepted under when unmarshalling.
+	aliases []string
+
+	// dedupeIndex is the index of the field of the element struct that
+	// identifies duplicate elements, if any, and merge is set if they are
+	// merged rather than dropped.
+	dedupeIndex []int
+	merge       bool
+
+	// items is the key under which the elements may hold batches of
+	// sub-objects to be stored as elements of their own, if any.
+	items string
+
+	// fallback is set if the field receives the elements with type names
+	// that match no field.
+	fallback bool
+	// emit is the type name that the elements of the field are emitted with
+	// when marshalling, if it isn't the type name of the field.
+	emit string
 }
 
 // Unmarshal is a convenience function that takes a raw JSON byte slice and a
@@ -128,86 +178,188 @@ func Unmarshal(rawJson []byte, target any) error {
 //		}
 //
 //		var result Result
-//		err := UnmarshalCustom(jsonData, &result, reflect.Type(AnimalTypeLocator{})
+//		err := UnmarshalCustom(jsonData, &result, reflect.TypeOf(AnimalTypeLocator{}))
 //
 // In this example, the UnmarshalCustom function would unmarshal the JSON into
 // the Result struct, populating the Dogs and Cats slices based on the
 // polymorphic type names defined in the TypeLocator struct.
 func UnmarshalCustom(rawJson []byte, target any, typeLocator reflect.Type) error {
+	return unmarshal(rawJson, target, newOptions([]Option{WithLocator(typeLocator)}))
+}
+
+// UnmarshalCustomLocator works like UnmarshalCustom, but takes an instance of
+// the TypeLocator rather than its reflect.Type. Only the type of the locator is
+// used: each element is unmarshalled into a new, zero instance of it, so the
+// locator is usually given as a pointer to the zero value. Further options may
+// be given as with UnmarshalWithOptions.
+//
+// Example usage:
+//
+//	err := poly.UnmarshalCustomLocator(jsonData, &result, &AnimalTypeLocator{})
+func UnmarshalCustomLocator(rawJson []byte, target any, locator TypeLocator, opts ...Option) error {
+	return unmarshal(rawJson, target, newOptions(append([]Option{WithLocator(locatorType(locator))}, opts...)))
+}
+
+// locatorType returns the type that the elements are unmarshalled into to
+// locate their types with the locator, which is the type the locator points to
+// if it is a pointer.
+func locatorType(locator any) reflect.Type {
+	t := reflect.TypeOf(locator)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// UnmarshalWithResolver works like UnmarshalCustom, but determines the type
+// name of each element by calling the resolve function with its raw JSON
+// instead of unmarshalling it into a TypeLocator. This covers discriminators
+// that need logic a flat locator struct can't express, such as combining two
+// fields. An empty type name means that the element is of no interest, and an
+// error stops the unmarshalling and is returned from it. Further options may
+// be given as with UnmarshalWithOptions.
+//
+// Example usage:
+//
+//	err := poly.UnmarshalWithResolver(data, &result, func(raw json.RawMessage) (string, error) {
+//	    var header struct {
+//	        Kind    string `json:"kind"`
+//	        Version int    `json:"version"`
+//	    }
+//	    err := json.Unmarshal(raw, &header)
+//	    return fmt.Sprintf("%s.v%d", header.Kind, header.Version), err
+//	})
+func UnmarshalWithResolver(rawJson []byte, target any, resolve func(raw json.RawMessage) (string, error), opts ...Option) error {
+	return unmarshal(rawJson, target, newOptions(append([]Option{WithResolver(resolve)}, opts...)))
+}
+
+// UnmarshalWithOptions works like Unmarshal, but allows the unmarshalling
+// behavior to be adjusted with the given options. The DefaultLocator is used
+// for type resolution unless a different one is given with WithLocator.
+func UnmarshalWithOptions(rawJson []byte, target any, opts ...Option) error {
+	return unmarshal(rawJson, target, newOptions(opts))
+}
+
+// unmarshal is the implementation behind the Unmarshal family of functions.
+func unmarshal(rawJson []byte, target any, o *options) error {
 	if len(rawJson) == 0 {
 		return nil
 	}
+	if isEmptyArray(rawJson) && o.metrics == nil && o.report == nil {
+		if _, ok := target.(Accumulator); !ok {
+			return unmarshalEmpty(target, o)
+		}
+	}
+	if o.manifest {
+		return unmarshalSource(newManifestSource(rawJson, o.objectMode), target, o)
+	}
+	if o.strategy != StrategyBatch {
+		return unmarshalStrategy(rawJson, target, o)
+	}
+	return unmarshalSource(newArraySource(rawJson, o.objectMode), target, o)
+}
 
-	targetFields, err := makeTargetFieldLookup(target)
-	if err != nil {
-		return err
+// isEmptyArray reports whether the raw JSON is an array without elements.
+func isEmptyArray(rawJson []byte) bool {
+	offset := skipSpace(rawJson, 0)
+	if offset >= len(rawJson) || rawJson[offset] != '[' {
+		return false
+	}
+	offset = skipSpace(rawJson, offset+1)
+	if offset >= len(rawJson) || rawJson[offset] != ']' {
+		return false
 	}
+	return skipSpace(rawJson, offset+1) == len(rawJson)
+}
 
-	subTypesSlice, err := unmarshalTypeMap(rawJson, typeLocator)
+// unmarshalEmpty unmarshals an array without elements into the target. Since
+// there is nothing to route, it only validates the target and its options and
+// completes the decoding, without reading the array. This
+// is the common case for endpoints that are polled, whose responses are mostly
+// empty.
+func unmarshalEmpty(target any, o *options) error {
+	d, err := newDecoder(target, o)
 	if err != nil {
 		return err
 	}
-
-	subJSONs, err := unmarshalSubArrays(rawJson)
+	if o.typeFields {
+		_, err = typeFieldKeys(d.targetFields)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = optionsResolver(o)
 	if err != nil {
-		// We should never hit this because we've previously unmarshalled the type map above.
 		return err
 	}
+	return d.finish(0)
+}
 
-	targetValue := reflect.ValueOf(target).Elem()
-	for i := 0; i < subTypesSlice.Len(); i++ {
-		// Figure out what type of object we need to make to satisfy the polymorphic
-		// needs for *this* sub-object.
-		tc, ok := subTypesSlice.Index(i).Interface().(TypeLocator)
-		if !ok {
-			// This should be impossible to get to as we've already checked.
-			return fmt.Errorf("could not convert object to a TypeLocator")
-		}
-		t := tc.TypeName()
-		if len(t) == 0 {
-			// If nothing is returned, that's the signal that we are not interested in
-			// this sub-object.
-			continue
-		}
-		if fl, ok := targetFields[t]; ok {
-			// We have a matching field we should unmarshal into.
-
-			// Create an instance of that object and unmarshal the sub-JSON into
-			// this object.
-			newSub := reflect.New(fl.fieldType)
-			newSubObj := newSub.Interface()
-			err = json.Unmarshal(subJSONs[i], newSubObj)
-			if err != nil {
-				return err
-			}
-
-			// If that object implements the IndexSettable interface, let it know the
-			// index from which it was read from.
-			if indexable, ok := newSubObj.(IndexSettable); ok {
-				indexable.SetIndex(i)
-			}
-
-			// If the actual target isn't a pointer, unwrap the Value into the object itself.
-			if !fl.ptr {
-				newSub = newSub.Elem()
+// validatePositions verifies that the elements of fields tagged with the
+// `first` or `last` option were found at the start or the end of the JSON
+// array respectively. The positions map holds the array indexes at which the
+// elements of each constrained field were found, in increasing order, and
+// count is the total number of elements in the array. The fields are checked
+// in the order they are declared, so that the same error is returned for the
+// same input.
+func validatePositions(targetFields map[string]fieldLookup, positions map[string][]int, count int) error {
+	for _, fl := range sortedFieldLookups(targetFields) {
+		t := fl.name
+		found := positions[t]
+		for i, pos := range found {
+			if fl.first && pos != i {
+				return fmt.Errorf("%q elements must be first in the array, found one at index %d", t, pos)
 			}
-
-			// Finally figure out how to save it.
-			if fl.kind == reflect.Slice {
-				// A slice gets appended to.
-				newSlice := reflect.Append(targetValue.Field(fl.index), newSub)
-				targetValue.Field(fl.index).Set(newSlice)
-			} else {
-				// A value just gets set.
-				targetValue.Field(fl.index).Set(newSub)
+			if fl.last && pos != count-len(found)+i {
+				return fmt.Errorf("%q elements must be last in the array, found one at index %d", t, pos)
 			}
 		}
 	}
-
 	return nil
 }
 
-// makeTargetFieldLookup is a helper function that takes a target any type
+// targetLookupKey identifies the lookup table of a target type under a set of
+// tag keys.
+type targetLookupKey struct {
+	targetType reflect.Type
+	tagKeys    string
+}
+
+// targetLookup is a lookup table built by buildTargetFieldLookup, along with
+// the error it returned.
+type targetLookup struct {
+	fields map[string]fieldLookup
+	err    error
+}
+
+// targetLookups memoizes the lookup tables of the target types, since they
+// only depend on the type and the tag keys, and building them with reflection
+// dominates the cost of decoding small payloads.
+var targetLookups sync.Map
+
+// makeTargetFieldLookup returns the lookup table of the target as built by
+// buildTargetFieldLookup, which is only called the first time a target type is
+// used with the tag keys. The caller gets a copy of the table that it may
+// change.
+func makeTargetFieldLookup(target any, tagKeys []string) (map[string]fieldLookup, error) {
+	key := targetLookupKey{targetType: reflect.TypeOf(target), tagKeys: strings.Join(tagKeys, "\x00")}
+	cached, ok := targetLookups.Load(key)
+	if !ok {
+		fields, err := buildTargetFieldLookup(target, tagKeys)
+		cached, _ = targetLookups.LoadOrStore(key, targetLookup{fields: fields, err: err})
+	}
+	lookup := cached.(targetLookup)
+	if lookup.err != nil {
+		return nil, lookup.err
+	}
+	fields := make(map[string]fieldLookup, len(lookup.fields))
+	for name, fl := range lookup.fields {
+		fields[name] = fl
+	}
+	return fields, nil
+}
+
+// buildTargetFieldLookup is a helper function that takes a target any type
 // variable and returns a map of fieldLookup structs keyed by the polymorphic
 // type names. The target variable should be a struct with fields optionally
 // tagged with their respective polymorphic type names or using the field name as
@@ -226,90 +378,142 @@ func UnmarshalCustom(rawJson []byte, target any, typeLocator reflect.Type) error
 //	     	Owner Owner `poly:"owner"`
 //		}
 //
-//		fields, err := makeTargetFieldLookup(&Result{})
+//		fields, err := buildTargetFieldLookup(&Result{}, []string{"poly"})
 //		// fields is a map containing fieldLookup structs for the "dog," "cat," and "owner" types.
 //
 // The returned map would have two entries, one for the "dog" type and one for the "cat"
 // type. Each entry would contain a fieldLookup struct with information about the
 // corresponding field in the target struct, such as the field index, field type,
 // whether it is a pointer, and the kind of the field (e.g., slice or value).
-func makeTargetFieldLookup(target any) (map[string]fieldLookup, error) {
+func buildTargetFieldLookup(target any, tagKeys []string) (map[string]fieldLookup, error) {
 	fields := map[string]fieldLookup{}
 	targetTypePtr := reflect.TypeOf(target)
-	if targetTypePtr.Kind() != reflect.Pointer {
+	if targetTypePtr == nil || targetTypePtr.Kind() != reflect.Pointer {
 		return nil, fmt.Errorf("target must be a pointer")
 	}
 	targetType := targetTypePtr.Elem()
+	if targetType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("target must be a pointer to a struct")
+	}
 	for i := 0; i < targetType.NumField(); i++ {
 		f := targetType.Field(i)
+		if f.Type == elementOrderType || isExcludedField(f, tagKeys) || isRestField(f, tagKeys) {
+			continue
+		}
 
 		fl := fieldLookup{
+			goName:    f.Name,
 			index:     i,
 			fieldType: f.Type,
-			kind:      f.Type.Kind(),
 		}
 
-		if f.Type.Kind() == reflect.Slice {
+		elemType, err := containerElementType(f.Type)
+		if err != nil {
+			return nil, err
+		}
+		// A json.RawMessage is a slice of bytes, but it holds a single
+		// element.
+		if elemType != nil {
+			fl.container = true
+			fl.fieldType = elemType
+		} else if f.Type.Kind() == reflect.Slice && f.Type != rawMessageType {
+			fl.slice = true
 			fl.fieldType = f.Type.Elem()
-		} else {
-			fl.fieldType = f.Type
 		}
 		if fl.fieldType.Kind() == reflect.Pointer {
 			fl.ptr = true
 			fl.fieldType = fl.fieldType.Elem()
 		}
+		fl.raw = fl.fieldType == rawMessageType
 
 		var typeName string
-		if tag, ok := f.Tag.Lookup("poly"); ok {
-			typeName = tag
-		} else {
+		if tag, ok := lookupTag(f.Tag, tagKeys); ok {
+			var opts tagOptions
+			typeName, opts, err = parseTag(tag)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			fl.first = opts.first
+			fl.last = opts.last
+			fl.after = opts.after
+			fl.before = opts.before
+			fl.aliases = opts.aliases
+			fl.fallback = opts.fallback
+			fl.emit = opts.emit
+			if opts.dedupe != "" {
+				fl.dedupeIndex, err = dedupeFieldIndex(fl, opts.dedupe)
+				if err != nil {
+					return nil, err
+				}
+				fl.merge = opts.merge
+			}
+			if opts.items != "" {
+				if !fl.slice && !fl.container {
+					return nil, fmt.Errorf("items on field %s requires a slice", fl.goName)
+				}
+				fl.items = opts.items
+			}
+		}
+		if typeName == "" {
 			typeName = f.Name
 		}
+		fl.name = typeName
 		fields[typeName] = fl
 	}
 	return fields, nil
 }
 
-// unmarshalTypeMap is a helper function that takes a raw JSON byte slice and a
-// typeLocator of type reflect.Type. It unmarshalls the JSON into a slice of
-// typeLocator instances, one for each object in the input JSON. The typeLocator
-// should be a reflect.Type implementing the TypeLocator interface. If an error occurs
-// during unmarshalling, it returns an error along with an empty reflect.Value.
-//
-// This function is used internally by UnmarshalCustom to determine the
-// polymorphic type names for each object in the JSON.
-func unmarshalTypeMap(rawJson []byte, typeLocator reflect.Type) (reflect.Value, error) {
-	// Verify that the typeLocator is suitable.
-	if !reflect.PointerTo(typeLocator).AssignableTo(typeLocatorType) {
-		return reflect.Value{}, fmt.Errorf("typeLocator not assignable to a TypeLocator")
+// dedupeFieldIndex returns the index of the identity field with the given
+// name in the element struct of the field, verifying that the field can hold
+// several elements and that the identity can be compared.
+func dedupeFieldIndex(fl fieldLookup, name string) ([]int, error) {
+	if !fl.slice || fl.fieldType.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dedupe on field %s requires a slice of structs", fl.goName)
+	}
+	idField, ok := fl.fieldType.FieldByName(name)
+	if !ok {
+		return nil, fmt.Errorf("dedupe field %s does not exist in %v", name, fl.fieldType)
 	}
+	if !idField.Type.Comparable() {
+		return nil, fmt.Errorf("dedupe field %s of %v is not comparable", name, fl.fieldType)
+	}
+	return idField.Index, nil
+}
 
-	typeSliceType := reflect.SliceOf(reflect.PointerTo(typeLocator))
-	slicePtr := reflect.New(typeSliceType)
+// decodeElement creates a new instance of elemType and unmarshals the raw JSON
+// of a sub-object into it. If the new object implements the IndexSettable
+// interface, it is told the index of the sub-object in the JSON array. The
+// returned value is a pointer to the new object.
+func decodeElement(raw json.RawMessage, elemType reflect.Type, index int) (reflect.Value, error) {
+	return decodeElementInto(reflect.New(elemType), raw, index, false)
+}
 
-	err := json.Unmarshal(rawJson, slicePtr.Interface())
+// decodeElementInto works like decodeElement, but unmarshals into newSub, a
+// pointer to an existing object, which is returned. If useNumber is set, the
+// numbers in interface values are decoded as json.Number.
+func decodeElementInto(newSub reflect.Value, raw json.RawMessage, index int, useNumber bool) (reflect.Value, error) {
+	newSubObj := newSub.Interface()
+	err := unmarshalJSON(raw, newSubObj, useNumber)
 	if err != nil {
 		return reflect.Value{}, err
 	}
 
-	return slicePtr.Elem(), nil
+	// If that object implements the IndexSettable interface, let it know the
+	// index from which it was read from.
+	if indexable, ok := newSubObj.(IndexSettable); ok {
+		indexable.SetIndex(index)
+	}
+	return newSub, nil
 }
 
-// unmarshalSubArrays is a helper function that takes a raw JSON byte slice and
-// returns a slice of json.RawMessage objects, where each json.RawMessage
-// corresponds to an object in the input JSON array. If an error occurs during
-// unmarshalling, it returns an error along with an empty slice.
-//
-// This function is used internally by UnmarshalCustom to extract the JSON
-// objects for each sub-object, which will later be unmarshalled into the
-// appropriate target fields based on their polymorphic type names.
-func unmarshalSubArrays(rawJson []byte) ([]json.RawMessage, error) {
-	var subJSONs []json.RawMessage
-	err := json.Unmarshal(rawJson, &subJSONs)
-	if err != nil {
-		// We should never get here because the code flow would have already unmarshalled this
-		// in a different way earlier.
-		return nil, err
+// unmarshalJSON works like json.Unmarshal, but decodes the numbers in
+// interface values, such as in a map[string]any, as json.Number rather than
+// float64 if useNumber is set.
+func unmarshalJSON(raw []byte, v any, useNumber bool) error {
+	if !useNumber {
+		return json.Unmarshal(raw, v)
 	}
-	return subJSONs, nil
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
 }
@@ -1,6 +1,9 @@
 package poly
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"reflect"
 	"testing"
@@ -61,6 +64,33 @@ func TestUnmarshal_BadLocator(t *testing.T) {
 	assert.Error(t, err)
 }
 
+type KindLocator struct {
+	Kind string `json:"kind"`
+}
+
+func (l *KindLocator) TypeName() string {
+	return l.Kind
+}
+
+func TestUnmarshalCustomLocator(t *testing.T) {
+	in := []byte(`[{"kind":"person","name":"John"},{"type":"pet","name":"Fido"},{"kind":"pet","name":"Rex"}]`)
+
+	var result Residence
+	err := UnmarshalCustomLocator(in, &result, &KindLocator{Kind: "ignored"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Rex"}}, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalCustomLocator(in, &result, &GenericTypeLocator{}, WithFieldPredicate("pet", func(raw json.RawMessage) bool { return false }))
+	assert.NoError(t, err)
+	assert.Empty(t, result.People)
+	assert.Empty(t, result.Pets)
+
+	err = UnmarshalCustomLocator(in, &result, nil)
+	assert.EqualError(t, err, "typeLocator not assignable to a TypeLocator")
+}
+
 func TestUnmarshal_JSONError(t *testing.T) {
 	in := `
 [
@@ -126,3 +156,801 @@ func TestUnmarshal_NonPointer(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+type OrderedResidence struct {
+	Location Location `poly:"location,first"`
+	People   []Person `poly:"person"`
+	Notes    []Pet    `poly:"note,last"`
+}
+
+func TestUnmarshal_OrderingConstraints(t *testing.T) {
+	in := `
+[
+	{"type": "location", "address": "123 Main"},
+	{"type": "person", "name": "John"},
+	{"type": "unknown"},
+	{"type": "note", "name": "A"},
+	{"type": "note", "name": "B"}
+]`
+	var result OrderedResidence
+	err := Unmarshal([]byte(in), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, "123 Main", result.Location.Address)
+	assert.Len(t, result.Notes, 2)
+}
+
+func TestUnmarshal_OrderingConstraintFirstViolated(t *testing.T) {
+	in := `
+[
+	{"type": "person", "name": "John"},
+	{"type": "location", "address": "123 Main"}
+]`
+	var result OrderedResidence
+	err := Unmarshal([]byte(in), &result)
+	assert.EqualError(t, err, `"location" elements must be first in the array, found one at index 1`)
+}
+
+func TestUnmarshal_OrderingConstraintLastViolated(t *testing.T) {
+	in := `
+[
+	{"type": "note", "name": "A"},
+	{"type": "person", "name": "John"},
+	{"type": "note", "name": "B"}
+]`
+	var result OrderedResidence
+	err := Unmarshal([]byte(in), &result)
+	assert.EqualError(t, err, `"note" elements must be last in the array, found one at index 0`)
+}
+
+type PassThrough struct {
+	Person Person            `poly:"person"`
+	Audit  []json.RawMessage `poly:"audit"`
+	Trace  json.RawMessage   `poly:"trace"`
+	Note   *json.RawMessage  `poly:"note"`
+}
+
+func TestUnmarshal_RawMessage(t *testing.T) {
+	input := `[
+		{"type":"audit", "user":"john", "action":"login"},
+		{"type":"person", "name":"John"},
+		{"type":"trace", "id":[1, 2, 3]},
+		{"type":"audit", "user":"jane"},
+		{"type":"note", "text":"hi"}
+	]`
+
+	var result PassThrough
+	err := Unmarshal([]byte(input), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", result.Person.Name)
+	assert.Equal(t, []json.RawMessage{
+		json.RawMessage(`{"type":"audit", "user":"john", "action":"login"}`),
+		json.RawMessage(`{"type":"audit", "user":"jane"}`),
+	}, result.Audit)
+	assert.Equal(t, `{"type":"trace", "id":[1, 2, 3]}`, string(result.Trace))
+	assert.Equal(t, `{"type":"note", "text":"hi"}`, string(*result.Note))
+
+	bytes, err := Marshal(result)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"name":"John"},
+		{"type":"audit", "user":"john", "action":"login"},
+		{"type":"audit", "user":"jane"},
+		{"type":"trace", "id":[1, 2, 3]},
+		{"type":"note", "text":"hi"}
+	]`, string(bytes))
+}
+
+type LooselyTyped struct {
+	Person   Person           `poly:"person"`
+	Settings map[string]any   `poly:"settings"`
+	Plugins  []map[string]any `poly:"plugin"`
+}
+
+func TestUnmarshal_Map(t *testing.T) {
+	input := `[
+		{"type":"plugin", "name":"lint", "level":2},
+		{"type":"person", "name":"John"},
+		{"type":"settings", "theme":"dark", "tabs":{"width":4}},
+		{"type":"plugin", "name":"fmt"}
+	]`
+
+	var result LooselyTyped
+	err := Unmarshal([]byte(input), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, Person{Name: "John"}, result.Person)
+	assert.Equal(t, map[string]any{"type": "settings", "theme": "dark", "tabs": map[string]any{"width": float64(4)}}, result.Settings)
+	assert.Equal(t, []map[string]any{
+		{"type": "plugin", "name": "lint", "level": float64(2)},
+		{"type": "plugin", "name": "fmt"},
+	}, result.Plugins)
+
+	bytes, err := Marshal(result)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"name":"John"},
+		{"type":"settings", "theme":"dark", "tabs":{"width":4}},
+		{"type":"plugin", "name":"lint", "level":2},
+		{"type":"plugin", "name":"fmt"}
+	]`, string(bytes))
+}
+
+func TestUnmarshalWithOptions_UseNumber(t *testing.T) {
+	input := `[{"type":"settings","amount":12345678901234567890.0100,"nested":[1e400]},{"type":"plugin","level":9007199254740993}]`
+
+	var result LooselyTyped
+	err := UnmarshalWithOptions([]byte(input), &result, WithUseNumber())
+	assert.NoError(t, err)
+	assert.Equal(t, json.Number("12345678901234567890.0100"), result.Settings["amount"])
+	assert.Equal(t, []any{json.Number("1e400")}, result.Settings["nested"])
+	assert.Equal(t, json.Number("9007199254740993"), result.Plugins[0]["level"])
+
+	bytes, err := Marshal(result)
+	assert.NoError(t, err)
+	assert.Equal(t, `[{"amount":12345678901234567890.0100,"nested":[1e400],"type":"settings"},{"level":9007199254740993,"type":"plugin"}]`, string(bytes))
+
+	// Without the option the numbers are float64, and so lose precision.
+	result = LooselyTyped{}
+	err = Unmarshal([]byte(`[{"type":"plugin","level":9007199254740993}]`), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(9007199254740992), result.Plugins[0]["level"])
+}
+
+func TestUnmarshalWithOptions_FieldOverride(t *testing.T) {
+	input := `[
+		{"type":"address", "address":"123 Main St"},
+		{"type":"resident", "name":"John"},
+		{"type":"occupant", "name":"Jane"},
+		{"type":"person", "name":"Ignored"}
+	]`
+
+	var result Residence
+	err := UnmarshalWithOptions([]byte(input), &result,
+		WithFieldOverride("address", "Location"),
+		WithFieldOverride("resident", "People"),
+		WithFieldOverride("occupant", "People"))
+	assert.NoError(t, err)
+	assert.Equal(t, "123 Main St", result.Location.Address)
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Jane"}}, result.People)
+
+	err = UnmarshalWithOptions([]byte(input), &result, WithFieldOverride("address", "Address"))
+	assert.EqualError(t, err, `field Address for type name "address" does not exist in the target`)
+}
+
+type ManyInts struct {
+	TypeInt []TypeInt
+}
+
+func TestUnmarshalWithOptions_BatchAllocation(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `{"type":"TypeInt","ValueC":%d}`, i)
+	}
+	buf.WriteString("]")
+	input := buf.Bytes()
+
+	var expected, actual ManyInts
+	assert.NoError(t, Unmarshal(input, &expected))
+	assert.NoError(t, UnmarshalWithOptions(input, &actual, WithBatchAllocation()))
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, 999, actual.TypeInt[999].index)
+
+	normal := testing.AllocsPerRun(5, func() {
+		var result ManyInts
+		_ = Unmarshal(input, &result)
+	})
+	batched := testing.AllocsPerRun(5, func() {
+		var result ManyInts
+		_ = UnmarshalWithOptions(input, &result, WithBatchAllocation())
+	})
+	assert.Less(t, batched, normal-900)
+}
+
+func TestUnmarshalWithOptions_BatchAllocationError(t *testing.T) {
+	var result ManyInts
+	err := UnmarshalWithOptions([]byte(`[{"type":"TypeInt","ValueC":1},{"type":"TypeInt","ValueC":"x"}]`), &result, WithBatchAllocation())
+	assert.Error(t, err)
+	assert.Equal(t, []TypeInt{{ValueC: 1, index: 0}}, result.TypeInt)
+}
+
+type Contact struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+type Contacts struct {
+	Contacts []Contact  `poly:"contact,dedupe=ID"`
+	Merged   []*Contact `poly:"merged,dedupe=ID,merge"`
+}
+
+func TestUnmarshal_Dedupe(t *testing.T) {
+	input := []byte(`[
+		{"type":"contact", "id":1, "name":"John"},
+		{"type":"contact", "id":2, "name":"Jane"},
+		{"type":"contact", "id":1, "name":"Johnny"},
+		{"type":"contact", "name":"Anonymous"},
+		{"type":"contact", "name":"Anonymous"},
+		{"type":"merged", "id":1, "name":"John"},
+		{"type":"merged", "id":1, "email":"john@example.com"}
+	]`)
+
+	expected := Contacts{
+		Contacts: []Contact{{ID: 1, Name: "John"}, {ID: 2, Name: "Jane"}, {Name: "Anonymous"}, {Name: "Anonymous"}},
+		Merged:   []*Contact{{ID: 1, Name: "John", Email: "john@example.com"}},
+	}
+
+	var result Contacts
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	result = Contacts{}
+	err = UnmarshalWithOptions(input, &result, WithBatchAllocation())
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+}
+
+func TestUnmarshal_DedupeInvalid(t *testing.T) {
+	var missing struct {
+		Contacts []Contact `poly:"contact,dedupe=Key"`
+	}
+	err := Unmarshal([]byte(`[]`), &missing)
+	assert.EqualError(t, err, "dedupe field Key does not exist in poly.Contact")
+
+	var scalar struct {
+		Contact Contact `poly:"contact,dedupe=ID"`
+	}
+	err = Unmarshal([]byte(`[]`), &scalar)
+	assert.EqualError(t, err, "dedupe on field Contact requires a slice of structs")
+
+	var notComparable struct {
+		Jobs []Job `poly:"job,dedupe=Tags"`
+	}
+	err = Unmarshal([]byte(`[]`), &notComparable)
+	assert.EqualError(t, err, "dedupe field Tags of poly.Job is not comparable")
+}
+
+type Batches struct {
+	People []Person          `poly:"person,items"`
+	Pets   []*Pet            `poly:"pet,items=pets"`
+	Raw    []json.RawMessage `poly:"raw,items"`
+}
+
+func TestUnmarshal_Batches(t *testing.T) {
+	input := []byte(`[
+		{"type":"person","items":[{"name":"John"},{"name":"Jane"}]},
+		{"type":"person","name":"Single"},
+		{"type":"pet","pets":[{"name":"Fido"}]},
+		{"type":"pet","items":[{"name":"Not a batch"}]},
+		{"type":"raw","items":[1,{"a":2}]},
+		{"type":"person","items":[]}
+	]`)
+
+	var result Batches
+	err := UnmarshalWithOptions(input, &result, WithBatchAllocation())
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Jane"}, {Name: "Single"}}, result.People)
+	assert.Equal(t, []*Pet{{Name: "Fido"}, {}}, result.Pets)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`1`), json.RawMessage(`{"a":2}`)}, result.Raw)
+}
+
+func TestUnmarshal_BatchErrors(t *testing.T) {
+	var result Batches
+	err := Unmarshal([]byte(`[{"type":"person","items":{"name":"John"}}]`), &result)
+	assert.ErrorContains(t, err, `batch element 0 of type "person": "items" does not hold an array`)
+
+	var scalar struct {
+		Person Person `poly:"person,items"`
+	}
+	err = Unmarshal([]byte(`[]`), &scalar)
+	assert.EqualError(t, err, "items on field Person requires a slice")
+}
+
+func TestUnmarshal_BatchPositions(t *testing.T) {
+	var result struct {
+		People []Person `poly:"person,first,items"`
+		Pets   []Pet    `poly:"pet,last,items"`
+	}
+	err := Unmarshal([]byte(`[
+		{"type":"person","items":[{"name":"John"},{"name":"Jane"}]},
+		{"type":"pet","items":[{"name":"Fido"},{"name":"Rex"}]}
+	]`), &result)
+	assert.NoError(t, err)
+	assert.Len(t, result.People, 2)
+	assert.Len(t, result.Pets, 2)
+}
+
+func TestUnmarshal_PositionErrorsInDeclarationOrder(t *testing.T) {
+	in := []byte(`[
+		{"type": "note", "name": "A"},
+		{"type": "person", "name": "John"},
+		{"type": "location", "address": "123 Main"}
+	]`)
+	for i := 0; i < 20; i++ {
+		var result OrderedResidence
+		err := Unmarshal(in, &result)
+		assert.EqualError(t, err, `"location" elements must be first in the array, found one at index 2`)
+	}
+}
+
+func TestUnmarshalWithOptions_Vocabulary(t *testing.T) {
+	input := []byte(`[
+		{"type":"person","name":"John"},
+		{"type":"persona","name":"Juan"},
+		{"type":"animal","name":"Fido"},
+		{"type":"tier","name":"Rex"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result,
+		WithVocabulary(map[string][]string{"person": {"persona", "personne"}}),
+		WithVocabulary(map[string][]string{"pet": {"animal"}, "person": {"person"}}),
+		WithVocabulary(map[string][]string{"pet": {"tier"}}))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Juan"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Rex"}}, result.Pets)
+
+	err = UnmarshalWithOptions(input, &result, WithVocabulary(map[string][]string{
+		"pet":    {"animal"},
+		"person": {"animal"},
+	}))
+	assert.EqualError(t, err, `type name "animal" is an alias of both "person" and "pet"`)
+}
+
+func TestUnmarshalWithOptions_TypeKeys(t *testing.T) {
+	input := []byte(`[
+		{"kind":"person","name":"John"},
+		{"$type":"pet","kind":"person","name":"Fido"},
+		{"type":"pet","kind":"","name":"Rex"},
+		{"name":"?"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithTypeKeys(append(DefaultTypeKeys(), "$type", "kind")...))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Rex"}}, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalWithOptions(input, &result, WithTypeKeys("kind"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Fido"}}, result.People)
+	assert.Empty(t, result.Pets)
+
+	err = UnmarshalWithOptions(input, &result, WithTypeKeys("$type", "kind"), WithDiscriminatorConflicts(RejectConflicts))
+	assert.ErrorIs(t, err, ErrConflictingDiscriminators)
+
+	result = Residence{}
+	err = UnmarshalWithOptions(input, &result, WithTypeKeys("kind"), WithLocator(DefaultLocator))
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Rex"}}, result.Pets)
+}
+
+func TestUnmarshalWithOptions_TypeMapping(t *testing.T) {
+	input := []byte(`[
+		{"type":"persona","name":"Juan"},
+		{"type":"person","name":"Fido"},
+		{"type":"pet","name":"Rex"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithTypeMapping(map[string]string{
+		"persona": "person",
+		"person":  "pet",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "Juan"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Rex"}}, result.Pets)
+
+	err = UnmarshalWithOptions(input, &result,
+		WithVocabulary(map[string][]string{"person": {"persona"}}),
+		WithTypeMapping(map[string]string{"persona": "pet"}))
+	assert.EqualError(t, err, `type name "persona" is an alias of both "person" and "pet"`)
+}
+
+type EventStream struct {
+	Created []TypeString `event:"created" poly:"TypeString"`
+	Deleted *TypeInt     `event:"deleted"`
+	Other   TypeFloat
+	Rest    json.RawMessage `event:"!rest"`
+}
+
+func TestUnmarshalWithOptions_TagKey(t *testing.T) {
+	input := []byte(`[{"type":"created","ValueA":"A"},{"type":"deleted","ValueC":1},{"type":"TypeString"},{"type":"Other","ValueB":2}]`)
+
+	var result EventStream
+	err := UnmarshalWithOptions(input, &result, WithTagKey("event"))
+	assert.NoError(t, err)
+	assert.Equal(t, []TypeString{{ValueA: "A"}}, result.Created)
+	assert.Equal(t, 1, result.Deleted.ValueC)
+	assert.Equal(t, TypeFloat{ValueB: 2}, result.Other)
+	assert.Equal(t, `[{"type":"TypeString"}]`, string(result.Rest))
+
+	bytes, err := MarshalWithOptions(result, WithTagKey("event"), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	// TypeInt implements IndexGettable, and so comes first.
+	assert.Equal(t, `[{"type":"deleted","ValueC":1},{"type":"created","ValueA":"A"},{"type":"Other","ValueB":2},{"type":"TypeString"}]`, string(bytes))
+
+	fields, err := DescribeTarget(result, WithTagKey("event"))
+	assert.NoError(t, err)
+	assert.Equal(t, "created", fields[0].TypeName)
+
+	// The default key is still poly.
+	fields, err = DescribeTarget(result)
+	assert.NoError(t, err)
+	assert.Equal(t, "TypeString", fields[0].TypeName)
+}
+
+type JSONTagged struct {
+	People   []Person      `json:"person,omitempty"`
+	Water    *WaterService `json:"water,omitempty"`
+	Internal string        `json:"-"`
+}
+
+func TestUnmarshalWithOptions_JSONTagKey(t *testing.T) {
+	input := []byte(`[{"type":"person","name":"John"},{"type":"water","provider":"City"},{"type":"Internal"}]`)
+
+	var result JSONTagged
+	err := UnmarshalWithOptions(input, &result, WithTagKey("json"))
+	assert.NoError(t, err)
+	assert.Equal(t, JSONTagged{People: []Person{{Name: "John"}}, Water: &WaterService{Provider: "City"}}, result)
+
+	fields, err := DescribeTarget(result, WithTagKey("json"))
+	assert.NoError(t, err)
+	assert.Len(t, fields, 2)
+	assert.Empty(t, fields[0].Aliases)
+
+	bytes, err := MarshalWithOptions(result, WithTagKey("json"), WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"person","name":"John"},{"type":"water","provider":"City"}]`, string(bytes))
+}
+
+type TwoGenerations struct {
+	People []Person  `poly:"person" polyv2:"human"`
+	Pets   []Pet     `polyv2:"animal"`
+	Water  TypeFloat `poly:"water,last"`
+}
+
+func TestUnmarshalWithOptions_TagKeys(t *testing.T) {
+	v1 := []byte(`[{"type":"person","name":"John"},{"type":"Pets","name":"Fido"},{"type":"water","ValueB":1}]`)
+	v2 := []byte(`[{"type":"human","name":"John"},{"type":"animal","name":"Fido"},{"type":"water","ValueB":1}]`)
+	expected := TwoGenerations{
+		People: []Person{{Name: "John"}},
+		Pets:   []Pet{{Name: "Fido"}},
+		Water:  TypeFloat{ValueB: 1},
+	}
+
+	var result TwoGenerations
+	err := Unmarshal(v1, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	result = TwoGenerations{}
+	err = UnmarshalWithOptions(v2, &result, WithTagKeys("polyv2", "poly"))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, result)
+
+	// The options of the fallback tag still apply.
+	err = UnmarshalWithOptions([]byte(`[{"type":"water"},{"type":"human"}]`), &result, WithTagKeys("polyv2", "poly"))
+	assert.EqualError(t, err, `"water" elements must be last in the array, found one at index 0`)
+
+	v2Profile := Profile{Name: "v2", DiscriminatorKey: "type", TagKeys: []string{"polyv2", "poly"}}
+	bytes, err := MarshalWithOptions(expected, WithProfile(v2Profile))
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(v2), string(bytes))
+}
+
+func TestUnmarshalWithOptions_FieldPredicate(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John", "occupation":"acme"},
+		{"type":"person", "name":"Jane", "occupation":"globex"},
+		{"type":"pet", "name":"Fido"}
+	]`)
+	acme := WithFieldPredicate("person", func(raw json.RawMessage) bool {
+		return bytes.Contains(raw, []byte(`"occupation":"acme"`))
+	})
+
+	var result Residence
+	report := &DecodeReport{}
+	err := UnmarshalWithOptions(input, &result, acme, WithDecodeReport(report))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John", Occupation: "acme"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+	assert.Equal(t, 1, report.Unmatched)
+
+	list := &lockedList{}
+	err = UnmarshalWithOptions(input, list, WithRegistry(accumulatorRegistry()), acme)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{&Person{Name: "John", Occupation: "acme"}, &Pet{Name: "Fido"}}, list.elements)
+}
+
+type VersionedEvents struct {
+	Old []TypeString `poly:"event.v1"`
+	New []TypeString `poly:"event.v2"`
+}
+
+func TestUnmarshalWithResolver(t *testing.T) {
+	input := []byte(`[
+		{"kind":"event", "version":1, "ValueA":"a"},
+		{"kind":"event", "version":2, "ValueA":"b"},
+		{"kind":"other", "version":2}
+	]`)
+	resolve := func(raw json.RawMessage) (string, error) {
+		var header struct {
+			Kind    string `json:"kind"`
+			Version int    `json:"version"`
+		}
+		err := json.Unmarshal(raw, &header)
+		return fmt.Sprintf("%s.v%d", header.Kind, header.Version), err
+	}
+
+	var result VersionedEvents
+	err := UnmarshalWithResolver(input, &result, resolve)
+	assert.NoError(t, err)
+	assert.Equal(t, VersionedEvents{
+		Old: []TypeString{{ValueA: "a"}},
+		New: []TypeString{{ValueA: "b"}},
+	}, result)
+
+	err = UnmarshalWithResolver(input, &result, func(raw json.RawMessage) (string, error) {
+		return "", fmt.Errorf("unknown kind")
+	})
+	assert.EqualError(t, err, "unknown kind")
+
+	// A later locator replaces the resolver.
+	result = VersionedEvents{}
+	err = UnmarshalWithOptions(input, &result, WithResolver(resolve), WithLocator(reflect.TypeOf(GenericTypeLocator{})))
+	assert.NoError(t, err)
+	assert.Equal(t, VersionedEvents{}, result)
+}
+
+func TestUnmarshalWithOptions_TypePath(t *testing.T) {
+	input := []byte(`[
+		{"meta":{"kind":"person"}, "name":"John"},
+		{"meta":{"kind":"pet"}, "name":"Fido"},
+		{"meta":{"version":1}},
+		{"meta":"person"},
+		{"type":"person", "name":"Jane"}
+	]`)
+
+	var result Residence
+	err := UnmarshalWithOptions(input, &result, WithTypePath("meta.kind"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+
+	result = Residence{}
+	err = UnmarshalWithOptions([]byte(`[{"type":"person", "name":"Jane"}]`), &result, WithTypePath("type"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "Jane"}}, result.People)
+}
+
+type RenamedKennel struct {
+	Owner Person `poly:"owner,first,keeper"`
+	Dogs  []Pet  `poly:"dog,puppy,canine"`
+}
+
+func TestUnmarshal_TagAliases(t *testing.T) {
+	input := []byte(`[
+		{"type":"keeper", "name":"John"},
+		{"type":"dog", "name":"Rex"},
+		{"type":"puppy", "name":"Fido"},
+		{"type":"canine", "name":"Spot"}
+	]`)
+
+	var result RenamedKennel
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, "John", result.Owner.Name)
+	assert.Equal(t, []Pet{{Name: "Rex"}, {Name: "Fido"}, {Name: "Spot"}}, result.Dogs)
+
+	// Marshalling uses the type name.
+	bytes, err := MarshalWithOptions(result, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"owner","name":"John"},{"type":"dog","name":"Rex"},{"type":"dog","name":"Fido"},{"type":"dog","name":"Spot"}]`, string(bytes))
+
+	fields, err := DescribeTarget(RenamedKennel{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"keeper"}, fields[0].Aliases)
+	assert.Equal(t, []string{"puppy", "canine"}, fields[1].Aliases)
+
+	var conflicting struct {
+		Dogs []Pet `poly:"dog,pet"`
+		Pets []Pet `poly:"pet"`
+	}
+	err = Unmarshal(input, &conflicting)
+	assert.EqualError(t, err, `type name "pet" is used by both fields Pets and Dogs`)
+}
+
+func TestUnmarshal_TagOptionTypos(t *testing.T) {
+	var unknown struct {
+		Notes []Pet `poly:"note,afterr=owner"`
+	}
+	err := Unmarshal([]byte(`[]`), &unknown)
+	assert.EqualError(t, err, `field Notes: unknown tag option "afterr"`)
+	_, err = Marshal(unknown)
+	assert.EqualError(t, err, `field Notes: unknown tag option "afterr"`)
+}
+
+func TestUnmarshal_AliasesNearOptionNames(t *testing.T) {
+	var result struct {
+		Notes []Pet `poly:"note,list,lost,alias=first"`
+	}
+	err := Unmarshal([]byte(`[{"type":"list","name":"Rex"},{"type":"lost","name":"Fido"},{"type":"first","name":"Tom"}]`), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Rex"}, {Name: "Fido"}, {Name: "Tom"}}, result.Notes)
+}
+
+type ExcludingResidence struct {
+	People []Person `poly:"person"`
+	Helper Person   `poly:"-"`
+	Dash   []Pet    `poly:"-,"`
+}
+
+func TestUnmarshal_ExcludedField(t *testing.T) {
+	input := []byte(`[
+		{"type":"person", "name":"John"},
+		{"type":"Helper", "name":"Jane"},
+		{"type":"-", "name":"Fido"}
+	]`)
+
+	var result ExcludingResidence
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	assert.Equal(t, Person{}, result.Helper)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Dash)
+
+	result.Helper = Person{Name: "Jane"}
+	bytes, err := MarshalWithOptions(result, WithDiscriminator("type"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"person","name":"John"},{"type":"-","name":"Fido"}]`, string(bytes))
+	assert.Equal(t, []Person{{Name: "John"}}, Find[Person](result))
+
+	fields, err := DescribeTarget(result)
+	assert.NoError(t, err)
+	assert.Len(t, fields, 2)
+}
+
+type PrivateKennel struct {
+	cache []Pet             `poly:"pet"`
+	rest  []json.RawMessage `poly:"*"`
+	Dogs  []Pet             `poly:"dog"`
+}
+
+func TestUnmarshal_UnexportedField(t *testing.T) {
+	input := []byte(`[{"type":"pet", "name":"Tom"}, {"type":"dog", "name":"Fido"}]`)
+
+	var result PrivateKennel
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, PrivateKennel{Dogs: []Pet{{Name: "Fido"}}}, result)
+
+	fields, err := DescribeTarget(result)
+	assert.NoError(t, err)
+	assert.Len(t, fields, 1)
+}
+
+type Catalog struct {
+	Pets  []Pet             `poly:"pet"`
+	Other []json.RawMessage `poly:"other,default"`
+}
+
+func TestUnmarshal_DefaultType(t *testing.T) {
+	input := []byte(`[
+		{"type":"pet", "name":"Fido"},
+		{"type":"hamster", "name":"Nibbles"},
+		{"name":"untyped"}
+	]`)
+
+	var result Catalog
+	err := Unmarshal(input, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Fido"}}, result.Pets)
+	assert.Equal(t, []json.RawMessage{json.RawMessage(`{"type":"hamster", "name":"Nibbles"}`)}, result.Other)
+
+	var residence Residence
+	err = UnmarshalWithOptions(input, &residence, WithDefaultType("pet"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Fido"}, {Name: "Nibbles"}}, residence.Pets)
+
+	err = UnmarshalWithOptions(input, &residence, WithDefaultType("missing"))
+	assert.EqualError(t, err, `default type "missing" has no field in the target`)
+
+	var twice struct {
+		Pets  []Pet `poly:"pet,default"`
+		Other []Pet `poly:"other,default"`
+	}
+	err = Unmarshal(input, &twice)
+	assert.EqualError(t, err, `only one field may have the default option, found Pets and Other`)
+}
+
+func TestUnmarshal_EmptyArray(t *testing.T) {
+	for _, in := range []string{`[]`, ` [ ] `, "\n[\n]\n"} {
+		result := Residence{People: []Person{{Name: "John"}}}
+		assert.NoError(t, Unmarshal([]byte(in), &result))
+		assert.Equal(t, []Person{{Name: "John"}}, result.People)
+	}
+
+	// The target and the options are still validated.
+	var result Residence
+	assert.EqualError(t, Unmarshal([]byte(`[]`), result), "target must be a pointer")
+	assert.EqualError(t, UnmarshalWithOptions([]byte(`[]`), &result, WithDefaultType("car")), `default type "car" has no field in the target`)
+
+	// Position constraints hold for an empty array.
+	var ordered OrderedResidence
+	assert.NoError(t, Unmarshal([]byte(`[]`), &ordered))
+
+	var report DecodeReport
+	assert.NoError(t, UnmarshalWithOptions([]byte(`[]`), &result, WithDecodeReport(&report)))
+	assert.Equal(t, 0, report.Elements)
+}
+
+func TestMakeTargetFieldLookup_Memoized(t *testing.T) {
+	fields, err := makeTargetFieldLookup(&Residence{}, []string{defaultTagKey})
+	assert.NoError(t, err)
+	delete(fields, "person")
+
+	fields, err = makeTargetFieldLookup(&Residence{}, []string{defaultTagKey})
+	assert.NoError(t, err)
+	assert.Contains(t, fields, "person")
+
+	_, err = makeTargetFieldLookup(Residence{}, []string{defaultTagKey})
+	assert.EqualError(t, err, "target must be a pointer")
+	_, err = makeTargetFieldLookup(Residence{}, []string{defaultTagKey})
+	assert.EqualError(t, err, "target must be a pointer")
+}
+
+type ResettableResidence struct {
+	People []Person          `poly:"person"`
+	Water  *WaterService     `poly:"water"`
+	Rest   []json.RawMessage `poly:"!rest"`
+	Note   string            `poly:"-"`
+}
+
+func TestUnmarshalWithOptions_Reset(t *testing.T) {
+	in := []byte(`[{"type":"person","name":"Juan"},{"type":"car"}]`)
+	existing := ResettableResidence{
+		People: []Person{{Name: "John"}},
+		Water:  &WaterService{Provider: "City"},
+		Rest:   []json.RawMessage{json.RawMessage(`{"type":"boat"}`)},
+		Note:   "kept",
+	}
+
+	result := existing
+	err := Unmarshal(in, &result)
+	assert.NoError(t, err)
+	assert.Equal(t, []Person{{Name: "John"}, {Name: "Juan"}}, result.People)
+	assert.NotNil(t, result.Water)
+
+	result = existing
+	err = UnmarshalWithOptions(in, &result, WithReset())
+	assert.NoError(t, err)
+	assert.Equal(t, ResettableResidence{
+		People: []Person{{Name: "Juan"}},
+		Rest:   []json.RawMessage{json.RawMessage(`{"type":"car"}`)},
+		Note:   "kept",
+	}, result)
+
+	// An empty array leaves an empty target.
+	result = existing
+	err = UnmarshalWithOptions([]byte(`[]`), &result, WithReset())
+	assert.NoError(t, err)
+	assert.Equal(t, ResettableResidence{Note: "kept"}, result)
+}
+
+type CountedKennel struct {
+	count int
+	Pets  []Pet `poly:"pet"`
+}
+
+func TestUnmarshalWithOptions_ResetUnexported(t *testing.T) {
+	result := CountedKennel{count: 3, Pets: []Pet{{Name: "Rex"}}}
+	err := UnmarshalWithOptions([]byte(`[{"type":"pet","name":"Fido"}]`), &result, WithReset())
+	assert.NoError(t, err)
+	assert.Equal(t, CountedKennel{count: 3, Pets: []Pet{{Name: "Fido"}}}, result)
+}
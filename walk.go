@@ -0,0 +1,94 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Walk unmarshals the polymorphic arrays found deep inside a larger JSON
+// document, so that a document with several of them doesn't need an
+// UnmarshalJSON method for each struct on the way. The spec maps the path of
+// each array to the target it is unmarshalled into, as with
+// UnmarshalWithOptions. A path is a sequence of keys separated by dots, where
+// a number selects an element of an array, and the empty path is the document
+// itself:
+//
+//	var residence Residence
+//	var history Residence
+//	err := poly.Walk(data, map[string]any{
+//	    "household.members":   &residence,
+//	    "household.archive.0": &history,
+//	})
+//
+// Paths that aren't found in the document, or that lead to null, are skipped,
+// and the options apply to every array. The paths are unmarshalled in sorted
+// order, and an error names the path it occurred at.
+func Walk(rawJson []byte, spec map[string]any, opts ...Option) error {
+	o := newOptions(opts)
+	paths := make([]string, 0, len(spec))
+	for path := range spec {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		raw, err := lookupPath(rawJson, path)
+		if err != nil {
+			return fmt.Errorf("path %q: %w", path, err)
+		}
+		if raw == nil {
+			continue
+		}
+		err = unmarshal(raw, spec[path], o)
+		if err != nil {
+			return fmt.Errorf("path %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// lookupPath returns the JSON value at the path in the document, or nil if the
+// path isn't found or leads to null. An error is returned if the document
+// isn't valid JSON along the path.
+func lookupPath(rawJson []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(rawJson)
+	if path != "" {
+		for _, key := range strings.Split(path, ".") {
+			offset := skipSpace(raw, 0)
+			if offset == len(raw) {
+				return nil, nil
+			}
+			switch raw[offset] {
+			case '{':
+				var object map[string]json.RawMessage
+				err := json.Unmarshal(raw, &object)
+				if err != nil {
+					return nil, err
+				}
+				raw = object[key]
+			case '[':
+				index, err := strconv.Atoi(key)
+				if err != nil || index < 0 {
+					return nil, nil
+				}
+				var array []json.RawMessage
+				err = json.Unmarshal(raw, &array)
+				if err != nil {
+					return nil, err
+				}
+				if index >= len(array) {
+					return nil, nil
+				}
+				raw = array[index]
+			default:
+				return nil, nil
+			}
+		}
+	}
+	if value := strings.TrimSpace(string(raw)); value == "" || value == "null" {
+		return nil, nil
+	}
+	return raw, nil
+}
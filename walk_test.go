@@ -0,0 +1,56 @@
+package poly
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	in := []byte(`{
+		"household": {
+			"id": 7,
+			"members": [{"type":"person","name":"John"},{"type":"pet","name":"Fido"}],
+			"archive": [
+				[{"type":"person","name":"Juan"}],
+				[{"type":"pet","name":"Rex"}]
+			],
+			"previous": null
+		}
+	}`)
+
+	var current, first, second, previous, missing Residence
+	err := Walk(in, map[string]any{
+		"household.members":   &current,
+		"household.archive.0": &first,
+		"household.archive.1": &second,
+		"household.previous":  &previous,
+		"household.archive.5": &missing,
+		"household.id.name":   &missing,
+		"nothing.here":        &missing,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Residence{People: []Person{{Name: "John"}}, Pets: []Pet{{Name: "Fido"}}}, current)
+	assert.Equal(t, Residence{People: []Person{{Name: "Juan"}}}, first)
+	assert.Equal(t, Residence{Pets: []Pet{{Name: "Rex"}}}, second)
+	assert.Equal(t, Residence{}, previous)
+	assert.Equal(t, Residence{}, missing)
+
+	// The options apply to every array, and the empty path is the document.
+	var whole Residence
+	err = Walk([]byte(`[{"kind":"pet","name":"Tom"}]`), map[string]any{"": &whole}, WithTypePath("kind"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Pet{{Name: "Tom"}}, whole.Pets)
+}
+
+func TestWalk_Errors(t *testing.T) {
+	var result Residence
+	err := Walk([]byte(`{"household":{"id":7}}`), map[string]any{"household.id": &result})
+	assert.ErrorIs(t, err, ErrNotArray)
+	assert.Contains(t, err.Error(), `path "household.id": `)
+
+	err = Walk([]byte(`{"household":[}`), map[string]any{"household.members": &result})
+	assert.Error(t, err)
+
+	err = Walk([]byte(`{"members":[]}`), map[string]any{"members": result})
+	assert.EqualError(t, err, `path "members": target must be a pointer`)
+}
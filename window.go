@@ -0,0 +1,204 @@
+package poly
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// UnmarshalWindows decodes the elements of the source into a sequence of
+// target structs of type T, one for each fixed window of time, and delivers
+// each of them to the deliver function along with the start of its window. This
+// is the usual shape of a telemetry consumer that aggregates a stream of
+// events by the minute or the hour. The elements are routed to the fields of
+// the targets in the same way as with UnmarshalSource.
+//
+// The window of an element is determined by its timestamp, which is read from
+// the timeKey of the element as an RFC 3339 string, and truncated to a multiple
+// of the size. The elements within a window may be in any order, but the
+// windows must follow each other in time: a window is delivered as soon as an
+// element of a later window arrives, and the last one once the source is
+// exhausted. An element of a window that has already been delivered is an
+// error. Elements that no field of the target matches go to the window that is
+// open when they arrive, or to the first window if they come before it. If
+// there are only such elements, they are delivered in a single window with the
+// zero time as its start. Since each target sees only a part of the source,
+// the `first` and `last` ordering constraints aren't checked.
+//
+// An error from the deliver function stops the unmarshalling and is returned
+// from it.
+//
+// Example usage:
+//
+//	err := poly.UnmarshalWindows(src, time.Minute, "timestamp", func(start time.Time, w *Metrics) error {
+//	    return store(start, w)
+//	})
+func UnmarshalWindows[T any](src ElementSource, size time.Duration, timeKey string, deliver func(start time.Time, window *T) error, opts ...Option) error {
+	if size <= 0 {
+		return fmt.Errorf("window size must be positive, got %v", size)
+	}
+	o := newOptions(opts)
+	o.partial = true
+	if o.report != nil {
+		o.report.reset()
+		start := time.Now()
+		defer func() {
+			o.report.Duration = time.Since(start)
+		}()
+	}
+	w := &windower[T]{o: o, size: size, timeKey: timeKey, deliver: deliver}
+
+	// The decoder of a throwaway target tells which type names have a field,
+	// and so which elements need a timestamp.
+	probe, err := newDecoder(new(T), o)
+	if err != nil {
+		return err
+	}
+	w.probe = probe
+	resolve, err := optionsResolver(o)
+	if err != nil {
+		return err
+	}
+
+	count, err := forEachElement(wrapSource(src, o), o.firstIndex, resolve, w.element)
+	if o.report != nil {
+		o.report.Elements = count
+	}
+	if o.metrics != nil {
+		o.metrics.Decoded(count, err)
+	}
+	if err != nil {
+		return err
+	}
+	if w.d == nil && len(w.pending) > 0 {
+		// No window was opened, so the unmatched elements are delivered in
+		// one of their own.
+		err = w.open(time.Time{})
+		if err != nil {
+			return err
+		}
+	}
+	return w.flush()
+}
+
+// windower holds the state of UnmarshalWindows.
+type windower[T any] struct {
+	o       *options
+	size    time.Duration
+	timeKey string
+	deliver func(start time.Time, window *T) error
+	probe   *decoder
+
+	// current is the target of the open window, which started at start, and
+	// d is the decoder into it. count is the number of elements given to it.
+	current *T
+	start   time.Time
+	d       *decoder
+	count   int
+
+	// delivered is set once a window has been delivered, and pending holds
+	// the unmatched elements that came before the first window.
+	delivered bool
+	pending   []pendingElement
+}
+
+// pendingElement is an element that is held until there is a window to put
+// it in.
+type pendingElement struct {
+	index    int
+	typeName string
+	raw      json.RawMessage
+}
+
+// element puts an element into its window, delivering the open window first if
+// the element belongs to a later one.
+func (w *windower[T]) element(index int, typeName string, raw json.RawMessage) error {
+	if _, ok := w.probe.targetFields[w.probe.canonical(typeName)]; !ok || typeName == "" {
+		if w.d == nil {
+			w.pending = append(w.pending, pendingElement{index: index, typeName: typeName, raw: raw})
+			return nil
+		}
+		w.count++
+		return w.d.element(index, typeName, raw)
+	}
+
+	timestamp, err := w.timestamp(index, raw)
+	if err != nil {
+		return err
+	}
+	start := timestamp.Truncate(w.size)
+	if w.d != nil || w.delivered {
+		switch {
+		case start.Before(w.start):
+			return fmt.Errorf("element %d at %v belongs to the window starting at %v, which has been delivered", index, timestamp, start)
+		case start.After(w.start):
+			err = w.flush()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if w.d == nil {
+		err = w.open(start)
+		if err != nil {
+			return err
+		}
+	}
+	w.count++
+	return w.d.element(index, typeName, raw)
+}
+
+// timestamp reads the timestamp of the element from the time key.
+func (w *windower[T]) timestamp(index int, raw json.RawMessage) (time.Time, error) {
+	var object map[string]json.RawMessage
+	err := json.Unmarshal(raw, &object)
+	if err != nil {
+		return time.Time{}, err
+	}
+	value, ok := object[w.timeKey]
+	if !ok {
+		return time.Time{}, fmt.Errorf("element %d has no timestamp under %q", index, w.timeKey)
+	}
+	var timestamp time.Time
+	err = json.Unmarshal(value, &timestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("element %d has an invalid timestamp under %q: %w", index, w.timeKey, err)
+	}
+	return timestamp, nil
+}
+
+// open starts a new window at start, putting the pending elements into it.
+func (w *windower[T]) open(start time.Time) error {
+	w.current = new(T)
+	w.start = start
+	w.count = 0
+	var err error
+	w.d, err = newDecoder(w.current, w.o)
+	if err != nil {
+		return err
+	}
+	for _, p := range w.pending {
+		w.count++
+		err = w.d.element(p.index, p.typeName, p.raw)
+		if err != nil {
+			return err
+		}
+	}
+	w.pending = nil
+	return nil
+}
+
+// flush finishes and delivers the open window, if there is one.
+func (w *windower[T]) flush() error {
+	if w.d == nil {
+		return nil
+	}
+	err := w.d.finish(w.count)
+	if err != nil {
+		return err
+	}
+	current, start := w.current, w.start
+	w.current, w.d = nil, nil
+	w.delivered = true
+	return w.deliver(start, current)
+}
@@ -0,0 +1,127 @@
+package poly
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type Reading struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+type ReadingWindow struct {
+	Temperatures []Reading       `poly:"temperature"`
+	Humidity     []Reading       `poly:"humidity"`
+	Rest         json.RawMessage `poly:"!rest"`
+}
+
+type deliveredWindow struct {
+	start  time.Time
+	window *ReadingWindow
+}
+
+func TestUnmarshalWindows(t *testing.T) {
+	input := []byte(`[
+		{"type":"status"},
+		{"type":"temperature", "timestamp":"2024-01-01T10:00:10Z", "value":20},
+		{"type":"humidity", "timestamp":"2024-01-01T10:00:50Z", "value":40},
+		{"type":"temperature", "timestamp":"2024-01-01T10:00:05Z", "value":21},
+		{"type":"temperature", "timestamp":"2024-01-01T10:02:00Z", "value":22},
+		{"type":"status"}
+	]`)
+
+	var delivered []deliveredWindow
+	err := UnmarshalWindows(NewArraySource(input), time.Minute, "timestamp", func(start time.Time, w *ReadingWindow) error {
+		delivered = append(delivered, deliveredWindow{start, w})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, delivered, 2)
+
+	minute := func(m int) time.Time {
+		return time.Date(2024, 1, 1, 10, m, 0, 0, time.UTC)
+	}
+	assert.True(t, minute(0).Equal(delivered[0].start))
+	assert.Equal(t, []float64{20, 21}, readingValues(delivered[0].window.Temperatures))
+	assert.Equal(t, []float64{40}, readingValues(delivered[0].window.Humidity))
+	assert.JSONEq(t, `[{"type":"status"}]`, string(delivered[0].window.Rest))
+
+	assert.True(t, minute(2).Equal(delivered[1].start))
+	assert.Equal(t, []float64{22}, readingValues(delivered[1].window.Temperatures))
+	assert.Empty(t, delivered[1].window.Humidity)
+	assert.JSONEq(t, `[{"type":"status"}]`, string(delivered[1].window.Rest))
+}
+
+func TestUnmarshalWindows_ExternalTagging(t *testing.T) {
+	input := []byte(`[
+		{"temperature":{"timestamp":"2024-01-01T10:00:10Z", "value":20}},
+		{"humidity":{"timestamp":"2024-01-01T10:01:50Z", "value":40}}
+	]`)
+
+	var delivered []deliveredWindow
+	err := UnmarshalWindows(NewArraySource(input), time.Minute, "timestamp", func(start time.Time, w *ReadingWindow) error {
+		delivered = append(delivered, deliveredWindow{start, w})
+		return nil
+	}, WithExternalTagging())
+	assert.NoError(t, err)
+	assert.Len(t, delivered, 2)
+	assert.Equal(t, []float64{20}, readingValues(delivered[0].window.Temperatures))
+	assert.Equal(t, []float64{40}, readingValues(delivered[1].window.Humidity))
+}
+
+func TestUnmarshalWindows_OnlyUnmatched(t *testing.T) {
+	var delivered []deliveredWindow
+	err := UnmarshalWindows(NewArraySource([]byte(`[{"type":"status"},{"type":"status"}]`)), time.Minute, "timestamp", func(start time.Time, w *ReadingWindow) error {
+		delivered = append(delivered, deliveredWindow{start, w})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, delivered, 1)
+	assert.True(t, delivered[0].start.IsZero())
+	assert.JSONEq(t, `[{"type":"status"},{"type":"status"}]`, string(delivered[0].window.Rest))
+
+	// Nothing is delivered for an empty source.
+	delivered = nil
+	err = UnmarshalWindows(NewArraySource([]byte(`[]`)), time.Minute, "timestamp", func(start time.Time, w *ReadingWindow) error {
+		delivered = append(delivered, deliveredWindow{start, w})
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, delivered)
+}
+
+func TestUnmarshalWindows_Errors(t *testing.T) {
+	ignore := func(start time.Time, w *ReadingWindow) error { return nil }
+
+	err := UnmarshalWindows(NewArraySource([]byte(`[
+		{"type":"temperature", "timestamp":"2024-01-01T10:01:00Z"},
+		{"type":"temperature", "timestamp":"2024-01-01T10:00:59Z"}
+	]`)), time.Minute, "timestamp", ignore)
+	assert.EqualError(t, err, "element 1 at 2024-01-01 10:00:59 +0000 UTC belongs to the window starting at 2024-01-01 10:00:00 +0000 UTC, which has been delivered")
+
+	err = UnmarshalWindows(NewArraySource([]byte(`[{"type":"temperature"}]`)), time.Minute, "timestamp", ignore)
+	assert.EqualError(t, err, `element 0 has no timestamp under "timestamp"`)
+
+	err = UnmarshalWindows(NewArraySource([]byte(`[{"type":"temperature", "timestamp":"yesterday"}]`)), time.Minute, "timestamp", ignore)
+	assert.ErrorContains(t, err, `element 0 has an invalid timestamp under "timestamp"`)
+
+	err = UnmarshalWindows(NewArraySource([]byte(`[]`)), 0, "timestamp", ignore)
+	assert.EqualError(t, err, "window size must be positive, got 0s")
+
+	err = UnmarshalWindows(NewArraySource([]byte(`[{"type":"temperature", "timestamp":"2024-01-01T10:01:00Z"}]`)), time.Minute, "timestamp", func(start time.Time, w *ReadingWindow) error {
+		return errors.New("full")
+	})
+	assert.EqualError(t, err, "full")
+}
+
+func readingValues(readings []Reading) []float64 {
+	var values []float64
+	for _, r := range readings {
+		values = append(values, r.Value)
+	}
+	return values
+}